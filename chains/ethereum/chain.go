@@ -21,6 +21,7 @@ The writer recieves the message and creates a proposals on-chain. Once a proposa
 package ethereum
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 
@@ -36,8 +37,13 @@ import (
 	"github.com/stafiprotocol/chainbridge/utils/crypto/secp256k1"
 	"github.com/stafiprotocol/chainbridge/utils/keystore"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/notify"
 )
 
+var _ notify.BalanceChecker = &Chain{}
+var _ notify.LagChecker = &Chain{}
+var _ core.Backfiller = &Chain{}
+
 type Connection interface {
 	Connect() error
 	Keypair() *secp256k1.Keypair
@@ -103,6 +109,13 @@ func InitializeChain(chainCfg *core.ChainConfig, logger log15.Logger, sysErr cha
 		return nil, err
 	}
 
+	if !cfg.FreshStart() {
+		err = rewindBlockstore(bs, cfg, conn, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if chainCfg.LatestBlock {
 		curr, err := conn.LatestBlock()
 		if err != nil {
@@ -129,6 +142,7 @@ func InitializeChain(chainCfg *core.ChainConfig, logger log15.Logger, sysErr cha
 func (c *Chain) SetRouter(r *core.Router) {
 	r.Listen(c.cfg.Id, c.writer)
 	c.listener.setRouter(r)
+	c.writer.setRouter(r)
 }
 
 func (c *Chain) Start() error {
@@ -137,7 +151,7 @@ func (c *Chain) Start() error {
 		return err
 	}
 
-	err = c.writer.start()
+	err = c.StartWriter()
 	if err != nil {
 		return err
 	}
@@ -146,6 +160,11 @@ func (c *Chain) Start() error {
 	return nil
 }
 
+// StartWriter starts the writer without the listener.
+func (c *Chain) StartWriter() error {
+	return c.writer.start()
+}
+
 func (c *Chain) Id() msg.ChainId {
 	return c.cfg.Id
 }
@@ -154,6 +173,25 @@ func (c *Chain) Name() string {
 	return c.cfg.Name
 }
 
+// Balance implements notify.BalanceChecker, it returns the balance of the relayer account in wei.
+func (c *Chain) Balance() (*big.Int, error) {
+	return c.conn.Client().BalanceAt(context.Background(), c.conn.Keypair().CommonAddress(), nil)
+}
+
+// Lag implements notify.LagChecker. The listener always stays BlockDelay behind the latest block.
+func (c *Chain) Lag() (uint64, error) {
+	latest, err := c.conn.LatestBlock()
+	if err != nil {
+		return 0, err
+	}
+	return c.listener.lag(latest.Uint64()), nil
+}
+
+// Backfill implements core.Backfiller.
+func (c *Chain) Backfill(from, to uint64) error {
+	return c.listener.backfill(from, to)
+}
+
 // Stop signals to any running routines to exit
 func (c *Chain) Stop() {
 	close(c.stop)
@@ -183,3 +221,31 @@ func setupBlockstore(cfg *ethconn.Config, kp *secp256k1.Keypair) (*blockstore.Bl
 
 	return bs, nil
 }
+
+// rewindBlockstore drops the blocks stored before a reorg that are no longer part of the chain
+// and resumes from the latest block that still is.
+func rewindBlockstore(bs *blockstore.Blockstore, cfg *ethconn.Config, conn Connection, logger log15.Logger) error {
+	latest, err := bs.TryLoadLatestBlock()
+	if err != nil {
+		return err
+	}
+	c, err := bs.Rewind(func(height uint64) (string, error) {
+		header, err := conn.Client().HeaderByNumber(context.Background(), new(big.Int).SetUint64(height))
+		if err != nil {
+			return "", err
+		}
+		return header.Hash().Hex(), nil
+	})
+	if err != nil {
+		return fmt.Errorf("blockstore: %s", err)
+	}
+	if c == nil || c.Height == latest.Uint64() {
+		return nil
+	}
+
+	logger.Warn("Stored blocks were reorganized, rewinding", "stored", latest, "resume", c.Height)
+	if cfg.StartBlock().Cmp(latest) == 0 {
+		cfg.SetStartBlock(new(big.Int).SetUint64(c.Height))
+	}
+	return nil
+}
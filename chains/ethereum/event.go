@@ -1,18 +1,33 @@
 package ethereum
 
 import (
+	"context"
+
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/stafiprotocol/chainbridge/bindings/ERC20Handler"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
 )
 
-func (l *listener) handleErc20DepositedEvent(destId msg.ChainId, nonce msg.Nonce) (msg.Message, error) {
-	l.log.Info("Handling fungible deposit event", "dest", destId, "nonce", nonce)
+func (l *listener) handleErc20DepositedEvent(ctx context.Context, destId msg.ChainId, nonce msg.Nonce) (msg.Message, error) {
+	l.log.Info("Handling fungible deposit event", "src", l.cfg.ChainId(), "dst", destId, "nonce", nonce)
 
-	record, err := l.erc20HandlerContract.GetDepositRecord(&bind.CallOpts{From: l.conn.Keypair().CommonAddress()}, uint64(nonce), uint8(destId))
+	m, err := l.readDepositRecord(ctx, l.erc20HandlerContract, destId, nonce)
 	if err != nil {
 		l.log.Error("Error Unpacking ERC20 Deposit Record", "err", err)
 		return msg.Message{}, err
 	}
+	return m, nil
+}
+
+// readDepositRecord reads the deposit record of nonce to destId from an ERC20 handler.
+func (l *listener) readDepositRecord(ctx context.Context, handler *ERC20Handler.ERC20Handler, destId msg.ChainId, nonce msg.Nonce) (msg.Message, error) {
+	ctx, span := tracing.Start(ctx, tracing.SpanDepositRecord, tracing.Endpoint(l.cfg.Endpoint()))
+	record, err := handler.GetDepositRecord(&bind.CallOpts{From: l.conn.Keypair().CommonAddress(), Context: ctx}, uint64(nonce), uint8(destId))
+	tracing.End(span, err)
+	if err != nil {
+		return msg.Message{}, err
+	}
 
 	return msg.NewFungibleTransfer(
 		l.cfg.ChainId(),
@@ -8,8 +8,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
 	"math/big"
+	"sync/atomic"
 	"time"
 
 	"github.com/ChainSafe/log15"
@@ -19,6 +22,7 @@ import (
 	ethconn "github.com/stafiprotocol/chainbridge/connections/ethereum"
 	utils "github.com/stafiprotocol/chainbridge/shared/ethereum"
 	"github.com/stafiprotocol/chainbridge/utils/blockstore"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
 )
 
 var (
@@ -38,7 +42,8 @@ type listener struct {
 	log                  log15.Logger
 	blockstore           blockstore.Blockstorer
 	stop                 <-chan int
-	sysErr               chan<- error // Reports fatal error to core
+	sysErr               chan<- error  // Reports fatal error to core
+	processed            atomic.Uint64 // last block processed
 }
 
 // NewListener creates and returns a listener
@@ -53,6 +58,16 @@ func NewListener(conn Connection, cfg *ethconn.Config, log log15.Logger, bs bloc
 	}
 }
 
+// lag returns how many blocks the listener is behind latest, 0 before the first block was
+// processed.
+func (l *listener) lag(latest uint64) uint64 {
+	processed := l.processed.Load()
+	if processed == 0 || latest <= processed {
+		return 0
+	}
+	return latest - processed
+}
+
 // setContracts sets the listener with the appropriate contracts
 func (l *listener) setContracts(bridge *Bridge.Bridge, erc20Handler *ERC20Handler.ERC20Handler) {
 	l.bridgeContract = bridge
@@ -84,6 +99,7 @@ func (l *listener) start() error {
 func (l *listener) pollBlocks() error {
 	l.log.Info("Polling Blocks...")
 	var currentBlock = l.cfg.StartBlock()
+	var latestBlock = big.NewInt(0)
 	var retry = BlockRetryLimit
 	if l.cfg.ChainId() == 3 {
 		logInterval = 200
@@ -100,12 +116,16 @@ func (l *listener) pollBlocks() error {
 				return nil
 			}
 
-			latestBlock, err := l.conn.LatestBlock()
-			if err != nil {
-				l.log.Error("Unable to get latest block", "block", currentBlock, "err", err)
-				retry--
-				time.Sleep(BlockRetryInterval)
-				continue
+			// The latest block is only queried again once the blocks up to the last one seen are processed
+			if big.NewInt(0).Sub(latestBlock, currentBlock).Cmp(BlockDelay) == -1 {
+				latest, err := l.conn.LatestBlock()
+				if err != nil {
+					l.log.Error("Unable to get latest block", "block", currentBlock, "err", err)
+					retry--
+					time.Sleep(BlockRetryInterval)
+					continue
+				}
+				latestBlock = latest
 			}
 
 			if currentBlock.Uint64()%logInterval == 0 {
@@ -118,8 +138,16 @@ func (l *listener) pollBlocks() error {
 				continue
 			}
 
-			// Parse out events
-			err = l.getDepositEventsForBlock(currentBlock)
+			// Parse out events, of the block whose hash is stored
+			header, err := l.conn.Client().HeaderByNumber(context.Background(), currentBlock)
+			if err != nil {
+				l.log.Error("Unable to get block header", "block", currentBlock, "err", err)
+				retry--
+				time.Sleep(BlockRetryInterval)
+				continue
+			}
+			hash := header.Hash()
+			err = l.getDepositEventsForBlock(currentBlock, &hash)
 			if err != nil {
 				l.log.Error("Failed to get events for block", "block", currentBlock, "err", err)
 				retry--
@@ -127,11 +155,13 @@ func (l *listener) pollBlocks() error {
 			}
 
 			// Write to block store. Not a critical operation, no need to retry
-			err = l.blockstore.StoreBlock(currentBlock)
+			err = l.blockstore.StoreBlock(currentBlock, hash.Hex())
 			if err != nil {
 				l.log.Error("Failed to write latest block to blockstore", "block", currentBlock, "err", err)
 			}
 
+			l.processed.Store(currentBlock.Uint64())
+
 			// Goto next block and reset retry counter
 			currentBlock.Add(currentBlock, big.NewInt(1))
 			retry = BlockRetryLimit
@@ -139,11 +169,112 @@ func (l *listener) pollBlocks() error {
 	}
 }
 
-// getDepositEventsForBlock looks for the deposit event in the latest block
-func (l *listener) getDepositEventsForBlock(latestBlock *big.Int) error {
+// backfill routes the deposits of the blocks from to to, both included, without updating the
+// blockstore. Failed blocks are retried as when polling.
+func (l *listener) backfill(from, to uint64) error {
+	latest, err := l.conn.LatestBlock()
+	if err != nil {
+		return err
+	}
+	if new(big.Int).SetUint64(to).Cmp(new(big.Int).Sub(latest, BlockDelay)) == 1 {
+		return fmt.Errorf("block %d is less than %s blocks behind the latest block %s", to, BlockDelay, latest)
+	}
+
+	for block := from; block <= to; block++ {
+		retry := BlockRetryLimit
+		for {
+			select {
+			case <-l.stop:
+				return errors.New("backfill terminated")
+			default:
+			}
+			err = l.getDepositEventsForBlock(new(big.Int).SetUint64(block), nil)
+			if err == nil {
+				break
+			}
+			retry--
+			if retry == 0 {
+				return fmt.Errorf("block %d: %s", block, err)
+			}
+			l.log.Error("Failed to get events for block", "block", block, "err", err)
+			time.Sleep(BlockRetryInterval)
+		}
+		if block%logInterval == 0 {
+			l.log.Info("Backfilling", "block", block, "to", to)
+		}
+	}
+	return nil
+}
+
+// routeDeposit reads the deposit record of a deposit event from its handler and sends it to the
+// router. It starts the trace of the transfer.
+func (l *listener) routeDeposit(latestBlock *big.Int, log types.Log, destId msg.ChainId, rId msg.ResourceId, nonce msg.Nonce) (err error) {
+	deposit := msg.Message{Source: l.cfg.ChainId(), Destination: destId, Type: msg.FungibleTransfer, DepositNonce: nonce, ResourceId: rId,
+		Block: log.BlockNumber, TxHash: log.TxHash.Hex()}
+	ctx, span := tracing.StartTransfer(deposit, tracing.SpanDeposit)
+	defer func() { tracing.End(span, err) }()
+
+	_, lookup := tracing.Start(ctx, tracing.SpanHandlerLookup, tracing.Endpoint(l.cfg.Endpoint()))
+	addr, err := l.bridgeContract.ResourceIDToHandlerAddress(&bind.CallOpts{From: l.conn.Keypair().CommonAddress(), Context: ctx}, rId)
+	tracing.End(lookup, err)
+	if err != nil {
+		return fmt.Errorf("failed to get handler from resource ID %x", rId)
+	}
+
+	var m msg.Message
+	if addr == l.cfg.Erc20HandlerContract() {
+		m, err = l.handleErc20DepositedEvent(ctx, destId, nonce)
+	} else {
+		l.log.Error("event has unrecognized handler", "handler", addr.Hex())
+		l.router.Reject(l.unroutedDeposit(ctx, addr, deposit), fmt.Sprintf("block %s: handler %s of resourceId unrecognized", latestBlock, addr.Hex()))
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	m.Block = log.BlockNumber
+	m.TxHash = log.TxHash.Hex()
+
+	err = l.router.Send(m)
+	if err != nil {
+		l.log.Error("subscription error: failed to route message", append(m.LogContext(), "err", err)...)
+		tracing.Fail(span, err)
+		return nil
+	}
+	l.log.Debug("send to router ok")
+	return nil
+}
+
+// unroutedDeposit completes a deposit of an unrecognized handler with the amount and recipient
+// of its deposit record, so it can be retried once the handler is configured. If the handler
+// has no ERC20 deposit record, deposit is returned without them.
+func (l *listener) unroutedDeposit(ctx context.Context, handler common.Address, deposit msg.Message) msg.Message {
+	contract, err := ERC20Handler.NewERC20Handler(handler, l.conn.Client())
+	if err != nil {
+		l.log.Warn("Failed to bind unrecognized handler", append(deposit.LogContext(), "handler", handler.Hex(), "err", err)...)
+		return deposit
+	}
+	m, err := l.readDepositRecord(ctx, contract, deposit.Destination, deposit.DepositNonce)
+	if err != nil {
+		l.log.Warn("Failed to read deposit record of unrecognized handler", append(deposit.LogContext(), "handler", handler.Hex(), "err", err)...)
+		return deposit
+	}
+	m.Block = deposit.Block
+	m.TxHash = deposit.TxHash
+	return m
+}
+
+// getDepositEventsForBlock looks for the deposit event in the latest block. If hash is not nil
+// the logs are queried by the hash of the block, so they cannot be of another fork.
+func (l *listener) getDepositEventsForBlock(latestBlock *big.Int, hash *common.Hash) error {
 	l.log.Debug("getDepositEventsForBlock start: ", "block", latestBlock.Uint64())
 
 	query := buildQuery(l.cfg.BridgeContract(), utils.Deposit, latestBlock, latestBlock)
+	if hash != nil {
+		query.FromBlock, query.ToBlock = nil, nil
+		query.BlockHash = hash
+	}
 
 	// querying for logs
 	logs, err := l.conn.Client().FilterLogs(context.Background(), query)
@@ -155,7 +286,6 @@ func (l *listener) getDepositEventsForBlock(latestBlock *big.Int) error {
 	for _, log := range logs {
 		l.log.Debug("log index: ", "logIndex", log.Index)
 
-		var m msg.Message
 		destId := msg.ChainId(log.Topics[1].Big().Uint64())
 		rId := msg.ResourceIdFromSlice(log.Topics[2].Bytes())
 		nonce := msg.Nonce(log.Topics[3].Big().Uint64())
@@ -166,27 +296,10 @@ func (l *listener) getDepositEventsForBlock(latestBlock *big.Int) error {
 			continue
 		}
 
-		addr, err := l.bridgeContract.ResourceIDToHandlerAddress(&bind.CallOpts{From: l.conn.Keypair().CommonAddress()}, rId)
-		if err != nil {
-			return fmt.Errorf("failed to get handler from resource ID %x", rId)
-		}
-
-		if addr == l.cfg.Erc20HandlerContract() {
-			m, err = l.handleErc20DepositedEvent(destId, nonce)
-		} else {
-			l.log.Error("event has unrecognized handler", "handler", addr.Hex())
-			return nil
-		}
-
+		err = l.routeDeposit(latestBlock, log, destId, rId, nonce)
 		if err != nil {
 			return err
 		}
-
-		err = l.router.Send(m)
-		if err != nil {
-			l.log.Error("subscription error: failed to route message", "err", err)
-		}
-		l.log.Debug("send to router ok")
 	}
 
 	l.log.Debug("getDepositEventsForBlock end: ", "block", latestBlock.Uint64())
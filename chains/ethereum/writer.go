@@ -8,8 +8,10 @@ import (
 
 	"github.com/ChainSafe/log15"
 	"github.com/stafiprotocol/chainbridge/bindings/Bridge"
+	"github.com/stafiprotocol/chainbridge/chains"
 	ethconn "github.com/stafiprotocol/chainbridge/connections/ethereum"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
 )
 
 const (
@@ -23,6 +25,7 @@ type writer struct {
 	cfg            *ethconn.Config
 	conn           Connection
 	bridgeContract *Bridge.Bridge // instance of bound receiver bridgeContract
+	router         chains.Router
 	log            log15.Logger
 	msgChan        chan msg.Message
 	stop           <-chan int
@@ -51,8 +54,10 @@ func (w *writer) start() error {
 				w.log.Info("writer stopped")
 				return
 			case msg := <-w.msgChan:
+				tracing.QueueWait(msg)
 				result := w.processMessage(msg)
 				w.log.Info("processMessage", "result", result)
+				w.router.Processed(msg, result)
 				if !result {
 					w.sysErr <- fmt.Errorf("processMessage failed")
 				}
@@ -63,13 +68,17 @@ func (w *writer) start() error {
 	return nil
 }
 
+func (w *writer) setRouter(r chains.Router) {
+	w.router = r
+}
+
 // setContract adds the bound receiver bridgeContract to the writer
 func (w *writer) setContract(bridge *Bridge.Bridge) {
 	w.bridgeContract = bridge
 }
 
 func (w *writer) ResolveMessage(m msg.Message) bool {
-	w.log.Info("Attempting to resolve message", "type", m.Type, "src", m.Source, "dst", m.Destination, "nonce", m.DepositNonce, "rId", m.ResourceId.Hex())
+	w.log.Info("Attempting to resolve message", append(m.LogContext(), "type", m.Type)...)
 	w.log.Info("ResolveMessage: size of msgChan", "size", len(w.msgChan))
 	w.msgChan <- m
 	return true
@@ -78,12 +87,15 @@ func (w *writer) ResolveMessage(m msg.Message) bool {
 // ResolveMessage handles any given message based on type
 // A bool is returned to indicate failure/success, this should be ignored except for within tests.
 func (w *writer) processMessage(m msg.Message) bool {
-	w.log.Info("Attempting to process message", "type", m.Type, "src", m.Source, "dst", m.Destination, "nonce", m.DepositNonce, "rId", m.ResourceId.Hex())
+	ctx, span := tracing.StartMessage(tracing.Context(m), m, tracing.SpanProcess)
+	defer span.End()
+	log := w.log.New(m.LogContext()...)
+	log.Info("Attempting to process message", "type", m.Type)
 	switch m.Type {
 	case msg.FungibleTransfer:
 		result := make(chan bool)
 		defer close(result)
-		go w.createErc20Proposal(m, result)
+		go w.createErc20Proposal(ctx, m, result)
 		select {
 		case <-w.stop:
 			return false
@@ -91,7 +103,7 @@ func (w *writer) processMessage(m msg.Message) bool {
 			return re
 		}
 	default:
-		w.log.Error("Unknown message type received", "type", m.Type)
+		log.Error("Unknown message type received", "type", m.Type)
 		return false
 	}
 }
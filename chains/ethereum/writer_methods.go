@@ -4,14 +4,18 @@
 package ethereum
 
 import (
+	"context"
 	"errors"
 	"math/big"
 	"time"
 
 	eth "github.com/ethereum/go-ethereum"
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	utils "github.com/stafiprotocol/chainbridge/shared/ethereum"
+	"github.com/stafiprotocol/chainbridge/utils/journal"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
 )
 
 // Time between retrying a failed tx
@@ -23,6 +27,7 @@ const TxRetryLimit = 10
 var ErrNonceTooLow = errors.New("nonce too low")
 var ErrTxUnderpriced = errors.New("replacement transaction underpriced")
 var ErrFatalTx = errors.New("submission of transaction failed")
+var ErrTxReverted = errors.New("transaction reverted")
 var ErrFatalQuery = errors.New("query of chain state failed")
 
 // proposalIsComplete returns true if the proposal state is either Transferred or Cancelled
@@ -46,16 +51,22 @@ func (w *writer) hasVoted(srcId msg.ChainId, nonce msg.Nonce, dataHash [32]byte)
 	return hasVoted
 }
 
-func (w *writer) shouldVote(m msg.Message, dataHash [32]byte) bool {
+func (w *writer) shouldVote(ctx context.Context, m msg.Message, dataHash [32]byte) bool {
+	log := w.log.New(m.LogContext()...)
+	_, span := tracing.StartMessage(ctx, m, tracing.SpanProposalCheck, tracing.Endpoint(w.cfg.Endpoint()))
+	defer span.End()
+
 	// Check if proposal has passed and skip if Passed or Transferred
 	if w.proposalIsComplete(m.Source, m.DepositNonce, dataHash) {
-		w.log.Info("Proposal complete, not voting", "src", m.Source, "nonce", m.DepositNonce)
+		log.Info("Proposal complete, not voting")
+		w.router.Journal(journal.NewDecision(m, journal.StatusExecuted, "proposal complete"))
 		return false
 	}
 
 	// Check if relayer has previously voted
 	if w.hasVoted(m.Source, m.DepositNonce, dataHash) {
-		w.log.Info("Relayer has already voted, not voting", "src", m.Source, "nonce", m.DepositNonce)
+		log.Info("Relayer has already voted, not voting")
+		w.router.Journal(journal.NewDecision(m, journal.StatusNotVoted, "already voted"))
 		return false
 	}
 
@@ -64,24 +75,29 @@ func (w *writer) shouldVote(m msg.Message, dataHash [32]byte) bool {
 
 // createErc20Proposal creates an Erc20 proposal.
 // Returns true if the proposal is successfully created or is complete
-func (w *writer) createErc20Proposal(m msg.Message, propResult chan<- bool) {
-	w.log.Info("Creating erc20 proposal", "src", m.Source, "nonce", m.DepositNonce)
+func (w *writer) createErc20Proposal(ctx context.Context, m msg.Message, propResult chan<- bool) {
+	log := w.log.New(m.LogContext()...)
+	log.Info("Creating erc20 proposal")
 
 	data := ConstructErc20ProposalData(m.Payload[0].([]byte), m.Payload[1].([]byte))
 	dataHash := utils.Hash(append(w.cfg.Erc20HandlerContract().Bytes(), data...))
 
-	if !w.shouldVote(m, dataHash) {
+	if !w.shouldVote(ctx, m, dataHash) {
 		propResult <- true
 		return
 	}
 
-	w.voteProposal(m, dataHash, data)
+	w.voteProposal(ctx, m, dataHash, data)
 	propResult <- true
 }
 
 // voteProposal submits a vote proposal
 // a vote proposal will try to be submitted up to the TxRetryLimit times
-func (w *writer) voteProposal(m msg.Message, dataHash [32]byte, data []byte) {
+func (w *writer) voteProposal(ctx context.Context, m msg.Message, dataHash [32]byte, data []byte) {
+	log := w.log.New(m.LogContext()...)
+	_, span := tracing.StartMessage(ctx, m, tracing.SpanTxSubmit, tracing.Endpoint(w.cfg.Endpoint()))
+	defer span.End()
+
 	for i := 0; i < TxRetryLimit; i++ {
 		select {
 		case <-w.stop:
@@ -89,7 +105,7 @@ func (w *writer) voteProposal(m msg.Message, dataHash [32]byte, data []byte) {
 		default:
 			err := w.conn.LockAndUpdateOpts()
 			if err != nil {
-				w.log.Error("Failed to update tx opts", "err", err)
+				log.Error("Failed to update tx opts", "err", err)
 				continue
 			}
 
@@ -103,27 +119,65 @@ func (w *writer) voteProposal(m msg.Message, dataHash [32]byte, data []byte) {
 			w.conn.UnlockOpts()
 
 			if err == nil {
-				w.log.Info("Submitted proposal vote", "tx", tx.Hash(), "src", m.Source, "depositNonce", m.DepositNonce)
+				log.Info("Submitted proposal vote", "tx", tx.Hash())
+				span.SetAttributes(tracing.Tx(tx.Hash().Hex()))
+				w.router.Journal(journal.NewTx(m, tx.Hash().Hex(), journal.StatusSubmitted, "voteProposal"))
+				go w.watchVote(ctx, m, tx.Hash())
 				return
 			} else if err.Error() == ErrNonceTooLow.Error() || err.Error() == ErrTxUnderpriced.Error() {
-				w.log.Debug("Nonce too low, will retry")
+				log.Debug("Nonce too low, will retry")
 				time.Sleep(TxRetryInterval)
 			} else {
-				w.log.Warn("Voting failed", "source", m.Source, "dest", m.Destination, "depositNonce", m.DepositNonce, "err", err)
+				log.Warn("Voting failed", "err", err)
 				time.Sleep(TxRetryInterval)
 			}
 
 			// Verify proposal is still open for voting, otherwise no need to retry
 			if w.proposalIsComplete(m.Source, m.DepositNonce, dataHash) {
-				w.log.Info("Proposal voting complete on chain", "src", m.Source, "dst", m.Destination, "nonce", m.DepositNonce)
+				log.Info("Proposal voting complete on chain")
 				return
 			}
 		}
 	}
-	w.log.Error("Submission of Vote transaction failed", "source", m.Source, "dest", m.Destination, "depositNonce", m.DepositNonce)
+	log.Error("Submission of Vote transaction failed")
+	tracing.Fail(span, ErrFatalTx)
+	w.router.Journal(journal.NewTx(m, "", journal.StatusFailed, "voteProposal submission failed"))
 	w.sysErr <- ErrFatalTx
 }
 
+// watchVote waits for the receipt of a submitted vote and journals whether it succeeded, with the
+// hash of the vote. A vote still not mined after BlockRetryLimit polls stays submitted.
+func (w *writer) watchVote(ctx context.Context, m msg.Message, hash ethcommon.Hash) {
+	log := w.log.New(m.LogContext()...)
+	_, span := tracing.StartMessage(ctx, m, tracing.SpanTxConfirm, tracing.Endpoint(w.cfg.Endpoint()), tracing.Tx(hash.Hex()))
+	defer span.End()
+
+	for i := 0; i < BlockRetryLimit; i++ {
+		receipt, err := w.conn.Client().TransactionReceipt(ctx, hash)
+		if err == nil {
+			if receipt.Status == types.ReceiptStatusSuccessful {
+				log.Info("Proposal vote succeeded", "tx", hash, "block", receipt.BlockNumber)
+				w.router.Journal(journal.NewTx(m, hash.Hex(), journal.StatusSucceeded, "voteProposal"))
+			} else {
+				log.Error("Proposal vote reverted", "tx", hash, "block", receipt.BlockNumber)
+				tracing.Fail(span, ErrTxReverted)
+				w.router.Journal(journal.NewTx(m, hash.Hex(), journal.StatusFailed, "voteProposal reverted"))
+			}
+			return
+		}
+		if !errors.Is(err, eth.NotFound) {
+			log.Warn("Failed to get vote receipt", "tx", hash, "err", err)
+		}
+
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(BlockRetryInterval):
+		}
+	}
+	log.Warn("Proposal vote not mined, outcome unknown", "tx", hash)
+}
+
 // buildQuery constructs a query for the bridgeContract by hashing sig to get the event topic
 func buildQuery(contract ethcommon.Address, sig utils.EventSig, startBlock *big.Int, endBlock *big.Int) eth.FilterQuery {
 	query := eth.FilterQuery{
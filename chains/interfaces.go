@@ -4,10 +4,19 @@
 package chains
 
 import (
+	"github.com/stafiprotocol/chainbridge/utils/journal"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
 )
 
 type Router interface {
 	Send(message msg.Message) error
 	SupportChainId(chainId msg.ChainId) bool
+	// Reject records a message a listener could not route
+	Reject(message msg.Message, reason string)
+	// DeadLetter records a message a writer skipped
+	DeadLetter(message msg.Message, reason string)
+	// Journal records an action taken on a message
+	Journal(record *journal.Record)
+	// Processed reports that a writer handled a message
+	Processed(message msg.Message, ok bool)
 }
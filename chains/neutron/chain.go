@@ -23,11 +23,16 @@ As the writer receives messages from the router, nothing happened.
 package neutron
 
 import (
+	"math/big"
+
 	"github.com/ChainSafe/log15"
 	"github.com/stafiprotocol/chainbridge/utils/core"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/notify"
 )
 
+var _ notify.BalanceChecker = &Chain{}
+
 type Chain struct {
 	cfg    *core.ChainConfig // The config of the chain
 	conn   *Connection       // THe chains connection
@@ -55,8 +60,14 @@ func (c *Chain) Start() error {
 	return nil
 }
 
+// StartWriter starts the writer, the chain has no listener.
+func (c *Chain) StartWriter() error {
+	return c.writer.start()
+}
+
 func (c *Chain) SetRouter(r *core.Router) {
 	r.Listen(c.cfg.Id, c.writer)
+	c.writer.setRouter(r)
 }
 
 func (c *Chain) Id() msg.ChainId {
@@ -67,6 +78,16 @@ func (c *Chain) Name() string {
 	return c.cfg.Name
 }
 
+// Balance implements notify.BalanceChecker, it returns the balance of the relayer account in
+// the fee denom.
+func (c *Chain) Balance() (*big.Int, error) {
+	res, err := c.conn.client.QueryBalance(c.conn.client.GetFromAddress(), c.conn.client.GetDenom(), 0)
+	if err != nil {
+		return nil, err
+	}
+	return res.Balance.Amount.BigInt(), nil
+}
+
 func (c *Chain) Stop() {
 	close(c.stop)
 }
@@ -15,8 +15,11 @@ import (
 	"github.com/cosmos/cosmos-sdk/types"
 	errType "github.com/cosmos/cosmos-sdk/types/errors"
 	"github.com/stafihub/rtoken-relay-core/common/core"
+	"github.com/stafiprotocol/chainbridge/chains"
 	"github.com/stafiprotocol/chainbridge/utils"
+	"github.com/stafiprotocol/chainbridge/utils/journal"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
 )
 
 const (
@@ -35,6 +38,7 @@ var (
 
 type writer struct {
 	conn    *Connection
+	router  chains.Router
 	log     log15.Logger
 	sysErr  chan<- error
 	msgChan chan msg.Message
@@ -60,8 +64,10 @@ func (w *writer) start() error {
 				w.log.Info("writer stopped")
 				return
 			case msg := <-w.msgChan:
+				tracing.QueueWait(msg)
 				result := w.processMessage(msg)
 				w.log.Info("processMessage", "result", result)
+				w.router.Processed(msg, result)
 				if !result {
 					w.sysErr <- fmt.Errorf("processMessage failed")
 				}
@@ -72,21 +78,28 @@ func (w *writer) start() error {
 	return nil
 }
 
+func (w *writer) setRouter(r chains.Router) {
+	w.router = r
+}
+
 func (w *writer) ResolveMessage(m msg.Message) bool {
 	w.msgChan <- m
 	return true
 }
 
 func (w *writer) processMessage(m msg.Message) bool {
-	w.log.Info("ResolveMessage", "Name", w.conn.name, "Destination", m.Destination)
+	ctx, span := tracing.StartMessage(tracing.Context(m), m, tracing.SpanProcess)
+	defer span.End()
+	log := w.log.New(m.LogContext()...)
+	log.Info("ResolveMessage", "Name", w.conn.name, "Destination", m.Destination)
 	switch m.Type {
 	case msg.FungibleTransfer:
 		bigAmt := big.NewInt(0).SetBytes(m.Payload[0].([]byte))
-		w.log.Debug("amount info", "amount", bigAmt.String())
+		log.Debug("amount info", "amount", bigAmt.String())
 		//should not have 0x prefix and length must 64
 		resourceIdStr := strings.ToLower(m.ResourceId.Hex())
 		if len(resourceIdStr) != 64 {
-			w.log.Error("resourceId  length  must be 64")
+			log.Error("resourceId  length  must be 64")
 			return false
 		}
 
@@ -95,16 +108,17 @@ func (w *writer) processMessage(m msg.Message) bool {
 		recipientHexStr := hex.EncodeToString(recipient)
 		receiver, err := types.AccAddressFromHexUnsafe(recipientHexStr)
 		if err != nil {
-			w.log.Error("accAddressFromHex failed", "err", err)
-			return false
+			log.Error("accAddressFromHex failed, will skip", "err", err)
+			w.router.DeadLetter(m, fmt.Sprintf("recipient %s invalid: %s", recipientHexStr, err))
+			return true
 		}
 		done := core.UseSdkConfigContext(w.conn.client.GetAccountPrefix())
 		receiverStr := receiver.String()
 		done()
 
-		w.log.Info("ResolveMessage", "nonce", depositNonce, "source",
-			m.Source, "resource", resourceIdStr, "receiver", receiverStr, "amount", bigAmt.String())
+		log.Info("ResolveMessage", "receiver", receiverStr, "amount", bigAmt.String())
 
+		_, check := tracing.StartMessage(ctx, m, tracing.SpanProposalCheck)
 		proposalDetail, err := utils.QueryProposal(
 			w.conn.client,
 			w.conn.bridgeAddress,
@@ -115,61 +129,74 @@ func (w *writer) processMessage(m msg.Message) bool {
 				Recipient:    receiverStr,
 				Amount:       bigAmt.String(),
 			})
+		if err != nil && !strings.Contains(err.Error(), "not found") {
+			tracing.Fail(check, err)
+		}
+		check.End()
 		if err != nil {
 			if !strings.Contains(err.Error(), "not found") {
-				w.log.Error("QueryBridgeProposalDetail failed", "err", err)
+				log.Error("QueryBridgeProposalDetail failed", "err", err)
 				return false
 			}
 		} else {
 			if proposalDetail.Executed {
+				w.router.Journal(journal.NewDecision(m, journal.StatusExecuted, "proposal executed"))
 				return true
 			}
 			for _, voter := range proposalDetail.Voters {
 				if strings.EqualFold(voter, w.conn.Address()) {
+					w.router.Journal(journal.NewDecision(m, journal.StatusNotVoted, "already voted"))
 					return true
 				}
 			}
 		}
 
-		err = w.checkAndReSendWithProposal("voteproposal", &utils.VoteProposalParams{
+		_, submit := tracing.StartMessage(ctx, m, tracing.SpanTxSubmit)
+		txHash, err := w.checkAndReSendWithProposal("voteproposal", &utils.VoteProposalParams{
 			ChainId:      uint64(m.Source),
 			DepositNonce: depositNonce,
 			ResourceId:   resourceIdStr,
 			Recipient:    receiverStr,
 			Amount:       bigAmt.String(),
 		})
+		if txHash != "" {
+			submit.SetAttributes(tracing.Tx(txHash))
+		}
+		tracing.End(submit, err)
 		if err != nil {
-			w.log.Error("checkAndReSend failed", "err", err)
+			log.Error("checkAndReSend failed", "err", err)
+			w.router.Journal(journal.NewTx(m, txHash, journal.StatusFailed, err.Error()))
 			return false
 		}
-		w.log.Info("checkAndResend ok", "recipient", receiverStr)
+		log.Info("checkAndResend ok", "recipient", receiverStr)
+		w.router.Journal(journal.NewTx(m, txHash, journal.StatusSucceeded, "voteProposal"))
 		return true
 
 	default:
-		w.log.Warn("message type unsupported", "type", m.Type)
+		log.Warn("message type unsupported", "type", m.Type)
 		return false
 	}
 }
 
-func (h *writer) checkAndReSendWithProposal(typeStr string, content *utils.VoteProposalParams) error {
+func (h *writer) checkAndReSendWithProposal(typeStr string, content *utils.VoteProposalParams) (string, error) {
 	msg := utils.VoteProposalMsg(*content)
 	txHashStr, err := h.conn.client.SendContractExecuteMsg(h.conn.bridgeAddress, msg, nil)
 	if err != nil {
 		switch {
 		case strings.Contains(err.Error(), "Duplicate"):
 			h.log.Info("no need send, already executed", "txHash", txHashStr, "type", typeStr)
-			return nil
+			return txHashStr, nil
 
 		case strings.Contains(err.Error(), "Already executed"):
 			h.log.Info("no need send, already voted", "txHash", txHashStr, "type", typeStr)
-			return nil
+			return txHashStr, nil
 
 		// resend case:
 		case strings.Contains(err.Error(), errType.ErrWrongSequence.Error()):
 			return h.checkAndReSendWithProposal(txHashStr, content)
 		}
 
-		return err
+		return txHashStr, err
 	}
 
 	retry := BlockRetryLimit
@@ -179,7 +206,7 @@ func (h *writer) checkAndReSendWithProposal(typeStr string, content *utils.VoteP
 			h.log.Error("checkAndReSendWithProposal QueryTxByHash, reach retry limit.",
 				"tx hash", txHashStr,
 				"err", err)
-			return fmt.Errorf("checkAndReSendWithProposal QueryTxByHash reach retry limit, tx hash: %s,err: %s", txHashStr, err)
+			return txHashStr, fmt.Errorf("checkAndReSendWithProposal QueryTxByHash reach retry limit, tx hash: %s,err: %s", txHashStr, err)
 		}
 
 		//check on chain
@@ -209,17 +236,17 @@ func (h *writer) checkAndReSendWithProposal(typeStr string, content *utils.VoteP
 			switch {
 			case strings.Contains(res.RawLog, "Duplicate"):
 				h.log.Info("no need send, already executed", "txHash", txHashStr, "type", typeStr)
-				return nil
+				return txHashStr, nil
 
 			case strings.Contains(res.RawLog, "Already executed"):
 				h.log.Info("no need send, already voted", "txHash", txHashStr, "type", typeStr)
-				return nil
+				return txHashStr, nil
 
 			// resend case
 			case strings.Contains(res.RawLog, errType.ErrOutOfGas.Error()):
 				return h.checkAndReSendWithProposal(txHashStr, content)
 			default:
-				return fmt.Errorf("tx failed, txHash: %s, rawlog: %s", txHashStr, res.RawLog)
+				return txHashStr, fmt.Errorf("tx failed, txHash: %s, rawlog: %s", txHashStr, res.RawLog)
 			}
 		}
 
@@ -227,5 +254,5 @@ func (h *writer) checkAndReSendWithProposal(typeStr string, content *utils.VoteP
 	}
 
 	h.log.Info("checkAndReSendWithProposal success", "txHash", txHashStr, "type", typeStr)
-	return nil
+	return txHashStr, nil
 }
@@ -4,16 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 
 	"github.com/ChainSafe/log15"
 	"github.com/stafiprotocol/chainbridge/utils/blockstore"
 	"github.com/stafiprotocol/chainbridge/utils/core"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/notify"
 	"github.com/stafiprotocol/solana-go-sdk/client"
 	"github.com/stafiprotocol/solana-go-sdk/common"
 )
 
+var _ notify.BalanceChecker = &Chain{}
+var _ core.Backfiller = &Chain{}
+
 var TerminatedError = errors.New("terminated")
 
 type Chain struct {
@@ -35,7 +40,7 @@ func InitializeChain(cfg *core.ChainConfig, logger log15.Logger, sysErr chan<- e
 	}
 
 	// Attempt to load latest block
-	bs, err := blockstore.NewBlockstore(cfg.BlockstorePath, cfg.Id, conn.poolClient.FeeAccount.PublicKey.ToBase58())
+	bs, err := blockstore.NewSignatureBlockstore(cfg.BlockstorePath, cfg.Id, conn.poolClient.FeeAccount.PublicKey.ToBase58())
 	if err != nil {
 		return nil, err
 	}
@@ -103,7 +108,7 @@ func (c *Chain) Start() error {
 		return err
 	}
 
-	err = c.writer.start()
+	err = c.StartWriter()
 	if err != nil {
 		return err
 	}
@@ -112,6 +117,11 @@ func (c *Chain) Start() error {
 	return nil
 }
 
+// StartWriter starts the writer without the listener.
+func (c *Chain) StartWriter() error {
+	return c.writer.start()
+}
+
 func (c *Chain) Id() msg.ChainId {
 	return c.cfg.Id
 }
@@ -120,6 +130,20 @@ func (c *Chain) Name() string {
 	return c.cfg.Name
 }
 
+// Balance implements notify.BalanceChecker, it returns the lamports of the fee account.
+func (c *Chain) Balance() (*big.Int, error) {
+	lamports, err := c.conn.GetQueryClient().GetBalance(context.Background(), c.conn.poolClient.FeeAccount.PublicKey.ToBase58())
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetUint64(lamports), nil
+}
+
+// Backfill implements core.Backfiller, from and to are slots.
+func (c *Chain) Backfill(from, to uint64) error {
+	return c.listener.backfill(from, to)
+}
+
 // Stop signals to any running routines to exit
 func (c *Chain) Stop() {
 	close(c.stop)
@@ -87,20 +87,20 @@ func (w *writer) createProposalAccount(
 	resourceId [32]byte,
 	amount uint64,
 	processName string,
-) bool {
+) (string, bool) {
 	res, err := rpcClient.GetLatestBlockhash(context.Background(), solClient.GetLatestBlockhashConfig{
 		Commitment: solClient.CommitmentConfirmed,
 	})
 	if err != nil {
 		w.log.Error(fmt.Sprintf("[%s] GetRecentBlockhash failed", processName),
 			"err", err)
-		return false
+		return "", false
 	}
 	miniMumBalanceForRent, err := rpcClient.GetMinimumBalanceForRentExemption(context.Background(), solClient.MintProposalInfoLengthDefault)
 	if err != nil || miniMumBalanceForRent == 0 {
 		w.log.Error(fmt.Sprintf("[%s] GetMinimumBalanceForRentExemption failed", processName),
 			"err", err)
-		return false
+		return "", false
 	}
 	//send from one relayers
 	//create multisig tx account of this era
@@ -134,19 +134,19 @@ func (w *writer) createProposalAccount(
 	if err != nil {
 		w.log.Error(fmt.Sprintf("[%s] createProposalAccount CreateRawTransaction failed", processName),
 			"err", err)
-		return false
+		return "", false
 	}
 
 	txHash, err := rpcClient.SendRawTransaction(context.Background(), rawTx)
 	if err != nil {
 		w.log.Error(fmt.Sprintf("[%s] createProposalAccount SendRawTransaction failed", processName),
 			"err", err)
-		return false
+		return "", false
 	}
 	w.log.Info(fmt.Sprintf("[%s] create proposal account has send", processName),
 		"tx hash", txHash,
 		"proposal account", proposalAccountPubkey.ToBase58())
-	return true
+	return txHash, true
 }
 
 func (w *writer) approveProposal(
@@ -157,21 +157,21 @@ func (w *writer) approveProposal(
 	toAccount,
 	mintManager,
 	minterProgramId solCommon.PublicKey,
-	processName string) bool {
+	processName string) (string, bool) {
 	res, err := rpcClient.GetLatestBlockhash(context.Background(), solClient.GetLatestBlockhashConfig{
 		Commitment: solClient.CommitmentConfirmed,
 	})
 	if err != nil {
 		w.log.Error(fmt.Sprintf("[%s] GetRecentBlockhash failed", processName),
 			"err", err)
-		return false
+		return "", false
 	}
 
 	mintAuthority, _, err := solCommon.FindProgramAddress([][]byte{mintManager.Bytes(), []byte("mint")}, minterProgramId)
 	if err != nil {
 		w.log.Error(fmt.Sprintf("[%s] FindProgramAddress failed", processName),
 			"err", err)
-		return false
+		return "", false
 	}
 	rawTx, err := solTypes.CreateRawTransaction(solTypes.CreateRawTransactionParam{
 		Instructions: []solTypes.Instruction{
@@ -196,21 +196,21 @@ func (w *writer) approveProposal(
 	if err != nil {
 		w.log.Error(fmt.Sprintf("[%s] approveProposal CreateRawTransaction failed", processName),
 			"err", err)
-		return false
+		return "", false
 	}
 
 	txHash, err := rpcClient.SendRawTransaction(context.Background(), rawTx)
 	if err != nil {
 		w.log.Error(fmt.Sprintf("[%s] approveProposal SendRawTransaction failed", processName),
 			"err", err)
-		return false
+		return "", false
 	}
 
 	w.log.Info(fmt.Sprintf("[%s] approveProposal multisig tx account has send", processName),
 		"tx hash", txHash,
 		"proposal account", proposalAccountPubkey.ToBase58())
 
-	return true
+	return txHash, true
 }
 
 func (w *writer) IsProposalExe(proposalAccountPubkey solCommon.PublicKey) bool {
@@ -16,6 +16,7 @@ import (
 	"github.com/stafiprotocol/chainbridge/chains"
 	"github.com/stafiprotocol/chainbridge/utils/blockstore"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
 	"github.com/stafiprotocol/solana-go-sdk/bridgeprog"
 	solClient "github.com/stafiprotocol/solana-go-sdk/client"
 )
@@ -25,6 +26,9 @@ var (
 	eventTickerInterval = time.Second * 15
 )
 
+// Most signatures getSignaturesForAddress returns in one call
+const signaturePageLimit = 1000
+
 // listen event or block update from solana
 type listener struct {
 	name           string
@@ -93,120 +97,218 @@ func (l *listener) pollBlocks() error {
 func (l *listener) getDepositEventsForBlock(untilSignature string) error {
 	rpcClient := l.conn.queryClient
 	bridgeProgramId := l.conn.poolClient.BridgeProgramId.ToBase58()
-	bridgeAccount := l.conn.poolClient.BridgeAccountPubkey.ToBase58()
-
-	signatures, err := rpcClient.GetSignaturesForAddress(
-		context.Background(),
-		bridgeProgramId,
-		solClient.GetSignaturesForAddressConfig{
-			Until:      untilSignature,
-			Commitment: solClient.CommitmentFinalized,
-		})
 
+	signatures, err := signaturesUntil(untilSignature, func(before string) ([]solClient.GetSignaturesForAddress, error) {
+		return rpcClient.GetSignaturesForAddress(
+			context.Background(),
+			bridgeProgramId,
+			solClient.GetSignaturesForAddressConfig{
+				Limit:      signaturePageLimit,
+				Before:     before,
+				Until:      untilSignature,
+				Commitment: solClient.CommitmentFinalized,
+			})
+	})
 	if err != nil {
 		return fmt.Errorf("rpcClient.GetConfirmedSignaturesForAddress err: %s", err.Error())
 	}
+	if len(signatures) > signaturePageLimit {
+		l.log.Info("Catching up on signatures", "until", untilSignature, "signatures", len(signatures))
+	}
 
-	for i := len(signatures) - 1; i >= 0; i-- {
-		usesig := signatures[i].Signature
-		tx, err := rpcClient.GetTransaction(context.Background(), usesig, solClient.GetTransactionWithLimitConfig{
-			Commitment:                     solClient.CommitmentFinalized,
-			MaxSupportedTransactionVersion: &solClient.DefaultMaxSupportedTransactionVersion,
-		})
+	for _, usesig := range signatures {
+		err = l.processSignature(usesig)
 		if err != nil {
-			return fmt.Errorf("rpcClient.GetConfirmedTransaction err: %s", err.Error())
+			return err
 		}
-		//skip failed tx
-		if tx.Meta.Err != nil {
-			err := l.storeDealedSig(usesig)
-			if err != nil {
-				return err
-			}
-			continue
+		err = l.storeDealedSig(usesig)
+		if err != nil {
+			return err
 		}
-		//skip zero instruction
-		if len(tx.Transaction.Message.Instructions) == 0 {
-			err := l.storeDealedSig(usesig)
-			if err != nil {
-				return err
-			}
-			continue
+	}
+	return nil
+}
+
+// signaturesUntil returns the signatures after untilSignature, oldest first. The signatures are
+// fetched newest first, a page before the oldest one of the previous page at a time, until a
+// page ends at untilSignature. Without untilSignature only the newest page is returned.
+func signaturesUntil(untilSignature string, fetch func(before string) ([]solClient.GetSignaturesForAddress, error)) ([]string, error) {
+	var newestFirst []string
+	before := ""
+	for {
+		page, err := fetch(before)
+		if err != nil {
+			return nil, err
+		}
+		for _, sig := range page {
+			newestFirst = append(newestFirst, sig.Signature)
 		}
-		for _, instruct := range tx.Transaction.Message.Instructions {
+		if len(page) < signaturePageLimit || untilSignature == "" {
+			break
+		}
+		before = page[len(page)-1].Signature
+	}
 
-			accountKeys := tx.Transaction.Message.AccountKeys
-			programIdIndex := instruct.ProgramIDIndex
-			if len(accountKeys) <= int(programIdIndex) {
-				return fmt.Errorf("accounts or programIdIndex err, %v", tx)
-			}
+	signatures := make([]string, len(newestFirst))
+	for i, sig := range newestFirst {
+		signatures[len(newestFirst)-1-i] = sig
+	}
+	return signatures, nil
+}
 
-			//skip if it doesn't call  bridge program
-			if !strings.EqualFold(accountKeys[programIdIndex], bridgeProgramId) {
-				continue
-			}
+// backfill routes the deposits of the transactions in the finalized slots from to to, both
+// included, without updating the blockstore.
+func (l *listener) backfill(from, to uint64) error {
+	rpcClient := l.conn.queryClient
+	bridgeProgramId := l.conn.poolClient.BridgeProgramId.ToBase58()
 
-			// check instruction data
-			if len(instruct.Data) == 0 {
-				continue
-			}
+	finalized, err := rpcClient.GetSlot(context.Background(), solClient.GetSlotConfig{Commitment: solClient.CommitmentFinalized})
+	if err != nil {
+		return err
+	}
+	if to > finalized {
+		return fmt.Errorf("slot %d is not finalized yet, latest finalized slot is %d", to, finalized)
+	}
 
-			dataBts := base58.Decode(instruct.Data)
-			if len(dataBts) < 8 {
-				continue
-			}
-			// skip if it doesn't call transferOut func
-			if !bytes.Equal(dataBts[:8], bridgeprog.InstructionTransferOut[:]) {
-				l.log.Warn("call func is not transferOut", "tx", tx)
-				continue
-			}
-			// check bridge account
-			if len(instruct.Accounts) == 0 {
-				continue
+	// signatures are returned newest first, page back until the range is covered
+	var inRange []string
+	before := ""
+	for {
+		signatures, err := rpcClient.GetSignaturesForAddress(
+			context.Background(),
+			bridgeProgramId,
+			solClient.GetSignaturesForAddressConfig{
+				Before:     before,
+				Commitment: solClient.CommitmentFinalized,
+			})
+		if err != nil {
+			return fmt.Errorf("rpcClient.GetConfirmedSignaturesForAddress err: %s", err.Error())
+		}
+		if len(signatures) == 0 {
+			break
+		}
+		for _, sig := range signatures {
+			if sig.Slot >= from && sig.Slot <= to {
+				inRange = append(inRange, sig.Signature)
 			}
+		}
+		last := signatures[len(signatures)-1]
+		if last.Slot < from {
+			break
+		}
+		before = last.Signature
+	}
 
-			if !strings.EqualFold(accountKeys[instruct.Accounts[0]], bridgeAccount) {
-				l.log.Warn("bridge account not equal", "tx", tx)
-				continue
-			}
+	l.log.Info("Backfilling", "from", from, "to", to, "signatures", len(inRange))
+	for i := len(inRange) - 1; i >= 0; i-- {
+		select {
+		case <-l.stop:
+			return errors.New("backfill terminated")
+		default:
+		}
+		err = l.processSignature(inRange[i])
+		if err != nil {
+			return fmt.Errorf("signature %s: %s", inRange[i], err)
+		}
+	}
+	return nil
+}
+
+// processSignature routes the deposits of the transaction with signature usesig.
+func (l *listener) processSignature(usesig string) error {
+	rpcClient := l.conn.queryClient
+	bridgeProgramId := l.conn.poolClient.BridgeProgramId.ToBase58()
+	bridgeAccount := l.conn.poolClient.BridgeAccountPubkey.ToBase58()
+
+	tx, err := rpcClient.GetTransaction(context.Background(), usesig, solClient.GetTransactionWithLimitConfig{
+		Commitment:                     solClient.CommitmentFinalized,
+		MaxSupportedTransactionVersion: &solClient.DefaultMaxSupportedTransactionVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("rpcClient.GetConfirmedTransaction err: %s", err.Error())
+	}
+	//skip failed tx
+	if tx.Meta.Err != nil {
+		return nil
+	}
+	//skip zero instruction
+	if len(tx.Transaction.Message.Instructions) == 0 {
+		return nil
+	}
+	for _, instruct := range tx.Transaction.Message.Instructions {
+
+		accountKeys := tx.Transaction.Message.AccountKeys
+		programIdIndex := instruct.ProgramIDIndex
+		if len(accountKeys) <= int(programIdIndex) {
+			return fmt.Errorf("accounts or programIdIndex err, %v", tx)
+		}
+
+		//skip if it doesn't call  bridge program
+		if !strings.EqualFold(accountKeys[programIdIndex], bridgeProgramId) {
+			continue
+		}
+
+		// check instruction data
+		if len(instruct.Data) == 0 {
+			continue
+		}
+
+		dataBts := base58.Decode(instruct.Data)
+		if len(dataBts) < 8 {
+			continue
+		}
+		// skip if it doesn't call transferOut func
+		if !bytes.Equal(dataBts[:8], bridgeprog.InstructionTransferOut[:]) {
+			l.log.Warn("call func is not transferOut", "tx", tx)
+			continue
+		}
+		// check bridge account
+		if len(instruct.Accounts) == 0 {
+			continue
+		}
 
-			for _, logMessage := range tx.Meta.LogMessages {
-				if strings.HasPrefix(logMessage, bridgeprog.EventTransferOutPrefix) {
-					l.log.Info("find log", "log", logMessage, "signature", usesig)
-					use_log := strings.TrimPrefix(logMessage, bridgeprog.ProgramLogPrefix)
-					logBts, err := base64.StdEncoding.DecodeString(use_log)
-					if err != nil {
-						return err
-					}
-					if len(logBts) <= 8 {
-						return fmt.Errorf("event pase length err")
-					}
-
-					eventTransferOut := EventTransferOut{}
-					err = borsh.Deserialize(&eventTransferOut, logBts[8:])
-					if err != nil {
-						return err
-					}
-					m := msg.NewFungibleTransfer(
-						l.chainId,
-						msg.ChainId(eventTransferOut.DestChainId),
-						msg.Nonce(eventTransferOut.DepositNonce),
-						new(big.Int).SetUint64(eventTransferOut.Amount),
-						eventTransferOut.ResourceId,
-						eventTransferOut.Receiver,
-					)
-					l.log.Info("send fungibletransfer msg", "msg", m)
-					err = l.router.Send(m)
-					if err != nil {
-						l.log.Error("router send error: failed to route message", "err", err)
-						return err
-					}
+		if !strings.EqualFold(accountKeys[instruct.Accounts[0]], bridgeAccount) {
+			l.log.Warn("bridge account not equal", "tx", tx)
+			continue
+		}
+
+		for _, logMessage := range tx.Meta.LogMessages {
+			if strings.HasPrefix(logMessage, bridgeprog.EventTransferOutPrefix) {
+				l.log.Info("find log", "log", logMessage, "signature", usesig)
+				use_log := strings.TrimPrefix(logMessage, bridgeprog.ProgramLogPrefix)
+				logBts, err := base64.StdEncoding.DecodeString(use_log)
+				if err != nil {
+					return err
+				}
+				if len(logBts) <= 8 {
+					return fmt.Errorf("event pase length err")
 				}
 
+				eventTransferOut := EventTransferOut{}
+				err = borsh.Deserialize(&eventTransferOut, logBts[8:])
+				if err != nil {
+					return err
+				}
+				m := msg.NewFungibleTransfer(
+					l.chainId,
+					msg.ChainId(eventTransferOut.DestChainId),
+					msg.Nonce(eventTransferOut.DepositNonce),
+					new(big.Int).SetUint64(eventTransferOut.Amount),
+					eventTransferOut.ResourceId,
+					eventTransferOut.Receiver,
+				)
+				m.Block = tx.Slot
+				m.TxHash = usesig
+				l.log.Info("send fungibletransfer msg", append(m.LogContext(), "signature", usesig)...)
+				_, span := tracing.StartTransfer(m, tracing.SpanDeposit, tracing.Endpoint(l.conn.endpoint))
+				err = l.router.Send(m)
+				tracing.End(span, err)
+				if err != nil {
+					l.log.Error("router send error: failed to route message", append(m.LogContext(), "err", err)...)
+					return err
+				}
 			}
-		}
-		err = l.storeDealedSig(usesig)
-		if err != nil {
-			return err
+
 		}
 	}
 	return nil
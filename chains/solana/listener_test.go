@@ -0,0 +1,66 @@
+package solana
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	solClient "github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSignatures answers getSignaturesForAddress from the signatures of a program, oldest first.
+type fakeSignatures struct {
+	all   []string
+	until string
+	calls int
+}
+
+func (f *fakeSignatures) fetch(before string) ([]solClient.GetSignaturesForAddress, error) {
+	f.calls++
+	i := len(f.all)
+	if before != "" {
+		for i = 0; f.all[i] != before; i++ {
+		}
+	}
+	var page []solClient.GetSignaturesForAddress
+	for i--; i >= 0 && f.all[i] != f.until && len(page) < signaturePageLimit; i-- {
+		page = append(page, solClient.GetSignaturesForAddress{Signature: f.all[i]})
+	}
+	return page, nil
+}
+
+func TestSignaturesUntil(t *testing.T) {
+	f := &fakeSignatures{}
+	for i := 0; i < 2*signaturePageLimit+500; i++ {
+		f.all = append(f.all, fmt.Sprint(i))
+	}
+
+	// a surge of more than a page since the stored signature is fetched completely, oldest first
+	f.until = "10"
+	signatures, err := signaturesUntil(f.until, f.fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, f.all[11:], signatures)
+	assert.Equal(t, 3, f.calls)
+
+	// a page ending exactly at the stored signature takes one more, empty, page
+	f.calls = 0
+	f.until = fmt.Sprint(len(f.all) - signaturePageLimit - 1)
+	signatures, err = signaturesUntil(f.until, f.fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, f.all[len(f.all)-signaturePageLimit:], signatures)
+	assert.Equal(t, 2, f.calls)
+
+	// without a stored signature only the newest page is taken
+	f.calls = 0
+	f.until = ""
+	signatures, err = signaturesUntil(f.until, f.fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, f.all[len(f.all)-signaturePageLimit:], signatures)
+	assert.Equal(t, 1, f.calls)
+
+	_, err = signaturesUntil("10", func(string) ([]solClient.GetSignaturesForAddress, error) {
+		return nil, errors.New("rate limited")
+	})
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package solana
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
@@ -9,7 +10,9 @@ import (
 
 	"github.com/ChainSafe/log15"
 	"github.com/stafiprotocol/chainbridge/chains"
+	"github.com/stafiprotocol/chainbridge/utils/journal"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
 	solClient "github.com/stafiprotocol/solana-go-sdk/client"
 	"github.com/stafiprotocol/solana-go-sdk/common"
 	"github.com/stafiprotocol/solana-go-sdk/tokenprog"
@@ -46,7 +49,7 @@ func (w *writer) setRouter(r chains.Router) {
 }
 
 func (w *writer) ResolveMessage(m msg.Message) bool {
-	w.log.Info("Attempting to resolve message", "type", m.Type, "src", m.Source, "dst", m.Destination, "nonce", m.DepositNonce, "rId", m.ResourceId.Hex())
+	w.log.Info("Attempting to resolve message", append(m.LogContext(), "type", m.Type)...)
 	w.log.Info("ResolveMessage: size of msgChan", "size", len(w.msgChan))
 	w.msgChan <- m
 	return true
@@ -54,11 +57,18 @@ func (w *writer) ResolveMessage(m msg.Message) bool {
 
 // resolve msg from other chains
 func (w *writer) processMessage(m msg.Message) (processOk bool) {
+	ctx, span := tracing.StartMessage(tracing.Context(m), m, tracing.SpanProcess)
+	defer span.End()
+	log := w.log.New(m.LogContext()...)
 	switch m.Type {
 	case msg.FungibleTransfer:
 		poolClient := w.conn.poolClient
 		rpcClient := w.conn.GetQueryClient()
 		bigAmt := new(big.Int).SetBytes(m.Payload[0].([]byte))
+		if !bigAmt.IsUint64() {
+			w.router.DeadLetter(m, fmt.Sprintf("amount %s overflows u64", bigAmt))
+			return true
+		}
 		recipient := m.Payload[1].([]byte)
 		toAccount := common.PublicKeyFromBytes(recipient)
 		//check toAccount
@@ -67,22 +77,24 @@ func (w *writer) processMessage(m msg.Message) (processOk bool) {
 		var retry = 0
 		for {
 			if retry > retryLimit {
-				w.log.Error("GetTokenAccountInfo failed, will skip this recipient",
+				log.Error("GetTokenAccountInfo failed, will skip this recipient",
 					"token account address", toAccount.ToBase58(),
 					"err", err)
+				w.router.DeadLetter(m, fmt.Sprintf("token account %s unavailable: %s", toAccount.ToBase58(), err))
 				return true
 			}
 			toAccountInfo, err = rpcClient.GetTokenAccountInfo(context.Background(), toAccount.ToBase58())
 			if err != nil {
 				// should skip if no account data
 				if strings.Contains(err.Error(), "data length not match") {
-					w.log.Warn("GetTokenAccountInfo failed, will skip",
+					log.Warn("GetTokenAccountInfo failed, will skip",
 						"token account address", toAccount.ToBase58(),
 						"err", err)
+					w.router.DeadLetter(m, fmt.Sprintf("token account %s has no data: %s", toAccount.ToBase58(), err))
 					return true
 				}
 				// return false if retry limit
-				w.log.Warn("GetTokenAccountInfo failed, will retry...",
+				log.Warn("GetTokenAccountInfo failed, will retry...",
 					"token account address", toAccount.ToBase58(),
 					"err", err)
 				retry++
@@ -101,18 +113,19 @@ func (w *writer) processMessage(m msg.Message) (processOk bool) {
 		)
 
 		//get gridgeAccount info
+		_, lookup := tracing.StartMessage(ctx, m, tracing.SpanHandlerLookup, tracing.Endpoint(w.conn.endpoint))
 		bridgeAccount, err := rpcClient.GetBridgeAccountInfo(context.Background(), poolClient.BridgeAccountPubkey.ToBase58())
+		tracing.End(lookup, err)
 		if err != nil {
-			w.log.Error("GetBridgeAccountInfo err",
+			log.Error("GetBridgeAccountInfo err",
 				"bridge account address", poolClient.BridgeAccountPubkey.ToBase58(),
 				"err", err)
 			return false
 		}
 		var willUseMintAccount common.PublicKey
 		if mint, exist := bridgeAccount.ResourceIdToMint[m.ResourceId]; !exist {
-			w.log.Error("bridge resourceidToMint not exist",
-				"resourceIdToMint", bridgeAccount.ResourceIdToMint,
-				"resourceId", m.ResourceId)
+			log.Error("bridge resourceidToMint not exist",
+				"resourceIdToMint", bridgeAccount.ResourceIdToMint)
 			return false
 		} else {
 			willUseMintAccount = mint
@@ -120,17 +133,25 @@ func (w *writer) processMessage(m msg.Message) (processOk bool) {
 
 		//toAccount mint should equal willUseMintAccount
 		if toAccountInfo.Mint != willUseMintAccount {
-			w.log.Warn("TokenAccountInfo's mint account not equal, will skip this fungibleTransfer",
+			log.Warn("TokenAccountInfo's mint account not equal, will skip this fungibleTransfer",
 				"token account address", toAccount.ToBase58(),
 				"mintAccount in tokenAccount", toAccountInfo.Mint.ToBase58(),
 				"mintAccount in bridgeAccount", willUseMintAccount.ToBase58())
+			w.router.DeadLetter(m, fmt.Sprintf("token account %s mint %s does not match bridge mint %s",
+				toAccount.ToBase58(), toAccountInfo.Mint.ToBase58(), willUseMintAccount.ToBase58()))
 			return true
 		}
 
 		//check and create proposal is not exist
+		_, check := tracing.StartMessage(ctx, m, tracing.SpanProposalCheck, tracing.Endpoint(w.conn.endpoint))
 		_, err = rpcClient.GetMintProposalInfo(context.Background(), willUseProposalAccount.ToBase58())
+		if err != nil && err != solClient.ErrAccountNotFound {
+			tracing.Fail(check, err)
+		}
+		check.End()
 		if err != nil && err == solClient.ErrAccountNotFound {
-			sendOk := w.createProposalAccount(
+			_, submit := tracing.StartMessage(ctx, m, tracing.SpanTxSubmit, tracing.Endpoint(w.conn.endpoint))
+			txHash, sendOk := w.createProposalAccount(
 				rpcClient,
 				poolClient,
 				toAccount,
@@ -140,37 +161,50 @@ func (w *writer) processMessage(m msg.Message) (processOk bool) {
 				bigAmt.Uint64(),
 				"FungibleTransfer",
 			)
+			submit.SetAttributes(tracing.Tx(txHash))
 			if !sendOk {
+				tracing.End(submit, errors.New("createMintProposal not sent"))
+				w.router.Journal(journal.NewTx(m, txHash, journal.StatusFailed, "createMintProposal not sent"))
 				return false
 			}
+			submit.End()
+			w.router.Journal(journal.NewTx(m, txHash, journal.StatusSubmitted, "createMintProposal"))
 		}
 		if err != nil && err != solClient.ErrAccountNotFound {
-			w.log.Error("GetMintProposalInfo err",
+			log.Error("GetMintProposalInfo err",
 				"proposal account address", willUseProposalAccount.ToBase58(),
 				"err", err)
 			return false
 		}
 
 		//check proposal account is created
+		_, confirm := tracing.StartMessage(ctx, m, tracing.SpanTxConfirm, tracing.Endpoint(w.conn.endpoint))
 		create := w.waitingForProposalAccountCreate(rpcClient, willUseProposalAccount.ToBase58(), "FungibleTransfer")
 		if !create {
+			tracing.End(confirm, errors.New("proposal account not created"))
 			return false
 		}
-		w.log.Info("FungibleTransfer proposalAccount has create", "proposalAccount", willUseProposalAccount.ToBase58())
+		confirm.End()
+		log.Info("FungibleTransfer proposalAccount has create", "proposalAccount", willUseProposalAccount.ToBase58())
 
+		_, check = tracing.StartMessage(ctx, m, tracing.SpanProposalCheck, tracing.Endpoint(w.conn.endpoint))
 		valid := w.CheckProposalAccount(willUseProposalAccount, willUseMintAccount, toAccount, bigAmt.Uint64())
 		if !valid {
-			w.log.Info("FungibleTransfer CheckProposalAccount failed", "proposalAccount", willUseProposalAccount.ToBase58())
+			check.End()
+			log.Info("FungibleTransfer CheckProposalAccount failed", "proposalAccount", willUseProposalAccount.ToBase58())
 			return false
 		}
 		//if has exe just return
 		isExe := w.IsProposalExe(willUseProposalAccount)
+		check.End()
 		if isExe {
-			w.log.Info("FungibleTransfer proposalAccount has execute", "proposalAccount", willUseProposalAccount.ToBase58())
+			log.Info("FungibleTransfer proposalAccount has execute", "proposalAccount", willUseProposalAccount.ToBase58())
+			w.router.Journal(journal.NewDecision(m, journal.StatusExecuted, "proposal executed"))
 			return true
 		}
 		//approve proposal
-		send := w.approveProposal(
+		_, submit := tracing.StartMessage(ctx, m, tracing.SpanTxSubmit, tracing.Endpoint(w.conn.endpoint))
+		txHash, send := w.approveProposal(
 			rpcClient,
 			poolClient,
 			willUseProposalAccount,
@@ -180,19 +214,29 @@ func (w *writer) processMessage(m msg.Message) (processOk bool) {
 			w.minterProgramId,
 			"FungibleTransfer",
 		)
+		submit.SetAttributes(tracing.Tx(txHash))
 		if !send {
+			tracing.End(submit, errors.New("approveMintProposal not sent"))
+			w.router.Journal(journal.NewTx(m, txHash, journal.StatusFailed, "approveMintProposal not sent"))
 			return false
 		}
+		submit.End()
 
 		//check proposal exe result
+		_, confirm = tracing.StartMessage(ctx, m, tracing.SpanTxConfirm, tracing.Endpoint(w.conn.endpoint), tracing.Tx(txHash))
 		exe := w.waitingForProposalExe(rpcClient, willUseProposalAccount.ToBase58(), "FungibleTransfer")
 		if !exe {
+			tracing.End(confirm, errors.New("approveMintProposal not executed"))
+			w.router.Journal(journal.NewTx(m, txHash, journal.StatusFailed, "approveMintProposal not executed"))
 			return false
 		}
-		w.log.Info("FungibleTransfer proposalAccount has execute", "proposalAccount", willUseProposalAccount.ToBase58())
+		confirm.End()
+		w.router.Journal(journal.NewTx(m, txHash, journal.StatusSucceeded, "approveMintProposal executed"))
+		w.router.Journal(journal.NewDecision(m, journal.StatusExecuted, "proposal executed"))
+		log.Info("FungibleTransfer proposalAccount has execute", "proposalAccount", willUseProposalAccount.ToBase58())
 		return true
 	default:
-		w.log.Warn("message type unsupported", "type", m.Type)
+		log.Warn("message type unsupported", "type", m.Type)
 		return false
 	}
 }
@@ -207,8 +251,10 @@ func (w *writer) start() error {
 				w.log.Info("solana writer stopped")
 				return
 			case msg := <-w.msgChan:
+				tracing.QueueWait(msg)
 				result := w.processMessage(msg)
 				w.log.Info("processMessage", "result", result)
+				w.router.Processed(msg, result)
 				if !result {
 					w.sysErr <- fmt.Errorf("processMessage failed")
 				}
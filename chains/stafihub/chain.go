@@ -23,14 +23,21 @@ As the writer receives messages from the router, nothing happened.
 package stafihub
 
 import (
+	"errors"
+	"math/big"
 	"strconv"
 
 	"github.com/ChainSafe/log15"
 	"github.com/stafiprotocol/chainbridge/utils/blockstore"
 	"github.com/stafiprotocol/chainbridge/utils/core"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/notify"
 )
 
+var _ notify.BalanceChecker = &Chain{}
+var _ notify.LagChecker = &Chain{}
+var _ core.Backfiller = &Chain{}
+
 type Chain struct {
 	cfg      *core.ChainConfig // The config of the chain
 	conn     *Connection       // THe chains connection
@@ -79,20 +86,27 @@ func (c *Chain) Start() error {
 		return err
 	}
 
-	if len(c.conn.client.GetFromName()) > 0 {
-		err = c.writer.start()
-		if err != nil {
-			return err
-		}
+	err = c.StartWriter()
+	if err != nil {
+		return err
 	}
 
 	c.conn.log.Debug("Successfully started chain", "chainId", c.cfg.Id)
 	return nil
 }
 
+// StartWriter starts the writer without the listener. The writer only runs with a key.
+func (c *Chain) StartWriter() error {
+	if len(c.conn.client.GetFromName()) > 0 {
+		return c.writer.start()
+	}
+	return nil
+}
+
 func (c *Chain) SetRouter(r *core.Router) {
 	r.Listen(c.cfg.Id, c.writer)
 	c.listener.setRouter(r)
+	c.writer.setRouter(r)
 }
 
 func (c *Chain) Id() msg.ChainId {
@@ -103,6 +117,33 @@ func (c *Chain) Name() string {
 	return c.cfg.Name
 }
 
+// Balance implements notify.BalanceChecker, it returns the balance of the relayer account in
+// the fee denom.
+func (c *Chain) Balance() (*big.Int, error) {
+	if c.conn.Address() == "" {
+		return nil, errors.New("no relayer account")
+	}
+	res, err := c.conn.client.QueryBalance(c.conn.client.GetFromAddress(), c.conn.client.GetDenom(), 0)
+	if err != nil {
+		return nil, err
+	}
+	return res.Balance.Amount.BigInt(), nil
+}
+
+// Lag implements notify.LagChecker, the listener only processes finalized blocks.
+func (c *Chain) Lag() (uint64, error) {
+	finalized, err := c.conn.FinalizedBlockNumber()
+	if err != nil {
+		return 0, err
+	}
+	return c.listener.lag(finalized), nil
+}
+
+// Backfill implements core.Backfiller.
+func (c *Chain) Backfill(from, to uint64) error {
+	return c.listener.backfill(from, to)
+}
+
 func (c *Chain) Stop() {
 	close(c.stop)
 }
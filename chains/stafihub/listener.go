@@ -13,8 +13,10 @@ import (
 	"github.com/stafiprotocol/chainbridge/chains"
 	"github.com/stafiprotocol/chainbridge/utils/blockstore"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
 	"math/big"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,6 +34,7 @@ type listener struct {
 	log        log15.Logger
 	stop       <-chan int
 	sysErr     chan<- error
+	processed  atomic.Uint64 // last block processed
 }
 
 var (
@@ -57,6 +60,16 @@ func NewListener(conn *Connection, name string, id msg.ChainId, startBlock uint6
 	}
 }
 
+// lag returns how many blocks the listener is behind latest, 0 before the first block was
+// processed.
+func (l *listener) lag(latest uint64) uint64 {
+	processed := l.processed.Load()
+	if processed == 0 || latest <= processed {
+		return 0
+	}
+	return latest - processed
+}
+
 func (l *listener) setRouter(r chains.Router) {
 	l.router = r
 }
@@ -121,11 +134,12 @@ func (l *listener) pollBlocks() error {
 				continue
 			}
 
-			// Write to blockstore
-			err = l.blockstore.StoreBlock(big.NewInt(0).SetUint64(currentBlock))
+			// Write to blockstore, without the hash as only finalized blocks are processed and never rewound
+			err = l.blockstore.StoreBlock(big.NewInt(0).SetUint64(currentBlock), "")
 			if err != nil {
 				l.log.Error("Failed to write to blockstore", "err", err)
 			}
+			l.processed.Store(currentBlock)
 
 			currentBlock++
 			retry = BlockRetryLimit
@@ -133,6 +147,43 @@ func (l *listener) pollBlocks() error {
 	}
 }
 
+// backfill processes the events of the finalized blocks from to to, both included, without
+// updating the blockstore. Failed blocks are retried as when polling.
+func (l *listener) backfill(from, to uint64) error {
+	finalized, err := l.conn.FinalizedBlockNumber()
+	if err != nil {
+		return err
+	}
+	if to > finalized {
+		return fmt.Errorf("block %d is not finalized yet, latest finalized block is %d", to, finalized)
+	}
+
+	for block := from; block <= to; block++ {
+		retry := BlockRetryLimit
+		for {
+			select {
+			case <-l.stop:
+				return errors.New("backfill terminated")
+			default:
+			}
+			err = l.processEvents(block)
+			if err == nil {
+				break
+			}
+			retry--
+			if retry == 0 {
+				return fmt.Errorf("block %d: %s", block, err)
+			}
+			l.log.Error("Failed to process events in block", "block", block, "err", err)
+			time.Sleep(BlockRetryInterval)
+		}
+		if block%100 == 0 {
+			l.log.Info("Backfilling", "block", block, "to", to)
+		}
+	}
+	return nil
+}
+
 // processEvents fetches a block and parses out the events, calling Listener.handleEvents()
 func (l *listener) processEvents(blockNum uint64) error {
 	if blockNum%100 == 0 {
@@ -157,7 +208,7 @@ func (l *listener) processEvents(blockNum uint64) error {
 	for _, tx := range evts {
 		for _, log := range tx.Logs {
 			for _, event := range log.Events {
-				err := l.processStringEvents(event, int64(blockNum))
+				err := l.processStringEvents(event, int64(blockNum), tx.TxHash)
 				if err != nil {
 					return err
 				}
@@ -171,14 +222,16 @@ func (l *listener) processEvents(blockNum uint64) error {
 // submitMessage inserts the chainId into the msg and sends it to the router
 func (l *listener) submitMessage(m msg.Message) (err error) {
 	m.Source = l.chainId
+	_, span := tracing.StartTransfer(m, tracing.SpanDeposit)
+	defer func() { tracing.End(span, err) }()
 	err = l.router.Send(m)
 	if err != nil {
-		l.log.Error("failed to process event", "err", err)
+		l.log.Error("failed to process event", append(m.LogContext(), "err", err)...)
 	}
 	return err
 }
 
-func (l *listener) processStringEvents(event types.StringEvent, blockNumber int64) error {
+func (l *listener) processStringEvents(event types.StringEvent, blockNumber int64, txHash string) error {
 	l.log.Debug("processStringEvents", "event", event)
 	switch {
 	case event.Type == stafiHubXBridgeTypes.EventTypeDeposit:
@@ -224,6 +277,8 @@ func (l *listener) processStringEvents(event types.StringEvent, blockNumber int6
 			resource,
 			receiver,
 		)
+		m.Block = uint64(blockNumber)
+		m.TxHash = txHash
 
 		l.log.Info("find event", "msg", m, "block number", blockNumber)
 		return l.submitMessage(m)
@@ -23,31 +23,37 @@ As the writer receives messages from the router, nothing happened.
 package substrate
 
 import (
+	"encoding/hex"
 	"fmt"
+	"math/big"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/ChainSafe/log15"
-	"github.com/shopspring/decimal"
+	"github.com/stafiprotocol/chainbridge/config"
 	"github.com/stafiprotocol/chainbridge/utils/blockstore"
 	"github.com/stafiprotocol/chainbridge/utils/core"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/notify"
+	"github.com/stafiprotocol/chainbridge/utils/tokens"
+	"github.com/stafiprotocol/go-substrate-rpc-client/types"
 )
 
+var _ notify.BalanceChecker = &Chain{}
+var _ notify.LagChecker = &Chain{}
+var _ core.Backfiller = &Chain{}
+var _ tokens.DecimalsSource = &Chain{}
+
 type Chain struct {
 	cfg      *core.ChainConfig // The config of the chain
 	conn     *Connection       // THe chains connection
 	listener *listener         // The listener of this chain
 	writer   *writer           // The writer of the chain
+	decimals *decimalsReader   // Reads the decimals of tokens, nil if not read from the chain
 	stop     chan<- int
 }
 
 func InitializeChain(cfg *core.ChainConfig, logger log15.Logger, sysErr chan<- error) (*Chain, error) {
-	decimals, err := getDecimals(cfg)
-	if err != nil {
-		return nil, err
-	}
-
 	stop := make(chan int)
 	conn, err := NewConnection(cfg, logger, stop)
 	if err != nil {
@@ -83,9 +89,43 @@ func InitializeChain(cfg *core.ChainConfig, logger log15.Logger, sysErr chan<- e
 	}
 
 	// Setup listener & writer
-	l := NewListener(conn, cfg.Name, cfg.Id, startBlock, logger, bs, stop, sysErr, decimals)
-	w := NewWriter(conn, logger, sysErr, stop, decimals)
-	return &Chain{cfg: cfg, conn: conn, listener: l, writer: w, stop: stop}, nil
+	l := NewListener(conn, cfg.Name, cfg.Id, startBlock, logger, bs, stop, sysErr)
+	l.subscribeHeads = cfg.Opts["subscribeHeads"] == "true"
+	if opt, ok := cfg.Opts["prefetch"]; ok {
+		concurrency, err := strconv.Atoi(opt)
+		if err != nil || concurrency < 1 {
+			return nil, fmt.Errorf("prefetch %s invalid, must be a positive number", opt)
+		}
+		if concurrency > 1 {
+			l.prefetch = newPrefetcher(conn.FetchEvents, concurrency)
+		}
+	}
+	w := NewWriter(conn, logger, sysErr, stop)
+	err = parseBatchOptions(w, cfg.Opts)
+	if err != nil {
+		return nil, err
+	}
+	w.signer, err = parseSigner(cfg.Opts, types.NewAccountID(conn.key.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	if w.signer != nil {
+		version, err := conn.gc.MetadataVersion()
+		if err != nil {
+			return nil, err
+		}
+		err = w.signer.checkMetadata(version)
+		if err != nil {
+			return nil, err
+		}
+		voter := w.signer.voter()
+		logger.Info("Relayer acts through proxy or multisig", "voter", hex.EncodeToString(voter[:]))
+	}
+	decimals, err := parseDecimalsReader(cfg.Opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Chain{cfg: cfg, conn: conn, listener: l, writer: w, decimals: decimals, stop: stop}, nil
 }
 
 func (c *Chain) Start() error {
@@ -94,7 +134,7 @@ func (c *Chain) Start() error {
 		return err
 	}
 
-	err = c.writer.start()
+	err = c.StartWriter()
 	if err != nil {
 		return err
 	}
@@ -103,9 +143,15 @@ func (c *Chain) Start() error {
 	return nil
 }
 
+// StartWriter starts the writer without the listener.
+func (c *Chain) StartWriter() error {
+	return c.writer.start()
+}
+
 func (c *Chain) SetRouter(r *core.Router) {
 	r.Listen(c.cfg.Id, c.writer)
 	c.listener.setRouter(r)
+	c.writer.setRouter(r)
 }
 
 func (c *Chain) Id() msg.ChainId {
@@ -116,6 +162,37 @@ func (c *Chain) Name() string {
 	return c.cfg.Name
 }
 
+// Balance implements notify.BalanceChecker, it returns the free balance of the relayer account.
+func (c *Chain) Balance() (*big.Int, error) {
+	info, err := c.conn.gc.GetAccountInfo()
+	if err != nil {
+		return nil, err
+	}
+	return info.Data.Free.Int, nil
+}
+
+// Lag implements notify.LagChecker, the listener only processes finalized blocks.
+func (c *Chain) Lag() (uint64, error) {
+	finalized, err := c.conn.FinalizedBlockNumber()
+	if err != nil {
+		return 0, err
+	}
+	return c.listener.lag(finalized), nil
+}
+
+// Backfill implements core.Backfiller.
+func (c *Chain) Backfill(from, to uint64) error {
+	return c.listener.backfill(from, to)
+}
+
+// Decimals implements tokens.DecimalsSource, if the decimals of tokens are read from the chain.
+func (c *Chain) Decimals(rId msg.ResourceId) (uint8, bool, error) {
+	if c.decimals == nil {
+		return 0, false, nil
+	}
+	return c.decimals.read(c.conn, rId)
+}
+
 func (c *Chain) Stop() {
 	close(c.stop)
 }
@@ -135,6 +212,34 @@ func checkBlockstore(bs *blockstore.Blockstore, startBlock uint64) (uint64, erro
 	}
 }
 
+// parseBatchOptions reads the options batching the acknowledgements of the writer.
+func parseBatchOptions(w *writer, opts map[string]string) error {
+	if opt, ok := opts["batchSize"]; ok {
+		size, err := strconv.Atoi(opt)
+		if err != nil || size < 1 {
+			return fmt.Errorf("batchSize %s invalid, must be a positive number", opt)
+		}
+		w.batchSize = size
+	}
+	w.batchWait = DefaultBatchWait
+	if opt, ok := opts["batchWait"]; ok {
+		wait, err := time.ParseDuration(opt)
+		if err != nil || wait < 0 {
+			return fmt.Errorf("batchWait %s invalid, must be a duration like 2s", opt)
+		}
+		w.batchWait = wait
+	}
+	switch opts["batchCall"] {
+	case "", "force_batch":
+		w.batchCall = config.UtilityForceBatch
+	case "batch_all":
+		w.batchCall = config.UtilityBatchAll
+	default:
+		return fmt.Errorf("batchCall %s invalid, must be force_batch or batch_all", opts["batchCall"])
+	}
+	return nil
+}
+
 func parseStartBlock(cfg *core.ChainConfig) uint64 {
 	if blk, ok := cfg.Opts["startBlock"]; ok {
 		res, err := strconv.ParseUint(blk, 10, 32)
@@ -145,47 +250,3 @@ func parseStartBlock(cfg *core.ChainConfig) uint64 {
 	}
 	return 0
 }
-
-func getDecimals(cfg *core.ChainConfig) (map[string]decimal.Decimal, error) {
-	symbols := cfg.Symbols
-	if len(symbols) == 0 {
-		return nil, fmt.Errorf("config does not contains symbols")
-	}
-
-	decimals := make(map[string]decimal.Decimal)
-	for _, sym := range symbols {
-		info, ok := sym.(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("symbol not a string map")
-		}
-
-		rId, ok := info["resourceId"].(string)
-		if !ok {
-			return nil, fmt.Errorf("unable to get symbol resourceId")
-		}
-		if rId != decimalDefault {
-			rId = strings.ToLower(rId)
-		}
-		if strings.Contains(rId, "0x") {
-			return nil, fmt.Errorf("resourceId should not with prefix 0x")
-		}
-		if rId != decimalDefault && len(rId) != 64 {
-			return nil, fmt.Errorf("resourceId length must be 64")
-		}
-
-		df, ok := info["decimalFactor"].(string)
-		if !ok {
-			return nil, fmt.Errorf("unable to get symbol decimalFactor")
-		}
-
-		dDeci, err := decimal.NewFromString(df)
-		if err != nil {
-			return nil, err
-		}
-
-		decimals[rId] = dDeci
-	}
-	fmt.Println(decimals)
-
-	return decimals, nil
-}
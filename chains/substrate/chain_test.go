@@ -2,7 +2,9 @@ package substrate
 
 import (
 	"testing"
+	"time"
 
+	"github.com/stafiprotocol/chainbridge/config"
 	"github.com/stafiprotocol/chainbridge/utils/core"
 )
 
@@ -25,3 +27,28 @@ func TestParseStartBlock(t *testing.T) {
 		t.Fatalf("Got: %d Expected: %d", blk, 0)
 	}
 }
+
+func TestParseBatchOptions(t *testing.T) {
+	w := NewWriter(nil, nil, nil, nil)
+	err := parseBatchOptions(w, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.batchSize != 1 || w.batchWait != DefaultBatchWait || w.batchCall != config.UtilityForceBatch {
+		t.Fatalf("unexpected defaults %d %s %s", w.batchSize, w.batchWait, w.batchCall)
+	}
+
+	err = parseBatchOptions(w, map[string]string{"batchSize": "20", "batchWait": "500ms", "batchCall": "batch_all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.batchSize != 20 || w.batchWait != 500*time.Millisecond || w.batchCall != config.UtilityBatchAll {
+		t.Fatalf("unexpected options %d %s %s", w.batchSize, w.batchWait, w.batchCall)
+	}
+
+	for _, opts := range []map[string]string{{"batchSize": "0"}, {"batchWait": "2"}, {"batchCall": "batch"}} {
+		if err := parseBatchOptions(w, opts); err == nil {
+			t.Fatalf("expected error for %v", opts)
+		}
+	}
+}
@@ -5,6 +5,10 @@ package substrate
 
 import (
 	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/ChainSafe/log15"
 	"github.com/stafiprotocol/chainbridge/shared/substrate"
@@ -23,45 +27,144 @@ type Connection struct {
 	stop <-chan int // Signals system shutdown, should be observed in all selects and loops
 	log  log15.Logger
 	key  *signature.KeyringPair
+
+	pallet *pallet // names of the bridge pallet and its items
 }
 
 const (
 	DefaultTypeFilePath = "../../network/stafi.json"
+	DefaultResubmits    = 3
 )
 
 func NewConnection(cfg *core.ChainConfig, log log15.Logger, stop <-chan int) (*Connection, error) {
-	log.Info("NewConnection", "name", cfg.Name, "KeystorePath", cfg.KeystorePath, "Endpoint", cfg.Endpoint)
+	log.Info("NewConnection", "name", cfg.Name, "KeystorePath", cfg.KeystorePath, "Endpoint", cfg.Endpoint, "EndpointList", cfg.EndpointList)
+
+	p, err := parsePallet(cfg.Opts)
+	if err != nil {
+		return nil, err
+	}
+
+	endpointOpts, err := parseEndpointOptions(cfg.Opts)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := substrate.NewEndpointPool(append([]string{cfg.Endpoint}, cfg.EndpointList...), endpointOpts, log)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := endpoints.Best()
 
 	kp, err := keystore.KeypairFromAddress(cfg.From, keystore.SubChain, cfg.KeystorePath, cfg.Insecure)
 	if err != nil {
 		return nil, err
 	}
 	krp := kp.(*sr25519.Keypair).AsKeyringPair()
-	gc, err := substrate.NewGsrpcClient(cfg.Endpoint, "AccountId", krp, log, stop)
+	gc, err := substrate.NewGsrpcClient(endpoint, "AccountId", krp, log, stop)
 	if err != nil {
 		return nil, err
 	}
 
-	path := DefaultTypeFilePath
+	// the types file is only needed for runtimes before metadata V14
+	path := ""
 	if file, ok := cfg.Opts["typeRegister"]; ok {
 		path = file
+	} else if _, err := os.Stat(DefaultTypeFilePath); err == nil {
+		path = DefaultTypeFilePath
+	}
+	sc, err := substrate.NewSarpcClient(endpoint, path, log)
+	if err != nil {
+		return nil, err
 	}
-	sc, err := substrate.NewSarpcClient(cfg.Endpoint, path, log)
+
+	gc.SetEndpoints(endpoints)
+	sc.SetEndpoints(endpoints)
+	endpoints.Start(stop)
+
+	metadata := substrate.NewMetadataCache()
+	sc.SetMetadataCache(metadata)
+	gc.SetMetadataCache(metadata)
+	gc.SetOutcomeCheck(sc.ExtrinsicOutcome)
+	if opt, ok := cfg.Opts["finalityTimeout"]; ok {
+		timeout, err := time.ParseDuration(opt)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("finalityTimeout %s invalid, must be a duration like 2m", opt)
+		}
+		gc.SetFinalityTimeout(timeout)
+	}
+	submit, err := parseSubmitOptions(cfg.Opts)
 	if err != nil {
 		return nil, err
 	}
+	gc.SetSubmitOptions(submit)
 
 	return &Connection{
-		url:  cfg.Endpoint,
+		url:  endpoint,
 		name: cfg.Name,
 		sc:   sc,
 		gc:   gc,
 		stop: stop,
 		log:  log,
 		key:  krp,
+
+		pallet: p,
 	}, nil
 }
 
+// parseEndpointOptions reads the options of the endpoint health checks.
+func parseEndpointOptions(opts map[string]string) (substrate.EndpointOptions, error) {
+	o := substrate.DefaultEndpointOptions()
+	for name, d := range map[string]*time.Duration{"healthInterval": &o.HealthInterval, "maxLatency": &o.MaxLatency, "staleAfter": &o.StaleAfter} {
+		opt, ok := opts[name]
+		if !ok {
+			continue
+		}
+		duration, err := time.ParseDuration(opt)
+		if err != nil || duration < 0 || (name == "healthInterval" && duration == 0) {
+			return o, fmt.Errorf("%s %s invalid, must be a duration like 30s", name, opt)
+		}
+		*d = duration
+	}
+	if opt, ok := opts["maxLag"]; ok {
+		lag, err := strconv.ParseUint(opt, 10, 64)
+		if err != nil {
+			return o, fmt.Errorf("maxLag %s invalid, must be a number of blocks", opt)
+		}
+		o.MaxLag = lag
+	}
+	return o, nil
+}
+
+// parseSubmitOptions reads the era, tip and resubmission options.
+func parseSubmitOptions(opts map[string]string) (substrate.SubmitOptions, error) {
+	o := substrate.SubmitOptions{Resubmits: DefaultResubmits}
+	if opt, ok := opts["eraPeriod"]; ok {
+		period, err := strconv.ParseUint(opt, 10, 64)
+		if err != nil {
+			return o, fmt.Errorf("eraPeriod %s invalid, must be a number of blocks", opt)
+		}
+		o.EraPeriod = period
+	}
+	for name, tip := range map[string]**big.Int{"tip": &o.Tip, "tipStep": &o.TipStep, "maxTip": &o.MaxTip} {
+		opt, ok := opts[name]
+		if !ok {
+			continue
+		}
+		amount, ok := new(big.Int).SetString(opt, 10)
+		if !ok || amount.Sign() < 0 {
+			return o, fmt.Errorf("%s %s invalid, must be an amount in the smallest unit", name, opt)
+		}
+		*tip = amount
+	}
+	if opt, ok := opts["resubmits"]; ok {
+		n, err := strconv.Atoi(opt)
+		if err != nil || n < 0 {
+			return o, fmt.Errorf("resubmits %s invalid, must be a number", opt)
+		}
+		o.Resubmits = n
+	}
+	return o, nil
+}
+
 func (c *Connection) Address() string {
 	return c.gc.Address()
 }
@@ -74,17 +177,46 @@ func (c *Connection) FinalizedBlockNumber() (uint64, error) {
 	return c.gc.GetFinalizedBlockNumber()
 }
 
+// SubscribeFinalizedHeads sends the number of every finalized head to heads until stop is closed,
+// see SarpcClient.SubscribeFinalizedHeads.
+func (c *Connection) SubscribeFinalizedHeads(heads chan<- uint64, stop <-chan int) error {
+	return c.sc.SubscribeFinalizedHeads(heads, HeadTimeout, stop)
+}
+
 func (c *Connection) GetEvents(blockNum uint64) ([]*substrate.ChainEvent, error) {
 	return c.sc.GetEvents(blockNum)
 }
 
+// FetchEvents fetches the undecoded events of a block, it may be called concurrently.
+func (c *Connection) FetchEvents(blockNum uint64) (*substrate.BlockEvents, error) {
+	return c.sc.FetchEvents(blockNum)
+}
+
+func (c *Connection) DecodeEvents(b *substrate.BlockEvents) ([]*substrate.ChainEvent, error) {
+	return c.sc.DecodeEvents(b)
+}
+
 // queryStorage performs a storage lookup. Arguments may be nil, result must be a pointer.
+// ExtrinsicHashes returns the hashes of the extrinsics of a block in their order.
+func (c *Connection) ExtrinsicHashes(blockNum uint64) ([]string, error) {
+	hash, err := c.sc.GetBlockHash(blockNum)
+	if err != nil {
+		return nil, err
+	}
+	return c.sc.ExtrinsicHashes(hash)
+}
+
 func (c *Connection) QueryStorage(prefix, method string, arg1, arg2 []byte, result interface{}) (bool, error) {
 	return c.gc.QueryStorage(prefix, method, arg1, arg2, result)
 }
 
+// QueryStorageRaw performs a storage lookup returning the encoded value, empty if there is none.
+func (c *Connection) QueryStorageRaw(prefix, method string, arg1, arg2 []byte) ([]byte, error) {
+	return c.gc.QueryStorageRaw(prefix, method, arg1, arg2)
+}
+
 func (c *Connection) checkChainId(expected msg.ChainId) error {
-	actual, err := c.gc.ChainId()
+	actual, err := c.gc.ChainId(c.pallet.name, c.pallet.chainIdentity)
 	if err != nil {
 		return err
 	}
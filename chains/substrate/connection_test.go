@@ -6,8 +6,10 @@ package substrate
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/shared/substrate"
 	"github.com/stafiprotocol/chainbridge/utils/core"
 	"github.com/stafiprotocol/chainbridge/utils/keystore"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
@@ -74,3 +76,51 @@ func newTestLogger(name string) log15.Logger {
 	tLog.SetHandler(log15.LvlFilterHandler(TestLogLevel, tLog.GetHandler()))
 	return tLog
 }
+
+func TestParseSubmitOptions(t *testing.T) {
+	o, err := parseSubmitOptions(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.EraPeriod != 0 || o.Tip != nil || o.Resubmits != DefaultResubmits {
+		t.Fatalf("unexpected defaults %+v", o)
+	}
+
+	o, err = parseSubmitOptions(map[string]string{"eraPeriod": "64", "tip": "1000", "tipStep": "500", "maxTip": "2000", "resubmits": "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.EraPeriod != 64 || o.Tip.Int64() != 1000 || o.TipStep.Int64() != 500 || o.MaxTip.Int64() != 2000 || o.Resubmits != 5 {
+		t.Fatalf("unexpected options %+v", o)
+	}
+
+	for _, opts := range []map[string]string{{"eraPeriod": "-1"}, {"tip": "0x10"}, {"maxTip": "-5"}, {"resubmits": "x"}} {
+		if _, err := parseSubmitOptions(opts); err == nil {
+			t.Fatalf("expected error for %v", opts)
+		}
+	}
+}
+
+func TestParseEndpointOptions(t *testing.T) {
+	o, err := parseEndpointOptions(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o != substrate.DefaultEndpointOptions() {
+		t.Fatalf("unexpected defaults %+v", o)
+	}
+
+	o, err = parseEndpointOptions(map[string]string{"healthInterval": "30s", "maxLag": "10", "maxLatency": "0", "staleAfter": "5m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.HealthInterval != 30*time.Second || o.MaxLag != 10 || o.MaxLatency != 0 || o.StaleAfter != 5*time.Minute {
+		t.Fatalf("unexpected options %+v", o)
+	}
+
+	for _, opts := range []map[string]string{{"healthInterval": "0s"}, {"maxLag": "-1"}, {"maxLatency": "5"}, {"staleAfter": "-1m"}} {
+		if _, err := parseEndpointOptions(opts); err == nil {
+			t.Fatalf("expected error for %v", opts)
+		}
+	}
+}
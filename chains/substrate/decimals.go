@@ -0,0 +1,104 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package substrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/go-substrate-rpc-client/types"
+)
+
+const DefaultAssetsPallet = "Assets"
+
+// storageQuerier looks up storage of the chain, implemented by Connection.
+type storageQuerier interface {
+	QueryStorage(prefix, method string, arg1, arg2 []byte, result interface{}) (bool, error)
+	QueryStorageRaw(prefix, method string, arg1, arg2 []byte) ([]byte, error)
+}
+
+// storageItem names a storage item of a pallet.
+type storageItem struct {
+	pallet string
+	name   string
+}
+
+// assetMetadata is the Metadata of a pallet-assets asset.
+type assetMetadata struct {
+	Deposit  types.U128
+	Name     types.Bytes
+	Symbol   types.Bytes
+	Decimals types.U8
+	IsFrozen types.Bool
+}
+
+// decimalsReader reads the decimals of tokens from the chain, from a storage map of the decimals
+// keyed by resourceId, or from the metadata of the pallet-assets asset a storage map keyed by
+// resourceId points to.
+type decimalsReader struct {
+	decimals *storageItem // map from resourceIds to decimals
+	assetIds *storageItem // map from resourceIds to asset ids
+	assets   string       // the assets pallet
+}
+
+// parseDecimalsReader reads the decimalsStorage, assetIdStorage and assetsPallet options. It
+// returns nil if decimals are not read from the chain.
+func parseDecimalsReader(opts map[string]string) (*decimalsReader, error) {
+	r := &decimalsReader{assets: DefaultAssetsPallet}
+	var err error
+	if opt, ok := opts["decimalsStorage"]; ok {
+		if r.decimals, err = parseStorageItem("decimalsStorage", opt); err != nil {
+			return nil, err
+		}
+	}
+	if opt, ok := opts["assetIdStorage"]; ok {
+		if r.assetIds, err = parseStorageItem("assetIdStorage", opt); err != nil {
+			return nil, err
+		}
+	}
+	if opt, ok := opts["assetsPallet"]; ok {
+		if opt == "" {
+			return nil, fmt.Errorf("assetsPallet empty")
+		}
+		r.assets = opt
+	}
+
+	switch {
+	case r.decimals != nil && r.assetIds != nil:
+		return nil, fmt.Errorf("decimalsStorage and assetIdStorage both given")
+	case r.decimals == nil && r.assetIds == nil:
+		return nil, nil
+	}
+	return r, nil
+}
+
+// parseStorageItem reads a storage item given like Pallet.Storage.
+func parseStorageItem(opt, value string) (*storageItem, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("%s %s invalid, must be like Pallet.Storage", opt, value)
+	}
+	return &storageItem{pallet: parts[0], name: parts[1]}, nil
+}
+
+// read returns the decimals of a token, and false if the chain does not hold the token.
+func (r *decimalsReader) read(q storageQuerier, rId msg.ResourceId) (uint8, bool, error) {
+	if r.decimals != nil {
+		var decimals types.U8
+		ok, err := q.QueryStorage(r.decimals.pallet, r.decimals.name, rId[:], nil, &decimals)
+		return uint8(decimals), ok, err
+	}
+
+	assetId, err := q.QueryStorageRaw(r.assetIds.pallet, r.assetIds.name, rId[:], nil)
+	if err != nil || len(assetId) == 0 {
+		return 0, false, err
+	}
+	var meta assetMetadata
+	ok, err := q.QueryStorage(r.assets, "Metadata", assetId, nil, &meta)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	return uint8(meta.Decimals), true, nil
+}
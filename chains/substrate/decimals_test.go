@@ -0,0 +1,91 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package substrate
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/go-substrate-rpc-client/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDecimalsReader(t *testing.T) {
+	r, err := parseDecimalsReader(map[string]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	r, err = parseDecimalsReader(map[string]string{"decimalsStorage": "BridgeCommon.Decimals"})
+	assert.NoError(t, err)
+	assert.Equal(t, &storageItem{pallet: "BridgeCommon", name: "Decimals"}, r.decimals)
+
+	r, err = parseDecimalsReader(map[string]string{"assetIdStorage": "BridgeCommon.AssetIds", "assetsPallet": "ForeignAssets"})
+	assert.NoError(t, err)
+	assert.Equal(t, &storageItem{pallet: "BridgeCommon", name: "AssetIds"}, r.assetIds)
+	assert.Equal(t, "ForeignAssets", r.assets)
+
+	for _, opts := range []map[string]string{
+		{"decimalsStorage": "Decimals"},
+		{"assetIdStorage": "BridgeCommon."},
+		{"decimalsStorage": "A.B", "assetIdStorage": "A.C"},
+		{"assetIdStorage": "A.C", "assetsPallet": ""},
+	} {
+		_, err := parseDecimalsReader(opts)
+		assert.Error(t, err, "%v", opts)
+	}
+}
+
+// fakeStorage holds encoded storage values by pallet, storage and keys.
+type fakeStorage struct {
+	values map[string][]byte
+	err    error
+}
+
+func (s *fakeStorage) QueryStorageRaw(prefix, method string, arg1, arg2 []byte) ([]byte, error) {
+	return s.values[prefix+"."+method+"."+string(arg1)+string(arg2)], s.err
+}
+
+func (s *fakeStorage) QueryStorage(prefix, method string, arg1, arg2 []byte, result interface{}) (bool, error) {
+	raw, err := s.QueryStorageRaw(prefix, method, arg1, arg2)
+	if err != nil || len(raw) == 0 {
+		return false, err
+	}
+	return true, types.DecodeFromBytes(raw, result)
+}
+
+func TestDecimalsReaderRead(t *testing.T) {
+	held := msg.ResourceIdFromSlice([]byte{1})
+	unknown := msg.ResourceIdFromSlice([]byte{2})
+	meta, err := types.EncodeToBytes(assetMetadata{Deposit: types.NewU128(*big.NewInt(0)), Name: types.Bytes("Token"), Symbol: types.Bytes("TKN"), Decimals: 12})
+	assert.NoError(t, err)
+	s := &fakeStorage{values: map[string][]byte{
+		"BridgeCommon.Decimals." + string(held[:]):      {18},
+		"BridgeCommon.AssetIds." + string(held[:]):      {7, 0, 0, 0},
+		"Assets.Metadata." + string([]byte{7, 0, 0, 0}): meta,
+	}}
+
+	r, _ := parseDecimalsReader(map[string]string{"decimalsStorage": "BridgeCommon.Decimals"})
+	decimals, ok, err := r.read(s, held)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(18), decimals)
+	_, ok, err = r.read(s, unknown)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	r, _ = parseDecimalsReader(map[string]string{"assetIdStorage": "BridgeCommon.AssetIds"})
+	decimals, ok, err = r.read(s, held)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(12), decimals)
+	_, ok, err = r.read(s, unknown)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	s.err = errors.New("connection reset")
+	_, _, err = r.read(s, held)
+	assert.Error(t, err)
+}
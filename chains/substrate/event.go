@@ -5,9 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"strings"
 
-	"github.com/shopspring/decimal"
 	"github.com/stafiprotocol/chainbridge/shared/substrate"
 
 	"github.com/ChainSafe/log15"
@@ -26,12 +24,29 @@ var (
 type eventName string
 type eventHandler func(interface{}, log15.Logger) (msg.Message, error)
 
+// eventDecoder reads the data passed to the handler of an event. It returns ErrorSkip for events
+// to ignore and a *rejectedEvent for events to reject.
+type eventDecoder func(*listener, *substrate.ChainEvent) (interface{}, error)
+
 const FungibleTransfer eventName = config.FungibleTransferEventId
 
+// Subscriptions are the events of the bridge pallet handled by the listener. The name of an event
+// in the pallet is configured per chain.
 var Subscriptions = []struct {
 	name    eventName
+	decoder eventDecoder
 	handler eventHandler
-}{{FungibleTransfer, fungibleTransferHandler}}
+}{{FungibleTransfer, decodeFungibleTransfer, fungibleTransferHandler}}
+
+// rejectedEvent is an event whose message is rejected rather than relayed.
+type rejectedEvent struct {
+	m   msg.Message
+	err error
+}
+
+func (e *rejectedEvent) Error() string {
+	return e.err.Error()
+}
 
 func fungibleTransferHandler(evtI interface{}, log log15.Logger) (msg.Message, error) {
 	evt, ok := evtI.(*EventFungibleTransfer)
@@ -46,45 +61,57 @@ func fungibleTransferHandler(evtI interface{}, log log15.Logger) (msg.Message, e
 		0,
 		msg.ChainId(evt.Destination),
 		msg.Nonce(evt.DepositNonce),
-		evt.Decimal.Mul(decimal.NewFromBigInt(evt.Amount, 0)).BigInt(),
+		evt.Amount,
 		resourceId,
 		evt.Recipient,
 	), nil
 }
 
-// FungibleTransfer(AccountId, ChainId, DepositNonce, ResourceId, U256, Vec<u8>)
-func (l *listener) FungibleTransferEventData(evt *substrate.ChainEvent, decimals map[string]decimal.Decimal) (*EventFungibleTransfer, error) {
-	if len(evt.Params) != 6 {
-		return nil, fmt.Errorf("EventFungibleTransfer params number not right: %d, expected: 6", len(evt.Params))
+// decodeFungibleTransfer decodes a FungibleTransfer event. A transfer whose recipient cannot be
+// read is rejected.
+func decodeFungibleTransfer(l *listener, evt *substrate.ChainEvent) (interface{}, error) {
+	data, err := l.FungibleTransferEventData(evt)
+	if err != nil && data != nil {
+		m := msg.NewFungibleTransfer(l.chainId, msg.ChainId(data.Destination), msg.Nonce(data.DepositNonce),
+			data.Amount, data.ResourceId, nil)
+		return nil, &rejectedEvent{m: m, err: err}
 	}
-
-	chainId, err := parseChainId(evt.Params[1])
 	if err != nil {
-		return nil, fmt.Errorf("EventFungibleTransfer params[1] -> chainId error: %s", err)
+		return nil, err
 	}
+	return data, nil
+}
 
-	if !l.router.SupportChainId(msg.ChainId(chainId)) {
-		return nil, ErrorSkip
+// FungibleTransfer(AccountId, ChainId, DepositNonce, ResourceId, U256, Vec<u8>) with the stafi
+// layout, the positions of the arguments are taken from the transfer layout of the pallet.
+func (l *listener) FungibleTransferEventData(evt *substrate.ChainEvent) (*EventFungibleTransfer, error) {
+	layout := l.conn.pallet.layout
+	if len(evt.Params) != layout.params {
+		return nil, fmt.Errorf("EventFungibleTransfer params number not right: %d, expected: %d", len(evt.Params), layout.params)
 	}
 
-	nonce, err := parseDepositNonce(evt.Params[2])
+	chainId, err := parseChainId(evt.Params[layout.chainId])
 	if err != nil {
-		return nil, fmt.Errorf("EventFungibleTransfer params[1] -> chainId error: %s", err)
+		return nil, fmt.Errorf("EventFungibleTransfer params[%d] -> chainId error: %s", layout.chainId, err)
+	}
+
+	if !l.router.SupportChainId(msg.ChainId(chainId)) {
+		return nil, ErrorSkip
 	}
 
-	resourceId, err := parseBytes(evt.Params[3].Value)
+	nonce, err := parseDepositNonce(evt.Params[layout.nonce])
 	if err != nil {
-		return nil, fmt.Errorf("EventFungibleTransfer params[3] -> resourceId error: %s", err)
+		return nil, fmt.Errorf("EventFungibleTransfer params[%d] -> nonce error: %s", layout.nonce, err)
 	}
 
-	amount, err := parseU256(evt.Params[4].Value)
+	resourceId, err := parseBytes(evt.Params[layout.resourceId].Value)
 	if err != nil {
-		return nil, fmt.Errorf("EventFungibleTransfer params[4] -> amount error: %s", err)
+		return nil, fmt.Errorf("EventFungibleTransfer params[%d] -> resourceId error: %s", layout.resourceId, err)
 	}
 
-	rec, err := parseBytes(evt.Params[5].Value)
+	amount, err := parseU256(evt.Params[layout.amount].Value)
 	if err != nil {
-		return nil, fmt.Errorf("EventFungibleTransfer params[5] -> recipient error: %s", err)
+		return nil, fmt.Errorf("EventFungibleTransfer params[%d] -> amount error: %s", layout.amount, err)
 	}
 
 	eft := &EventFungibleTransfer{
@@ -92,19 +119,13 @@ func (l *listener) FungibleTransferEventData(evt *substrate.ChainEvent, decimals
 		DepositNonce: nonce,
 		ResourceId:   msg.ResourceIdFromSlice(resourceId),
 		Amount:       amount,
-		Recipient:    rec,
-	}
-	//should not have 0x prefix and length must 64
-	resourceIdStr := strings.ToLower(eft.ResourceId.Hex())
-	if len(resourceIdStr) != 64 {
-		return nil, fmt.Errorf("resourceId  length  must be 64")
 	}
 
-	decimal, ok := decimals[resourceIdStr]
-	if !ok {
-		return nil, fmt.Errorf("failed to get decimal")
+	// the transfer is returned without recipient so that it can be recorded as dead
+	eft.Recipient, err = parseBytes(evt.Params[layout.recipient].Value)
+	if err != nil {
+		return eft, fmt.Errorf("EventFungibleTransfer params[%d] -> recipient error: %s", layout.recipient, err)
 	}
-	eft.Decimal = decimal
 	return eft, nil
 }
 
@@ -7,30 +7,32 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/shopspring/decimal"
-	"github.com/stafiprotocol/chainbridge/config"
-
 	"github.com/ChainSafe/log15"
 	"github.com/stafiprotocol/chainbridge/chains"
+	"github.com/stafiprotocol/chainbridge/shared/substrate"
 	"github.com/stafiprotocol/chainbridge/utils/blockstore"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
 )
 
 type listener struct {
-	name          string
-	chainId       msg.ChainId
-	startBlock    uint64
-	blockstore    blockstore.Blockstorer
-	conn          *Connection
-	subscriptions map[eventName]eventHandler // Handlers for specific events
-	router        chains.Router
-	log           log15.Logger
-	stop          <-chan int
-	sysErr        chan<- error
-	decimals      map[string]decimal.Decimal
+	name           string
+	chainId        msg.ChainId
+	startBlock     uint64
+	blockstore     blockstore.Blockstorer
+	conn           *Connection
+	subscriptions  map[eventName]eventHandler // Handlers for specific events
+	decoders       map[eventName]eventDecoder // Decoders of the data of specific events
+	router         chains.Router
+	log            log15.Logger
+	stop           <-chan int
+	sysErr         chan<- error
+	processed      atomic.Uint64 // last block processed
+	subscribeHeads bool          // follow the finalized head subscription instead of polling
+	prefetch       *prefetcher   // fetches upcoming blocks concurrently, nil to fetch one at a time
 }
 
 var (
@@ -40,10 +42,14 @@ var (
 
 	EventRetryLimit    = 20
 	EventRetryInterval = 100 * time.Millisecond
+
+	// Finalized head subscription
+	HeadTimeout         = time.Minute     // the subscription is dropped if no head arrives within
+	ResubscribeInterval = 5 * time.Minute // time spent polling before subscribing again
 )
 
 func NewListener(conn *Connection, name string, id msg.ChainId, startBlock uint64, log log15.Logger,
-	bs blockstore.Blockstorer, stop <-chan int, sysErr chan<- error, decimals map[string]decimal.Decimal) *listener {
+	bs blockstore.Blockstorer, stop <-chan int, sysErr chan<- error) *listener {
 	return &listener{
 		name:          name,
 		chainId:       id,
@@ -51,13 +57,23 @@ func NewListener(conn *Connection, name string, id msg.ChainId, startBlock uint6
 		blockstore:    bs,
 		conn:          conn,
 		subscriptions: make(map[eventName]eventHandler),
+		decoders:      make(map[eventName]eventDecoder),
 		log:           log,
 		stop:          stop,
 		sysErr:        sysErr,
-		decimals:      decimals,
 	}
 }
 
+// lag returns how many blocks the listener is behind latest, 0 before the first block was
+// processed.
+func (l *listener) lag(latest uint64) uint64 {
+	processed := l.processed.Load()
+	if processed == 0 || latest <= processed {
+		return 0
+	}
+	return latest - processed
+}
+
 func (l *listener) setRouter(r chains.Router) {
 	l.router = r
 }
@@ -74,11 +90,9 @@ func (l *listener) start() error {
 		return fmt.Errorf("starting block (%d) is greater than latest known block (%d)", l.startBlock, latest)
 	}
 
-	for _, sub := range Subscriptions {
-		err := l.registerEventHandler(sub.name, sub.handler)
-		if err != nil {
-			return err
-		}
+	err = l.registerSubscriptions()
+	if err != nil {
+		return err
 	}
 
 	go func() {
@@ -91,6 +105,18 @@ func (l *listener) start() error {
 	return nil
 }
 
+// registerSubscriptions enables the decoders and handlers of Subscriptions.
+func (l *listener) registerSubscriptions() error {
+	for _, sub := range Subscriptions {
+		err := l.registerEventHandler(sub.name, sub.handler)
+		if err != nil {
+			return err
+		}
+		l.decoders[sub.name] = sub.decoder
+	}
+	return nil
+}
+
 // registerEventHandler enables a handler for a given event. This cannot be used after Start is called.
 func (l *listener) registerEventHandler(name eventName, handler eventHandler) error {
 	if l.subscriptions[name] != nil {
@@ -102,15 +128,27 @@ func (l *listener) registerEventHandler(name eventName, handler eventHandler) er
 
 // pollBlocks will poll for the latest block and proceed to parse the associated events as it sees new blocks.
 // Polling begins at the block defined in `l.startBlock`. Failed attempts to fetch the latest block or parse
-// a block will be retried up to BlockRetryLimit times before returning with an error.
+// a block will be retried up to BlockRetryLimit times before returning with an error. If subscribeHeads is
+// set the listener follows the finalized head subscription instead and only polls while it is unavailable.
 func (l *listener) pollBlocks() error {
 	var currentBlock = l.startBlock
 	var retry = BlockRetryLimit
+	var resubscribe time.Time
 	for {
 		select {
 		case <-l.stop:
 			return errors.New("terminated")
 		default:
+			if l.subscribeHeads && !time.Now().Before(resubscribe) {
+				err := l.followHeads(&currentBlock)
+				if err == nil {
+					return errors.New("terminated")
+				}
+				l.log.Warn("Finalized head subscription failed, polling", "block", currentBlock, "err", err)
+				resubscribe = time.Now().Add(ResubscribeInterval)
+				continue
+			}
+
 			// No more retries, goto next block
 			if retry == 0 {
 				l.sysErr <- fmt.Errorf("event polling retries exceeded (chain=%d, name=%s)", l.chainId, l.name)
@@ -134,32 +172,126 @@ func (l *listener) pollBlocks() error {
 				continue
 			}
 
-			err = l.processEvents(currentBlock)
+			err = l.processBlock(currentBlock, finalized)
 			if err != nil {
 				l.log.Error("Failed to process events in block", "block", currentBlock, "err", err)
 				retry--
 				continue
 			}
 
-			// Write to blockstore
-			err = l.blockstore.StoreBlock(big.NewInt(0).SetUint64(currentBlock))
-			if err != nil {
-				l.log.Error("Failed to write to blockstore", "err", err)
-			}
-
 			currentBlock++
 			retry = BlockRetryLimit
 		}
 	}
 }
 
-// processEvents fetches a block and parses out the events, calling Listener.handleEvents()
-func (l *listener) processEvents(blockNum uint64) error {
+// followHeads processes the blocks up to every finalized head announced by the subscription,
+// including the blocks between heads that were not announced. It advances currentBlock and
+// returns nil once the listener is stopped, or the error that ended the subscription.
+func (l *listener) followHeads(currentBlock *uint64) error {
+	heads := make(chan uint64)
+	subErr := make(chan error, 1)
+	unsubscribe := make(chan int)
+	defer close(unsubscribe)
+	go func() {
+		subErr <- l.conn.SubscribeFinalizedHeads(heads, unsubscribe)
+	}()
+	l.log.Info("Following finalized heads", "block", *currentBlock)
+
+	for {
+		select {
+		case <-l.stop:
+			return nil
+		case err := <-subErr:
+			if err == nil {
+				err = errors.New("subscription ended")
+			}
+			return err
+		case head := <-heads:
+			for ; *currentBlock <= head; *currentBlock++ {
+				select {
+				case <-l.stop:
+					return nil
+				default:
+				}
+				err := l.processBlock(*currentBlock, head)
+				if err != nil {
+					return fmt.Errorf("block %d: %s", *currentBlock, err)
+				}
+			}
+		}
+	}
+}
+
+// processBlock processes the events of a finalized block and stores it in the blockstore. Blocks
+// up to finalized may be prefetched.
+func (l *listener) processBlock(block, finalized uint64) error {
+	err := l.processEvents(block, finalized)
+	if err != nil {
+		return err
+	}
+
+	// Write to blockstore, without the hash as only finalized blocks are processed and never rewound
+	err = l.blockstore.StoreBlock(big.NewInt(0).SetUint64(block), "")
+	if err != nil {
+		l.log.Error("Failed to write to blockstore", "err", err)
+	}
+	l.processed.Store(block)
+	return nil
+}
+
+// backfill processes the events of the finalized blocks from to to, both included, without
+// updating the blockstore. Failed blocks are retried as when polling.
+func (l *listener) backfill(from, to uint64) error {
+	finalized, err := l.conn.FinalizedBlockNumber()
+	if err != nil {
+		return err
+	}
+	if to > finalized {
+		return fmt.Errorf("block %d is not finalized yet, latest finalized block is %d", to, finalized)
+	}
+
+	if len(l.subscriptions) == 0 {
+		err = l.registerSubscriptions()
+		if err != nil {
+			return err
+		}
+	}
+
+	for block := from; block <= to; block++ {
+		retry := BlockRetryLimit
+		for {
+			select {
+			case <-l.stop:
+				return errors.New("backfill terminated")
+			default:
+			}
+			err = l.processEvents(block, to)
+			if err == nil {
+				break
+			}
+			retry--
+			if retry == 0 {
+				return fmt.Errorf("block %d: %s", block, err)
+			}
+			l.log.Error("Failed to process events in block", "block", block, "err", err)
+			time.Sleep(BlockRetryInterval)
+		}
+		if block%100 == 0 {
+			l.log.Info("Backfilling", "block", block, "to", to)
+		}
+	}
+	return nil
+}
+
+// processEvents fetches a block and parses out the events, calling Listener.handleEvents(). With a
+// prefetcher the blocks after it up to limit are fetched meanwhile.
+func (l *listener) processEvents(blockNum, limit uint64) error {
 	if blockNum%100 == 0 {
 		l.log.Debug("processEvents", "blockNum", blockNum)
 	}
 
-	evts, err := l.conn.GetEvents(blockNum)
+	evts, err := l.getEvents(blockNum, limit)
 	if err != nil {
 		l.log.Warn("processEvents GetEvents error, will retry", "err", err)
 		for i := 0; i < EventRetryLimit; i++ {
@@ -174,16 +306,36 @@ func (l *listener) processEvents(blockNum uint64) error {
 		}
 	}
 
+	// the hashes of the extrinsics emitting deposits, fetched before any deposit is routed so
+	// that failing to fetch them retries the whole block
+	var extrinsics []string
+	for _, evt := range evts {
+		name, ok := l.conn.pallet.event(evt.ModuleId, evt.EventId)
+		if ok && l.subscriptions[name] != nil {
+			extrinsics, err = l.conn.ExtrinsicHashes(blockNum)
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+
 	for _, evt := range evts {
-		if evt.ModuleId != config.BridgeCommon || evt.EventId != config.FungibleTransferEventId {
+		name, ok := l.conn.pallet.event(evt.ModuleId, evt.EventId)
+		if !ok || l.subscriptions[name] == nil {
 			continue
 		}
+		txHash := extrinsicHash(extrinsics, evt)
 
-		data, err := l.FungibleTransferEventData(evt, l.decimals)
+		data, err := l.decoders[name](l, evt)
 		if err != nil {
+			var rejected *rejectedEvent
 			switch {
-			case strings.Contains(err.Error(), "recipient error"):
-				l.log.Warn("recipient err, will skip ", "blockNumber", blockNum, "eventId", evt.EventId)
+			case errors.As(err, &rejected):
+				l.log.Warn("event rejected, will skip", "blockNumber", blockNum, "eventId", evt.EventId, "err", err)
+				rejected.m.Block = blockNum
+				rejected.m.TxHash = txHash
+				l.router.Reject(rejected.m, err.Error())
 				continue
 			case err == ErrorSkip:
 				l.log.Warn("will skip", "blockNumber", blockNum, "eventId", evt.EventId, "err", err)
@@ -192,19 +344,37 @@ func (l *listener) processEvents(blockNum uint64) error {
 
 			return err
 		}
-		//skip event if not support chainId
-		if !l.router.SupportChainId(msg.ChainId(data.Destination)) {
-			continue
-		}
 
-		if l.subscriptions[FungibleTransfer] != nil {
-			l.submitMessage(l.subscriptions[FungibleTransfer](data, l.log))
-		}
+		m, err := l.subscriptions[name](data, l.log)
+		m.Block = blockNum
+		m.TxHash = txHash
+		l.submitMessage(m, err)
 	}
 
 	return nil
 }
 
+// extrinsicHash returns the hash of the extrinsic that emitted evt, or an empty string if evt
+// was not emitted by an extrinsic.
+func extrinsicHash(extrinsics []string, evt *substrate.ChainEvent) string {
+	if evt.Phase != 0 || evt.ExtrinsicIdx < 0 || evt.ExtrinsicIdx >= len(extrinsics) {
+		return ""
+	}
+	return extrinsics[evt.ExtrinsicIdx]
+}
+
+// getEvents returns the events of a block, from the prefetcher if the listener has one.
+func (l *listener) getEvents(blockNum, limit uint64) ([]*substrate.ChainEvent, error) {
+	if l.prefetch == nil {
+		return l.conn.GetEvents(blockNum)
+	}
+	b, err := l.prefetch.get(blockNum, limit)
+	if err != nil {
+		return nil, err
+	}
+	return l.conn.DecodeEvents(b)
+}
+
 // submitMessage inserts the chainId into the msg and sends it to the router
 func (l *listener) submitMessage(m msg.Message, err error) {
 	if err != nil {
@@ -212,8 +382,11 @@ func (l *listener) submitMessage(m msg.Message, err error) {
 		return
 	}
 	m.Source = l.chainId
+	_, span := tracing.StartTransfer(m, tracing.SpanDeposit, tracing.Endpoint(l.conn.url))
+	defer span.End()
 	err = l.router.Send(m)
 	if err != nil {
-		l.log.Error("failed to process event", "err", err)
+		l.log.Error("failed to process event", append(m.LogContext(), "err", err)...)
+		tracing.Fail(span, err)
 	}
 }
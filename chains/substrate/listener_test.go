@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stafiprotocol/chainbridge/shared/substrate"
 	"github.com/stafiprotocol/chainbridge/utils/blockstore"
 	"github.com/stretchr/testify/assert"
 )
@@ -20,7 +21,7 @@ func TestListener_start(t *testing.T) {
 	stop := make(chan int)
 	conn, err := NewConnection(seiyaCfg, AliceTestLogger, stop)
 	assert.NoError(t, err)
-	l := NewListener(conn, "stafi", ThisChain, 100000, AliceTestLogger, &blockstore.EmptyStore{}, stop, errs, nil)
+	l := NewListener(conn, "stafi", ThisChain, 100000, AliceTestLogger, &blockstore.EmptyStore{}, stop, errs)
 	err = l.start()
 	assert.NoError(t, err)
 
@@ -44,7 +45,7 @@ func TestSeiya(t *testing.T) {
 
 	t.Log(len(evts))
 	//assert.NoError(t, err)
-	//l := NewListener(conn, "stafi", ThisChain, 2963178, AliceTestLogger, &blockstore.EmptyStore{}, stop, errs, nil)
+	//l := NewListener(conn, "stafi", ThisChain, 2963178, AliceTestLogger, &blockstore.EmptyStore{}, stop, errs)
 	//err = l.start()
 	//assert.NoError(t, err)
 	//
@@ -59,9 +60,17 @@ func TestSeiya1(t *testing.T) {
 	conn, err := NewConnection(seiyaCfg, AliceTestLogger, stop)
 
 	assert.NoError(t, err)
-	l := NewListener(conn, "stafi", ThisChain, 2963177, AliceTestLogger, &blockstore.EmptyStore{}, stop, errs, nil)
+	l := NewListener(conn, "stafi", ThisChain, 2963177, AliceTestLogger, &blockstore.EmptyStore{}, stop, errs)
 	err = l.start()
 	assert.NoError(t, err)
 
 	<-time.After(30 * time.Minute)
 }
+
+func TestExtrinsicHash(t *testing.T) {
+	extrinsics := []string{"0xaa", "0xbb"}
+	assert.Equal(t, "0xbb", extrinsicHash(extrinsics, &substrate.ChainEvent{Phase: 0, ExtrinsicIdx: 1}))
+	assert.Equal(t, "", extrinsicHash(extrinsics, &substrate.ChainEvent{Phase: 1, ExtrinsicIdx: 1}))
+	assert.Equal(t, "", extrinsicHash(extrinsics, &substrate.ChainEvent{Phase: 0, ExtrinsicIdx: 2}))
+	assert.Equal(t, "", extrinsicHash(nil, &substrate.ChainEvent{Phase: 0, ExtrinsicIdx: 0}))
+}
@@ -4,21 +4,18 @@ import (
 	"fmt"
 	"math/big"
 
-	"github.com/shopspring/decimal"
+	"github.com/stafiprotocol/chainbridge/shared/substrate"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
 	"github.com/stafiprotocol/go-substrate-rpc-client/scale"
 	"github.com/stafiprotocol/go-substrate-rpc-client/types"
 )
 
-var decimalDefault = "Default"
-
 type EventFungibleTransfer struct {
 	Destination  uint8
 	DepositNonce uint64
 	ResourceId   msg.ResourceId
 	Amount       *big.Int
 	Recipient    []byte
-	Decimal      decimal.Decimal
 }
 
 type ChainIdParam struct {
@@ -74,6 +71,13 @@ type proposal struct {
 	SourceId     types.U8      `json:"sourceId"`
 	ResourceId   types.Bytes32 `json:"resourceId"`
 	Method       string        `json:"method"`
+
+	runtime *substrate.Runtime // the runtime Call is encoded for
+}
+
+// acknowledgeCall returns the call acknowledging p, the method of the bridge pallet
+func (p *proposal) acknowledgeCall(meta *types.Metadata, method string) (types.Call, error) {
+	return types.NewCall(meta, method, p.DepositNonce, p.SourceId, p.ResourceId, p.Call)
 }
 
 // encode takes only nonce and call and encodes them for storage queries
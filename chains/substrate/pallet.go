@@ -0,0 +1,130 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package substrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stafiprotocol/chainbridge/config"
+)
+
+// Argument layouts of the FungibleTransfer event of known bridge pallets. Arguments not read by
+// the listener, like the depositor, are given any other name.
+var TransferLayouts = map[string]string{
+	"stafi":       "depositor,chainId,nonce,resourceId,amount,recipient",
+	"chainbridge": "chainId,nonce,resourceId,amount,recipient",
+}
+
+// pallet names the bridge pallet of a chain and the items of it the relayer uses.
+type pallet struct {
+	name          string               // the pallet, like BridgeCommon
+	events        map[eventName]string // names of the subscribed events in the pallet
+	acknowledge   string               // call acknowledging a proposal
+	resources     string               // storage map of the resources
+	votes         string               // storage double map of the votes on proposals
+	chainIdentity string               // constant holding the chain id
+	layout        transferLayout       // arguments of the FungibleTransfer event
+}
+
+// transferLayout holds the positions of the arguments of a FungibleTransfer event.
+type transferLayout struct {
+	params     int // number of arguments
+	chainId    int
+	nonce      int
+	resourceId int
+	amount     int
+	recipient  int
+}
+
+// call returns the name of a call of the pallet as used by types.NewCall.
+func (p *pallet) call(name string) string {
+	return p.name + "." + name
+}
+
+// event returns the subscription handling an event, if the event is one of the pallet's
+// subscribed events.
+func (p *pallet) event(moduleId, eventId string) (eventName, bool) {
+	if moduleId != p.name {
+		return "", false
+	}
+	for name, id := range p.events {
+		if id == eventId {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// parsePallet reads the pallet options of a chain, defaulting to the stafi BridgeCommon pallet.
+func parsePallet(opts map[string]string) (*pallet, error) {
+	transferEvent := config.FungibleTransferEventId
+	p := &pallet{
+		name:          config.BridgeCommon,
+		acknowledge:   strings.TrimPrefix(config.AcknowledgeProposal, config.BridgeCommon+"."),
+		resources:     "Resources",
+		votes:         "Votes",
+		chainIdentity: config.ChainIdentity,
+	}
+	for opt, field := range map[string]*string{
+		"bridgePallet":     &p.name,
+		"transferEvent":    &transferEvent,
+		"acknowledgeCall":  &p.acknowledge,
+		"resourcesStorage": &p.resources,
+		"votesStorage":     &p.votes,
+		"chainIdConstant":  &p.chainIdentity,
+	} {
+		if value, ok := opts[opt]; ok {
+			if value == "" {
+				return nil, fmt.Errorf("%s empty", opt)
+			}
+			*field = value
+		}
+	}
+	p.events = map[eventName]string{FungibleTransfer: transferEvent}
+
+	layout := opts["transferLayout"]
+	if layout == "" {
+		layout = "stafi"
+	}
+	if known, ok := TransferLayouts[layout]; ok {
+		layout = known
+	}
+	var err error
+	p.layout, err = parseTransferLayout(layout)
+	if err != nil {
+		return nil, fmt.Errorf("transferLayout %s invalid: %s", opts["transferLayout"], err)
+	}
+	return p, nil
+}
+
+// parseTransferLayout reads a comma separated list naming the arguments of the event in order.
+func parseTransferLayout(s string) (transferLayout, error) {
+	names := strings.Split(s, ",")
+	l := transferLayout{params: len(names)}
+	positions := map[string]*int{
+		"chainId":    &l.chainId,
+		"nonce":      &l.nonce,
+		"resourceId": &l.resourceId,
+		"amount":     &l.amount,
+		"recipient":  &l.recipient,
+	}
+	found := make(map[string]bool)
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if pos, ok := positions[name]; ok {
+			if found[name] {
+				return l, fmt.Errorf("%s given twice", name)
+			}
+			*pos = i
+			found[name] = true
+		}
+	}
+	for name := range positions {
+		if !found[name] {
+			return l, fmt.Errorf("%s missing", name)
+		}
+	}
+	return l, nil
+}
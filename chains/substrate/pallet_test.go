@@ -0,0 +1,99 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package substrate
+
+import (
+	"math/big"
+	"testing"
+
+	scalecodec "github.com/itering/scale.go"
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/shared/substrate"
+	"github.com/stafiprotocol/chainbridge/utils/journal"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePallet(t *testing.T) {
+	p, err := parsePallet(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, config.AcknowledgeProposal, p.call(p.acknowledge))
+	name, ok := p.event(config.BridgeCommon, config.FungibleTransferEventId)
+	assert.True(t, ok)
+	assert.Equal(t, FungibleTransfer, name)
+	assert.Equal(t, transferLayout{params: 6, chainId: 1, nonce: 2, resourceId: 3, amount: 4, recipient: 5}, p.layout)
+
+	p, err = parsePallet(map[string]string{"bridgePallet": "ChainBridge", "transferEvent": "FungibleTransferV2",
+		"acknowledgeCall": "acknowledge", "votesStorage": "ProposalVotes", "transferLayout": "chainbridge"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ChainBridge.acknowledge", p.call(p.acknowledge))
+	assert.Equal(t, "ProposalVotes", p.votes)
+	assert.Equal(t, "Resources", p.resources)
+	_, ok = p.event(config.BridgeCommon, config.FungibleTransferEventId)
+	assert.False(t, ok)
+	_, ok = p.event("ChainBridge", "FungibleTransferV2")
+	assert.True(t, ok)
+	assert.Equal(t, transferLayout{params: 5, chainId: 0, nonce: 1, resourceId: 2, amount: 3, recipient: 4}, p.layout)
+
+	p, err = parsePallet(map[string]string{"transferLayout": "nonce,chainId,fee,resourceId,amount,recipient,data"})
+	assert.NoError(t, err)
+	assert.Equal(t, transferLayout{params: 7, chainId: 1, nonce: 0, resourceId: 3, amount: 4, recipient: 5}, p.layout)
+
+	for _, opts := range []map[string]string{
+		{"bridgePallet": ""},
+		{"transferLayout": "chainId,nonce,resourceId,amount"},
+		{"transferLayout": "chainId,nonce,nonce,resourceId,amount,recipient"},
+	} {
+		_, err := parsePallet(opts)
+		assert.Error(t, err, "%v", opts)
+	}
+}
+
+// supportRouter supports the destinations it holds
+type supportRouter map[msg.ChainId]bool
+
+func (r supportRouter) Send(msg.Message) error                 { return nil }
+func (r supportRouter) SupportChainId(id msg.ChainId) bool     { return r[id] }
+func (r supportRouter) Reject(msg.Message, string)             {}
+func (r supportRouter) DeadLetter(msg.Message, string)         {}
+func (r supportRouter) Journal(*journal.Record)                {}
+func (r supportRouter) Processed(message msg.Message, ok bool) {}
+
+func TestFungibleTransferEventDataLayout(t *testing.T) {
+	p, err := parsePallet(map[string]string{"transferLayout": "chainbridge"})
+	assert.NoError(t, err)
+	l := &listener{conn: &Connection{pallet: p}, chainId: 1, router: supportRouter{2: true}}
+
+	evt := &substrate.ChainEvent{Params: []scalecodec.EventParam{
+		{Type: "ChainId", Value: 2},
+		{Type: "DepositNonce", Value: 7},
+		{Type: "ResourceId", Value: "0x000000000000000000000000000000a9e0095b8965c01e6a09c97938f3860901"},
+		{Type: "U256", Value: "0x0a00000000000000000000000000000000000000000000000000000000000000"},
+		{Type: "Bytes", Value: "0x1234"},
+	}}
+	data, err := decodeFungibleTransfer(l, evt)
+	assert.NoError(t, err)
+	eft := data.(*EventFungibleTransfer)
+	assert.Equal(t, uint8(2), eft.Destination)
+	assert.Equal(t, uint64(7), eft.DepositNonce)
+	assert.Equal(t, big.NewInt(10), eft.Amount)
+	assert.Equal(t, []byte{0x12, 0x34}, eft.Recipient)
+
+	// a recipient that cannot be read rejects the transfer
+	evt.Params[4].Value = 5
+	_, err = decodeFungibleTransfer(l, evt)
+	var rejected *rejectedEvent
+	assert.ErrorAs(t, err, &rejected)
+	assert.Equal(t, msg.Nonce(7), rejected.m.DepositNonce)
+
+	// unsupported destinations are skipped
+	l.router = supportRouter{}
+	_, err = decodeFungibleTransfer(l, evt)
+	assert.Equal(t, ErrorSkip, err)
+
+	// the stafi layout expects the depositor first
+	l.conn.pallet.layout, _ = parseTransferLayout(TransferLayouts["stafi"])
+	_, err = decodeFungibleTransfer(l, evt)
+	assert.Error(t, err)
+}
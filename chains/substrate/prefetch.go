@@ -0,0 +1,76 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package substrate
+
+import (
+	"github.com/stafiprotocol/chainbridge/shared/substrate"
+)
+
+// Blocks scheduled ahead of the listener per concurrent fetch
+var PrefetchDepth = 4
+
+// fetched is a block whose events are being fetched.
+type fetched struct {
+	block  uint64
+	events *substrate.BlockEvents
+	err    error
+	done   chan struct{}
+}
+
+// prefetcher fetches the events of the blocks following the one the listener processes
+// concurrently, so catching up is not bound by the latency of one block at a time. The listener
+// still takes the blocks one by one and in order.
+type prefetcher struct {
+	fetch  func(block uint64) (*substrate.BlockEvents, error)
+	slots  chan struct{} // limits the concurrent fetches
+	window int           // blocks scheduled ahead
+	queue  []*fetched    // scheduled blocks, in order
+	next   uint64        // next block to schedule
+}
+
+func newPrefetcher(fetch func(block uint64) (*substrate.BlockEvents, error), concurrency int) *prefetcher {
+	return &prefetcher{
+		fetch:  fetch,
+		slots:  make(chan struct{}, concurrency),
+		window: concurrency * PrefetchDepth,
+	}
+}
+
+// get returns the events of block, scheduling the blocks after it up to limit. If block is not
+// the one following the previous call, the scheduled blocks are dropped. After an error the
+// scheduled blocks are dropped as well, so block is fetched again by the next call.
+func (p *prefetcher) get(block, limit uint64) (*substrate.BlockEvents, error) {
+	if len(p.queue) == 0 || p.queue[0].block != block {
+		p.queue = nil
+		p.next = block
+	}
+	for len(p.queue) < p.window && p.next <= limit {
+		p.queue = append(p.queue, p.schedule(p.next))
+		p.next++
+	}
+	if len(p.queue) == 0 {
+		// block is beyond limit, fetch it alone
+		return p.fetch(block)
+	}
+
+	f := p.queue[0]
+	<-f.done
+	if f.err != nil {
+		p.queue = nil
+		return nil, f.err
+	}
+	p.queue = p.queue[1:]
+	return f.events, nil
+}
+
+func (p *prefetcher) schedule(block uint64) *fetched {
+	f := &fetched{block: block, done: make(chan struct{})}
+	go func() {
+		p.slots <- struct{}{}
+		f.events, f.err = p.fetch(block)
+		<-p.slots
+		close(f.done)
+	}()
+	return f
+}
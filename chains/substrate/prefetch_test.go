@@ -0,0 +1,81 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package substrate
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stafiprotocol/chainbridge/shared/substrate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefetcherOrderAndConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	var lock sync.Mutex
+	fetchedBlocks := make(map[uint64]int)
+	p := newPrefetcher(func(block uint64) (*substrate.BlockEvents, error) {
+		n := running.Add(1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		// later blocks finish first
+		time.Sleep(time.Duration(20-block%20) * time.Millisecond)
+		running.Add(-1)
+		lock.Lock()
+		fetchedBlocks[block]++
+		lock.Unlock()
+		return &substrate.BlockEvents{Number: block}, nil
+	}, 3)
+
+	for block := uint64(0); block < 30; block++ {
+		b, err := p.get(block, 29)
+		assert.NoError(t, err)
+		assert.Equal(t, block, b.Number)
+	}
+	assert.Equal(t, int32(3), peak.Load())
+	assert.Len(t, fetchedBlocks, 30)
+	for block, n := range fetchedBlocks {
+		assert.Equal(t, 1, n, "block %d", block)
+	}
+	// nothing is scheduled beyond the limit
+	assert.Empty(t, p.queue)
+}
+
+func TestPrefetcherRefetchAfterError(t *testing.T) {
+	var calls atomic.Int32
+	p := newPrefetcher(func(block uint64) (*substrate.BlockEvents, error) {
+		if block == 5 && calls.Add(1) == 1 {
+			return nil, errors.New("connection reset")
+		}
+		return &substrate.BlockEvents{Number: block}, nil
+	}, 2)
+
+	for block := uint64(0); block < 5; block++ {
+		_, err := p.get(block, 10)
+		assert.NoError(t, err)
+	}
+	_, err := p.get(5, 10)
+	assert.Error(t, err)
+	b, err := p.get(5, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), b.Number)
+
+	// skipping ahead drops the scheduled blocks
+	b, err = p.get(20, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(20), b.Number)
+	assert.Equal(t, uint64(21), p.queue[0].block)
+
+	// beyond the limit the block is fetched alone
+	b, err = p.get(40, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(40), b.Number)
+}
@@ -0,0 +1,229 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package substrate
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/decred/base58"
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/go-substrate-rpc-client/scale"
+	"github.com/stafiprotocol/go-substrate-rpc-client/types"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Weight the last approval of a multisig call may use by default
+const DefaultMultisigMaxWeight = 10_000_000_000
+
+// signer makes the relayer key act for another account: a proxied account on whose behalf the
+// calls are dispatched with Proxy.proxy, and or a multisig account whose calls the relayer
+// approves with Multisig.as_multi. With both, the multisig is the proxy of the proxied account.
+type signer struct {
+	relayer   types.AccountID
+	real      *types.AccountID  // the proxied account, nil without a proxy
+	proxyType types.OptionU8    // index of the ProxyType of the proxy, none for any
+	threshold uint16            // approvals of the multisig, 0 without a multisig
+	others    []types.AccountID // the other signatories of the multisig, sorted
+	multisig  types.AccountID   // the account of the multisig
+	maxWeight uint64            // of the call dispatched by the last approval
+}
+
+// timepoint is the block and extrinsic index a multisig call was first approved at.
+type timepoint struct {
+	Height types.U32
+	Index  types.U32
+}
+
+type optionTimepoint struct {
+	hasValue bool
+	value    timepoint
+}
+
+func (o optionTimepoint) Encode(encoder scale.Encoder) error {
+	return encoder.EncodeOption(o.hasValue, o.value)
+}
+
+// multisigState is a pending multisig call, stored in Multisig.Multisigs.
+type multisigState struct {
+	When      timepoint
+	Deposit   types.U128
+	Depositor types.AccountID
+	Approvals []types.AccountID
+}
+
+// parseSigner reads the proxy and multisig options of the writer for the relayer account. It
+// returns nil if the relayer signs for itself.
+func parseSigner(opts map[string]string, relayer types.AccountID) (*signer, error) {
+	s := &signer{relayer: relayer, proxyType: types.NewOptionU8Empty(), maxWeight: DefaultMultisigMaxWeight}
+	if opt, ok := opts["proxyReal"]; ok {
+		real, err := decodeAccount(opt)
+		if err != nil {
+			return nil, fmt.Errorf("proxyReal %s invalid: %s", opt, err)
+		}
+		s.real = &real
+	}
+	if opt, ok := opts["proxyType"]; ok {
+		index, err := strconv.ParseUint(opt, 10, 8)
+		if err != nil || s.real == nil {
+			return nil, fmt.Errorf("proxyType %s invalid, must be the index of a ProxyType with proxyReal", opt)
+		}
+		s.proxyType = types.NewOptionU8(types.U8(index))
+	}
+
+	signatories, ok := opts["multisigSignatories"]
+	if !ok {
+		if _, ok := opts["multisigThreshold"]; ok {
+			return nil, fmt.Errorf("multisigThreshold without multisigSignatories")
+		}
+		if s.real == nil {
+			return nil, nil
+		}
+		return s, nil
+	}
+	for _, addr := range strings.Split(signatories, ",") {
+		account, err := decodeAccount(strings.TrimSpace(addr))
+		if err != nil {
+			return nil, fmt.Errorf("multisigSignatories %s invalid: %s", addr, err)
+		}
+		if account == relayer {
+			continue
+		}
+		for _, other := range s.others {
+			if account == other {
+				return nil, fmt.Errorf("multisigSignatories %s given twice", addr)
+			}
+		}
+		s.others = append(s.others, account)
+	}
+	threshold, err := strconv.ParseUint(opts["multisigThreshold"], 10, 16)
+	if err != nil || threshold < 2 || int(threshold) > len(s.others)+1 {
+		return nil, fmt.Errorf("multisigThreshold %s invalid, must be between 2 and the %d signatories", opts["multisigThreshold"], len(s.others)+1)
+	}
+	s.threshold = uint16(threshold)
+	if opt, ok := opts["multisigMaxWeight"]; ok {
+		if s.maxWeight, err = strconv.ParseUint(opt, 10, 64); err != nil {
+			return nil, fmt.Errorf("multisigMaxWeight %s invalid, must be a number", opt)
+		}
+	}
+	sortAccounts(s.others)
+	s.multisig, err = multisigAccount(append([]types.AccountID{relayer}, s.others...), s.threshold)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// checkMetadata fails for runtimes with metadata V14 or later, whose Proxy.proxy takes a
+// MultiAddress and whose Multisig.as_multi takes a boxed call and a V2 weight, unlike the calls
+// wrap encodes.
+func (s *signer) checkMetadata(version int) error {
+	if version >= 14 {
+		return fmt.Errorf("proxyReal and multisigSignatories need a runtime with metadata before V14, found V%d", version)
+	}
+	return nil
+}
+
+// voter returns the account that votes in the bridge pallet.
+func (s *signer) voter() types.AccountID {
+	switch {
+	case s.real != nil:
+		return *s.real
+	case s.threshold != 0:
+		return s.multisig
+	}
+	return s.relayer
+}
+
+// wrap returns the call submitting call for the proxied or multisig account. If the relayer
+// already approved the multisig call it returns the reason instead.
+func (s *signer) wrap(q storageQuerier, meta *types.Metadata, call types.Call) (types.Call, string, error) {
+	var err error
+	if s.real != nil {
+		call, err = types.NewCall(meta, config.ProxyProxy, *s.real, s.proxyType, call)
+		if err != nil {
+			return types.Call{}, "", err
+		}
+	}
+	if s.threshold == 0 {
+		return call, "", nil
+	}
+
+	enc, err := types.EncodeToBytes(call)
+	if err != nil {
+		return types.Call{}, "", err
+	}
+	hash := blake2b.Sum256(enc)
+	var pending multisigState
+	exists, err := q.QueryStorage(config.Multisig, config.MultisigStorage, s.multisig[:], hash[:], &pending)
+	if err != nil {
+		return types.Call{}, "", err
+	}
+	var when optionTimepoint
+	if exists {
+		if containsVote(pending.Approvals, s.relayer) {
+			return types.Call{}, "multisig call already approved", nil
+		}
+		when = optionTimepoint{hasValue: true, value: pending.When}
+	}
+	call, err = types.NewCall(meta, config.MultisigAsMulti, types.U16(s.threshold), s.others, when,
+		types.NewBytes(enc), types.NewBool(false), types.U64(s.maxWeight))
+	if err != nil {
+		return types.Call{}, "", err
+	}
+	return call, "", nil
+}
+
+// multisigAccount derives the account of the multisig of signatories with threshold, like
+// pallet-multisig does.
+func multisigAccount(signatories []types.AccountID, threshold uint16) (types.AccountID, error) {
+	sorted := append([]types.AccountID{}, signatories...)
+	sortAccounts(sorted)
+	enc, err := types.EncodeToBytes(sorted)
+	if err != nil {
+		return types.AccountID{}, err
+	}
+	threshold16, err := types.EncodeToBytes(types.U16(threshold))
+	if err != nil {
+		return types.AccountID{}, err
+	}
+	entropy := blake2b.Sum256(append(append([]byte("modlpy/utilisuba"), enc...), threshold16...))
+	return types.NewAccountID(entropy[:]), nil
+}
+
+func sortAccounts(accounts []types.AccountID) {
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i][:], accounts[j][:]) < 0
+	})
+}
+
+// decodeAccount reads an account given as ss58 address or as hex of the public key.
+func decodeAccount(addr string) (types.AccountID, error) {
+	if raw, err := hex.DecodeString(strings.TrimPrefix(addr, "0x")); err == nil {
+		if len(raw) != 32 {
+			return types.AccountID{}, fmt.Errorf("%d bytes instead of 32", len(raw))
+		}
+		return types.NewAccountID(raw), nil
+	}
+
+	raw := base58.Decode(addr)
+	var prefix int
+	switch len(raw) {
+	case 35: // a one byte prefix and a two byte checksum
+		prefix = 1
+	case 36: // a two byte prefix
+		prefix = 2
+	default:
+		return types.AccountID{}, fmt.Errorf("not an ss58 address or hex public key")
+	}
+	checksum := blake2b.Sum512(append([]byte("SS58PRE"), raw[:prefix+32]...))
+	if !bytes.Equal(checksum[:2], raw[prefix+32:]) {
+		return types.AccountID{}, fmt.Errorf("ss58 checksum mismatch")
+	}
+	return types.NewAccountID(raw[prefix : prefix+32]), nil
+}
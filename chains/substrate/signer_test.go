@@ -0,0 +1,156 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package substrate
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stafiprotocol/go-substrate-rpc-client/types"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	aliceHex   = "d43593c715fdd31c61141abd04a99fd6822c8558854ccde39a5684e7a56da27d"
+	bobHex     = "8eaf04151687736326c9fea17e25fc5287613693c912909cb226aa4794f26a48"
+	bobSS58    = "5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty"
+	charlieHex = "90b5ab205c6974c9ea841be688864633dc9ca8a357843eeacf2314649965fe22"
+	daveHex    = "306721211d5404bd9da88e0204360a1a9ab8b87c66c1bc2fcdd37f3c2222cc20"
+)
+
+func account(t *testing.T, s string) types.AccountID {
+	a, err := decodeAccount(s)
+	assert.NoError(t, err)
+	return a
+}
+
+func TestDecodeAccount(t *testing.T) {
+	assert.Equal(t, account(t, bobHex), account(t, bobSS58))
+	assert.Equal(t, account(t, bobHex), account(t, "0x"+bobHex))
+	for _, addr := range []string{"0x1234", "5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694tz", "bob"} {
+		_, err := decodeAccount(addr)
+		assert.Error(t, err, addr)
+	}
+}
+
+func TestParseSigner(t *testing.T) {
+	alice := account(t, aliceHex)
+	s, err := parseSigner(map[string]string{}, alice)
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+
+	s, err = parseSigner(map[string]string{"proxyReal": bobSS58, "proxyType": "3"}, alice)
+	assert.NoError(t, err)
+	assert.Equal(t, account(t, bobHex), s.voter())
+	ok, index := s.proxyType.Unwrap()
+	assert.True(t, ok)
+	assert.Equal(t, types.U8(3), index)
+	assert.Zero(t, s.threshold)
+
+	s, err = parseSigner(map[string]string{"multisigSignatories": daveHex + ", " + aliceHex + "," + bobSS58,
+		"multisigThreshold": "2"}, alice)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(2), s.threshold)
+	assert.Equal(t, []types.AccountID{account(t, daveHex), account(t, bobHex)}, s.others, "sorted without the relayer")
+	assert.Equal(t, s.multisig, s.voter())
+	assert.Equal(t, uint64(DefaultMultisigMaxWeight), s.maxWeight)
+
+	for _, opts := range []map[string]string{
+		{"proxyReal": "bob"},
+		{"proxyType": "1"},
+		{"proxyReal": bobHex, "proxyType": "Any"},
+		{"multisigThreshold": "2"},
+		{"multisigSignatories": bobHex, "multisigThreshold": "3"},
+		{"multisigSignatories": bobHex, "multisigThreshold": "1"},
+		{"multisigSignatories": bobHex + "," + bobSS58, "multisigThreshold": "2"},
+		{"multisigSignatories": bobHex, "multisigThreshold": "2", "multisigMaxWeight": "-1"},
+	} {
+		_, err := parseSigner(opts, alice)
+		assert.Error(t, err, "%v", opts)
+	}
+}
+
+func TestMultisigAccount(t *testing.T) {
+	// the 2 of 3 multisig of alice, bob and charlie
+	m, err := multisigAccount([]types.AccountID{account(t, aliceHex), account(t, bobHex), account(t, charlieHex)}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, account(t, "5DjYJStmdZ2rcqXbXGX7TW85JsrW6uG4y9MUcLq2BoPMpRA7"), m)
+
+	// the order of the signatories does not matter
+	a, err := multisigAccount([]types.AccountID{account(t, aliceHex), account(t, bobHex), account(t, daveHex)}, 2)
+	assert.NoError(t, err)
+	b, err := multisigAccount([]types.AccountID{account(t, daveHex), account(t, aliceHex), account(t, bobHex)}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+	c, err := multisigAccount([]types.AccountID{account(t, aliceHex), account(t, bobHex), account(t, daveHex)}, 3)
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, c)
+}
+
+func TestMultisigTimepoint(t *testing.T) {
+	enc, err := types.EncodeToBytes(optionTimepoint{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0}, enc)
+	enc, err = types.EncodeToBytes(optionTimepoint{hasValue: true, value: timepoint{Height: 7, Index: 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, "010700000001000000", hex.EncodeToString(enc))
+}
+
+func TestSignerCheckMetadata(t *testing.T) {
+	s, err := parseSigner(map[string]string{"proxyReal": bobSS58}, account(t, aliceHex))
+	assert.NoError(t, err)
+	assert.NoError(t, s.checkMetadata(13))
+	assert.Error(t, s.checkMetadata(14))
+}
+
+func TestSignerWrap(t *testing.T) {
+	meta := types.ExamplaryMetadataV13
+	alice := account(t, aliceHex)
+	s, err := parseSigner(map[string]string{"proxyReal": daveHex, "multisigSignatories": bobHex,
+		"multisigThreshold": "2", "multisigMaxWeight": "1000"}, alice)
+	assert.NoError(t, err)
+	remark, err := types.NewCall(meta, "System.remark", types.NewBytes([]byte{1}))
+	assert.NoError(t, err)
+	proxied, err := types.NewCall(meta, "Proxy.proxy", account(t, daveHex), types.NewOptionU8Empty(), remark)
+	assert.NoError(t, err)
+	enc, err := types.EncodeToBytes(proxied)
+	assert.NoError(t, err)
+	hash := blake2b.Sum256(enc)
+	key := "Multisig.Multisigs." + string(s.multisig[:]) + string(hash[:])
+
+	// the first approval starts the multisig call
+	storage := &fakeStorage{values: map[string][]byte{}}
+	call, reason, err := s.wrap(storage, meta, remark)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+	asMulti, err := meta.FindCallIndex("Multisig.as_multi")
+	assert.NoError(t, err)
+	assert.Equal(t, asMulti, call.CallIndex)
+	others, _ := types.EncodeToBytes([]types.AccountID{account(t, bobHex)})
+	args := append(append([]byte{2, 0}, others...), 0)
+	args = append(append(args, mustEncode(t, types.NewBytes(enc))...), 0)
+	args = append(args, 0xe8, 0x03, 0, 0, 0, 0, 0, 0)
+	assert.Equal(t, args, []byte(call.Args))
+
+	// later approvals refer to the first one
+	storage.values[key] = mustEncode(t, multisigState{When: timepoint{Height: 7, Index: 1},
+		Deposit: types.NewU128(*big.NewInt(1)), Depositor: account(t, bobHex), Approvals: []types.AccountID{account(t, bobHex)}})
+	call, reason, err = s.wrap(storage, meta, remark)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+	assert.Contains(t, hex.EncodeToString(call.Args), "010700000001000000")
+
+	storage.values[key] = mustEncode(t, multisigState{Deposit: types.NewU128(*big.NewInt(1)), Approvals: []types.AccountID{alice}})
+	_, reason, err = s.wrap(storage, meta, remark)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, reason)
+}
+
+func mustEncode(t *testing.T, v interface{}) []byte {
+	enc, err := types.EncodeToBytes(v)
+	assert.NoError(t, err)
+	return enc
+}
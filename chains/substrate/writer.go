@@ -5,42 +5,57 @@ package substrate
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math/big"
-	"strings"
 	"time"
 
 	"github.com/ChainSafe/log15"
-	"github.com/shopspring/decimal"
+	"github.com/stafiprotocol/chainbridge/chains"
 	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/shared/substrate"
+	"github.com/stafiprotocol/chainbridge/utils/journal"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
 	"github.com/stafiprotocol/go-substrate-rpc-client/types"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	msgLimit = 4096
 )
 
+// Time the writer waits for a batch to fill by default
+var DefaultBatchWait = 2 * time.Second
+
 var ErrorTerminated = errors.New("terminated")
 
 type writer struct {
-	conn     *Connection
-	log      log15.Logger
-	sysErr   chan<- error
-	msgChan  chan msg.Message
-	stop     <-chan int
-	decimals map[string]decimal.Decimal
+	conn    *Connection
+	router  chains.Router
+	log     log15.Logger
+	sysErr  chan<- error
+	msgChan chan msg.Message
+	stop    <-chan int
+
+	batchSize int           // proposals acknowledged in one extrinsic, 1 to not batch
+	batchWait time.Duration // how long to wait for a batch to fill
+	batchCall string        // the Utility call of the batch
+
+	signer *signer // the proxy and multisig the relayer acts through, nil to act for itself
 }
 
-func NewWriter(conn *Connection, log log15.Logger, sysErr chan<- error, stop <-chan int, decimals map[string]decimal.Decimal) *writer {
+func NewWriter(conn *Connection, log log15.Logger, sysErr chan<- error, stop <-chan int) *writer {
 	return &writer{
-		conn:     conn,
-		log:      log,
-		sysErr:   sysErr,
-		msgChan:  make(chan msg.Message, msgLimit),
-		stop:     stop,
-		decimals: decimals,
+		conn:    conn,
+		log:     log,
+		sysErr:  sysErr,
+		msgChan: make(chan msg.Message, msgLimit),
+		stop:    stop,
+
+		batchSize: 1,
+		batchCall: config.UtilityForceBatch,
 	}
 }
 
@@ -53,11 +68,12 @@ func (w *writer) start() error {
 				w.log.Info("writer stopped")
 				return
 			case msg := <-w.msgChan:
-				result := w.processMessage(msg)
-				w.log.Info("processMessage", "result", result)
-				if !result {
-					w.sysErr <- fmt.Errorf("processMessage failed")
+				tracing.QueueWait(msg)
+				if w.batchSize > 1 {
+					w.processBatch(w.collect(msg))
+					continue
 				}
+				w.finish(msg, w.processMessage(msg))
 			}
 		}
 	}()
@@ -65,13 +81,49 @@ func (w *writer) start() error {
 	return nil
 }
 
+// finish reports the result of processing m.
+func (w *writer) finish(m msg.Message, result bool) {
+	w.log.Info("processMessage", "result", result)
+	w.router.Processed(m, result)
+	if !result {
+		w.sysErr <- fmt.Errorf("processMessage failed")
+	}
+}
+
+// collect returns first and the messages queued after it, up to batchSize messages and waiting
+// at most batchWait for them.
+func (w *writer) collect(first msg.Message) []msg.Message {
+	msgs := []msg.Message{first}
+	timer := time.NewTimer(w.batchWait)
+	defer timer.Stop()
+	for len(msgs) < w.batchSize {
+		select {
+		case m := <-w.msgChan:
+			tracing.QueueWait(m)
+			msgs = append(msgs, m)
+		case <-timer.C:
+			return msgs
+		case <-w.stop:
+			return msgs
+		}
+	}
+	return msgs
+}
+
+func (w *writer) setRouter(r chains.Router) {
+	w.router = r
+}
+
 func (w *writer) ResolveMessage(m msg.Message) bool {
 	w.msgChan <- m
 	return true
 }
 
 func (w *writer) processMessage(m msg.Message) bool {
-	w.log.Info("ResolveMessage", "Name", w.conn.name, "Destination", m.Destination)
+	ctx, span := tracing.StartMessage(tracing.Context(m), m, tracing.SpanProcess)
+	defer span.End()
+	log := w.log.New(m.LogContext()...)
+	log.Info("ResolveMessage", "Name", w.conn.name, "Destination", m.Destination)
 
 	var prop *proposal
 	var err error
@@ -79,9 +131,9 @@ func (w *writer) processMessage(m msg.Message) bool {
 	// Construct the proposal
 	switch m.Type {
 	case msg.FungibleTransfer:
-		prop, err = w.createFungibleProposal(m)
+		prop, err = w.createFungibleProposal(ctx, m)
 	default:
-		w.log.Warn("unrecognized message type received")
+		log.Warn("unrecognized message type received")
 		return false
 	}
 
@@ -90,73 +142,268 @@ func (w *writer) processMessage(m msg.Message) bool {
 		return false
 	}
 
-	w.log.Info("ResolveMessage prop", "nonce", prop.DepositNonce, "source",
-		prop.SourceId, "resource", fmt.Sprintf("%x", prop.ResourceId), "method", prop.Method)
+	log.Info("ResolveMessage prop", "method", prop.Method)
 
+	// an included extrinsic whose outcome could not be fetched is settled by the vote status
+	var unknown string
+	var unknownErr error
 	for i := 0; i < BlockRetryLimit; i++ {
 		// Ensure we only submit a vote if status of the proposal is Active
+		_, check := tracing.StartMessage(ctx, m, tracing.SpanProposalCheck, tracing.Endpoint(w.conn.url))
 		valid, reason, err := w.proposalValid(prop)
-		w.log.Info("ResolveMessage proposalValid", "valid", valid, "reason", reason)
+		tracing.End(check, err)
+		log.Info("ResolveMessage proposalValid", "valid", valid, "reason", reason)
 		if err != nil {
-			w.log.Error("Failed to assert proposal state", "err", err)
+			log.Error("Failed to assert proposal state", "err", err)
 			time.Sleep(BlockRetryInterval)
 			continue
 		}
 
+		if unknown != "" {
+			if !valid && reason == "already voted" {
+				w.router.Journal(journal.NewTx(m, unknown, journal.StatusSucceeded, "acknowledgeProposal included, vote recorded"))
+				return true
+			}
+			if valid {
+				w.router.Journal(journal.NewTx(m, unknown, journal.StatusFailed, fmt.Sprintf("vote not recorded: %s", unknownErr)))
+			}
+			unknown = ""
+		}
+
 		if !valid {
-			w.log.Debug("Ignoring proposal", "reason", reason)
+			w.ignoreProposal(m, reason)
 			return true
 		}
 
-		w.log.Info("Acknowledging proposal on chain")
-		ext, err := w.conn.gc.NewUnsignedExtrinsic(config.AcknowledgeProposal, prop.DepositNonce, prop.SourceId, prop.ResourceId, prop.Call)
+		log.Info("Acknowledging proposal on chain")
+		call, reason, err := w.acknowledgeCall(prop)
+		if err != nil {
+			log.Error("Acknowledging proposal call error", "err", err)
+			time.Sleep(BlockRetryInterval)
+			continue
+		}
+		if reason != "" {
+			w.ignoreProposal(m, reason)
+			return true
+		}
+		ext, err := w.conn.gc.NewUnsignedExtrinsicOf(call)
 		if err != nil {
-			w.log.Error("Acknowledging NewUnsignedExtrinsic met err")
+			log.Error("Acknowledging NewUnsignedExtrinsic met err")
 			return false
 		}
-		err = w.conn.gc.SignAndSubmitTx(ext)
+		_, submit := tracing.StartMessage(ctx, m, tracing.SpanTxSubmit, tracing.Endpoint(w.conn.url))
+		hash, _, err := w.conn.gc.SignAndSubmitFor(prop.runtime, ext)
+		if hash != "" {
+			submit.SetAttributes(tracing.Tx(hash))
+		}
+		tracing.End(submit, err)
+		if errors.Is(err, substrate.RuntimeUpgradedError) {
+			// encode the proposal again for the new runtime
+			log.Warn("Runtime upgraded, encoding the proposal again", "err", err)
+			prop, err = w.createFungibleProposal(ctx, m)
+			if err != nil {
+				w.sysErr <- fmt.Errorf("construct proposal Error: %s", err)
+				return false
+			}
+			continue
+		}
+		if errors.Is(err, substrate.OutcomeUnknownError) {
+			log.Warn("Acknowledging proposal outcome unknown, checking the vote", "hash", hash, "err", err)
+			unknown, unknownErr = hash, err
+			time.Sleep(BlockRetryInterval)
+			continue
+		}
 		if err != nil {
+			w.router.Journal(journal.NewTx(m, hash, journal.StatusFailed, err.Error()))
 			if err.Error() == ErrorTerminated.Error() {
-				w.log.Error("Acknowledging proposal met TerminatedError")
+				log.Error("Acknowledging proposal met TerminatedError")
 				return false
 			}
-			w.log.Error("Acknowledging proposal error", "err", err)
+			log.Error("Acknowledging proposal error", "err", err)
 			time.Sleep(BlockRetryInterval)
 			continue
 		}
+		w.router.Journal(journal.NewTx(m, hash, journal.StatusSucceeded, "acknowledgeProposal included"))
 		return true
 	}
+	if unknown != "" {
+		w.router.Journal(journal.NewTx(m, unknown, journal.StatusSubmitted, unknownErr.Error()))
+	}
 	return false
 }
 
-func (w *writer) createFungibleProposal(m msg.Message) (*proposal, error) {
-	bigAmt := big.NewInt(0).SetBytes(m.Payload[0].([]byte))
-	//should not have 0x prefix and length must 64
-	resourceIdStr := strings.ToLower(m.ResourceId.Hex())
-	if len(resourceIdStr) != 64 {
-		return nil, fmt.Errorf("resourceId  length  must be 64")
+// ignoreProposal journals why the proposal of m is not acknowledged.
+func (w *writer) ignoreProposal(m msg.Message, reason string) {
+	w.log.Debug("Ignoring proposal", "reason", reason, "nonce", m.DepositNonce)
+	status := journal.StatusNotVoted
+	if reason == fmt.Sprintf("CurrentVoteStatus: %s", VoteStatusExecuted) {
+		status = journal.StatusExecuted
 	}
+	w.router.Journal(journal.NewDecision(m, status, reason))
+}
 
-	d, ok := w.decimals[resourceIdStr]
-	if !ok {
-		return nil, fmt.Errorf("failed to get decimal")
+// processBatch acknowledges the valid proposals of msgs in one batch extrinsic. Messages that
+// cannot be batched, and those whose call in the batch failed, are processed one by one.
+func (w *writer) processBatch(msgs []msg.Message) {
+	var batch []msg.Message
+	var calls []types.Call
+	var single []msg.Message
+	rt, err := w.conn.gc.LatestRuntime()
+	if err != nil {
+		w.log.Error("Batch runtime error", "err", err)
+		single = msgs
+		msgs = nil
+	}
+	for _, m := range msgs {
+		if m.Type != msg.FungibleTransfer {
+			single = append(single, m)
+			continue
+		}
+		prop, err := w.createFungibleProposal(tracing.Context(m), m)
+		// a proposal encoded for another runtime is left to processMessage
+		if err != nil || prop.runtime.SpecVersion() != rt.SpecVersion() {
+			single = append(single, m)
+			continue
+		}
+		valid, reason, err := w.proposalValid(prop)
+		if err != nil {
+			single = append(single, m)
+			continue
+		}
+		if !valid {
+			w.ignoreProposal(m, reason)
+			w.finish(m, true)
+			continue
+		}
+		call, reason, err := w.acknowledgeCall(prop)
+		if err != nil {
+			single = append(single, m)
+			continue
+		}
+		if reason != "" {
+			w.ignoreProposal(m, reason)
+			w.finish(m, true)
+			continue
+		}
+		batch = append(batch, m)
+		calls = append(calls, call)
+	}
+
+	if len(batch) == 1 {
+		single = append(single, batch...)
+	} else if len(batch) > 1 {
+		results := w.submitBatch(rt, batch, calls)
+		for i, m := range batch {
+			if results[i] != nil {
+				w.log.Warn("Acknowledging proposal in batch failed", "nonce", m.DepositNonce, "err", results[i])
+				single = append(single, m)
+				continue
+			}
+			w.finish(m, true)
+		}
 	}
 
-	amount := types.NewU128(*decimal.NewFromBigInt(bigAmt, 0).Div(d).BigInt())
+	for _, m := range single {
+		w.finish(m, w.processMessage(m))
+	}
+}
+
+// submitBatch submits calls in one batch extrinsic and returns the result of every call.
+func (w *writer) submitBatch(rt *substrate.Runtime, batch []msg.Message, calls []types.Call) []error {
+	results := make([]error, len(calls))
+	fail := func(err error) []error {
+		for i := range results {
+			results[i] = err
+		}
+		return results
+	}
+
+	w.log.Info("Acknowledging proposals in a batch", "size", len(calls), "call", w.batchCall)
+	ext, err := w.conn.gc.NewUnsignedExtrinsicFor(rt, w.batchCall, calls)
+	if err != nil {
+		return fail(err)
+	}
+	spans := make([]trace.Span, len(batch))
+	for i, m := range batch {
+		_, spans[i] = tracing.StartMessage(tracing.Context(m), m, tracing.SpanTxSubmit, tracing.Endpoint(w.conn.url))
+	}
+	hash, block, err := w.conn.gc.SignAndSubmitFor(rt, ext)
+	if errors.Is(err, substrate.RuntimeUpgradedError) {
+		// not submitted, the proposals are encoded again one by one
+		w.log.Warn("Runtime upgraded, acknowledging the batch one by one", "err", err)
+		for _, span := range spans {
+			tracing.End(span, err)
+		}
+		return fail(err)
+	}
+	if err == nil {
+		results, err = w.conn.sc.BatchOutcome(block, hash, len(calls))
+	}
+	for i, m := range batch {
+		if hash != "" {
+			spans[i].SetAttributes(tracing.Tx(hash))
+		}
+		if err != nil {
+			tracing.End(spans[i], err)
+			// the proposals are acknowledged one by one, which settles an unknown outcome by the vote status
+			status := journal.StatusFailed
+			if errors.Is(err, substrate.OutcomeUnknownError) {
+				status = journal.StatusSubmitted
+			}
+			w.router.Journal(journal.NewTx(m, hash, status, err.Error()))
+			continue
+		}
+		tracing.End(spans[i], results[i])
+		if results[i] != nil {
+			w.router.Journal(journal.NewTx(m, hash, journal.StatusFailed, results[i].Error()))
+		} else {
+			w.router.Journal(journal.NewTx(m, hash, journal.StatusSucceeded, "acknowledgeProposal included in batch"))
+		}
+	}
+	if err != nil {
+		w.log.Error("Acknowledging proposals in a batch error", "err", err)
+		return fail(err)
+	}
+	return results
+}
+
+// acknowledgeCall returns the call acknowledging prop, submitted through the proxy and multisig
+// of the relayer. Instead it returns the reason not to submit it, if any.
+func (w *writer) acknowledgeCall(prop *proposal) (types.Call, string, error) {
+	call, err := prop.acknowledgeCall(prop.runtime.Metadata, w.conn.pallet.call(w.conn.pallet.acknowledge))
+	if err != nil || w.signer == nil {
+		return call, "", err
+	}
+	return w.signer.wrap(w.conn, prop.runtime.Metadata, call)
+}
+
+// voter returns the account whose votes the relayer casts.
+func (w *writer) voter() types.AccountID {
+	if w.signer == nil {
+		return types.NewAccountID(w.conn.key.PublicKey)
+	}
+	return w.signer.voter()
+}
+
+func (w *writer) createFungibleProposal(ctx context.Context, m msg.Message) (*proposal, error) {
+	bigAmt := big.NewInt(0).SetBytes(m.Payload[0].([]byte))
+	amount := types.NewU128(*bigAmt)
 	recipient := types.NewAccountID(m.Payload[1].([]byte))
 	depositNonce := types.U64(m.DepositNonce)
+	_, lookup := tracing.StartMessage(ctx, m, tracing.SpanHandlerLookup, tracing.Endpoint(w.conn.url))
 	method, err := w.resolveResourceId(m.ResourceId)
+	tracing.End(lookup, err)
 	if err != nil {
 		return nil, err
 	}
 
-	meta, err := w.conn.gc.GetLatestMetadata()
+	rt, err := w.conn.gc.LatestRuntime()
 	if err != nil {
 		return nil, err
 	}
 
 	call, err := types.NewCall(
-		meta,
+		rt.Metadata,
 		method,
 		recipient,
 		amount,
@@ -172,12 +419,13 @@ func (w *writer) createFungibleProposal(m msg.Message) (*proposal, error) {
 		SourceId:     types.U8(m.Source),
 		ResourceId:   types.NewBytes32(m.ResourceId),
 		Method:       method,
+		runtime:      rt,
 	}, nil
 }
 
 func (w *writer) resolveResourceId(id [32]byte) (string, error) {
 	var res []byte
-	exist, err := w.conn.QueryStorage(config.BridgeCommon, "Resources", id[:], nil, &res)
+	exist, err := w.conn.QueryStorage(w.conn.pallet.name, w.conn.pallet.resources, id[:], nil, &res)
 	if err != nil {
 		return "", err
 	}
@@ -201,7 +449,7 @@ func (w *writer) proposalValid(prop *proposal) (bool, string, error) {
 		return false, "", err
 	}
 
-	exists, err := w.conn.QueryStorage(config.BridgeCommon, "Votes", srcId, propBz, &voteRes)
+	exists, err := w.conn.QueryStorage(w.conn.pallet.name, w.conn.pallet.votes, srcId, propBz, &voteRes)
 	if err != nil {
 		return false, "", err
 	}
@@ -214,7 +462,7 @@ func (w *writer) proposalValid(prop *proposal) (bool, string, error) {
 		return false, fmt.Sprintf("CurrentVoteStatus: %s", voteRes.Status), nil
 	}
 
-	if containsVote(voteRes.Voted, types.NewAccountID(w.conn.key.PublicKey)) {
+	if containsVote(voteRes.Voted, w.voter()) {
 		return false, "already voted", nil
 	}
 
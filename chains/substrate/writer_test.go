@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/big"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/stafiprotocol/chainbridge/config"
@@ -91,3 +92,26 @@ func TestEncode(t *testing.T) {
 	b := []byte("sdfsdf")
 	fmt.Println(hexutil.Encode(b))
 }
+
+func TestWriterCollect(t *testing.T) {
+	w := NewWriter(nil, AliceTestLogger, nil, make(chan int))
+	w.batchSize = 3
+	w.batchWait = time.Second
+	for i := 0; i < 4; i++ {
+		w.msgChan <- msg.Message{DepositNonce: msg.Nonce(i)}
+	}
+
+	// bound by the size
+	msgs := w.collect(<-w.msgChan)
+	if len(msgs) != 3 || msgs[2].DepositNonce != 2 {
+		t.Fatalf("unexpected batch %v", msgs)
+	}
+
+	// bound by the wait
+	w.batchWait = 50 * time.Millisecond
+	start := time.Now()
+	msgs = w.collect(<-w.msgChan)
+	if len(msgs) != 1 || msgs[0].DepositNonce != 3 || time.Since(start) < w.batchWait {
+		t.Fatalf("unexpected batch %v", msgs)
+	}
+}
@@ -27,7 +27,7 @@ type dataHandler struct {
 // it in the correct signature for the Cli Commands
 func wrapHandler(hdl func(*cli.Context, *dataHandler) error) cli.ActionFunc {
 	return func(ctx *cli.Context) error {
-		err := startLogger(ctx)
+		err := startLogger(ctx, config.NewConfig())
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,69 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	log "github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/journal"
+	"github.com/stafiprotocol/chainbridge/utils/limits"
+	"github.com/stafiprotocol/chainbridge/utils/tracking"
+)
+
+// startApi serves the transfer tracking API on port. Transfers are read from the journal and
+// the stores of the configured guards and the dead letters.
+func startApi(cfg *config.Config, j *journal.Journal, port int) error {
+	tracker := tracking.NewTracker(j)
+
+	stores := make(map[string]string)
+	if cfg.Screening != nil {
+		dir, err := stateDir(cfg, screeningDir)
+		if err != nil {
+			return err
+		}
+		stores[screeningDir] = dir
+	}
+	if len(cfg.Limits) != 0 {
+		dir, err := stateDir(cfg, breakerDir)
+		if err != nil {
+			return err
+		}
+		stores[breakerDir] = limits.HeldDir(dir)
+	}
+	if len(cfg.Approvals) != 0 {
+		dir, err := stateDir(cfg, approvalDir)
+		if err != nil {
+			return err
+		}
+		stores[approvalDir] = dir
+	}
+	dir, err := stateDir(cfg, deadLetterDir)
+	if err != nil {
+		return err
+	}
+	stores[deadLetterDir] = dir
+
+	for name, dir := range stores {
+		if err := tracker.AddStore(name, dir); err != nil {
+			return err
+		}
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	logger := log.Root().New("system", "api")
+	go func() {
+		logger.Info("Serving transfer tracking API", "port", port)
+		if err := http.Serve(listener, tracking.NewHandler(tracker, logger)); err != nil {
+			logger.Error("Transfer tracking API stopped", "err", err)
+		}
+	}()
+	return nil
+}
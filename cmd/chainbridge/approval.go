@@ -0,0 +1,96 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/approval"
+	"github.com/urfave/cli/v2"
+)
+
+var approvalFlags = []cli.Flag{
+	config.ConfigFileFlag,
+	config.BlockstorePathFlag,
+}
+
+var approvalCommand = cli.Command{
+	Name:  "approval",
+	Usage: "manage transfers held for manual approval",
+	Description: "The approval command is used to decide on transfers above their approval threshold.\n" +
+		"\tTo list pending transfers: chainbridge approval list --config config.json\n" +
+		"\tTo approve a transfer: chainbridge approval approve --config config.json --transfer 1-2-5\n" +
+		"\tTo reject a transfer: chainbridge approval reject --config config.json --transfer 1-2-5 --note \"reason\"",
+	Subcommands: []*cli.Command{
+		{
+			Action:      handleApprovalListCmd,
+			Name:        "list",
+			Usage:       "list transfers awaiting approval",
+			Flags:       append(approvalFlags, config.AllFlag),
+			Description: "The list subcommand shows the pending transfers, or all queued transfers with --all.\n",
+		},
+		{
+			Action:      handleApprovalDecideCmd(true),
+			Name:        "approve",
+			Usage:       "approve a pending transfer",
+			Flags:       append(approvalFlags, config.TransferFlag, config.NoteFlag),
+			Description: "The approve subcommand lets the running relayer vote on a pending transfer.\n",
+		},
+		{
+			Action:      handleApprovalDecideCmd(false),
+			Name:        "reject",
+			Usage:       "reject a pending transfer",
+			Flags:       append(approvalFlags, config.TransferFlag, config.NoteFlag),
+			Description: "The reject subcommand marks a pending transfer as rejected, it will not be voted.\n",
+		},
+	},
+}
+
+func handleApprovalListCmd(ctx *cli.Context) error {
+	dir, err := stateDirFromCli(ctx, approvalDir)
+	if err != nil {
+		return err
+	}
+
+	status := approval.StatusPending
+	if ctx.Bool(config.AllFlag.Name) {
+		status = ""
+	}
+	entries, err := approval.List(dir, status)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("transfers: %d\n", len(entries))
+	for _, e := range entries {
+		fmt.Printf("  %s\tsource %d nonce %d amount %s recipient %s resourceId %s\n", e.Key(), e.Source, e.DepositNonce, e.Amount, e.Recipient, e.ResourceId)
+		fmt.Printf("  \tstatus %s, held at %s, expires at %s: %s\n", e.Status, e.CreatedAt.Format("2006-01-02 15:04:05"), e.ExpiresAt.Format("2006-01-02 15:04:05"), e.Reason)
+		if e.Note != "" {
+			fmt.Printf("  \tnote: %s\n", e.Note)
+		}
+	}
+	return nil
+}
+
+func handleApprovalDecideCmd(approve bool) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		key := ctx.String(config.TransferFlag.Name)
+		if key == "" {
+			return fmt.Errorf("transfer flag not supplied")
+		}
+
+		dir, err := stateDirFromCli(ctx, approvalDir)
+		if err != nil {
+			return err
+		}
+
+		e, err := approval.Decide(dir, key, approve, ctx.String(config.NoteFlag.Name))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("transfer %s %s\n", key, e.Status)
+		return nil
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	log "github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/urfave/cli/v2"
+)
+
+var backfillCommand = cli.Command{
+	Action: handleBackfillCmd,
+	Name:   "backfill",
+	Usage:  "relay the deposits of a range of past blocks and exit",
+	Flags: []cli.Flag{
+		config.ConfigFileFlag,
+		config.VerbosityFlag,
+		config.KeystorePathFlag,
+		config.BlockstorePathFlag,
+		config.ChainFlag,
+		config.FromBlockFlag,
+		config.ToBlockFlag,
+	},
+	Description: "The backfill command scans a range of blocks of one chain like the listener does, relays the deposits\n" +
+		"\tfound to their destination and exits once every transfer is resolved. The blockstore is not changed and the\n" +
+		"\tguards apply as usual. Backfill shares the state of the guards with the relayer, so it refuses to run while\n" +
+		"\tthe relayer runs on the same blockstore path; held transfers are released by the relayer once it runs again.\n" +
+		"\tTo relay the deposits of blocks 1000 to 2000 of chain 2: chainbridge backfill --config config.json --chain 2 --from 1000 --to 2000",
+}
+
+func handleBackfillCmd(ctx *cli.Context) error {
+	cfg, err := config.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+	err = startLogger(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	id, err := backfillChain(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if !ctx.IsSet(config.FromBlockFlag.Name) || !ctx.IsSet(config.ToBlockFlag.Name) {
+		return fmt.Errorf("--%s and --%s required", config.FromBlockFlag.Name, config.ToBlockFlag.Name)
+	}
+	from, to := ctx.Uint64(config.FromBlockFlag.Name), ctx.Uint64(config.ToBlockFlag.Name)
+	if from > to {
+		return fmt.Errorf("--%s %d is after --%s %d", config.FromBlockFlag.Name, from, config.ToBlockFlag.Name, to)
+	}
+
+	lock, err := lockState(cfg)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	stopTracing, err := setupTracing(cfg)
+	if err != nil {
+		return err
+	}
+	defer stopTracing()
+
+	sysErr := make(chan error)
+	c := core.NewCore(sysErr)
+	// fresh, so the blockstore is neither read nor rewound
+	err = initializeChains(c, cfg, sysErr, true, false)
+	if err != nil {
+		return err
+	}
+
+	j, err := setupJournal(c, cfg)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	err = setupTokens(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	// the watchers stop right away, held and dead transfers are left to the relayer
+	stop := make(chan int)
+	close(stop)
+	n, err := setupNotifications(c, cfg, stop)
+	if err != nil {
+		return err
+	}
+	if n != nil {
+		defer n.Close()
+	}
+	err = setupDeadLetters(c, cfg, stop)
+	if err != nil {
+		return err
+	}
+	err = setupGuards(c, cfg, stop, true)
+	if err != nil {
+		return err
+	}
+
+	summary, err := c.Backfill(id, from, to)
+	if summary != nil {
+		printBackfillSummary(summary)
+	}
+	if err != nil {
+		return err
+	}
+	if failed := summary.Counts()[core.OutcomeFailed]; failed != 0 {
+		return fmt.Errorf("%d transfers failed", failed)
+	}
+	log.Info("Backfill done", "chain", id, "from", from, "to", to)
+	return nil
+}
+
+// backfillChain returns the id of the chain selected on the command line.
+func backfillChain(ctx *cli.Context, cfg *config.Config) (msg.ChainId, error) {
+	selected := ctx.String(config.ChainFlag.Name)
+	if selected == "" {
+		return 0, fmt.Errorf("--%s required", config.ChainFlag.Name)
+	}
+	for _, chain := range cfg.Chains {
+		if selected != chain.Id && selected != chain.Name {
+			continue
+		}
+		id, err := strconv.ParseUint(chain.Id, 10, 8)
+		if err != nil {
+			return 0, fmt.Errorf("chain %s id %s invalid", chain.Name, chain.Id)
+		}
+		return msg.ChainId(id), nil
+	}
+	return 0, fmt.Errorf("chain %s not in config", selected)
+}
+
+func printBackfillSummary(s *core.BackfillSummary) {
+	keys := make([]string, 0, len(s.Transfers))
+	for k := range s.Transfers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("%s\t%s\n", k, s.Transfers[k])
+	}
+
+	counts := s.Counts()
+	fmt.Printf("deposits sent: %d, processed: %d, failed: %d, held: %d, rejected: %d\n", s.Sent,
+		counts[core.OutcomeProcessed], counts[core.OutcomeFailed], counts[core.OutcomeHeld], counts[core.OutcomeRejected])
+}
@@ -0,0 +1,447 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	log "github.com/ChainSafe/log15"
+	"github.com/cosmos/cosmos-sdk/crypto/keyring"
+	"github.com/cosmos/cosmos-sdk/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	stafihub "github.com/stafihub/stafi-hub-relay-sdk/client"
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/shared/substrate"
+	"github.com/stafiprotocol/chainbridge/utils/blockstore"
+	"github.com/stafiprotocol/chainbridge/utils/keystore"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/runlock"
+	solClient "github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/urfave/cli/v2"
+)
+
+// Time given to a chain to report its head
+const headTimeout = 15 * time.Second
+
+var blockstoreFlags = []cli.Flag{
+	config.ConfigFileFlag,
+	config.KeystorePathFlag,
+	config.BlockstorePathFlag,
+	config.ChainFlag,
+}
+
+var blockstoreCommand = cli.Command{
+	Name:  "blockstore",
+	Usage: "manage where the listeners resume",
+	Description: "The blockstore command shows and changes the progress of the listeners. Stop the relayer before changing it.\n" +
+		"\tThe blockstore file of a chain is named after the relayer account of the config, --chain selects a chain by id or name.\n" +
+		"\tSubstrate and stafihub accounts are read from the keystore. --file selects another blockstore file of a single chain.\n" +
+		"\tTo show all chains: chainbridge blockstore show --config config.json\n" +
+		"\tTo resume from a block: chainbridge blockstore set --config config.json --chain 1 --block 1000\n" +
+		"\tTo resume after a solana signature: chainbridge blockstore set --config config.json --chain 3 --signature 5x...\n" +
+		"\tTo start from the configured startBlock: chainbridge blockstore reset --config config.json --chain 1",
+	Subcommands: []*cli.Command{
+		{
+			Action:      handleBlockstoreShowCmd,
+			Name:        "show",
+			Usage:       "show the progress of the listeners",
+			Flags:       append(blockstoreFlags, config.BlockstoreFileFlag, config.OfflineFlag),
+			Description: "The show subcommand lists the latest block or signature of every chain, with the current head of the chain for comparison.",
+		},
+		{
+			Action:      handleBlockstoreSetCmd,
+			Name:        "set",
+			Usage:       "set the block or signature a listener resumes from",
+			Flags:       append(blockstoreFlags, config.BlockstoreFileFlag, config.BlockFlag, config.BlockHashFlag, config.SignatureFlag),
+			Description: "The set subcommand moves a listener to a block, or a solana listener to a signature. Later blocks are dropped from the history.",
+		},
+		{
+			Action:      handleBlockstoreExportCmd,
+			Name:        "export",
+			Usage:       "export the blockstores as JSON",
+			Flags:       append(blockstoreFlags, config.FileFlag),
+			Description: "The export subcommand writes the blockstores of the selected chains as JSON.",
+		},
+		{
+			Action:      handleBlockstoreImportCmd,
+			Name:        "import",
+			Usage:       "import blockstores from JSON",
+			Flags:       append(blockstoreFlags, config.FileFlag),
+			Description: "The import subcommand replaces the blockstores of the chains found in an export.",
+		},
+		{
+			Action:      handleBlockstoreResetCmd,
+			Name:        "reset",
+			Usage:       "clear the progress of a listener",
+			Flags:       append(blockstoreFlags, config.BlockstoreFileFlag),
+			Description: "The reset subcommand clears the blockstore of a chain, so its listener starts from the configured start block.",
+		},
+	},
+}
+
+// chainStore is the blockstore of a chain of the config.
+type chainStore struct {
+	chain config.RawChainConfig
+	id    msg.ChainId
+	path  string
+	store *blockstore.Blockstore
+}
+
+// exportedStore is the JSON form of a blockstore.
+type exportedStore struct {
+	Chain msg.ChainId `json:"chain"`
+	Name  string      `json:"name"`
+	blockstore.State
+}
+
+// openChainStores opens the blockstores of the chains selected on the command line. Chains
+// without a listener are skipped. If required is set, or a blockstore file is given as override, a
+// single chain must be selected.
+func openChainStores(ctx *cli.Context, required bool, override string) ([]*chainStore, error) {
+	cfg, err := config.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := blockstore.ResolvePath(cfg.BlockStorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := ctx.String(config.ChainFlag.Name)
+	if (required || override != "") && selected == "" {
+		return nil, fmt.Errorf("--%s required", config.ChainFlag.Name)
+	}
+	var stores []*chainStore
+	for _, chain := range cfg.Chains {
+		if selected != "" && selected != chain.Id && selected != chain.Name {
+			continue
+		}
+		if !hasBlockstore(chain.Type) {
+			if selected != "" {
+				return nil, fmt.Errorf("chain %s of type %s has no blockstore", chain.Name, chain.Type)
+			}
+			continue
+		}
+		id, err := strconv.ParseUint(chain.Id, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("chain %s id %s invalid", chain.Name, chain.Id)
+		}
+		path, err := blockstoreFile(cfg, dir, chain, msg.ChainId(id), override)
+		if err != nil {
+			return nil, err
+		}
+		backend := blockstore.NewFileBackend(path)
+		if chain.Type == "solana" {
+			backend = blockstore.NewSignatureFileBackend(path)
+		}
+		stores = append(stores, &chainStore{
+			chain: chain,
+			id:    msg.ChainId(id),
+			path:  path,
+			store: blockstore.New(backend),
+		})
+	}
+	if selected != "" && len(stores) == 0 {
+		return nil, fmt.Errorf("chain %s not in config", selected)
+	}
+	return stores, nil
+}
+
+func hasBlockstore(chainType string) bool {
+	switch chainType {
+	case "ethereum", "substrate", "solana", "stafihub":
+		return true
+	}
+	return false
+}
+
+// blockstoreFile returns the blockstore file of a chain. It is named after the relayer account,
+// which is resolved like the chain does on startup. An override given with --file, a path or a
+// pattern matching a single file, is used instead.
+func blockstoreFile(cfg *config.Config, dir string, chain config.RawChainConfig, id msg.ChainId, override string) (string, error) {
+	if override != "" {
+		matches, err := filepath.Glob(override)
+		if err != nil {
+			return "", err
+		}
+		if len(matches) != 1 {
+			return "", fmt.Errorf("--%s %s must match a single file, found %v", config.BlockstoreFileFlag.Name, override, matches)
+		}
+		return matches[0], nil
+	}
+
+	relayer, err := relayerAddress(cfg, chain)
+	if err != nil {
+		return "", fmt.Errorf("chain %s: %s", chain.Name, err)
+	}
+	return filepath.Join(dir, blockstore.FileName(id, relayer)), nil
+}
+
+// relayerAddress returns the account the blockstore of a chain is named after. Substrate and
+// stafihub accounts are read from the keystore, which may ask for its password.
+func relayerAddress(cfg *config.Config, chain config.RawChainConfig) (string, error) {
+	switch chain.Type {
+	case "ethereum":
+		return common.HexToAddress(chain.From).Hex(), nil
+	case "substrate":
+		kp, err := keystore.KeypairFromAddress(chain.From, keystore.SubChain, cfg.KeystorePath, false)
+		if err != nil {
+			return "", err
+		}
+		return kp.Address(), nil
+	case "solana":
+		return chain.Opts["feeAccount"], nil
+	case "stafihub":
+		if chain.From == "" {
+			return "stafihub", nil
+		}
+		fmt.Printf("Will open stafihub wallet from <%s>. \nPlease ", cfg.KeystorePath)
+		kr, err := keyring.New(types.KeyringServiceName(), keyring.BackendFile, cfg.KeystorePath, os.Stdin, stafihub.MakeEncodingConfig().Marshaler)
+		if err != nil {
+			return "", err
+		}
+		info, err := kr.Key(chain.From)
+		if err != nil {
+			return "", fmt.Errorf("keyring get address from name:%s err: %s", chain.From, err)
+		}
+		addr, err := info.GetAddress()
+		if err != nil {
+			return "", err
+		}
+		return addr.String(), nil
+	}
+	return "", fmt.Errorf("chain type %s unsupported", chain.Type)
+}
+
+// chainHead returns the latest block of a chain, the latest finalized block of substrate and the
+// latest finalized slot of solana.
+func chainHead(chain config.RawChainConfig) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), headTimeout)
+	defer cancel()
+
+	switch chain.Type {
+	case "ethereum":
+		client, err := ethclient.DialContext(ctx, chain.Endpoint)
+		if err != nil {
+			return 0, err
+		}
+		defer client.Close()
+		return client.BlockNumber(ctx)
+	case "substrate":
+		endpoint := chain.Endpoint
+		if endpoint == "" && len(chain.EndpointList) > 0 {
+			endpoint = chain.EndpointList[0]
+		}
+		gc, err := substrate.NewGsrpcClient(endpoint, substrate.AddressTypeAccountId, nil, log.Root(), nil)
+		if err != nil {
+			return 0, err
+		}
+		return gc.GetFinalizedBlockNumber()
+	case "stafihub":
+		client, err := stafihub.NewClient(nil, "", "", chain.EndpointList, log.Root())
+		if err != nil {
+			return 0, err
+		}
+		height, err := client.GetCurrentBlockHeight()
+		return uint64(height), err
+	case "solana":
+		return solClient.NewClient(chain.EndpointList).GetSlot(ctx, solClient.GetSlotConfig{Commitment: solClient.CommitmentFinalized})
+	}
+	return 0, fmt.Errorf("chain type %s unsupported", chain.Type)
+}
+
+func handleBlockstoreShowCmd(ctx *cli.Context) error {
+	stores, err := openChainStores(ctx, false, ctx.String(config.BlockstoreFileFlag.Name))
+	if err != nil {
+		return err
+	}
+	for _, cs := range stores {
+		fmt.Printf("%s (chain %d, %s)\n  file: %s\n", cs.chain.Name, cs.id, cs.chain.Type, cs.path)
+		s, err := cs.store.State()
+		if err != nil {
+			fmt.Printf("  error: %s\n", err)
+			continue
+		}
+		latest := s.Latest()
+		switch {
+		case latest != nil:
+			fmt.Printf("  latest block: %d", latest.Height)
+			if latest.Hash != "" {
+				fmt.Printf(" %s", latest.Hash)
+			}
+			fmt.Printf(" at %s (%d in history)\n", latest.Time.Format(time.RFC3339), len(s.History))
+		case s.Signature == "":
+			fmt.Println("  latest block: none, starts from the configured start block")
+		}
+		if s.Signature != "" {
+			fmt.Printf("  latest signature: %s\n", s.Signature)
+		}
+
+		if ctx.Bool(config.OfflineFlag.Name) {
+			continue
+		}
+		head, err := chainHead(cs.chain)
+		if err != nil {
+			fmt.Printf("  head: unavailable: %s\n", err)
+			continue
+		}
+		if latest != nil && head >= latest.Height {
+			fmt.Printf("  head: %d, %d behind\n", head, head-latest.Height)
+		} else {
+			fmt.Printf("  head: %d\n", head)
+		}
+	}
+	return nil
+}
+
+func handleBlockstoreSetCmd(ctx *cli.Context) error {
+	stores, err := openChainStores(ctx, true, ctx.String(config.BlockstoreFileFlag.Name))
+	if err != nil {
+		return err
+	}
+	cs := stores[0]
+
+	block := ctx.String(config.BlockFlag.Name)
+	sig := ctx.String(config.SignatureFlag.Name)
+	switch {
+	case block == "" && sig == "":
+		return fmt.Errorf("--%s or --%s required", config.BlockFlag.Name, config.SignatureFlag.Name)
+	case block != "" && sig != "":
+		return fmt.Errorf("--%s and --%s are exclusive", config.BlockFlag.Name, config.SignatureFlag.Name)
+	case sig != "":
+		if cs.chain.Type != "solana" {
+			return fmt.Errorf("chain %s of type %s resumes from a block, not a signature", cs.chain.Name, cs.chain.Type)
+		}
+		err = cs.store.StoreSignature(sig)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s resumes after signature %s\n", cs.chain.Name, sig)
+		return nil
+	}
+
+	if cs.chain.Type == "solana" {
+		return fmt.Errorf("chain %s resumes from a signature, not a block", cs.chain.Name)
+	}
+	height, ok := new(big.Int).SetString(block, 10)
+	if !ok || height.Sign() < 0 || !height.IsUint64() {
+		return fmt.Errorf("block %s invalid", block)
+	}
+	err = cs.store.StoreBlock(height, ctx.String(config.BlockHashFlag.Name))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s resumes from block %s\n", cs.chain.Name, height)
+	return nil
+}
+
+func handleBlockstoreExportCmd(ctx *cli.Context) error {
+	stores, err := openChainStores(ctx, false, "")
+	if err != nil {
+		return err
+	}
+	exported := make([]exportedStore, 0, len(stores))
+	for _, cs := range stores {
+		s, err := cs.store.State()
+		if err != nil {
+			return fmt.Errorf("chain %s: %s", cs.chain.Name, err)
+		}
+		exported = append(exported, exportedStore{Chain: cs.id, Name: cs.chain.Name, State: *s})
+	}
+
+	data, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return err
+	}
+	if file := ctx.String(config.FileFlag.Name); file != "" {
+		return ioutil.WriteFile(file, data, 0600)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func handleBlockstoreImportCmd(ctx *cli.Context) error {
+	var data []byte
+	var err error
+	if file := ctx.String(config.FileFlag.Name); file != "" {
+		data, err = ioutil.ReadFile(file)
+	} else {
+		data, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return err
+	}
+	var imported []exportedStore
+	err = json.Unmarshal(data, &imported)
+	if err != nil {
+		return fmt.Errorf("import invalid: %s", err)
+	}
+
+	stores, err := openChainStores(ctx, false, "")
+	if err != nil {
+		return err
+	}
+	byId := make(map[msg.ChainId]*chainStore)
+	for _, cs := range stores {
+		byId[cs.id] = cs
+	}
+	for _, e := range imported {
+		if byId[e.Chain] == nil {
+			return fmt.Errorf("chain %d (%s) of the import not selected in config", e.Chain, e.Name)
+		}
+	}
+
+	for _, e := range imported {
+		cs := byId[e.Chain]
+		s := e.State
+		err = cs.store.Replace(&s)
+		if err != nil {
+			return fmt.Errorf("chain %s: %s", cs.chain.Name, err)
+		}
+		fmt.Printf("%s: imported %d blocks", cs.chain.Name, len(s.History))
+		if s.Signature != "" {
+			fmt.Printf(" and signature %s", s.Signature)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func handleBlockstoreResetCmd(ctx *cli.Context) error {
+	stores, err := openChainStores(ctx, true, ctx.String(config.BlockstoreFileFlag.Name))
+	if err != nil {
+		return err
+	}
+	cs := stores[0]
+	err = cs.store.Reset()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s starts from the configured start block\n", cs.chain.Name)
+	return nil
+}
+
+// lockState takes the lock of the state directory next to the blockstore. The relayer and
+// backfill hold it while they run, so they never share the state of the guards.
+func lockState(cfg *config.Config) (*runlock.Lock, error) {
+	dir, err := blockstore.ResolvePath(cfg.BlockStorePath)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := runlock.Acquire(dir)
+	if errors.Is(err, runlock.ErrLocked) {
+		return nil, fmt.Errorf("%s, another relayer or backfill is running", err)
+	}
+	return lock, err
+}
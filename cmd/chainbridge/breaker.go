@@ -0,0 +1,127 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/limits"
+	"github.com/stafiprotocol/chainbridge/utils/msgstore"
+	"github.com/urfave/cli/v2"
+)
+
+var breakerFlags = []cli.Flag{
+	config.ConfigFileFlag,
+	config.BlockstorePathFlag,
+}
+
+var breakerCommand = cli.Command{
+	Name:  "breaker",
+	Usage: "inspect and reset the transfer circuit breaker",
+	Description: "The breaker command is used to manage routes paused by the transfer limits.\n" +
+		"\tTo list paused routes and held transfers: chainbridge breaker list --config config.json\n" +
+		"\tTo reset a route and release its transfers: chainbridge breaker reset --config config.json --route 1-2-<resourceId>\n" +
+		"\tTo release a transfer still breaching a limit after the reset: chainbridge breaker release --config config.json --transfer 1-2-5",
+	Subcommands: []*cli.Command{
+		{
+			Action:      handleBreakerListCmd,
+			Name:        "list",
+			Usage:       "list paused routes and held transfers",
+			Flags:       breakerFlags,
+			Description: "The list subcommand shows the routes paused by the circuit breaker and the transfers held on them.\n",
+		},
+		{
+			Action:      handleBreakerResetCmd,
+			Name:        "reset",
+			Usage:       "reset a paused route",
+			Flags:       append(breakerFlags, config.RouteFlag, config.DiscardFlag),
+			Description: "The reset subcommand resumes a paused route. A running relayer checks the held transfers of the route against the limits again and releases those within them.\n",
+		},
+		{
+			Action:      handleBreakerDecideCmd(limits.Release),
+			Name:        "release",
+			Usage:       "release a transfer breaching a limit",
+			Flags:       append(breakerFlags, config.TransferFlag, config.NoteFlag),
+			Description: "The release subcommand lets the running relayer vote on a held transfer that still breached a limit when its route was reset.\n",
+		},
+		{
+			Action:      handleBreakerDecideCmd(limits.Discard),
+			Name:        "discard",
+			Usage:       "drop a transfer breaching a limit",
+			Flags:       append(breakerFlags, config.TransferFlag, config.NoteFlag),
+			Description: "The discard subcommand drops a held transfer that still breached a limit when its route was reset, it will not be voted.\n",
+		},
+	},
+}
+
+func handleBreakerListCmd(ctx *cli.Context) error {
+	dir, err := stateDirFromCli(ctx, breakerDir)
+	if err != nil {
+		return err
+	}
+
+	trips, err := limits.LoadTrips(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("paused routes: %d\n", len(trips))
+	for _, t := range trips {
+		fmt.Printf("  %s\ttripped at %s by %s: %s\n", t.Route, t.TrippedAt.Format("2006-01-02 15:04:05"), t.Trigger, t.Reason)
+	}
+
+	held, err := limits.HeldTransfers(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("held transfers: %d\n", len(held))
+	for _, e := range held {
+		fmt.Printf("  %s\t%s resourceId %s amount %s recipient %s: %s\n", e.Key(), e.Status, e.ResourceId, e.Amount, e.Recipient, e.Reason)
+	}
+	return nil
+}
+
+func handleBreakerResetCmd(ctx *cli.Context) error {
+	route := ctx.String(config.RouteFlag.Name)
+	if route == "" {
+		return fmt.Errorf("route flag not supplied")
+	}
+
+	dir, err := stateDirFromCli(ctx, breakerDir)
+	if err != nil {
+		return err
+	}
+
+	discard := ctx.Bool(config.DiscardFlag.Name)
+	if err := limits.Reset(dir, route, discard); err != nil {
+		return err
+	}
+	if discard {
+		fmt.Printf("route %s reset, held transfers discarded\n", route)
+	} else {
+		fmt.Printf("route %s reset, held transfers will be released by the running relayer\n", route)
+	}
+	return nil
+}
+
+func handleBreakerDecideCmd(decide func(dir, key, note string) (*msgstore.Entry, error)) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		key := ctx.String(config.TransferFlag.Name)
+		if key == "" {
+			return fmt.Errorf("transfer flag not supplied")
+		}
+
+		dir, err := stateDirFromCli(ctx, breakerDir)
+		if err != nil {
+			return err
+		}
+
+		e, err := decide(dir, key, ctx.String(config.NoteFlag.Name))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("transfer %s %s\n", key, e.Status)
+		return nil
+	}
+}
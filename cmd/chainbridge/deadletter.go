@@ -0,0 +1,156 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/deadletter"
+	"github.com/stafiprotocol/chainbridge/utils/msgstore"
+	"github.com/urfave/cli/v2"
+)
+
+const deadLetterDir = "deadletter"
+
+// setupDeadLetters records the transfers that could not be relayed and retries them on request
+// until stop is closed.
+func setupDeadLetters(c *core.Core, cfg *config.Config, stop <-chan int) error {
+	dir, err := stateDir(cfg, deadLetterDir)
+	if err != nil {
+		return err
+	}
+	queue, err := deadletter.NewQueue(dir, log.Root().New("system", "deadletter"))
+	if err != nil {
+		return err
+	}
+	c.SetDeadLetters(queue)
+	go queue.Watch(c.Retry, stop)
+	return nil
+}
+
+var deadLetterFlags = []cli.Flag{
+	config.ConfigFileFlag,
+	config.BlockstorePathFlag,
+}
+
+var deadLetterCommand = cli.Command{
+	Name:  "deadletter",
+	Usage: "manage transfers that could not be relayed",
+	Description: "The deadletter command is used to inspect, retry and discard transfers that were skipped.\n" +
+		"\tTo list dead transfers: chainbridge deadletter list --config config.json\n" +
+		"\tTo show a transfer: chainbridge deadletter inspect --config config.json --transfer 1-2-5\n" +
+		"\tTo relay a transfer again: chainbridge deadletter retry --config config.json --transfer 1-2-5\n" +
+		"\tTo drop a transfer: chainbridge deadletter discard --config config.json --transfer 1-2-5",
+	Subcommands: []*cli.Command{
+		{
+			Action:      handleDeadLetterListCmd,
+			Name:        "list",
+			Usage:       "list dead transfers",
+			Flags:       append(deadLetterFlags, config.AllFlag),
+			Description: "The list subcommand shows the transfers waiting for an operator, or all records with --all.\n",
+		},
+		{
+			Action:      handleDeadLetterInspectCmd,
+			Name:        "inspect",
+			Usage:       "show a dead transfer",
+			Flags:       append(deadLetterFlags, config.TransferFlag),
+			Description: "The inspect subcommand prints the full record of a transfer as JSON.\n",
+		},
+		{
+			Action:      handleDeadLetterDecideCmd(deadletter.Retry),
+			Name:        "retry",
+			Usage:       "relay a dead transfer again",
+			Flags:       append(deadLetterFlags, config.TransferFlag, config.NoteFlag),
+			Description: "The retry subcommand lets the running relayer send a transfer again from the stage it was dropped at.\n",
+		},
+		{
+			Action:      handleDeadLetterDecideCmd(deadletter.Discard),
+			Name:        "discard",
+			Usage:       "drop a dead transfer",
+			Flags:       append(deadLetterFlags, config.TransferFlag, config.NoteFlag),
+			Description: "The discard subcommand marks a dead transfer as dropped, it is kept as a record.\n",
+		},
+	},
+}
+
+func handleDeadLetterListCmd(ctx *cli.Context) error {
+	dir, err := stateDirFromCli(ctx, deadLetterDir)
+	if err != nil {
+		return err
+	}
+
+	status := deadletter.StatusDead
+	if ctx.Bool(config.AllFlag.Name) {
+		status = ""
+	}
+	entries, err := deadletter.List(dir, status)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("transfers: %d\n", len(entries))
+	for _, e := range entries {
+		fmt.Printf("  %s\tsource %d nonce %d amount %s recipient %s resourceId %s\n", e.Key(), e.Source, e.DepositNonce, e.Amount, e.Recipient, e.ResourceId)
+		fmt.Printf("  \tstatus %s at %s since %s: %s\n", e.Status, e.Stage, e.UpdatedAt.Format("2006-01-02 15:04:05"), e.Reason)
+		if e.Note != "" {
+			fmt.Printf("  \tnote: %s\n", e.Note)
+		}
+		if reason := deadletter.Retryable(e); reason != "" {
+			fmt.Printf("  \tnot retryable: %s\n", reason)
+		}
+	}
+	return nil
+}
+
+func handleDeadLetterInspectCmd(ctx *cli.Context) error {
+	key := ctx.String(config.TransferFlag.Name)
+	if key == "" {
+		return fmt.Errorf("transfer flag not supplied")
+	}
+
+	dir, err := stateDirFromCli(ctx, deadLetterDir)
+	if err != nil {
+		return err
+	}
+	e, err := deadletter.Get(dir, key)
+	if err != nil {
+		return err
+	}
+	reason := deadletter.Retryable(e)
+	data, err := json.MarshalIndent(struct {
+		*msgstore.Entry
+		Retryable    bool   `json:"retryable"`
+		NotRetryable string `json:"notRetryable,omitempty"`
+	}{e, reason == "", reason}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func handleDeadLetterDecideCmd(decide func(dir, key, note string) (*msgstore.Entry, error)) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		key := ctx.String(config.TransferFlag.Name)
+		if key == "" {
+			return fmt.Errorf("transfer flag not supplied")
+		}
+
+		dir, err := stateDirFromCli(ctx, deadLetterDir)
+		if err != nil {
+			return err
+		}
+
+		e, err := decide(dir, key, ctx.String(config.NoteFlag.Name))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("transfer %s %s\n", key, e.Status)
+		return nil
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	log "github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/approval"
+	"github.com/stafiprotocol/chainbridge/utils/blockstore"
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/limits"
+	"github.com/stafiprotocol/chainbridge/utils/screening"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	breakerDir   = "breaker"
+	approvalDir  = "approval"
+	screeningDir = "screening"
+)
+
+// setupGuards registers the configured guards with the router. Their background routines
+// run until stop is closed. Recipients are screened first, then hard limits are checked before
+// transfers are queued for approval. With inline set recipients are screened in the router, for
+// runs that exit before a background routine would get to them.
+func setupGuards(c *core.Core, cfg *config.Config, stop <-chan int, inline bool) error {
+	if cfg.Screening != nil {
+		screeners := make([]screening.Screener, 0)
+		if cfg.Screening.Denylist != "" {
+			denylist, err := screening.NewDenylist(cfg.Screening.Denylist)
+			if err != nil {
+				return err
+			}
+			screeners = append(screeners, denylist)
+		}
+		if cfg.Screening.Url != "" {
+			var timeout time.Duration
+			if cfg.Screening.Timeout != "" {
+				t, err := time.ParseDuration(cfg.Screening.Timeout)
+				if err != nil {
+					return fmt.Errorf("screening timeout %s invalid: %s", cfg.Screening.Timeout, err)
+				}
+				timeout = t
+			}
+			screeners = append(screeners, screening.NewHTTPScreener(cfg.Screening.Url, timeout))
+		}
+		if len(screeners) == 0 {
+			return fmt.Errorf("screening requires a denylist or url")
+		}
+
+		dir, err := stateDir(cfg, screeningDir)
+		if err != nil {
+			return err
+		}
+		guard, err := screening.NewGuard(dir, screeners, log.Root().New("system", "screening"))
+		if err != nil {
+			return err
+		}
+		guard.SetInline(inline)
+		guard.SetNotifier(c)
+		go guard.Watch(c.AddGuard(guard), stop)
+	}
+
+	if len(cfg.Limits) != 0 {
+		rules := make([]*limits.Rule, 0, len(cfg.Limits))
+		for _, l := range cfg.Limits {
+			rule, err := limits.ParseRule(l.ResourceId, l.Source, l.Destination, l.MaxAmount, l.WindowAmount, l.Window)
+			if err != nil {
+				return err
+			}
+			rules = append(rules, rule)
+		}
+
+		dir, err := stateDir(cfg, breakerDir)
+		if err != nil {
+			return err
+		}
+		breaker, err := limits.NewBreaker(dir, rules, log.Root().New("system", "breaker"))
+		if err != nil {
+			return err
+		}
+		go breaker.Watch(c.AddGuard(breaker), stop)
+	}
+
+	if len(cfg.Approvals) != 0 {
+		thresholds := make([]*approval.Threshold, 0, len(cfg.Approvals))
+		for _, a := range cfg.Approvals {
+			threshold, err := approval.ParseThreshold(a.ResourceId, a.Threshold, a.Expiry)
+			if err != nil {
+				return err
+			}
+			thresholds = append(thresholds, threshold)
+		}
+
+		dir, err := stateDir(cfg, approvalDir)
+		if err != nil {
+			return err
+		}
+		queue, err := approval.NewQueue(dir, thresholds, log.Root().New("system", "approval"))
+		if err != nil {
+			return err
+		}
+		go queue.Watch(c.AddGuard(queue), stop)
+	}
+
+	return nil
+}
+
+// stateDir returns the directory of a relayer component, kept alongside the blockstore.
+func stateDir(cfg *config.Config, name string) (string, error) {
+	path, err := blockstore.ResolvePath(cfg.BlockStorePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(path, name), nil
+}
+
+// stateDirFromCli loads the config given on the command line and returns the directory of
+// a relayer component.
+func stateDirFromCli(ctx *cli.Context, name string) (string, error) {
+	cfg, err := config.GetConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	return stateDir(cfg, name)
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/journal"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/urfave/cli/v2"
+)
+
+const journalDir = "journal"
+
+// setupJournal opens the journal the router and writers record their actions in. The returned
+// journal must be closed once the relayer stopped.
+func setupJournal(c *core.Core, cfg *config.Config) (*journal.Journal, error) {
+	dir, err := stateDir(cfg, journalDir)
+	if err != nil {
+		return nil, err
+	}
+	j, err := journal.Open(filepath.Join(dir, journal.FileName))
+	if err != nil {
+		return nil, err
+	}
+	c.SetJournal(j)
+	return j, nil
+}
+
+var journalCommand = cli.Command{
+	Action: handleJournalCmd,
+	Name:   "journal",
+	Usage:  "query the record of relayer actions",
+	Flags: []cli.Flag{
+		config.ConfigFileFlag,
+		config.BlockstorePathFlag,
+		config.SourceFlag,
+		config.DestinationFlag,
+		config.NonceFlag,
+		config.TxHashFlag,
+		config.StatusFlag,
+		config.SinceFlag,
+		config.UntilFlag,
+		config.LimitFlag,
+	},
+	Description: "The journal command lists the deposits, decisions and transactions recorded by the relayer.\n" +
+		"\tTo show the history of a transfer: chainbridge journal --config config.json --source 1 --destination 2 --nonce 5\n" +
+		"\tTo find a transaction: chainbridge journal --config config.json --tx 0x1234...\n" +
+		"\tTo list failures of a day: chainbridge journal --config config.json --status failed --since 2021-06-01 --until 2021-06-02",
+}
+
+func handleJournalCmd(ctx *cli.Context) error {
+	q := journal.Query{
+		TxHash: ctx.String(config.TxHashFlag.Name),
+		Status: ctx.String(config.StatusFlag.Name),
+		Limit:  ctx.Int(config.LimitFlag.Name),
+	}
+	if s := ctx.String(config.SourceFlag.Name); s != "" {
+		id, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return fmt.Errorf("source %s invalid: %s", s, err)
+		}
+		source := msg.ChainId(id)
+		q.Source = &source
+	}
+	if s := ctx.String(config.DestinationFlag.Name); s != "" {
+		id, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return fmt.Errorf("destination %s invalid: %s", s, err)
+		}
+		destination := msg.ChainId(id)
+		q.Destination = &destination
+	}
+	if s := ctx.String(config.NonceFlag.Name); s != "" {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("nonce %s invalid: %s", s, err)
+		}
+		nonce := msg.Nonce(n)
+		q.DepositNonce = &nonce
+	}
+	var err error
+	if q.From, err = parseTime(ctx.String(config.SinceFlag.Name)); err != nil {
+		return err
+	}
+	if q.To, err = parseTime(ctx.String(config.UntilFlag.Name)); err != nil {
+		return err
+	}
+
+	dir, err := stateDirFromCli(ctx, journalDir)
+	if err != nil {
+		return err
+	}
+	j, err := journal.OpenReadOnly(filepath.Join(dir, journal.FileName))
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	records, err := j.Query(q)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("records: %d\n", len(records))
+	for _, r := range records {
+		fmt.Printf("  %s\t%s\t%s %s on chain %d", r.Time.Format("2006-01-02 15:04:05"), r.Key(), r.Kind, r.Status, r.Chain)
+		if r.Block != 0 {
+			fmt.Printf(" block %d", r.Block)
+		}
+		if r.TxHash != "" {
+			fmt.Printf(" tx %s", r.TxHash)
+		}
+		fmt.Println()
+		if r.Kind == journal.KindDeposit {
+			fmt.Printf("  \tamount %s recipient %s resourceId %s\n", r.Amount, r.Recipient, r.ResourceId)
+		}
+		if r.Detail != "" {
+			fmt.Printf("  \t%s\n", r.Detail)
+		}
+	}
+	return nil
+}
+
+// parseTime accepts RFC3339 timestamps and dates, an empty string yields the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time %s invalid, expected RFC3339 or YYYY-MM-DD", s)
+	}
+	return t, nil
+}
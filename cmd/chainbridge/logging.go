@@ -0,0 +1,77 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+
+	log "github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/logging"
+)
+
+// loggingConfig converts the logging section of the config, the defaults are used without one.
+func loggingConfig(raw *config.RawLoggingConfig, lvl log.Lvl) (*logging.Config, error) {
+	if raw == nil {
+		return logging.DefaultConfig(lvl), nil
+	}
+
+	c := logging.DefaultConfig(lvl)
+	c.Levels = make(map[string]log.Lvl)
+	for name, l := range raw.Levels {
+		parsed, err := logging.ParseLevel(l)
+		if err != nil {
+			return nil, fmt.Errorf("logging level of %s: %s", name, err)
+		}
+		c.Levels[name] = parsed
+	}
+
+	if raw.Stdout != nil {
+		if raw.Stdout.Disabled {
+			c.Stdout = nil
+		} else {
+			o, err := logOutput(raw.Stdout)
+			if err != nil {
+				return nil, err
+			}
+			c.Stdout = o
+		}
+	}
+
+	if raw.Files != nil {
+		c.Outputs = make([]*logging.Output, 0, len(raw.Files))
+		for i := range raw.Files {
+			o, err := logOutput(&raw.Files[i])
+			if err != nil {
+				return nil, err
+			}
+			c.Outputs = append(c.Outputs, o)
+		}
+	}
+	return c, nil
+}
+
+func logOutput(raw *config.RawLogOutput) (*logging.Output, error) {
+	o := &logging.Output{
+		Path:       raw.Path,
+		Format:     raw.Format,
+		MaxSize:    raw.MaxSize,
+		MaxBackups: raw.MaxBackups,
+		MaxAge:     raw.MaxAge,
+		Compress:   raw.Compress,
+	}
+	if raw.Level != "" {
+		lvl, err := logging.ParseLevel(raw.Level)
+		if err != nil {
+			return nil, fmt.Errorf("logging level of %s: %s", raw.Path, err)
+		}
+		o.Level = &lvl
+	}
+	rotate, err := parseDuration("logging rotate of "+raw.Path, raw.Rotate)
+	if err != nil {
+		return nil, err
+	}
+	o.Rotate = rotate
+	return o, nil
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/stafiprotocol/chainbridge/chains/substrate"
 	"github.com/stafiprotocol/chainbridge/config"
 	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/logging"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
 	"github.com/urfave/cli/v2"
 )
@@ -32,6 +33,8 @@ var cliFlags = []cli.Flag{
 	config.LatestBlockFlag,
 	config.MetricsFlag,
 	config.MetricsPort,
+	config.ApiFlag,
+	config.ApiPortFlag,
 }
 
 var generateFlags = []cli.Flag{
@@ -83,6 +86,13 @@ func init() {
 	app.EnableBashCompletion = true
 	app.Commands = []*cli.Command{
 		&accountCommand,
+		&breakerCommand,
+		&approvalCommand,
+		&screeningCommand,
+		&deadLetterCommand,
+		&journalCommand,
+		&blockstoreCommand,
+		&backfillCommand,
 	}
 
 	app.Flags = append(app.Flags, cliFlags...)
@@ -96,45 +106,106 @@ func main() {
 	}
 }
 
-func startLogger(ctx *cli.Context) error {
-	logger := log.Root()
-	var lvl log.Lvl
-
-	if lvlToInt, err := strconv.Atoi(ctx.String(config.VerbosityFlag.Name)); err == nil {
-		lvl = log.Lvl(lvlToInt)
-	} else if lvl, err = log.LvlFromString(ctx.String(config.VerbosityFlag.Name)); err != nil {
+func startLogger(ctx *cli.Context, cfg *config.Config) error {
+	lvl, err := logging.ParseLevel(ctx.String(config.VerbosityFlag.Name))
+	if err != nil {
 		return err
 	}
+	if cfg.Logging != nil && cfg.Logging.Level != "" && !ctx.IsSet(config.VerbosityFlag.Name) {
+		lvl, err = logging.ParseLevel(cfg.Logging.Level)
+		if err != nil {
+			return err
+		}
+	}
 
-	logger.SetHandler(log.MultiHandler(
-		log.LvlFilterHandler(
-			lvl,
-			log.StreamHandler(os.Stdout, log.LogfmtFormat())),
-		log.Must.FileHandler("bridge_log.json", log.JsonFormat()),
-		log.LvlFilterHandler(
-			log.LvlError,
-			log.Must.FileHandler("bridge_log_errors.json", log.JsonFormat()))))
-
+	lc, err := loggingConfig(cfg.Logging, lvl)
+	if err != nil {
+		return err
+	}
+	handler, err := logging.Handler(lc)
+	if err != nil {
+		return err
+	}
+	log.Root().SetHandler(handler)
 	return nil
 }
 
 func run(ctx *cli.Context) error {
-	err := startLogger(ctx)
+	cfg, err := config.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = startLogger(ctx, cfg)
 	if err != nil {
 		return err
 	}
 
 	log.Info("Starting ChainBridge...")
 
-	cfg, err := config.GetConfig(ctx)
+	lock, err := lockState(cfg)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	stopTracing, err := setupTracing(cfg)
 	if err != nil {
 		return err
 	}
+	defer stopTracing()
 
 	// Used to signal core shutdown due to fatal error
 	sysErr := make(chan error)
 	c := core.NewCore(sysErr)
 
+	err = initializeChains(c, cfg, sysErr, ctx.Bool(config.FreshStartFlag.Name), ctx.Bool(config.LatestBlockFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	j, err := setupJournal(c, cfg)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	if ctx.Bool(config.ApiFlag.Name) {
+		err = startApi(cfg, j, ctx.Int(config.ApiPortFlag.Name))
+		if err != nil {
+			return err
+		}
+	}
+	err = setupTokens(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan int)
+	defer close(stop)
+	n, err := setupNotifications(c, cfg, stop)
+	if err != nil {
+		return err
+	}
+	if n != nil {
+		defer n.Close()
+	}
+	err = setupDeadLetters(c, cfg, stop)
+	if err != nil {
+		return err
+	}
+	err = setupGuards(c, cfg, stop, false)
+	if err != nil {
+		return err
+	}
+
+	c.Start()
+
+	return nil
+}
+
+// initializeChains initializes the chains of the config and adds them to c. fresh and latest
+// select where the listeners start, see core.ChainConfig.
+func initializeChains(c *core.Core, cfg *config.Config, sysErr chan<- error, fresh, latest bool) error {
 	for _, chain := range cfg.Chains {
 		chainId, err := strconv.Atoi(chain.Id)
 		if err != nil {
@@ -150,8 +221,8 @@ func run(ctx *cli.Context) error {
 			KeystorePath:   cfg.KeystorePath,
 			Insecure:       false,
 			BlockstorePath: cfg.BlockStorePath,
-			FreshStart:     ctx.Bool(config.FreshStartFlag.Name),
-			LatestBlock:    ctx.Bool(config.LatestBlockFlag.Name),
+			FreshStart:     fresh,
+			LatestBlock:    latest,
 			Opts:           chain.Opts,
 			Symbols:        chain.Symbols,
 		}
@@ -181,8 +252,5 @@ func run(ctx *cli.Context) error {
 		c.AddChain(newChain)
 
 	}
-
-	c.Start()
-
 	return nil
 }
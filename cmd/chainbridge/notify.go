@@ -0,0 +1,119 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	log "github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/notify"
+)
+
+// setupNotifications sends operator notifications to the configured webhook and starts the
+// balance and lag checks, which run until stop is closed. The returned notifier is nil if
+// notifications are not configured, otherwise it must be closed once the relayer stopped.
+func setupNotifications(c *core.Core, cfg *config.Config, stop <-chan int) (*notify.Notifier, error) {
+	nc := cfg.Notifications
+	if nc == nil {
+		return nil, nil
+	}
+	if nc.Webhook == "" {
+		return nil, fmt.Errorf("notifications require a webhook")
+	}
+
+	timeout, err := parseDuration("notifications timeout", nc.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := notify.NewWebhookSink(nc.Webhook, nc.Template, timeout)
+	if err != nil {
+		return nil, err
+	}
+	n := notify.NewNotifier(sink, log.Root().New("system", "notify"))
+	for typ, t := range nc.Throttle {
+		d, err := parseDuration("notifications throttle of "+typ, t)
+		if err != nil {
+			n.Close()
+			return nil, err
+		}
+		n.SetThrottle(typ, d)
+	}
+	if nc.Dedup != "" {
+		d, err := parseDuration("notifications dedup", nc.Dedup)
+		if err != nil {
+			n.Close()
+			return nil, err
+		}
+		n.SetDedup(d)
+	}
+
+	interval, err := parseDuration("notifications interval", nc.Interval)
+	if err != nil {
+		n.Close()
+		return nil, err
+	}
+	monitor := notify.NewMonitor(n, interval)
+	if err := addChecks(monitor, c, nc); err != nil {
+		n.Close()
+		return nil, err
+	}
+
+	c.SetNotifier(n)
+	go monitor.Watch(stop)
+	return n, nil
+}
+
+// addChecks adds the balance and lag checks of the chains listed in the config.
+func addChecks(m *notify.Monitor, c *core.Core, nc *config.RawNotifyConfig) error {
+	chains := make(map[string]core.Chain)
+	for _, chain := range c.Registry {
+		chains[strconv.Itoa(int(chain.Id()))] = chain
+	}
+
+	for id, min := range nc.MinBalances {
+		chain, ok := chains[id]
+		if !ok {
+			return fmt.Errorf("notifications minBalances chain %s unknown", id)
+		}
+		checker, ok := chain.(notify.BalanceChecker)
+		if !ok {
+			return fmt.Errorf("notifications minBalances: chain %s does not report balances", id)
+		}
+		amount, ok := new(big.Int).SetString(min, 10)
+		if !ok {
+			return fmt.Errorf("notifications minBalances of chain %s: %s is not an integer", id, min)
+		}
+		m.AddBalance(chain.Id(), checker, amount)
+	}
+
+	for id, max := range nc.MaxLag {
+		chain, ok := chains[id]
+		if !ok {
+			return fmt.Errorf("notifications maxLag chain %s unknown", id)
+		}
+		checker, ok := chain.(notify.LagChecker)
+		if !ok {
+			return fmt.Errorf("notifications maxLag: chain %s does not report lag", id)
+		}
+		m.AddLag(chain.Id(), checker, max)
+	}
+	return nil
+}
+
+// parseDuration parses an optional duration, an empty string is zero.
+func parseDuration(name, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s %s invalid: %s", name, s, err)
+	}
+	return d, nil
+}
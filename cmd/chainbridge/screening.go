@@ -0,0 +1,101 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/msgstore"
+	"github.com/stafiprotocol/chainbridge/utils/screening"
+	"github.com/urfave/cli/v2"
+)
+
+var screeningFlags = []cli.Flag{
+	config.ConfigFileFlag,
+	config.BlockstorePathFlag,
+}
+
+var screeningCommand = cli.Command{
+	Name:  "screening",
+	Usage: "manage transfers parked by recipient screening",
+	Description: "The screening command is used to inspect and resolve transfers to screened recipients.\n" +
+		"\tTo list parked transfers: chainbridge screening list --config config.json\n" +
+		"\tTo relay a false positive: chainbridge screening release --config config.json --transfer 1-2-5\n" +
+		"\tTo drop a parked transfer: chainbridge screening discard --config config.json --transfer 1-2-5",
+	Subcommands: []*cli.Command{
+		{
+			Action:      handleScreeningListCmd,
+			Name:        "list",
+			Usage:       "list parked transfers",
+			Flags:       append(screeningFlags, config.AllFlag),
+			Description: "The list subcommand shows the transfers parked or awaiting screening, or all screening records with --all.\n",
+		},
+		{
+			Action:      handleScreeningDecideCmd(screening.Release),
+			Name:        "release",
+			Usage:       "relay a parked transfer",
+			Flags:       append(screeningFlags, config.TransferFlag, config.NoteFlag),
+			Description: "The release subcommand lets the running relayer vote on a parked transfer regardless of screening.\n",
+		},
+		{
+			Action:      handleScreeningDecideCmd(screening.Discard),
+			Name:        "discard",
+			Usage:       "drop a parked transfer",
+			Flags:       append(screeningFlags, config.TransferFlag, config.NoteFlag),
+			Description: "The discard subcommand marks a parked transfer as dropped, it will not be voted.\n",
+		},
+	},
+}
+
+func handleScreeningListCmd(ctx *cli.Context) error {
+	dir, err := stateDirFromCli(ctx, screeningDir)
+	if err != nil {
+		return err
+	}
+
+	entries, err := screening.List(dir, "")
+	if err != nil {
+		return err
+	}
+
+	all := ctx.Bool(config.AllFlag.Name)
+	shown := make([]*msgstore.Entry, 0, len(entries))
+	for _, e := range entries {
+		if all || e.Status == screening.StatusParked || e.Status == screening.StatusUnscreened {
+			shown = append(shown, e)
+		}
+	}
+
+	fmt.Printf("transfers: %d\n", len(shown))
+	for _, e := range shown {
+		fmt.Printf("  %s\tsource %d nonce %d amount %s recipient %s resourceId %s\n", e.Key(), e.Source, e.DepositNonce, e.Amount, e.Recipient, e.ResourceId)
+		fmt.Printf("  \tstatus %s since %s: %s\n", e.Status, e.UpdatedAt.Format("2006-01-02 15:04:05"), e.Reason)
+		if e.Note != "" {
+			fmt.Printf("  \tnote: %s\n", e.Note)
+		}
+	}
+	return nil
+}
+
+func handleScreeningDecideCmd(decide func(dir, key, note string) (*msgstore.Entry, error)) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		key := ctx.String(config.TransferFlag.Name)
+		if key == "" {
+			return fmt.Errorf("transfer flag not supplied")
+		}
+
+		dir, err := stateDirFromCli(ctx, screeningDir)
+		if err != nil {
+			return err
+		}
+
+		e, err := decide(dir, key, ctx.String(config.NoteFlag.Name))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("transfer %s %s\n", key, e.Status)
+		return nil
+	}
+}
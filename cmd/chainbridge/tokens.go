@@ -0,0 +1,107 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/tokens"
+)
+
+// setupTokens builds the token registry from the tokens section and the legacy substrate
+// symbols, and lets the router convert every transfer with it. Chains reading the decimals of
+// tokens from their state are asked for the tokens not configured for them, the config
+// overrides the chain.
+func setupTokens(c *core.Core, cfg *config.Config) error {
+	registry := tokens.NewRegistry()
+	configured := make(map[msg.ResourceId]bool)
+	for _, raw := range cfg.Tokens {
+		t, err := tokens.ParseToken(raw.ResourceId, raw.Symbol, raw.Decimals, raw.Chains)
+		if err != nil {
+			return err
+		}
+		if err := registry.Register(t); err != nil {
+			return err
+		}
+		configured[t.ResourceId] = true
+	}
+
+	for _, chain := range cfg.Chains {
+		chainId, err := strconv.Atoi(chain.Id)
+		if err != nil {
+			return err
+		}
+		registry.SetAmountBits(msg.ChainId(chainId), tokens.AmountBits(chain.Type))
+		if len(chain.Symbols) != 0 {
+			// the relayer always required the decimals of tokens of chains with symbols
+			registry.SetScaled(msg.ChainId(chainId))
+		}
+		if err := registerSymbols(registry, configured, msg.ChainId(chainId), chain.Symbols); err != nil {
+			return fmt.Errorf("chain %s symbols: %s", chain.Name, err)
+		}
+	}
+
+	for _, chain := range c.Registry {
+		if source, ok := chain.(tokens.DecimalsSource); ok {
+			registry.SetDecimalsSource(chain.Id(), source)
+		}
+	}
+
+	c.SetConverter(registry)
+	return nil
+}
+
+// registerSymbols translates the decimalFactor of the symbols config of a chain. A factor of
+// 10^n means an amount on the chain is multiplied by 10^n on every other chain, so the token
+// gets n decimals with 0 on the chain itself. Tokens of the tokens section take precedence.
+func registerSymbols(registry *tokens.Registry, configured map[msg.ResourceId]bool, chainId msg.ChainId, symbols []interface{}) error {
+	for _, sym := range symbols {
+		info, ok := sym.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("symbol not a string map")
+		}
+		rIdStr, _ := info["resourceId"].(string)
+		if rIdStr == "Default" {
+			continue
+		}
+		rId, err := hex.DecodeString(strings.ToLower(rIdStr))
+		if err != nil || len(rId) != 32 {
+			return fmt.Errorf("symbol resourceId %s invalid", rIdStr)
+		}
+		factor, _ := info["decimalFactor"].(string)
+		n, err := tokens.FactorDecimals(factor)
+		if err != nil {
+			return err
+		}
+
+		resourceId := msg.ResourceIdFromSlice(rId)
+		if configured[resourceId] {
+			log.Warn("Ignoring symbol, token is configured in tokens", "resourceId", rIdStr, "symbol", info["symbol"])
+			continue
+		}
+		if t, ok := registry.Token(resourceId); ok {
+			// the same token is bridged from another chain with symbols
+			if t.Decimals != n {
+				return fmt.Errorf("symbol %s decimalFactor %s conflicts with another chain", rIdStr, factor)
+			}
+			if err := registry.SetDecimals(resourceId, chainId, 0); err != nil {
+				return err
+			}
+			continue
+		}
+		symbol, _ := info["symbol"].(string)
+		t := &tokens.Token{ResourceId: resourceId, Symbol: symbol, Decimals: n, Chains: map[msg.ChainId]uint8{chainId: 0}}
+		if err := registry.Register(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/config"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
+)
+
+// setupTracing exports traces of the transfers as configured. The returned function flushes the
+// pending spans and must be called once the relayer stopped.
+func setupTracing(cfg *config.Config) (func(), error) {
+	tc := cfg.Tracing
+	if tc == nil {
+		return func() {}, nil
+	}
+	if tc.Otlp == nil && tc.File == "" {
+		return nil, fmt.Errorf("tracing requires an otlp endpoint or a file")
+	}
+
+	c := tracing.Config{File: tc.File, SampleRatio: tracing.DefaultSampleRatio}
+	if tc.SampleRatio != nil {
+		c.SampleRatio = *tc.SampleRatio
+	}
+	if tc.Otlp != nil {
+		if tc.Otlp.Endpoint == "" {
+			return nil, fmt.Errorf("tracing otlp requires an endpoint")
+		}
+		c.OTLP = &tracing.OTLP{
+			Endpoint: tc.Otlp.Endpoint,
+			URLPath:  tc.Otlp.UrlPath,
+			Insecure: tc.Otlp.Insecure,
+			Headers:  tc.Otlp.Headers,
+		}
+	}
+
+	shutdown, err := tracing.Setup(c)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Tracing transfers", "otlp", tc.Otlp != nil, "file", tc.File, "sampleRatio", c.SampleRatio)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracing.ShutdownTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			log.Error("Failed to flush traces", "err", err)
+		}
+	}, nil
+}
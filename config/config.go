@@ -16,9 +16,16 @@ import (
 const DefaultKeystorePath = "./keys"
 
 type Config struct {
-	Chains         []RawChainConfig `json:"chains"`
-	KeystorePath   string           `json:"keystorePath,omitempty"`
-	BlockStorePath string           `json:"blockstorePath,omitempty"`
+	Chains         []RawChainConfig    `json:"chains"`
+	KeystorePath   string              `json:"keystorePath,omitempty"`
+	BlockStorePath string              `json:"blockstorePath,omitempty"`
+	Limits         []RawLimitConfig    `json:"limits,omitempty"`
+	Approvals      []RawApprovalConfig `json:"approvals,omitempty"`
+	Screening      *RawScreeningConfig `json:"screening,omitempty"`
+	Tokens         []RawTokenConfig    `json:"tokens,omitempty"`
+	Notifications  *RawNotifyConfig    `json:"notifications,omitempty"`
+	Logging        *RawLoggingConfig   `json:"logging,omitempty"`
+	Tracing        *RawTracingConfig   `json:"tracing,omitempty"`
 }
 
 // RawChainConfig is parsed directly from the config file and should be using to construct the core.ChainConfig
@@ -33,6 +40,92 @@ type RawChainConfig struct {
 	Opts         map[string]string `json:"opts"`
 }
 
+// RawLimitConfig bounds the transfers of a resourceId, see utils/limits. Source and Destination
+// restrict the limit to a route and match any chain when empty.
+type RawLimitConfig struct {
+	ResourceId   string `json:"resourceId"`
+	Source       string `json:"source,omitempty"`
+	Destination  string `json:"destination,omitempty"`
+	MaxAmount    string `json:"maxAmount,omitempty"`    // maximum amount of a single transfer
+	WindowAmount string `json:"windowAmount,omitempty"` // maximum volume within Window
+	Window       string `json:"window,omitempty"`       // rolling window, e.g. "24h"
+}
+
+// RawApprovalConfig holds transfers of a resourceId above Threshold for a manual approval,
+// see utils/approval.
+type RawApprovalConfig struct {
+	ResourceId string `json:"resourceId"`
+	Threshold  string `json:"threshold"`
+	Expiry     string `json:"expiry,omitempty"` // how long a held transfer waits for a decision, e.g. "72h"
+}
+
+// RawScreeningConfig enables recipient screening, see utils/screening.
+type RawScreeningConfig struct {
+	Denylist string `json:"denylist,omitempty"` // path of a local denylist file
+	Url      string `json:"url,omitempty"`      // url of an HTTP screening service
+	Timeout  string `json:"timeout,omitempty"`  // timeout of a screening service request, e.g. "5s"
+}
+
+// RawTokenConfig registers the decimals of a token, see utils/tokens. Decimals applies to
+// every chain not listed in Chains, which maps chain ids to the decimals on that chain.
+type RawTokenConfig struct {
+	ResourceId string           `json:"resourceId"`
+	Symbol     string           `json:"symbol,omitempty"`
+	Decimals   uint8            `json:"decimals"`
+	Chains     map[string]uint8 `json:"chains,omitempty"`
+}
+
+// RawNotifyConfig sends operator notifications to a webhook, see utils/notify. Chain ids are
+// keys of MinBalances and MaxLag.
+type RawNotifyConfig struct {
+	Webhook     string            `json:"webhook"`
+	Template    string            `json:"template,omitempty"`    // text/template of the message text
+	Timeout     string            `json:"timeout,omitempty"`     // timeout of a webhook request, e.g. "10s"
+	Throttle    map[string]string `json:"throttle,omitempty"`    // minimum interval between notifications by event type, e.g. {"parked": "5m"}
+	Dedup       string            `json:"dedup,omitempty"`       // how long a repeated event is suppressed, e.g. "1h"
+	Interval    string            `json:"interval,omitempty"`    // interval of the balance and lag checks, e.g. "1m"
+	MinBalances map[string]string `json:"minBalances,omitempty"` // minimum balance of the relayer account in the smallest unit
+	MaxLag      map[string]uint64 `json:"maxLag,omitempty"`      // maximum number of blocks a listener may fall behind
+}
+
+// RawLoggingConfig configures the log outputs, see utils/logging. Without it logfmt is written to
+// stdout and JSON to bridge_log.json and bridge_log_errors.json.
+type RawLoggingConfig struct {
+	Level  string            `json:"level,omitempty"`  // default level, the verbosity flag takes precedence
+	Levels map[string]string `json:"levels,omitempty"` // levels by chain name or component, e.g. {"router": "trce"}
+	Stdout *RawLogOutput     `json:"stdout,omitempty"` // defaults to logfmt
+	Files  []RawLogOutput    `json:"files,omitempty"`
+}
+
+// RawLogOutput is stdout or a log file.
+type RawLogOutput struct {
+	Path       string `json:"path,omitempty"`
+	Format     string `json:"format,omitempty"`     // "json", "logfmt" or "terminal"
+	Level      string `json:"level,omitempty"`      // stricter level of this output
+	Disabled   bool   `json:"disabled,omitempty"`   // turns stdout off
+	MaxSize    int    `json:"maxSize,omitempty"`    // rotate after this many megabytes
+	Rotate     string `json:"rotate,omitempty"`     // rotate at this interval, e.g. "24h"
+	MaxBackups int    `json:"maxBackups,omitempty"` // number of rotated files kept
+	MaxAge     int    `json:"maxAge,omitempty"`     // days rotated files are kept
+	Compress   bool   `json:"compress,omitempty"`   // gzip rotated files
+}
+
+// RawTracingConfig exports traces of the transfers, see utils/tracing. At least one of Otlp and
+// File must be set.
+type RawTracingConfig struct {
+	Otlp        *RawOtlpConfig `json:"otlp,omitempty"`
+	File        string         `json:"file,omitempty"`        // spans are appended to this file as JSON
+	SampleRatio *float64       `json:"sampleRatio,omitempty"` // fraction of deposits traced, defaults to 1
+}
+
+// RawOtlpConfig is an OTLP/HTTP collector.
+type RawOtlpConfig struct {
+	Endpoint string            `json:"endpoint"`          // host:port, e.g. "localhost:4318"
+	UrlPath  string            `json:"urlPath,omitempty"` // defaults to "/v1/traces"
+	Insecure bool              `json:"insecure,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
 func NewConfig() *Config {
 	return &Config{
 		Chains: []RawChainConfig{},
@@ -56,3 +56,143 @@ var (
 		Value: 8001,
 	}
 )
+
+// Tracking API flags
+var (
+	ApiFlag = &cli.BoolFlag{
+		Name:  "api",
+		Usage: "Enables the transfer tracking API",
+	}
+
+	ApiPortFlag = &cli.IntFlag{
+		Name:  "apiPort",
+		Usage: "Port to serve the transfer tracking API on",
+		Value: 8002,
+	}
+)
+
+// Circuit breaker flags
+var (
+	RouteFlag = &cli.StringFlag{
+		Name:  "route",
+		Usage: "Route of the circuit breaker, formatted as <source>-<destination>-<resourceId>",
+	}
+
+	DiscardFlag = &cli.BoolFlag{
+		Name:  "discard",
+		Usage: "Drop the transfers held on the route instead of releasing them",
+	}
+)
+
+// Approval flags
+var (
+	TransferFlag = &cli.StringFlag{
+		Name:  "transfer",
+		Usage: "Transfer to act on, formatted as <source>-<destination>-<depositNonce>",
+	}
+
+	NoteFlag = &cli.StringFlag{
+		Name:  "note",
+		Usage: "Comment recorded with the decision",
+	}
+
+	AllFlag = &cli.BoolFlag{
+		Name:  "all",
+		Usage: "Include decided transfers",
+	}
+)
+
+// Journal flags
+var (
+	SourceFlag = &cli.StringFlag{
+		Name:  "source",
+		Usage: "Only records of transfers from this chain id",
+	}
+
+	DestinationFlag = &cli.StringFlag{
+		Name:  "destination",
+		Usage: "Only records of transfers to this chain id",
+	}
+
+	NonceFlag = &cli.StringFlag{
+		Name:  "nonce",
+		Usage: "Only records of transfers with this deposit nonce",
+	}
+
+	TxHashFlag = &cli.StringFlag{
+		Name:  "tx",
+		Usage: "Only records of this transaction hash or signature",
+	}
+
+	StatusFlag = &cli.StringFlag{
+		Name:  "status",
+		Usage: "Only records with this status, e.g. failed",
+	}
+
+	SinceFlag = &cli.StringFlag{
+		Name:  "since",
+		Usage: "Only records at or after this time, RFC3339 or YYYY-MM-DD",
+	}
+
+	UntilFlag = &cli.StringFlag{
+		Name:  "until",
+		Usage: "Only records before this time, RFC3339 or YYYY-MM-DD",
+	}
+
+	LimitFlag = &cli.IntFlag{
+		Name:  "limit",
+		Usage: "Maximum number of records shown",
+		Value: 100,
+	}
+)
+
+// Blockstore flags
+var (
+	ChainFlag = &cli.StringFlag{
+		Name:  "chain",
+		Usage: "Chain id or name, all chains if empty where allowed",
+	}
+
+	BlockFlag = &cli.StringFlag{
+		Name:  "block",
+		Usage: "Block the listener resumes from",
+	}
+
+	BlockHashFlag = &cli.StringFlag{
+		Name:  "hash",
+		Usage: "Hash of the block, checked against the chain on startup",
+	}
+
+	SignatureFlag = &cli.StringFlag{
+		Name:  "signature",
+		Usage: "Signature a solana listener resumes after",
+	}
+
+	FileFlag = &cli.StringFlag{
+		Name:  "file",
+		Usage: "JSON file to export to or import from, stdout or stdin if empty",
+	}
+
+	BlockstoreFileFlag = &cli.StringFlag{
+		Name:  "file",
+		Usage: "Blockstore file of the chain, or a pattern matching a single file, instead of the file of the relayer account",
+	}
+
+	OfflineFlag = &cli.BoolFlag{
+		Name:  "offline",
+		Usage: "Do not query the chains for their current head",
+	}
+)
+
+// Backfill flags
+var (
+	FromBlockFlag = &cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First block to backfill, a slot on solana",
+	}
+
+	ToBlockFlag = &cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last block to backfill, included",
+	}
+)
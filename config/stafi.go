@@ -6,4 +6,10 @@ const (
 	ChainIdentity           = "ChainIdentity"
 	FungibleTransferEventId = "FungibleTransfer"
 	AcknowledgeProposal     = "BridgeCommon.acknowledge_proposal"
+	UtilityForceBatch       = "Utility.force_batch"
+	UtilityBatchAll         = "Utility.batch_all"
+	ProxyProxy              = "Proxy.proxy"
+	Multisig                = "Multisig"
+	MultisigAsMulti         = "Multisig.as_multi"
+	MultisigStorage         = "Multisigs"
 )
@@ -121,6 +121,10 @@ func (c *Config) From() string {
 	return c.from
 }
 
+func (c *Config) Endpoint() string {
+	return c.endpoint
+}
+
 func (c *Config) KeystorePath() string {
 	return c.keystorePath
 }
@@ -0,0 +1,283 @@
+package substrate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/go-substrate-rpc-client/client"
+	"github.com/stafiprotocol/go-substrate-rpc-client/types"
+)
+
+// Defaults of the endpoint health checks
+const (
+	DefaultHealthInterval = 15 * time.Second
+	DefaultMaxLag         = 5
+	DefaultMaxLatency     = 5 * time.Second
+	DefaultStaleAfter     = 2 * time.Minute
+)
+
+// EndpointOptions configure the health checks of the endpoints of a chain.
+type EndpointOptions struct {
+	HealthInterval time.Duration // between health checks
+	MaxLag         uint64        // finalized blocks an endpoint may be behind the most advanced one
+	MaxLatency     time.Duration // of the health check requests, 0 for no limit
+	StaleAfter     time.Duration // an endpoint may go without a new finalized block, 0 for no limit
+}
+
+// DefaultEndpointOptions returns the default health check options.
+func DefaultEndpointOptions() EndpointOptions {
+	return EndpointOptions{
+		HealthInterval: DefaultHealthInterval,
+		MaxLag:         DefaultMaxLag,
+		MaxLatency:     DefaultMaxLatency,
+		StaleAfter:     DefaultStaleAfter,
+	}
+}
+
+// probe returns the finalized block number of an endpoint.
+type probe func(ctx context.Context, url string) (uint64, error)
+
+type endpoint struct {
+	url       string
+	client    client.Client // of the health checks
+	checked   bool          // whether a health check finished
+	finalized uint64        // the finalized block number at the last health check
+	advanced  time.Time     // when finalized last increased
+	latency   time.Duration // of the last health check
+	err       error         // of the last health check or request, cleared by a passing health check
+}
+
+// EndpointPool keeps the health of the RPC endpoints of a chain, so its clients use a healthy
+// endpoint and fail over to another one when the endpoint in use fails, answers slowly, falls
+// behind the other endpoints or stops finalizing blocks.
+type EndpointPool struct {
+	opts      EndpointOptions
+	log       log15.Logger
+	probe     probe
+	lock      sync.Mutex // guards the endpoints and current
+	endpoints []*endpoint
+	current   *endpoint
+}
+
+// NewEndpointPool creates a pool of the endpoints at urls, in order of preference, and checks
+// their health once.
+func NewEndpointPool(urls []string, opts EndpointOptions, log log15.Logger) (*EndpointPool, error) {
+	p := newEndpointPool(urls, opts, log, nil)
+	if p == nil {
+		return nil, errors.New("no substrate endpoint")
+	}
+	p.probe = p.finalizedNumber
+	if len(p.endpoints) > 1 {
+		p.check()
+	}
+	return p, nil
+}
+
+func newEndpointPool(urls []string, opts EndpointOptions, log log15.Logger, probe probe) *EndpointPool {
+	p := &EndpointPool{opts: opts, log: log, probe: probe}
+	seen := make(map[string]bool)
+	for _, url := range urls {
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		p.endpoints = append(p.endpoints, &endpoint{url: url})
+	}
+	if len(p.endpoints) == 0 {
+		return nil
+	}
+	p.current = p.endpoints[0]
+	return p
+}
+
+// Start checks the health of the endpoints every health interval until stop is closed.
+func (p *EndpointPool) Start(stop <-chan int) {
+	if len(p.endpoints) == 1 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(p.opts.HealthInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				p.check()
+			}
+		}
+	}()
+}
+
+// Best returns the endpoint to use: the endpoint in use while it is healthy, or else the healthy
+// endpoint with the lowest latency. Without healthy endpoints it keeps to the most advanced
+// endpoint that answers.
+func (p *EndpointPool) Best() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.best().url
+}
+
+// Failed records that a request to the endpoint at url failed, which makes the pool avoid the
+// endpoint until it passes a health check.
+func (p *EndpointPool) Failed(url string, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, e := range p.endpoints {
+		if e.url == url && e.err == nil {
+			e.err = err
+			p.log.Warn("Substrate endpoint failed", "endpoint", url, "err", err)
+		}
+	}
+}
+
+func (p *EndpointPool) best() *endpoint {
+	now := time.Now()
+	if p.healthy(p.current, now) {
+		return p.current
+	}
+	var best *endpoint
+	for _, e := range p.endpoints {
+		if p.healthy(e, now) && (best == nil || e.latency < best.latency) {
+			best = e
+		}
+	}
+	if best == nil {
+		for _, e := range p.endpoints {
+			if e.err == nil && (best == nil || e.finalized > best.finalized) {
+				best = e
+			}
+		}
+	}
+	if best == nil {
+		best = p.current
+	}
+	if best != p.current {
+		p.log.Warn("Switching substrate endpoint", "from", p.current.url, "to", best.url,
+			"finalized", best.finalized, "latency", best.latency)
+		p.current = best
+	}
+	return best
+}
+
+// healthy returns whether e answered its last health check in time and with a finalized block
+// that is recent and close to the most advanced endpoint.
+func (p *EndpointPool) healthy(e *endpoint, now time.Time) bool {
+	if !e.checked || e.err != nil {
+		return false
+	}
+	if p.opts.MaxLatency != 0 && e.latency > p.opts.MaxLatency {
+		return false
+	}
+	if p.opts.StaleAfter != 0 && now.Sub(e.advanced) > p.opts.StaleAfter {
+		return false
+	}
+	for _, other := range p.endpoints {
+		if other.err == nil && other.finalized > e.finalized+p.opts.MaxLag {
+			return false
+		}
+	}
+	return true
+}
+
+// check runs the health checks of all endpoints concurrently.
+func (p *EndpointPool) check() {
+	var wg sync.WaitGroup
+	for _, e := range p.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			timeout := p.opts.MaxLatency
+			if timeout == 0 {
+				timeout = DefaultMaxLatency
+			}
+			// a slow answer still tells whether the endpoint is behind
+			ctx, cancel := context.WithTimeout(context.Background(), 2*timeout)
+			defer cancel()
+			start := time.Now()
+			finalized, err := p.probe(ctx, e.url)
+			latency := time.Since(start)
+
+			p.lock.Lock()
+			defer p.lock.Unlock()
+			e.checked = true
+			e.latency = latency
+			e.err = err
+			if err != nil {
+				p.log.Warn("Substrate endpoint health check failed", "endpoint", e.url, "err", err)
+				return
+			}
+			if finalized > e.finalized || e.advanced.IsZero() {
+				e.finalized = finalized
+				e.advanced = time.Now()
+			}
+		}(e)
+	}
+	wg.Wait()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.best()
+}
+
+// contextCaller is implemented by the clients of gsrpc.
+type contextCaller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// finalizedNumber probes an endpoint for its finalized block number, over a connection kept for
+// the health checks.
+func (p *EndpointPool) finalizedNumber(ctx context.Context, url string) (uint64, error) {
+	var e *endpoint
+	p.lock.Lock()
+	for _, x := range p.endpoints {
+		if x.url == url {
+			e = x
+		}
+	}
+	c := e.client
+	p.lock.Unlock()
+
+	if c == nil {
+		var err error
+		c, err = client.Connect(url)
+		if err != nil {
+			return 0, err
+		}
+		p.lock.Lock()
+		e.client = c
+		p.lock.Unlock()
+	}
+	caller, ok := c.(contextCaller)
+	if !ok {
+		return 0, errors.New("client does not support contexts")
+	}
+
+	var hash types.Hash
+	err := caller.CallContext(ctx, &hash, "chain_getFinalizedHead")
+	if err == nil {
+		var header types.Header
+		err = caller.CallContext(ctx, &header, "chain_getHeader", hash.Hex())
+		if err == nil {
+			return uint64(header.Number), nil
+		}
+	}
+	if !isRPCError(err) {
+		// reconnect at the next check
+		c.Close()
+		p.lock.Lock()
+		e.client = nil
+		p.lock.Unlock()
+	}
+	return 0, err
+}
+
+// isRPCError returns whether err is an error answered by a node, rather than a failure to reach
+// the node.
+func isRPCError(err error) bool {
+	var rpcErr interface{ ErrorCode() int }
+	return errors.As(err, &rpcErr)
+}
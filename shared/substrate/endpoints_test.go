@@ -0,0 +1,86 @@
+package substrate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNodes are endpoints answering health checks with their finalized block, or their error.
+type fakeNodes struct {
+	lock      sync.Mutex
+	finalized map[string]uint64
+	errs      map[string]error
+	delay     map[string]time.Duration
+}
+
+func (n *fakeNodes) probe(ctx context.Context, url string) (uint64, error) {
+	n.lock.Lock()
+	delay, finalized, err := n.delay[url], n.finalized[url], n.errs[url]
+	n.lock.Unlock()
+	time.Sleep(delay)
+	return finalized, err
+}
+
+func (n *fakeNodes) set(url string, finalized uint64, err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.finalized[url] = finalized
+	n.errs[url] = err
+}
+
+func TestEndpointPoolFailover(t *testing.T) {
+	nodes := &fakeNodes{finalized: map[string]uint64{"a": 100, "b": 100, "c": 100}, errs: map[string]error{},
+		delay: map[string]time.Duration{"c": 50 * time.Millisecond}}
+	opts := EndpointOptions{MaxLag: 5, MaxLatency: 20 * time.Millisecond, StaleAfter: time.Hour}
+	p := newEndpointPool([]string{"a", "b", "", "a", "c"}, opts, tlog, nodes.probe)
+	assert.Len(t, p.endpoints, 3)
+	p.check()
+	assert.Equal(t, "a", p.Best())
+
+	// a lagging node is left even though it answers
+	nodes.set("a", 101, nil)
+	nodes.set("b", 110, nil)
+	nodes.set("c", 110, nil)
+	p.check()
+	assert.Equal(t, "b", p.Best())
+
+	// a failed request is avoided until the next health check, the slow c is still preferred
+	// to the lagging a
+	p.Failed("b", errors.New("connection reset"))
+	assert.Equal(t, "c", p.Best())
+	nodes.set("a", 110, nil)
+	nodes.set("b", 110, errors.New("connection refused"))
+	p.check()
+	assert.Equal(t, "a", p.Best())
+	nodes.set("b", 110, nil)
+	p.check()
+	assert.Equal(t, "a", p.Best(), "the endpoint in use is kept while healthy")
+
+	// without healthy endpoints the most advanced answering one is used
+	nodes.set("a", 0, errors.New("dial error"))
+	nodes.set("b", 111, errors.New("dial error"))
+	nodes.set("c", 112, nil)
+	p.check()
+	assert.Equal(t, "c", p.Best())
+}
+
+func TestEndpointPoolStale(t *testing.T) {
+	nodes := &fakeNodes{finalized: map[string]uint64{"a": 100, "b": 100}, errs: map[string]error{}}
+	opts := EndpointOptions{MaxLag: 5, StaleAfter: 30 * time.Millisecond}
+	p := newEndpointPool([]string{"a", "b"}, opts, tlog, nodes.probe)
+	p.check()
+	assert.Equal(t, "a", p.Best())
+
+	time.Sleep(20 * time.Millisecond)
+	nodes.set("b", 101, nil)
+	p.check()
+	time.Sleep(20 * time.Millisecond)
+	// a stopped finalizing while b is still within the lag
+	p.check()
+	assert.Equal(t, "b", p.Best())
+}
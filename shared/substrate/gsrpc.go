@@ -3,25 +3,65 @@ package substrate
 import (
 	"errors"
 	"fmt"
-	"github.com/stafiprotocol/chainbridge/config"
+	"math/big"
+	"math/bits"
+	"sync"
 	"time"
 
 	"github.com/ChainSafe/log15"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	gsrpc "github.com/stafiprotocol/go-substrate-rpc-client"
 	gsrpcConfig "github.com/stafiprotocol/go-substrate-rpc-client/config"
 	"github.com/stafiprotocol/go-substrate-rpc-client/rpc/author"
 	"github.com/stafiprotocol/go-substrate-rpc-client/signature"
 	"github.com/stafiprotocol/go-substrate-rpc-client/types"
+	"golang.org/x/crypto/blake2b"
 )
 
+// Retries of an outcome check that could not fetch the events of the block
+const outcomeRetryLimit = 3
+
+var outcomeRetryInterval = 2 * time.Second
+
 type GsrpcClient struct {
 	endpoint    string
+	endpoints   *EndpointPool // nil to only use endpoint
+	apiLock     sync.Mutex    // guards endpoint and api
 	addressType string
 	api         *gsrpc.SubstrateAPI
 	key         *signature.KeyringPair
 	genesisHash types.Hash
 	stop        <-chan int
 	log         log15.Logger
+
+	checkOutcome    func(blockHash, extHash string) error // checks the dispatch outcome of an included extrinsic
+	finalityTimeout time.Duration                         // how long to wait for finality, 0 to not wait
+	submit          SubmitOptions
+
+	metadata    *MetadataCache
+	runtime     *Runtime   // the latest runtime seen
+	runtimeLock sync.Mutex // guards runtime
+}
+
+// SubmitOptions configure how SignAndSubmit signs and resubmits extrinsics.
+type SubmitOptions struct {
+	EraPeriod uint64   // blocks an extrinsic is valid for, 0 for immortal extrinsics
+	Tip       *big.Int // tip of the first submission, nil for none
+	TipStep   *big.Int // added to the tip on every resubmission
+	MaxTip    *big.Int // limit of the tip, nil for no limit
+	Resubmits int      // resubmissions of a dropped or retracted extrinsic
+}
+
+// nextTip returns the tip of the resubmission following one with tip.
+func (o SubmitOptions) nextTip(tip *big.Int) *big.Int {
+	next := new(big.Int).Set(tip)
+	if o.TipStep != nil {
+		next.Add(next, o.TipStep)
+	}
+	if o.MaxTip != nil && next.Cmp(o.MaxTip) > 0 {
+		next.Set(o.MaxTip)
+	}
+	return next
 }
 
 func NewGsrpcClient(endpoint, addressType string, key *signature.KeyringPair, log log15.Logger, stop <-chan int) (*GsrpcClient, error) {
@@ -51,28 +91,100 @@ func NewGsrpcClient(endpoint, addressType string, key *signature.KeyringPair, lo
 		genesisHash: genesisHash,
 		stop:        stop,
 		log:         log,
+		metadata:    NewMetadataCache(),
 	}, nil
 }
 
+// SetMetadataCache shares the metadata cache of the client, usually with the SarpcClient of the
+// same chain.
+func (gc *GsrpcClient) SetMetadataCache(c *MetadataCache) {
+	gc.metadata = c
+}
+
+// SetOutcomeCheck sets the check SignAndSubmit runs once the extrinsic is included in a block,
+// usually SarpcClient.ExtrinsicOutcome.
+func (gc *GsrpcClient) SetOutcomeCheck(check func(blockHash, extHash string) error) {
+	gc.checkOutcome = check
+}
+
+// SetSubmitOptions sets the era, tips and resubmissions of SignAndSubmit.
+func (gc *GsrpcClient) SetSubmitOptions(o SubmitOptions) {
+	gc.submit = o
+}
+
+// SetFinalityTimeout makes SignAndSubmit wait up to timeout for the block including the extrinsic
+// to be finalized. With 0 it returns as soon as the extrinsic is included.
+func (gc *GsrpcClient) SetFinalityTimeout(timeout time.Duration) {
+	gc.finalityTimeout = timeout
+}
+
+// SetEndpoints makes the client fail over between the endpoints of the pool, reporting failed
+// requests to it.
+func (gc *GsrpcClient) SetEndpoints(p *EndpointPool) {
+	gc.apiLock.Lock()
+	defer gc.apiLock.Unlock()
+	gc.endpoints = p
+}
+
+// FlashApi returns the api of the endpoint in use, reconnecting if the endpoint does not answer.
+// With an endpoint pool it switches to the endpoint the pool picks.
 func (gc *GsrpcClient) FlashApi() (*gsrpc.SubstrateAPI, error) {
-	_, err := gc.api.RPC.Chain.GetBlockHashLatest()
-	if err != nil {
-		var api *gsrpc.SubstrateAPI
-		for i := 0; i < 3; i++ {
-			api, err = gsrpc.NewSubstrateAPI(gc.endpoint)
-			if err == nil {
-				break
-			} else {
-				time.Sleep(time.Millisecond * 100)
-			}
+	gc.apiLock.Lock()
+	defer gc.apiLock.Unlock()
+
+	endpoint := gc.endpoint
+	if gc.endpoints != nil {
+		endpoint = gc.endpoints.Best()
+	}
+	if endpoint == gc.endpoint {
+		_, err := gc.api.RPC.Chain.GetBlockHashLatest()
+		if err == nil {
+			return gc.api, nil
 		}
-		if api != nil {
-			gc.api = api
+		if gc.endpoints != nil {
+			gc.endpoints.Failed(endpoint, err)
+			endpoint = gc.endpoints.Best()
+		}
+	}
+
+	var api *gsrpc.SubstrateAPI
+	var err error
+	for i := 0; i < 3; i++ {
+		api, err = gsrpc.NewSubstrateAPI(endpoint)
+		if err == nil {
+			break
+		} else {
+			time.Sleep(time.Millisecond * 100)
 		}
 	}
+	if api == nil {
+		if gc.endpoints != nil {
+			gc.endpoints.Failed(endpoint, err)
+		}
+		return gc.api, nil
+	}
+	if endpoint != gc.endpoint {
+		gc.log.Info("Gsrpc switched endpoint", "from", gc.endpoint, "to", endpoint)
+		// leave submissions watched over the old endpoint time to finish
+		old := gc.api
+		time.AfterFunc(gc.finalityTimeout+2*time.Minute, old.Client.Close)
+	}
+	gc.api, gc.endpoint = api, endpoint
 	return gc.api, nil
 }
 
+// endpointFailed reports a failed request to the endpoint pool, unless the node answered it with
+// an error. It returns err, wrapped in EndpointError if the endpoint failed.
+func (gc *GsrpcClient) endpointFailed(endpoint string, err error) error {
+	if err == nil || isRPCError(err) {
+		return err
+	}
+	if gc.endpoints != nil {
+		gc.endpoints.Failed(endpoint, err)
+	}
+	return fmt.Errorf("%w %s: %s", EndpointError, endpoint, err)
+}
+
 func (gc *GsrpcClient) Address() string {
 	return gc.key.Address
 }
@@ -124,6 +236,14 @@ func (gc *GsrpcClient) GetHeader(blockHash types.Hash) (*types.Header, error) {
 	return api.RPC.Chain.GetHeader(blockHash)
 }
 
+func (gc *GsrpcClient) GetBlockHash(number uint64) (types.Hash, error) {
+	api, err := gc.FlashApi()
+	if err != nil {
+		return types.NewHash([]byte{}), err
+	}
+	return api.RPC.Chain.GetBlockHash(number)
+}
+
 func (gc *GsrpcClient) GetBlockNumber(blockHash types.Hash) (uint64, error) {
 	head, err := gc.GetHeader(blockHash)
 	if err != nil {
@@ -158,17 +278,121 @@ func (gc *GsrpcClient) QueryStorage(prefix, method string, arg1, arg2 []byte, re
 	return ok, nil
 }
 
+// QueryStorageRaw performs a storage lookup returning the encoded value, empty if there is none.
+func (gc *GsrpcClient) QueryStorageRaw(prefix, method string, arg1, arg2 []byte) ([]byte, error) {
+	meta, err := gc.GetLatestMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := types.CreateStorageKey(meta, prefix, method, arg1, arg2)
+	if err != nil {
+		return nil, err
+	}
+
+	api, err := gc.FlashApi()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := api.RPC.State.GetStorageRawLatest(key)
+	if err != nil {
+		return nil, err
+	}
+	return *raw, nil
+}
+
 func (gc *GsrpcClient) GetLatestMetadata() (*types.Metadata, error) {
+	rt, err := gc.LatestRuntime()
+	if err != nil {
+		return nil, err
+	}
+	return rt.Metadata, nil
+}
+
+// LatestRuntime returns the latest runtime version with its metadata. The metadata is only
+// fetched when the spec version changed since the last call, or taken from the metadata cache.
+func (gc *GsrpcClient) LatestRuntime() (*Runtime, error) {
+	rv, err := gc.GetLatestRuntimeVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	gc.runtimeLock.Lock()
+	defer gc.runtimeLock.Unlock()
+	if gc.runtime != nil && gc.runtime.Version.SpecVersion == rv.SpecVersion {
+		return gc.runtime, nil
+	}
+
 	api, err := gc.FlashApi()
 	if err != nil {
 		return nil, err
 	}
-	meta, err := api.RPC.State.GetMetadataLatest()
+	// version and metadata of the same block, in case the runtime is upgraded in between
+	hash, err := api.RPC.Chain.GetBlockHashLatest()
+	if err != nil {
+		return nil, err
+	}
+	rv, err = api.RPC.State.GetRuntimeVersion(hash)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := gc.rawMetadata(api, hash, int(rv.SpecVersion))
+	if err != nil {
+		return nil, err
+	}
+	var meta types.Metadata
+	err = types.DecodeFromHexString(raw, &meta)
 	if err != nil {
 		return nil, err
 	}
 
-	return meta, nil
+	if gc.runtime != nil {
+		gc.log.Info("Runtime upgraded", "specVersion", rv.SpecVersion, "previous", gc.runtime.Version.SpecVersion)
+	}
+	gc.runtime = &Runtime{Version: rv, Metadata: &meta}
+	return gc.runtime, nil
+}
+
+// rawMetadata returns the raw metadata of spec version specVersion at block hash, from the metadata
+// cache if it was fetched before.
+func (gc *GsrpcClient) rawMetadata(api *gsrpc.SubstrateAPI, hash types.Hash, specVersion int) (string, error) {
+	raw, ok := gc.metadata.get(specVersion)
+	if ok {
+		return raw, nil
+	}
+	err := api.Client.Call(&raw, "state_getMetadata", hash.Hex())
+	if err != nil {
+		return "", err
+	}
+	gc.metadata.put(specVersion, raw)
+	return raw, nil
+}
+
+// MetadataVersion returns the metadata version of the latest runtime. Unlike LatestRuntime it
+// also works for runtimes whose metadata types.Metadata cannot decode, such as V14.
+func (gc *GsrpcClient) MetadataVersion() (int, error) {
+	api, err := gc.FlashApi()
+	if err != nil {
+		return 0, err
+	}
+	hash, err := api.RPC.Chain.GetBlockHashLatest()
+	if err != nil {
+		return 0, err
+	}
+	rv, err := api.RPC.State.GetRuntimeVersion(hash)
+	if err != nil {
+		return 0, err
+	}
+	raw, err := gc.rawMetadata(api, hash, int(rv.SpecVersion))
+	if err != nil {
+		return 0, err
+	}
+	b, err := hexutil.Decode(raw)
+	if err != nil {
+		return 0, err
+	}
+	return metadataVersion(b), nil
 }
 
 func (gc *GsrpcClient) GetLatestRuntimeVersion() (*types.RuntimeVersion, error) {
@@ -208,17 +432,26 @@ func (gc *GsrpcClient) GetAccountInfo() (*types.AccountInfo, error) {
 }
 
 func (gc *GsrpcClient) NewUnsignedExtrinsic(callMethod string, args ...interface{}) (interface{}, error) {
-	gc.log.Debug("Submitting substrate call...", "callMethod", callMethod, "addressType", gc.addressType, "sender", gc.key.Address)
-	meta, err := gc.GetLatestMetadata()
+	rt, err := gc.LatestRuntime()
 	if err != nil {
 		return nil, err
 	}
+	return gc.NewUnsignedExtrinsicFor(rt, callMethod, args...)
+}
 
-	call, err := types.NewCall(meta, callMethod, args...)
+// NewUnsignedExtrinsicFor encodes the call with the metadata of rt, whose version should be passed
+// to SignAndSubmitFor.
+func (gc *GsrpcClient) NewUnsignedExtrinsicFor(rt *Runtime, callMethod string, args ...interface{}) (interface{}, error) {
+	gc.log.Debug("Submitting substrate call...", "callMethod", callMethod, "addressType", gc.addressType, "sender", gc.key.Address)
+	call, err := types.NewCall(rt.Metadata, callMethod, args...)
 	if err != nil {
 		return nil, err
 	}
+	return gc.NewUnsignedExtrinsicOf(call)
+}
 
+// NewUnsignedExtrinsicOf returns the unsigned extrinsic of an encoded call.
+func (gc *GsrpcClient) NewUnsignedExtrinsicOf(call types.Call) (interface{}, error) {
 	if gc.addressType == AddressTypeAccountId {
 		unsignedExt := types.NewExtrinsic(call)
 		return &unsignedExt, nil
@@ -231,55 +464,272 @@ func (gc *GsrpcClient) NewUnsignedExtrinsic(callMethod string, args ...interface
 }
 
 func (gc *GsrpcClient) SignAndSubmitTx(ext interface{}) error {
-	err := gc.signExtrinsic(ext)
+	_, err := gc.SignAndSubmit(ext)
+	return err
+}
+
+// SignAndSubmit signs and submits ext and waits until it is included in a block, checking its
+// dispatch outcome and, with a finality timeout, waiting for the block to be finalized. A dropped
+// or retracted extrinsic is signed again with a higher tip and resubmitted. Once ext is signed
+// the hash of the last submission is returned, also if the submission fails.
+func (gc *GsrpcClient) SignAndSubmit(ext interface{}) (string, error) {
+	hash, _, err := gc.SignAndSubmitFor(nil, ext)
+	return hash, err
+}
+
+// SignAndSubmitFor is SignAndSubmit for an extrinsic whose calls were encoded for runtime rt, also
+// returning the hash of the block including ext. If the runtime was upgraded since, ext is not
+// submitted and RuntimeUpgradedError returned, so the calls can be encoded again. A nil rt skips
+// the check.
+func (gc *GsrpcClient) SignAndSubmitFor(rt *Runtime, ext interface{}) (string, string, error) {
+	restore, err := unsignedCopy(ext)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
+	tip := new(big.Int)
+	if gc.submit.Tip != nil {
+		tip.Set(gc.submit.Tip)
+	}
+	for i := 0; ; i++ {
+		hash, block, err := gc.submitOnce(rt, ext, tip)
+		if i == gc.submit.Resubmits || !(errors.Is(err, DroppedError) || errors.Is(err, RetractedError) || errors.Is(err, EndpointError)) {
+			return hash, block, err
+		}
+		// a failed endpoint is not a reason to pay more
+		if !errors.Is(err, EndpointError) {
+			tip = gc.submit.nextTip(tip)
+		}
+		gc.log.Warn("Resubmitting extrinsic", "hash", hash, "err", err, "tip", tip)
+		restore()
+	}
+}
+
+// unsignedCopy keeps a copy of the unsigned ext and returns the function restoring it.
+func unsignedCopy(xt interface{}) (func(), error) {
+	switch ext := xt.(type) {
+	case *types.Extrinsic:
+		unsigned := *ext
+		return func() { *ext = unsigned }, nil
+	case *types.ExtrinsicMulti:
+		unsigned := *ext
+		return func() { *ext = unsigned }, nil
+	default:
+		return nil, errors.New("extrinsic cast error")
+	}
+}
+
+// submitOnce signs ext with tip, checks the balance covers the estimated fee and tip, and
+// submits and watches it. It returns the hash of ext and of the block including it.
+func (gc *GsrpcClient) submitOnce(rt *Runtime, ext interface{}, tip *big.Int) (string, string, error) {
+	err := gc.signExtrinsic(rt, ext, tip)
+	if err != nil {
+		return "", "", err
+	}
+	hash, err := extrinsicHash(ext)
+	if err != nil {
+		return "", "", err
+	}
+
+	fee, err := gc.EstimateFee(ext)
+	if err != nil {
+		return hash, "", err
+	}
+	err = gc.checkBalance(new(big.Int).Add(fee, tip))
+	if err != nil {
+		return hash, "", err
+	}
+	gc.log.Debug("Extrinsic fee estimated", "hash", hash, "fee", fee, "tip", tip)
+
 	api, err := gc.FlashApi()
 	if err != nil {
-		return err
+		return hash, "", err
 	}
+	endpoint := api.Client.URL()
 	// Do the transfer and track the actual status
 	sub, err := api.RPC.Author.SubmitAndWatch(ext)
 	if err != nil {
-		return err
+		return hash, "", gc.endpointFailed(endpoint, err)
 	}
-	gc.log.Trace("Extrinsic submission succeeded")
+	gc.log.Trace("Extrinsic submission succeeded", "hash", hash, "endpoint", endpoint)
 	defer sub.Unsubscribe()
 
-	return gc.watchSubmission(sub)
+	block, err := gc.watchSubmission(sub, hash)
+	var subErr *subscriptionError
+	if errors.As(err, &subErr) {
+		err = gc.endpointFailed(endpoint, subErr.err)
+	}
+	return hash, block, err
 }
 
-func (gc *GsrpcClient) watchSubmission(sub *author.ExtrinsicStatusSubscription) error {
-	for {
+// feeInfo is the result of payment_queryInfo
+type feeInfo struct {
+	PartialFee string `json:"partialFee"`
+}
+
+// EstimateFee returns the fee of the signed ext estimated by payment_queryInfo, without the tip.
+func (gc *GsrpcClient) EstimateFee(ext interface{}) (*big.Int, error) {
+	enc, err := types.EncodeToHexString(ext)
+	if err != nil {
+		return nil, err
+	}
+	api, err := gc.FlashApi()
+	if err != nil {
+		return nil, err
+	}
+	var info feeInfo
+	err = api.Client.Call(&info, "payment_queryInfo", enc)
+	if err != nil {
+		return nil, gc.endpointFailed(api.Client.URL(), err)
+	}
+	return parseFee(info.PartialFee)
+}
+
+// parseFee parses a fee, which nodes return as a decimal or a hex string.
+func parseFee(s string) (*big.Int, error) {
+	fee, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		return nil, fmt.Errorf("fee %q invalid", s)
+	}
+	return fee, nil
+}
+
+// checkBalance returns an error if the balance of the account available for fees is below amount.
+func (gc *GsrpcClient) checkBalance(amount *big.Int) error {
+	ac, err := gc.GetAccountInfo()
+	if err != nil {
+		return err
+	}
+	available := new(big.Int).Sub(ac.Data.Free.Int, ac.Data.FreeFrozen.Int)
+	if available.Cmp(amount) < 0 {
+		return fmt.Errorf("balance %s of %s below the fee and tip %s", available, gc.key.Address, amount)
+	}
+	return nil
+}
+
+// extrinsicHash returns the blake2b-256 hash of the encoded extrinsic, as shown by explorers.
+func extrinsicHash(ext interface{}) (string, error) {
+	enc, err := types.EncodeToBytes(ext)
+	if err != nil {
+		return "", err
+	}
+	hash := blake2b.Sum256(enc)
+	return hexutil.Encode(hash[:]), nil
+}
+
+// statusSubscription is the part of author.ExtrinsicStatusSubscription watchSubmission uses.
+type statusSubscription interface {
+	Chan() <-chan types.ExtrinsicStatus
+	Err() <-chan error
+}
+
+var _ statusSubscription = &author.ExtrinsicStatusSubscription{}
+
+// subscriptionError is the error of the subscription watching a submission.
+type subscriptionError struct {
+	err error
+}
+
+func (e *subscriptionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *subscriptionError) Unwrap() error {
+	return e.err
+}
+
+// outcome runs the outcome check of the extrinsic with hash included in block. A check that
+// could not fetch the outcome is retried, and still failing an OutcomeUnknownError is returned:
+// the extrinsic is included but whether it succeeded is left to the caller to find out.
+func (gc *GsrpcClient) outcome(block, hash string) error {
+	if gc.checkOutcome == nil {
+		return nil
+	}
+	for i := 0; ; i++ {
+		err := gc.checkOutcome(block, hash)
+		if i == outcomeRetryLimit || !errors.Is(err, OutcomeUnknownError) {
+			return err
+		}
+		gc.log.Warn("Extrinsic outcome check failed, retrying", "block", block, "err", err)
 		select {
 		case <-gc.stop:
 			return TerminatedError
+		case <-time.After(outcomeRetryInterval):
+		}
+	}
+}
+
+// watchSubmission follows the status of the extrinsic with hash until it is included in a block,
+// or with a finality timeout until the block is finalized, and returns the hash of the block. The
+// block is also returned with the failed or unknown outcome of an included extrinsic.
+func (gc *GsrpcClient) watchSubmission(sub statusSubscription, hash string) (string, error) {
+	var included string
+	var finality <-chan time.Time
+	for {
+		select {
+		case <-gc.stop:
+			return "", TerminatedError
+		case <-finality:
+			if included == "" {
+				return "", fmt.Errorf("%w and not included again within %s", RetractedError, gc.finalityTimeout)
+			}
+			return "", fmt.Errorf("block %s including the extrinsic not finalized within %s", included, gc.finalityTimeout)
 		case status := <-sub.Chan():
 			switch {
 			case status.IsInBlock:
-				gc.log.Info("Extrinsic included in block", "block", status.AsInBlock.Hex())
-				return nil
+				included = status.AsInBlock.Hex()
+				gc.log.Info("Extrinsic included in block", "block", included)
+				err := gc.outcome(included, hash)
+				if err != nil {
+					return included, err
+				}
+				if gc.finalityTimeout == 0 {
+					return included, nil
+				}
+				if finality == nil {
+					finality = time.After(gc.finalityTimeout)
+				}
+			case status.IsFinalized:
+				block := status.AsFinalized.Hex()
+				if block != included {
+					err := gc.outcome(block, hash)
+					if err != nil {
+						return block, err
+					}
+				}
+				gc.log.Info("Extrinsic finalized", "block", block)
+				return block, nil
 			case status.IsRetracted:
-				return fmt.Errorf("extrinsic retracted: %s", status.AsRetracted.Hex())
+				if finality == nil {
+					return "", fmt.Errorf("%w: %s", RetractedError, status.AsRetracted.Hex())
+				}
+				// back in the pool, wait for it to be included again
+				gc.log.Warn("Block including the extrinsic retracted", "block", status.AsRetracted.Hex())
+				included = ""
+			case status.IsFinalityTimeout:
+				return "", fmt.Errorf("block %s including the extrinsic not finalized", status.AsFinalityTimeout.Hex())
+			case status.IsUsurped:
+				return "", fmt.Errorf("extrinsic usurped by %s", status.AsUsurped.Hex())
 			case status.IsDropped:
-				return fmt.Errorf("extrinsic dropped from network")
+				return "", DroppedError
 			case status.IsInvalid:
-				return fmt.Errorf("extrinsic invalid")
+				return "", fmt.Errorf("extrinsic invalid")
 			}
 		case err := <-sub.Err():
 			gc.log.Trace("Extrinsic subscription error", "err", err)
-			return err
+			return "", &subscriptionError{err}
 		}
 	}
 }
 
-func (gc *GsrpcClient) signExtrinsic(xt interface{}) error {
+func (gc *GsrpcClient) signExtrinsic(rt *Runtime, xt interface{}, tip *big.Int) error {
 	rv, err := gc.GetLatestRuntimeVersion()
 	if err != nil {
 		return err
 	}
+	if rt != nil && rv.SpecVersion != rt.Version.SpecVersion {
+		return fmt.Errorf("%w: spec version %d, encoded for %d", RuntimeUpgradedError, rv.SpecVersion, rt.Version.SpecVersion)
+	}
 
 	nonce, err := gc.GetLatestNonce()
 	if err != nil {
@@ -292,9 +742,29 @@ func (gc *GsrpcClient) signExtrinsic(xt interface{}) error {
 		GenesisHash:        gc.genesisHash,
 		Nonce:              types.NewUCompactFromUInt(uint64(nonce)),
 		SpecVersion:        rv.SpecVersion,
-		Tip:                types.NewUCompactFromUInt(0),
+		Tip:                types.NewUCompact(tip),
 		TransactionVersion: rv.TransactionVersion,
 	}
+	if gc.submit.EraPeriod != 0 {
+		// the era starts at the finalized head, or at the block before it its quantized phase
+		// points to, and the hash of that birth block is signed
+		head, err := gc.GetFinalizedHead()
+		if err != nil {
+			return err
+		}
+		number, err := gc.GetBlockNumber(head)
+		if err != nil {
+			return err
+		}
+		era, birth := mortalEra(number, gc.submit.EraPeriod)
+		if birth != number {
+			if head, err = gc.GetBlockHash(birth); err != nil {
+				return err
+			}
+		}
+		o.BlockHash = head
+		o.Era = types.ExtrinsicEra{IsMortalEra: true, AsMortalEra: era}
+	}
 
 	if ext, ok := xt.(*types.Extrinsic); ok {
 		gc.log.Info("signExtrinsic", "addressType", gc.addressType)
@@ -315,17 +785,41 @@ func (gc *GsrpcClient) signExtrinsic(xt interface{}) error {
 	return nil
 }
 
+// mortalEra returns the era starting at block current and lasting period blocks, rounded to a
+// power of two between 4 and 65536, encoded like substrate's Era::mortal, and the birth block
+// of the era. Periods above 4096 quantize the phase, so the era is born up to period/4096
+// blocks before current.
+func mortalEra(current, period uint64) (types.MortalEra, uint64) {
+	p := uint64(4)
+	for p < period && p < 1<<16 {
+		p <<= 1
+	}
+	quantizeFactor := p >> 12
+	if quantizeFactor < 1 {
+		quantizeFactor = 1
+	}
+	phase := current % p / quantizeFactor
+
+	low := uint64(bits.TrailingZeros64(p) - 1)
+	if low > 15 {
+		low = 15
+	}
+	encoded := low | phase<<4
+	return types.MortalEra{First: byte(encoded), Second: byte(encoded >> 8)}, current - current%quantizeFactor
+}
+
 func (gc *GsrpcClient) PublicKey() []byte {
 	return gc.key.PublicKey
 }
 
-func (gc *GsrpcClient) ChainId() (uint8, error) {
+// ChainId returns the chain id held by the constant of the bridge pallet.
+func (gc *GsrpcClient) ChainId(pallet, constant string) (uint8, error) {
 	api, err := gc.FlashApi()
 	if err != nil {
 		return 0, err
 	}
 	var chainId uint8
-	err = api.RPC.State.GetConst(config.BridgeCommon, config.ChainIdentity, &chainId)
+	err = api.RPC.State.GetConst(pallet, constant, &chainId)
 	if err != nil {
 		return 0, err
 	}
@@ -1,11 +1,18 @@
 package substrate
 
 import (
+	"encoding/json"
+	"fmt"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ChainSafe/log15"
 	"github.com/stafiprotocol/chainbridge/utils/keystore"
+	gsrpc "github.com/stafiprotocol/go-substrate-rpc-client"
 	"github.com/stafiprotocol/go-substrate-rpc-client/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -91,3 +98,213 @@ func TestSarpcClient_GetChainEvents(t *testing.T) {
 	// 	//}
 	// }
 }
+
+type fakeSubscription struct {
+	statuses chan types.ExtrinsicStatus
+	errs     chan error
+}
+
+func (s *fakeSubscription) Chan() <-chan types.ExtrinsicStatus { return s.statuses }
+func (s *fakeSubscription) Err() <-chan error                  { return s.errs }
+
+func watch(gc *GsrpcClient, statuses ...types.ExtrinsicStatus) error {
+	sub := &fakeSubscription{statuses: make(chan types.ExtrinsicStatus, len(statuses)), errs: make(chan error)}
+	for _, s := range statuses {
+		sub.statuses <- s
+	}
+	_, err := gc.watchSubmission(sub, "0xext")
+	return err
+}
+
+func TestWatchSubmissionOutcome(t *testing.T) {
+	inBlock := types.ExtrinsicStatus{IsInBlock: true, AsInBlock: types.Hash{1}}
+	var checked []string
+	gc := &GsrpcClient{log: tlog, stop: make(chan int)}
+	gc.SetOutcomeCheck(func(blockHash, extHash string) error {
+		checked = append(checked, blockHash)
+		assert.Equal(t, "0xext", extHash)
+		if blockHash == inBlock.AsInBlock.Hex() {
+			return &DispatchError{Block: blockHash, Kind: "BadOrigin"}
+		}
+		return nil
+	})
+
+	err := watch(gc, types.ExtrinsicStatus{IsReady: true}, inBlock)
+	assert.IsType(t, &DispatchError{}, err)
+	assert.Equal(t, []string{inBlock.AsInBlock.Hex()}, checked)
+
+	checked = nil
+	other := types.ExtrinsicStatus{IsInBlock: true, AsInBlock: types.Hash{2}}
+	assert.NoError(t, watch(gc, other))
+	assert.Equal(t, []string{other.AsInBlock.Hex()}, checked)
+}
+
+func TestWatchSubmissionOutcomeUnknown(t *testing.T) {
+	defer func(interval time.Duration) { outcomeRetryInterval = interval }(outcomeRetryInterval)
+	outcomeRetryInterval = time.Millisecond
+
+	inBlock := types.ExtrinsicStatus{IsInBlock: true, AsInBlock: types.Hash{1}}
+	checks := 0
+	failing := 2
+	gc := &GsrpcClient{log: tlog, stop: make(chan int)}
+	gc.SetOutcomeCheck(func(blockHash, extHash string) error {
+		checks++
+		if checks <= failing {
+			return fmt.Errorf("%w: events unavailable", OutcomeUnknownError)
+		}
+		return nil
+	})
+
+	// the lookup is retried until it succeeds
+	assert.NoError(t, watch(gc, inBlock))
+	assert.Equal(t, 3, checks)
+
+	// and reported as unknown, not as a failure of the extrinsic, once the retries are used up
+	checks, failing = 0, outcomeRetryLimit+1
+	sub := &fakeSubscription{statuses: make(chan types.ExtrinsicStatus, 1), errs: make(chan error)}
+	sub.statuses <- inBlock
+	block, err := gc.watchSubmission(sub, "0xext")
+	assert.ErrorIs(t, err, OutcomeUnknownError)
+	assert.Equal(t, inBlock.AsInBlock.Hex(), block)
+	assert.Equal(t, outcomeRetryLimit+1, checks)
+
+	// a dispatch error is not retried
+	checks = 0
+	gc.SetOutcomeCheck(func(blockHash, extHash string) error {
+		checks++
+		return &DispatchError{Block: blockHash, Kind: "BadOrigin"}
+	})
+	assert.IsType(t, &DispatchError{}, watch(gc, inBlock))
+	assert.Equal(t, 1, checks)
+}
+
+func TestWatchSubmissionFinality(t *testing.T) {
+	gc := &GsrpcClient{log: tlog, stop: make(chan int)}
+	gc.SetFinalityTimeout(time.Second)
+	var checked []string
+	gc.SetOutcomeCheck(func(blockHash, extHash string) error {
+		checked = append(checked, blockHash)
+		return nil
+	})
+
+	// retracted and included again before finality
+	first := types.ExtrinsicStatus{IsInBlock: true, AsInBlock: types.Hash{1}}
+	second := types.ExtrinsicStatus{IsInBlock: true, AsInBlock: types.Hash{2}}
+	err := watch(gc, first, types.ExtrinsicStatus{IsRetracted: true, AsRetracted: types.Hash{1}}, second,
+		types.ExtrinsicStatus{IsFinalized: true, AsFinalized: types.Hash{2}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first.AsInBlock.Hex(), second.AsInBlock.Hex()}, checked)
+
+	err = watch(gc, first, types.ExtrinsicStatus{IsFinalityTimeout: true, AsFinalityTimeout: types.Hash{1}})
+	assert.Error(t, err)
+
+	gc.SetFinalityTimeout(50 * time.Millisecond)
+	err = watch(gc, first)
+	assert.Error(t, err)
+}
+
+func TestMortalEra(t *testing.T) {
+	// encodings of substrate's Era::mortal(period, current)
+	for _, c := range []struct {
+		current, period, birth uint64
+		era                    types.MortalEra
+	}{
+		{42, 64, 42, types.MortalEra{First: 165, Second: 2}},
+		{64 + 42, 50, 64 + 42, types.MortalEra{First: 165, Second: 2}},
+		{100, 1, 100, types.MortalEra{First: 1, Second: 0}},
+		{20000, 1 << 20, 20000, types.MortalEra{First: 0x2f, Second: 0x4e}},
+		// above 4096 the phase is quantized, the era is born at the quantized block
+		{20005, 1 << 20, 20000, types.MortalEra{First: 0x2f, Second: 0x4e}},
+		{10003, 8192, 10002, types.MortalEra{First: 0x9c, Second: 0x38}},
+	} {
+		era, birth := mortalEra(c.current, c.period)
+		assert.Equal(t, c.era, era, "%d %d", c.current, c.period)
+		assert.Equal(t, c.birth, birth, "%d %d", c.current, c.period)
+	}
+}
+
+func TestNextTip(t *testing.T) {
+	o := SubmitOptions{TipStep: big.NewInt(300), MaxTip: big.NewInt(1000)}
+	tip := big.NewInt(100)
+	for _, expected := range []int64{400, 700, 1000, 1000} {
+		tip = o.nextTip(tip)
+		assert.Equal(t, expected, tip.Int64())
+	}
+	assert.Equal(t, int64(5), SubmitOptions{}.nextTip(big.NewInt(5)).Int64())
+
+	fee, err := parseFee("125000000")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(125000000), fee.Int64())
+	fee, err = parseFee("0x10")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(16), fee.Int64())
+	_, err = parseFee("")
+	assert.Error(t, err)
+}
+
+// runtimeServer answers the JSON-RPC requests of a runtime with the given spec version and
+// counts the metadata requests.
+type runtimeServer struct {
+	specVersion   atomic.Int32
+	metadataCalls atomic.Int32
+}
+
+func (s *runtimeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Id     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var result interface{}
+	switch req.Method {
+	case "chain_getBlockHash":
+		result = types.Hash{1}.Hex()
+	case "state_getRuntimeVersion":
+		result = map[string]interface{}{"apis": [][]interface{}{}, "authoringVersion": 1, "implName": "stafi",
+			"implVersion": 1, "specName": "stafi", "specVersion": s.specVersion.Load(), "transactionVersion": 1}
+	case "state_getMetadata":
+		s.metadataCalls.Add(1)
+		result = types.ExamplaryMetadataV11SubstrateString
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": result})
+}
+
+func TestLatestRuntimeCache(t *testing.T) {
+	srv := &runtimeServer{}
+	srv.specVersion.Store(1)
+	httpSrv := httptest.NewServer(srv)
+	defer httpSrv.Close()
+	newClient := func(metadata *MetadataCache) *GsrpcClient {
+		api, err := gsrpc.NewSubstrateAPI(httpSrv.URL)
+		assert.NoError(t, err)
+		return &GsrpcClient{api: api, log: tlog, metadata: metadata}
+	}
+	cache := NewMetadataCache()
+	gc := newClient(cache)
+
+	rt, err := gc.LatestRuntime()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rt.SpecVersion())
+	cached, err := gc.LatestRuntime()
+	assert.NoError(t, err)
+	assert.Same(t, rt, cached)
+	assert.Equal(t, int32(1), srv.metadataCalls.Load())
+
+	// an extrinsic encoded before an upgrade is not submitted
+	srv.specVersion.Store(2)
+	_, _, err = gc.SignAndSubmitFor(rt, &types.Extrinsic{})
+	assert.ErrorIs(t, err, RuntimeUpgradedError)
+
+	upgraded, err := gc.LatestRuntime()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, upgraded.SpecVersion())
+	assert.Equal(t, int32(2), srv.metadataCalls.Load())
+
+	// a client sharing the cache does not fetch the metadata again
+	_, err = newClient(cache).LatestRuntime()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), srv.metadataCalls.Load())
+}
@@ -0,0 +1,45 @@
+package substrate
+
+import (
+	"sync"
+
+	"github.com/stafiprotocol/go-substrate-rpc-client/types"
+)
+
+// MetadataCache keeps the raw metadata of the runtime versions of a chain by spec version, so the
+// clients of a chain fetch the metadata of a runtime once.
+type MetadataCache struct {
+	lock sync.Mutex
+	raw  map[int]string
+}
+
+func NewMetadataCache() *MetadataCache {
+	return &MetadataCache{raw: make(map[int]string)}
+}
+
+func (c *MetadataCache) get(specVersion int) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	raw, ok := c.raw[specVersion]
+	return raw, ok
+}
+
+func (c *MetadataCache) put(specVersion int, raw string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.raw[specVersion] = raw
+}
+
+// Runtime is a runtime version of a chain with its metadata.
+type Runtime struct {
+	Version  *types.RuntimeVersion
+	Metadata *types.Metadata
+}
+
+// SpecVersion returns the spec version of the runtime, 0 for nil.
+func (r *Runtime) SpecVersion() int {
+	if r == nil {
+		return 0
+	}
+	return int(r.Version.SpecVersion)
+}
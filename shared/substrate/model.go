@@ -2,6 +2,8 @@ package substrate
 
 import (
 	"errors"
+	"fmt"
+
 	scalecodec "github.com/itering/scale.go"
 )
 
@@ -17,10 +19,38 @@ var (
 	TerminatedError           = errors.New("terminated")
 	BondEqualToUnbondError    = errors.New("BondEqualToUnbondError")
 	BondSmallerThanLeastError = errors.New("BondSmallerThanLeastError")
+	DroppedError              = errors.New("extrinsic dropped from network")
+	RetractedError            = errors.New("extrinsic retracted")
+	RuntimeUpgradedError      = errors.New("runtime upgraded")
+	EndpointError             = errors.New("endpoint failed")
+	OutcomeUnknownError       = errors.New("extrinsic outcome unknown")
 )
 
 type ChainEvent struct {
-	ModuleId string                  `json:"module_id" `
-	EventId  string                  `json:"event_id" `
-	Params   []scalecodec.EventParam `json:"params"`
+	ModuleId     string                  `json:"module_id" `
+	EventId      string                  `json:"event_id" `
+	Params       []scalecodec.EventParam `json:"params"`
+	Phase        int                     `json:"phase"`         // 0 while applying an extrinsic
+	ExtrinsicIdx int                     `json:"extrinsic_idx"` // index of the extrinsic in phase 0
+}
+
+// DispatchError is the error an included extrinsic was dispatched with.
+type DispatchError struct {
+	Block  string // hash of the including block
+	Index  int    // index of the extrinsic in the block
+	Kind   string // variant of the runtime DispatchError, like Module or BadOrigin
+	Module string // pallet of a Module error
+	Name   string // name of a Module error
+	Doc    string
+}
+
+func (e *DispatchError) Error() string {
+	msg := fmt.Sprintf("extrinsic %d of block %s failed: %s", e.Index, e.Block, e.Kind)
+	if e.Module != "" {
+		msg = fmt.Sprintf("%s %s.%s", msg, e.Module, e.Name)
+	}
+	if e.Doc != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, e.Doc)
+	}
+	return msg
 }
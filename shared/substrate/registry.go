@@ -0,0 +1,857 @@
+package substrate
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	scalecodec "github.com/itering/scale.go"
+)
+
+var errShortData = errors.New("unexpected end of data")
+
+// scaleReader reads SCALE encoded data.
+type scaleReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *scaleReader) next(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, errShortData
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *scaleReader) byte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// uint reads a little endian unsigned integer of n bytes, n at most 8.
+func (r *scaleReader) uint(n int) (uint64, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var buf [8]byte
+	copy(buf[:], b)
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+func (r *scaleReader) compact() (*big.Int, error) {
+	b, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch b & 3 {
+	case 0:
+		return big.NewInt(int64(b >> 2)), nil
+	case 1:
+		rest, err := r.uint(1)
+		if err != nil {
+			return nil, err
+		}
+		return big.NewInt(int64(uint64(b)|rest<<8) >> 2), nil
+	case 2:
+		rest, err := r.uint(3)
+		if err != nil {
+			return nil, err
+		}
+		return big.NewInt(int64(uint64(b)|rest<<8) >> 2), nil
+	}
+	le, err := r.next(int(b>>2) + 4)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(reverse(le)), nil
+}
+
+// length reads a compact length, which cannot exceed the remaining data.
+func (r *scaleReader) length() (int, error) {
+	n, err := r.compact()
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsInt64() || n.Int64() > int64(len(r.data)-r.pos) {
+		return 0, errShortData
+	}
+	return int(n.Int64()), nil
+}
+
+func (r *scaleReader) typeId() (uint32, error) {
+	n, err := r.compact()
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsUint64() || n.Uint64() > 1<<32-1 {
+		return 0, fmt.Errorf("type id %s out of range", n)
+	}
+	return uint32(n.Uint64()), nil
+}
+
+func (r *scaleReader) string() (string, error) {
+	n, err := r.length()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.next(n)
+	return string(b), err
+}
+
+func (r *scaleReader) strings() ([]string, error) {
+	n, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+	s := make([]string, n)
+	for i := range s {
+		if s[i], err = r.string(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// option reads the flag of an Option, whether a value follows.
+func (r *scaleReader) option() (bool, error) {
+	b, err := r.byte()
+	if err != nil {
+		return false, err
+	}
+	if b > 1 {
+		return false, fmt.Errorf("invalid option flag %d", b)
+	}
+	return b == 1, nil
+}
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+// Type definitions of a portable type registry
+const (
+	defComposite = iota
+	defVariant
+	defSequence
+	defArray
+	defTuple
+	defPrimitive
+	defCompact
+	defBitSequence
+)
+
+// Primitive types of a portable type registry
+var primitives = []string{"bool", "char", "str", "u8", "u16", "u32", "u64", "u128", "u256",
+	"i8", "i16", "i32", "i64", "i128", "i256"}
+
+type siField struct {
+	name     string
+	typ      uint32
+	typeName string
+}
+
+type siVariant struct {
+	name   string
+	fields []siField
+	index  byte
+	docs   []string
+}
+
+type siType struct {
+	path      []string
+	def       int
+	fields    []siField   // of a composite
+	variants  []siVariant // of a variant
+	elem      uint32      // of a sequence, array or compact, the store of a bit sequence
+	length    uint32      // of an array
+	tuple     []uint32
+	primitive string
+}
+
+type palletV14 struct {
+	name   string
+	index  byte
+	errors *uint32 // type of the errors of the pallet
+}
+
+// metadataV14 is the part of a V14 metadata used to decode events: the portable type registry
+// and the pallets.
+type metadataV14 struct {
+	types   map[uint32]*siType
+	pallets []palletV14
+	events  uint32 // type of the System Events storage
+}
+
+// metadataVersion returns the version of raw metadata, -1 if it is not metadata.
+func metadataVersion(raw []byte) int {
+	if len(raw) < 5 || string(raw[:4]) != "meta" {
+		return -1
+	}
+	return int(raw[4])
+}
+
+// decodeMetadataV14 reads the type registry and the pallets of a V14 metadata.
+func decodeMetadataV14(raw []byte) (*metadataV14, error) {
+	if v := metadataVersion(raw); v != 14 {
+		return nil, fmt.Errorf("metadata version %d not supported", v)
+	}
+	r := &scaleReader{data: raw, pos: 5}
+	m := &metadataV14{types: make(map[uint32]*siType)}
+	n, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		id, err := r.typeId()
+		if err != nil {
+			return nil, err
+		}
+		t, err := readType(r)
+		if err != nil {
+			return nil, fmt.Errorf("type %d: %s", id, err)
+		}
+		m.types[id] = t
+	}
+
+	n, err = r.length()
+	if err != nil {
+		return nil, err
+	}
+	foundEvents := false
+	for i := 0; i < n; i++ {
+		p, events, err := readPallet(r)
+		if err != nil {
+			return nil, fmt.Errorf("pallet %d: %s", i, err)
+		}
+		if events != nil {
+			m.events = *events
+			foundEvents = true
+		}
+		m.pallets = append(m.pallets, p)
+	}
+	if !foundEvents {
+		return nil, errors.New("metadata has no System Events storage")
+	}
+	return m, nil
+}
+
+func readType(r *scaleReader) (*siType, error) {
+	t := &siType{}
+	var err error
+	if t.path, err = r.strings(); err != nil {
+		return nil, err
+	}
+	// type parameters
+	params, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < params; i++ {
+		if _, err := r.string(); err != nil {
+			return nil, err
+		}
+		if some, err := r.option(); err != nil {
+			return nil, err
+		} else if some {
+			if _, err := r.typeId(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	def, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	t.def = int(def)
+	switch t.def {
+	case defComposite:
+		t.fields, err = readFields(r)
+	case defVariant:
+		var n int
+		if n, err = r.length(); err != nil {
+			return nil, err
+		}
+		t.variants = make([]siVariant, n)
+		for i := range t.variants {
+			v := &t.variants[i]
+			if v.name, err = r.string(); err != nil {
+				return nil, err
+			}
+			if v.fields, err = readFields(r); err != nil {
+				return nil, err
+			}
+			if v.index, err = r.byte(); err != nil {
+				return nil, err
+			}
+			if v.docs, err = r.strings(); err != nil {
+				return nil, err
+			}
+		}
+	case defSequence, defCompact:
+		t.elem, err = r.typeId()
+	case defArray:
+		var length uint64
+		if length, err = r.uint(4); err != nil {
+			return nil, err
+		}
+		t.length = uint32(length)
+		t.elem, err = r.typeId()
+	case defTuple:
+		var n int
+		if n, err = r.length(); err != nil {
+			return nil, err
+		}
+		t.tuple = make([]uint32, n)
+		for i := range t.tuple {
+			if t.tuple[i], err = r.typeId(); err != nil {
+				return nil, err
+			}
+		}
+	case defPrimitive:
+		var p byte
+		if p, err = r.byte(); err != nil {
+			return nil, err
+		}
+		if int(p) >= len(primitives) {
+			return nil, fmt.Errorf("unknown primitive %d", p)
+		}
+		t.primitive = primitives[p]
+	case defBitSequence:
+		if t.elem, err = r.typeId(); err != nil {
+			return nil, err
+		}
+		// the bit order
+		_, err = r.typeId()
+	default:
+		return nil, fmt.Errorf("unknown type definition %d", def)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// docs
+	_, err = r.strings()
+	return t, err
+}
+
+func readFields(r *scaleReader) ([]siField, error) {
+	n, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]siField, n)
+	for i := range fields {
+		f := &fields[i]
+		if some, err := r.option(); err != nil {
+			return nil, err
+		} else if some {
+			if f.name, err = r.string(); err != nil {
+				return nil, err
+			}
+		}
+		if f.typ, err = r.typeId(); err != nil {
+			return nil, err
+		}
+		if some, err := r.option(); err != nil {
+			return nil, err
+		} else if some {
+			if f.typeName, err = r.string(); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := r.strings(); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// readPallet reads a pallet, and the type of the System Events storage if the pallet holds it.
+func readPallet(r *scaleReader) (palletV14, *uint32, error) {
+	var p palletV14
+	var events *uint32
+	var err error
+	if p.name, err = r.string(); err != nil {
+		return p, nil, err
+	}
+
+	// storage
+	if some, err := r.option(); err != nil {
+		return p, nil, err
+	} else if some {
+		if _, err := r.string(); err != nil {
+			return p, nil, err
+		}
+		n, err := r.length()
+		if err != nil {
+			return p, nil, err
+		}
+		for i := 0; i < n; i++ {
+			name, err := r.string()
+			if err != nil {
+				return p, nil, err
+			}
+			// modifier
+			if _, err := r.byte(); err != nil {
+				return p, nil, err
+			}
+			kind, err := r.byte()
+			if err != nil {
+				return p, nil, err
+			}
+			switch kind {
+			case 0:
+				value, err := r.typeId()
+				if err != nil {
+					return p, nil, err
+				}
+				if p.name == "System" && name == "Events" {
+					events = &value
+				}
+			case 1:
+				hashers, err := r.length()
+				if err != nil {
+					return p, nil, err
+				}
+				if _, err := r.next(hashers); err != nil {
+					return p, nil, err
+				}
+				if _, err := r.typeId(); err != nil {
+					return p, nil, err
+				}
+				if _, err := r.typeId(); err != nil {
+					return p, nil, err
+				}
+			default:
+				return p, nil, fmt.Errorf("unknown storage entry type %d", kind)
+			}
+			// default value and docs
+			if n, err := r.length(); err != nil {
+				return p, nil, err
+			} else if _, err := r.next(n); err != nil {
+				return p, nil, err
+			}
+			if _, err := r.strings(); err != nil {
+				return p, nil, err
+			}
+		}
+	}
+
+	// calls and events
+	for i := 0; i < 2; i++ {
+		if _, err := readPalletType(r); err != nil {
+			return p, nil, err
+		}
+	}
+
+	// constants
+	n, err := r.length()
+	if err != nil {
+		return p, nil, err
+	}
+	for i := 0; i < n; i++ {
+		if _, err := r.string(); err != nil {
+			return p, nil, err
+		}
+		if _, err := r.typeId(); err != nil {
+			return p, nil, err
+		}
+		if n, err := r.length(); err != nil {
+			return p, nil, err
+		} else if _, err := r.next(n); err != nil {
+			return p, nil, err
+		}
+		if _, err := r.strings(); err != nil {
+			return p, nil, err
+		}
+	}
+
+	if p.errors, err = readPalletType(r); err != nil {
+		return p, nil, err
+	}
+	p.index, err = r.byte()
+	return p, events, err
+}
+
+// readPalletType reads the optional type of the calls, events or errors of a pallet.
+func readPalletType(r *scaleReader) (*uint32, error) {
+	some, err := r.option()
+	if err != nil || !some {
+		return nil, err
+	}
+	id, err := r.typeId()
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (m *metadataV14) lookup(id uint32) (*siType, error) {
+	t, ok := m.types[id]
+	if !ok {
+		return nil, fmt.Errorf("type %d not in registry", id)
+	}
+	return t, nil
+}
+
+// decodeEvents decodes the System Events storage of a block into events like the ones of the
+// scale.go events decoder.
+func (m *metadataV14) decodeEvents(data []byte) ([]*ChainEvent, error) {
+	r := &scaleReader{data: data}
+	vec, err := m.lookup(m.events)
+	if err != nil {
+		return nil, err
+	}
+	record, err := m.lookup(vec.elem)
+	if err != nil {
+		return nil, err
+	}
+	if vec.def != defSequence || record.def != defComposite {
+		return nil, errors.New("System Events storage is not a sequence of event records")
+	}
+
+	n, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*ChainEvent, 0, n)
+	for i := 0; i < n; i++ {
+		evt := &ChainEvent{Params: []scalecodec.EventParam{}}
+		for _, f := range record.fields {
+			switch f.name {
+			case "phase":
+				err = m.decodePhase(r, f.typ, evt)
+			case "event":
+				err = m.decodeEvent(r, f.typ, evt)
+			default:
+				_, err = m.decode(r, f.typ)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("event %d: %s", i, err)
+			}
+		}
+		events = append(events, evt)
+	}
+	return events, nil
+}
+
+func (m *metadataV14) decodePhase(r *scaleReader, id uint32, evt *ChainEvent) error {
+	v, err := m.variant(r, id)
+	if err != nil {
+		return err
+	}
+	evt.Phase = int(v.index)
+	if len(v.fields) == 1 {
+		idx, err := m.decode(r, v.fields[0].typ)
+		if err != nil {
+			return err
+		}
+		if i, ok := idx.(uint64); ok {
+			evt.ExtrinsicIdx = int(i)
+		}
+		return nil
+	}
+	return m.skipFields(r, v.fields)
+}
+
+// decodeEvent decodes a runtime event, a variant per pallet holding the variant of the event.
+func (m *metadataV14) decodeEvent(r *scaleReader, id uint32, evt *ChainEvent) error {
+	pallet, err := m.variant(r, id)
+	if err != nil {
+		return err
+	}
+	if len(pallet.fields) != 1 {
+		return fmt.Errorf("event of pallet %s has %d fields", pallet.name, len(pallet.fields))
+	}
+	event, err := m.variant(r, pallet.fields[0].typ)
+	if err != nil {
+		return err
+	}
+	evt.ModuleId = pallet.name
+	evt.EventId = event.name
+	for _, f := range event.fields {
+		value, err := m.decode(r, f.typ)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %s", pallet.name, event.name, err)
+		}
+		typeName := f.typeName
+		if typeName == "" {
+			typeName = m.typeName(f.typ)
+		}
+		evt.Params = append(evt.Params, scalecodec.EventParam{Type: typeName, Value: value})
+	}
+	return nil
+}
+
+// variant reads the index of a variant type and returns the variant.
+func (m *metadataV14) variant(r *scaleReader, id uint32) (*siVariant, error) {
+	t, err := m.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.def != defVariant {
+		return nil, fmt.Errorf("type %d is not a variant", id)
+	}
+	index, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	for i := range t.variants {
+		if t.variants[i].index == index {
+			return &t.variants[i], nil
+		}
+	}
+	return nil, fmt.Errorf("variant %d of %s unknown", index, strings.Join(t.path, "::"))
+}
+
+func (m *metadataV14) skipFields(r *scaleReader, fields []siField) error {
+	for _, f := range fields {
+		if _, err := m.decode(r, f.typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typeName names a type for event params without a type name.
+func (m *metadataV14) typeName(id uint32) string {
+	t, ok := m.types[id]
+	if !ok {
+		return ""
+	}
+	switch {
+	case len(t.path) > 0:
+		return t.path[len(t.path)-1]
+	case t.def == defSequence:
+		return "Vec<" + m.typeName(t.elem) + ">"
+	case t.def == defArray:
+		return fmt.Sprintf("[%s; %d]", m.typeName(t.elem), t.length)
+	case t.def == defCompact:
+		return "Compact<" + m.typeName(t.elem) + ">"
+	}
+	return t.primitive
+}
+
+// decode decodes a value the way scale.go does: byte arrays and sequences, and the big integers
+// of primitive_types, as hex, u128 as a decimal string, variants without fields as their name and
+// other variants as a map from their name to their fields.
+func (m *metadataV14) decode(r *scaleReader, id uint32) (interface{}, error) {
+	t, err := m.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	start := r.pos
+	switch t.def {
+	case defComposite:
+		value, err := m.decodeFields(r, t.fields)
+		if err != nil {
+			return nil, err
+		}
+		if len(t.path) == 2 && t.path[0] == "primitive_types" && strings.HasPrefix(t.path[1], "U") {
+			return "0x" + hex.EncodeToString(r.data[start:r.pos]), nil
+		}
+		return value, nil
+	case defVariant:
+		v, err := m.variant(r, id)
+		if err != nil {
+			return nil, err
+		}
+		value, err := m.decodeFields(r, v.fields)
+		if err != nil {
+			return nil, err
+		}
+		if len(t.path) == 1 && t.path[0] == "Option" {
+			return value, nil
+		}
+		if len(v.fields) == 0 {
+			return v.name, nil
+		}
+		return map[string]interface{}{v.name: value}, nil
+	case defSequence:
+		n, err := r.length()
+		if err != nil {
+			return nil, err
+		}
+		return m.decodeElems(r, t.elem, n)
+	case defArray:
+		return m.decodeElems(r, t.elem, int(t.length))
+	case defTuple:
+		if len(t.tuple) == 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, len(t.tuple))
+		for i, elem := range t.tuple {
+			if values[i], err = m.decode(r, elem); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case defPrimitive:
+		return decodePrimitive(r, t.primitive)
+	case defCompact:
+		n, err := r.compact()
+		if err != nil {
+			return nil, err
+		}
+		if n.IsUint64() {
+			return n.Uint64(), nil
+		}
+		return n.String(), nil
+	case defBitSequence:
+		store, err := m.lookup(t.elem)
+		if err != nil {
+			return nil, err
+		}
+		size := map[string]int{"u8": 1, "u16": 2, "u32": 4, "u64": 8}[store.primitive]
+		if size == 0 {
+			return nil, fmt.Errorf("bit sequence store %s not supported", store.primitive)
+		}
+		bits, err := r.compact()
+		if err != nil {
+			return nil, err
+		}
+		if !bits.IsInt64() || bits.Int64() > int64(len(r.data)-r.pos)*8 {
+			return nil, errShortData
+		}
+		words := (int(bits.Int64()) + size*8 - 1) / (size * 8)
+		b, err := r.next(words * size)
+		if err != nil {
+			return nil, err
+		}
+		return "0x" + hex.EncodeToString(b), nil
+	}
+	return nil, fmt.Errorf("type %d has unknown definition %d", id, t.def)
+}
+
+// decodeFields decodes the fields of a composite or variant: a single field as its value, named
+// fields as a map and unnamed fields as a list.
+func (m *metadataV14) decodeFields(r *scaleReader, fields []siField) (interface{}, error) {
+	switch {
+	case len(fields) == 0:
+		return nil, nil
+	case len(fields) == 1:
+		return m.decode(r, fields[0].typ)
+	case fields[0].name != "":
+		values := make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			value, err := m.decode(r, f.typ)
+			if err != nil {
+				return nil, err
+			}
+			values[f.name] = value
+		}
+		return values, nil
+	}
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		var err error
+		if values[i], err = m.decode(r, f.typ); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (m *metadataV14) decodeElems(r *scaleReader, elem uint32, n int) (interface{}, error) {
+	if t, err := m.lookup(elem); err != nil {
+		return nil, err
+	} else if t.def == defPrimitive && t.primitive == "u8" {
+		b, err := r.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return "0x" + hex.EncodeToString(b), nil
+	}
+	if n > len(r.data)-r.pos {
+		return nil, errShortData
+	}
+	values := make([]interface{}, n)
+	for i := range values {
+		var err error
+		if values[i], err = m.decode(r, elem); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func decodePrimitive(r *scaleReader, primitive string) (interface{}, error) {
+	switch primitive {
+	case "bool":
+		b, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		return b != 0, nil
+	case "char":
+		c, err := r.uint(4)
+		return string(rune(c)), err
+	case "str":
+		return r.string()
+	case "u8", "u16", "u32", "u64":
+		return r.uint(primitiveSize(primitive))
+	case "i8", "i16", "i32", "i64":
+		size := primitiveSize(primitive)
+		u, err := r.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+	case "u128":
+		b, err := r.next(16)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(reverse(b)).String(), nil
+	}
+	// u256, i128 and i256 as the hex of their little endian bytes
+	b, err := r.next(primitiveSize(primitive))
+	if err != nil {
+		return nil, err
+	}
+	return "0x" + hex.EncodeToString(b), nil
+}
+
+// primitiveSize returns the size in bytes of a numeric primitive.
+func primitiveSize(primitive string) int {
+	bits := 0
+	fmt.Sscanf(primitive[1:], "%d", &bits)
+	return bits / 8
+}
+
+// moduleError returns the pallet with an index and the name and docs of one of its errors.
+func (m *metadataV14) moduleError(palletIndex, errorIndex int) (pallet, name, doc string, ok bool) {
+	for _, p := range m.pallets {
+		if int(p.index) != palletIndex {
+			continue
+		}
+		if p.errors == nil {
+			return p.name, "", "", false
+		}
+		t, err := m.lookup(*p.errors)
+		if err != nil {
+			return p.name, "", "", false
+		}
+		for _, v := range t.variants {
+			if int(v.index) == errorIndex {
+				return p.name, v.name, strings.TrimSpace(strings.Join(v.docs, " ")), true
+			}
+		}
+		return p.name, "", "", false
+	}
+	return "", "", "", false
+}
@@ -0,0 +1,210 @@
+package substrate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func compactBytes(n int) []byte {
+	switch {
+	case n < 1<<6:
+		return []byte{byte(n << 2)}
+	case n < 1<<14:
+		return binary.LittleEndian.AppendUint16(nil, uint16(n<<2|1))
+	}
+	return binary.LittleEndian.AppendUint32(nil, uint32(n<<2|2))
+}
+
+func strBytes(s string) []byte {
+	return append(compactBytes(len(s)), s...)
+}
+
+func strsBytes(s ...string) []byte {
+	b := compactBytes(len(s))
+	for _, x := range s {
+		b = append(b, strBytes(x)...)
+	}
+	return b
+}
+
+func vecBytes(items ...[]byte) []byte {
+	return append(compactBytes(len(items)), bytes.Join(items, nil)...)
+}
+
+func cat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// fieldBytes encodes a field, unnamed if name is empty.
+func fieldBytes(name string, typ int, typeName string) []byte {
+	b := []byte{0}
+	if name != "" {
+		b = append([]byte{1}, strBytes(name)...)
+	}
+	b = append(b, compactBytes(typ)...)
+	if typeName == "" {
+		b = append(b, 0)
+	} else {
+		b = append(append(b, 1), strBytes(typeName)...)
+	}
+	return append(b, strsBytes()...)
+}
+
+func typeBytes(path []string, def ...byte) []byte {
+	return cat(strsBytes(path...), compactBytes(0), def, strsBytes())
+}
+
+func variantBytes(name string, index byte, fields []byte, docs ...string) []byte {
+	return cat(strBytes(name), fields, []byte{index}, strsBytes(docs...))
+}
+
+func arrayDef(n uint32, typ int) []byte {
+	return cat([]byte{defArray}, binary.LittleEndian.AppendUint32(nil, n), compactBytes(typ))
+}
+
+func palletBytes(name string, storage []byte, event, errors int, index byte) []byte {
+	b := strBytes(name)
+	if storage == nil {
+		b = append(b, 0)
+	} else {
+		b = append(append(b, 1), storage...)
+	}
+	b = append(b, 0) // calls
+	b = append(append(b, 1), compactBytes(event)...)
+	b = append(b, vecBytes(cat(strBytes("ChainIdentity"), compactBytes(0), vecBytes([]byte{1}), strsBytes()))...)
+	if errors < 0 {
+		b = append(b, 0)
+	} else {
+		b = append(append(b, 1), compactBytes(errors)...)
+	}
+	return append(b, index)
+}
+
+// testMetadataV14 is a V14 metadata of a System pallet and a bridge pallet at index 5.
+func testMetadataV14() []byte {
+	types := [][]byte{
+		typeBytes(nil, defPrimitive, 3),                              // 0 u8
+		typeBytes(nil, defPrimitive, 5),                              // 1 u32
+		typeBytes(nil, arrayDef(32, 0)...),                           // 2 [u8; 32]
+		typeBytes(nil, cat([]byte{defSequence}, compactBytes(0))...), // 3 Vec<u8>
+		typeBytes([]string{"frame_system", "Phase"}, cat([]byte{defVariant}, vecBytes( // 4
+			variantBytes("ApplyExtrinsic", 0, vecBytes(fieldBytes("", 1, "u32"))),
+			variantBytes("Finalization", 1, vecBytes()),
+			variantBytes("Initialization", 2, vecBytes())))...),
+		typeBytes([]string{"primitive_types", "U256"}, cat([]byte{defComposite}, vecBytes(fieldBytes("", 7, "[u64; 4]")))...), // 5
+		typeBytes(nil, defPrimitive, 6),   // 6 u64
+		typeBytes(nil, arrayDef(4, 6)...), // 7 [u64; 4]
+		typeBytes([]string{"bridge", "pallet", "Event"}, cat([]byte{defVariant}, vecBytes( // 8
+			variantBytes("FungibleTransfer", 0, vecBytes(
+				fieldBytes("", 0, "ChainId"),
+				fieldBytes("", 6, "DepositNonce"),
+				fieldBytes("", 2, "ResourceId"),
+				fieldBytes("", 5, "U256"),
+				fieldBytes("", 3, "")))))...),
+		typeBytes([]string{"frame_system", "pallet", "Event"}, cat([]byte{defVariant}, vecBytes( // 9
+			variantBytes("ExtrinsicSuccess", 0, vecBytes()),
+			variantBytes("ExtrinsicFailed", 1, vecBytes(fieldBytes("dispatch_error", 10, "DispatchError")))))...),
+		typeBytes([]string{"sp_runtime", "DispatchError"}, cat([]byte{defVariant}, vecBytes( // 10
+			variantBytes("BadOrigin", 2, vecBytes()),
+			variantBytes("Module", 3, vecBytes(fieldBytes("", 11, "ModuleError")))))...),
+		typeBytes([]string{"sp_runtime", "ModuleError"}, cat([]byte{defComposite}, vecBytes( // 11
+			fieldBytes("index", 0, "u8"),
+			fieldBytes("error", 12, "[u8; 4]")))...),
+		typeBytes(nil, arrayDef(4, 0)...), // 12 [u8; 4]
+		typeBytes([]string{"node_runtime", "Event"}, cat([]byte{defVariant}, vecBytes( // 13
+			variantBytes("System", 0, vecBytes(fieldBytes("", 9, "frame_system::Event<Runtime>"))),
+			variantBytes("BridgeCommon", 5, vecBytes(fieldBytes("", 8, "bridge::Event<Runtime>")))))...),
+		typeBytes([]string{"primitive_types", "H256"}, cat([]byte{defComposite}, vecBytes(fieldBytes("", 2, "[u8; 32]")))...), // 14
+		typeBytes(nil, cat([]byte{defSequence}, compactBytes(14))...),                                                         // 15 Vec<H256>
+		typeBytes([]string{"frame_system", "EventRecord"}, cat([]byte{defComposite}, vecBytes( // 16
+			fieldBytes("phase", 4, "Phase"),
+			fieldBytes("event", 13, "E"),
+			fieldBytes("topics", 15, "Vec<T>")))...),
+		typeBytes(nil, cat([]byte{defSequence}, compactBytes(16))...), // 17 Vec<EventRecord>
+		typeBytes([]string{"bridge", "pallet", "Error"}, cat([]byte{defVariant}, vecBytes( // 18
+			variantBytes("InvalidChainId", 0, vecBytes(), "Provided chain Id is not valid"),
+			variantBytes("ProposalAlreadyComplete", 2, vecBytes(), "Proposal has either failed or succeeded")))...),
+	}
+	var registry [][]byte
+	for id, t := range types {
+		registry = append(registry, cat(compactBytes(id), t))
+	}
+
+	events := cat(strBytes("Events"), []byte{1, 0}, compactBytes(17), vecBytes(), strsBytes("events"))
+	storage := cat(strBytes("System"), vecBytes(events))
+	return cat([]byte("meta"), []byte{14}, vecBytes(registry...), vecBytes(
+		palletBytes("System", storage, 9, -1, 0),
+		palletBytes("BridgeCommon", nil, 8, 18, 5),
+	), compactBytes(0), []byte{4}, vecBytes())
+}
+
+func TestDecodeEventsV14(t *testing.T) {
+	raw := testMetadataV14()
+	assert.Equal(t, 14, metadataVersion(raw))
+	m, err := decodeMetadataV14(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(17), m.events)
+
+	resourceId := bytes.Repeat([]byte{0xa9}, 32)
+	amount := make([]byte, 32)
+	amount[0] = 10
+	topic := bytes.Repeat([]byte{0x01}, 32)
+	events := vecBytes(
+		cat([]byte{0, 2, 0, 0, 0}, []byte{0, 0}, vecBytes()),
+		cat([]byte{0, 3, 0, 0, 0}, []byte{5, 0}, []byte{2}, binary.LittleEndian.AppendUint64(nil, 7), resourceId, amount,
+			vecBytes([]byte{0x12}, []byte{0x34}), vecBytes(topic)),
+		cat([]byte{0, 4, 0, 0, 0}, []byte{0, 1}, []byte{3, 5, 2, 0, 0, 0}, vecBytes()),
+		cat([]byte{1}, []byte{0, 1}, []byte{2}, vecBytes()),
+	)
+
+	sc := &SarpcClient{registry: m, metaRaw: hex.EncodeToString(raw), currentSpecVersion: 1, metadata: NewMetadataCache()}
+	evts, err := sc.DecodeEvents(&BlockEvents{Hash: "0xblock", SpecVersion: 1, raw: "0x" + hex.EncodeToString(events)})
+	assert.NoError(t, err)
+	assert.Len(t, evts, 4)
+
+	assert.Equal(t, "System", evts[0].ModuleId)
+	assert.Equal(t, "ExtrinsicSuccess", evts[0].EventId)
+	assert.Equal(t, 2, evts[0].ExtrinsicIdx)
+
+	transfer := evts[1]
+	assert.Equal(t, "BridgeCommon", transfer.ModuleId)
+	assert.Equal(t, "FungibleTransfer", transfer.EventId)
+	assert.Equal(t, 0, transfer.Phase)
+	assert.Equal(t, 3, transfer.ExtrinsicIdx)
+	assert.Len(t, transfer.Params, 5)
+	assert.Equal(t, "ChainId", transfer.Params[0].Type)
+	assert.Equal(t, float64(2), transfer.Params[0].Value)
+	assert.Equal(t, float64(7), transfer.Params[1].Value)
+	assert.Equal(t, "0x"+hex.EncodeToString(resourceId), transfer.Params[2].Value)
+	assert.Equal(t, "0x"+hex.EncodeToString(amount), transfer.Params[3].Value)
+	assert.Equal(t, "Vec<u8>", transfer.Params[4].Type)
+	assert.Equal(t, "0x1234", transfer.Params[4].Value)
+
+	failed := sc.dispatchError(evts[2].Params[0].Value, "0xblock", evts[2].ExtrinsicIdx)
+	assert.Equal(t, "Module", failed.Kind)
+	assert.Equal(t, "BridgeCommon", failed.Module)
+	assert.Equal(t, "ProposalAlreadyComplete", failed.Name)
+	assert.Equal(t, "Proposal has either failed or succeeded", failed.Doc)
+
+	assert.Equal(t, 1, evts[3].Phase)
+	assert.Equal(t, "BadOrigin", parseDispatchError(evts[3].Params[0].Value).Kind)
+
+	// truncated events fail instead of panicking
+	_, err = sc.DecodeEvents(&BlockEvents{Hash: "0xblock", SpecVersion: 1, raw: "0x" + hex.EncodeToString(events[:40])})
+	assert.Error(t, err)
+}
+
+func TestDecodeCompact(t *testing.T) {
+	for _, n := range []int{0, 63, 64, 16383, 16384, 1<<30 - 1} {
+		c, err := (&scaleReader{data: compactBytes(n)}).compact()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(n), c.Int64())
+	}
+	c, err := (&scaleReader{data: []byte{0x03, 0, 0, 0, 0x40}}).compact()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1<<30), c.Int64())
+}
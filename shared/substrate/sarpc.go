@@ -2,11 +2,16 @@ package substrate
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ChainSafe/log15"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/gorilla/websocket"
 	scalecodec "github.com/itering/scale.go"
 	"github.com/itering/scale.go/source"
@@ -17,6 +22,7 @@ import (
 	"github.com/itering/substrate-api-rpc/util"
 	wbskt "github.com/stafiprotocol/chainbridge/shared/substrate/websocket"
 	gsrpc "github.com/stafiprotocol/go-substrate-rpc-client"
+	"golang.org/x/crypto/blake2b"
 )
 
 const (
@@ -26,7 +32,9 @@ const (
 
 type SarpcClient struct {
 	endpoint           string
+	endpoints          *EndpointPool // nil to only use endpoint
 	wsPool             wbskt.Pool
+	poolLock           sync.Mutex // guards endpoint and wsPool
 	log                log15.Logger
 	chainType          string
 	metaRaw            string
@@ -34,8 +42,21 @@ type SarpcClient struct {
 	currentSpecVersion int
 	metaDecoder        scalecodec.MetadataDecoder
 	eventDecoder       scalecodec.EventsDecoder
+	registry           *metadataV14 // the metadata of a runtime since metadata V14, nil before
+	decodeLock         sync.Mutex   // guards the metadata and the decoders
+	metadata           *MetadataCache
 }
 
+// BlockEvents are the undecoded events of a block.
+type BlockEvents struct {
+	Number      uint64
+	Hash        string
+	SpecVersion int
+	raw         string
+}
+
+// NewSarpcClient creates a client decoding events with the type registry of the metadata since
+// metadata V14. The types at typesPath, if given, are used for runtimes with older metadata.
 func NewSarpcClient(endpoint, typesPath string, log log15.Logger) (*SarpcClient, error) {
 	api, err := gsrpc.NewSubstrateAPI(endpoint)
 	if err != nil {
@@ -57,9 +78,13 @@ func NewSarpcClient(endpoint, typesPath string, log log15.Logger) (*SarpcClient,
 		currentSpecVersion: 0,
 		metaDecoder:        scalecodec.MetadataDecoder{},
 		eventDecoder:       scalecodec.EventsDecoder{},
+		metadata:           NewMetadataCache(),
 	}
 
-	sc.regCustomTypes()
+	err = sc.regCustomTypes()
+	if err != nil {
+		return nil, err
+	}
 
 	err = sc.UpdateMeta(latestHash.Hex())
 	if err != nil {
@@ -69,47 +94,98 @@ func NewSarpcClient(endpoint, typesPath string, log log15.Logger) (*SarpcClient,
 	return sc, nil
 }
 
-func (sc *SarpcClient) regCustomTypes() {
-	content, err := ioutil.ReadFile(sc.typesPath)
-	if err != nil {
-		panic(err)
+// SetMetadataCache shares the metadata cache of the client, usually with the GsrpcClient of the
+// same chain. The metadata loaded so far is added to c.
+func (sc *SarpcClient) SetMetadataCache(c *MetadataCache) {
+	sc.decodeLock.Lock()
+	defer sc.decodeLock.Unlock()
+	if sc.metaRaw != "" {
+		c.put(sc.currentSpecVersion, sc.metaRaw)
 	}
+	sc.metadata = c
+}
 
+func (sc *SarpcClient) regCustomTypes() error {
 	types.RuntimeType{}.Reg()
+	if sc.typesPath == "" {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(sc.typesPath)
+	if err != nil {
+		return err
+	}
 	types.RegCustomTypes(source.LoadTypeRegistry(content))
+	return nil
+}
+
+// SetEndpoints makes the client fail over between the endpoints of the pool, reporting failed
+// requests to it.
+func (sc *SarpcClient) SetEndpoints(p *EndpointPool) {
+	sc.poolLock.Lock()
+	defer sc.poolLock.Unlock()
+	sc.endpoints = p
 }
 
-func (sc *SarpcClient) initial() (*wbskt.PoolConn, error) {
+// initial returns a connection of the pool of the endpoint in use. With an endpoint pool, the
+// connections are replaced when the pool picks another endpoint.
+func (sc *SarpcClient) initial() (*wbskt.PoolConn, string, error) {
+	sc.poolLock.Lock()
+	endpoint := sc.endpoint
+	if sc.endpoints != nil {
+		endpoint = sc.endpoints.Best()
+	}
+	if sc.wsPool != nil && endpoint != sc.endpoint {
+		sc.log.Info("Sarpc switched endpoint", "from", sc.endpoint, "to", endpoint)
+		sc.wsPool.Close()
+		sc.wsPool = nil
+	}
+	sc.endpoint = endpoint
+
 	var err error
 	if sc.wsPool == nil {
 		factory := func() (*recws.RecConn, error) {
 			SubscribeConn := &recws.RecConn{KeepAliveTimeout: 10 * time.Second}
-			SubscribeConn.Dial(sc.endpoint, nil)
+			SubscribeConn.Dial(endpoint, nil)
 			return SubscribeConn, err
 		}
 		if sc.wsPool, err = wbskt.NewChannelPool(1, 25, factory); err != nil {
 			fmt.Println("NewChannelPool", err)
 		}
 	}
+	pool := sc.wsPool
+	sc.poolLock.Unlock()
 	if err != nil {
-		return nil, err
+		return nil, endpoint, err
 	}
-	conn, err := sc.wsPool.Get()
-	return conn, err
+	conn, err := pool.Get()
+	return conn, endpoint, err
 }
 
+// sendWsRequest sends a request over p, or over a pooled connection if p is nil. A request over
+// a pooled connection that fails is retried once if the endpoint pool picks another endpoint.
 func (sc *SarpcClient) sendWsRequest(p wbskt.WsConn, v interface{}, action []byte) (err error) {
-	if p == nil {
-		var pool *wbskt.PoolConn
-		if pool, err = sc.initial(); err == nil {
-			defer pool.Close()
-			p = pool.Conn
-		} else {
-			return
-		}
+	if p != nil {
+		return sendWsRequest(p, v, action)
+	}
 
+	for retry := true; ; retry = false {
+		pool, endpoint, err := sc.initial()
+		if err == nil {
+			err = sendWsRequest(pool.Conn, v, action)
+			pool.Close()
+		}
+		if err == nil || sc.endpoints == nil {
+			return err
+		}
+		sc.endpoints.Failed(endpoint, err)
+		if !retry || sc.endpoints.Best() == endpoint {
+			return err
+		}
 	}
+}
 
+func sendWsRequest(p wbskt.WsConn, v interface{}, action []byte) (err error) {
 	if err = p.WriteMessage(websocket.TextMessage, action); err != nil {
 		if p != nil {
 			p.MarkUnusable()
@@ -126,35 +202,78 @@ func (sc *SarpcClient) sendWsRequest(p wbskt.WsConn, v interface{}, action []byt
 }
 
 func (sc *SarpcClient) UpdateMeta(blockHash string) error {
+	specVersion, err := sc.specVersion(blockHash)
+	if err != nil {
+		return err
+	}
+
+	sc.decodeLock.Lock()
+	defer sc.decodeLock.Unlock()
+	return sc.updateMeta(blockHash, specVersion)
+}
+
+// specVersion returns the spec version of the runtime at a block.
+func (sc *SarpcClient) specVersion(blockHash string) (int, error) {
 	v := &rpc.JsonRpcResult{}
 	// runtime version
 	if err := sc.sendWsRequest(nil, v, rpc.ChainGetRuntimeVersion(wsId, blockHash)); err != nil {
-		return err
+		return 0, err
 	}
 
 	r := v.ToRuntimeVersion()
 	if r == nil {
-		return fmt.Errorf("runtime version nil")
+		return 0, fmt.Errorf("runtime version nil")
 	}
+	return r.SpecVersion, nil
+}
 
+// updateMeta loads the metadata of a block if its runtime is newer than the current metadata,
+// from the metadata cache if present. The caller must hold the decode lock.
+func (sc *SarpcClient) updateMeta(blockHash string, specVersion int) error {
 	// metadata raw
-	if sc.metaRaw == "" || r.SpecVersion > sc.currentSpecVersion {
-		if err := sc.sendWsRequest(nil, v, rpc.StateGetMetadata(wsId, blockHash)); err != nil {
-			return err
+	if sc.metaRaw == "" || specVersion > sc.currentSpecVersion {
+		metaRaw, ok := sc.metadata.get(specVersion)
+		if !ok {
+			v := &rpc.JsonRpcResult{}
+			if err := sc.sendWsRequest(nil, v, rpc.StateGetMetadata(wsId, blockHash)); err != nil {
+				return err
+			}
+			var err error
+			metaRaw, err = v.ToString()
+			if err != nil {
+				return err
+			}
+			sc.metadata.put(specVersion, metaRaw)
 		}
-		metaRaw, err := v.ToString()
-		if err != nil {
+		if err := sc.loadMeta(metaRaw); err != nil {
 			return err
 		}
 		sc.metaRaw = metaRaw
-		sc.currentSpecVersion = r.SpecVersion
-		sc.metaDecoder.Init(utiles.HexToBytes(metaRaw))
-		if err := sc.metaDecoder.Process(); err != nil {
+		sc.currentSpecVersion = specVersion
+	}
+
+	return nil
+}
+
+// loadMeta decodes raw metadata, into the type registry since V14 and with the metadata decoder
+// of scale.go before. The caller must hold the decode lock.
+func (sc *SarpcClient) loadMeta(metaRaw string) error {
+	raw := utiles.HexToBytes(metaRaw)
+	if metadataVersion(raw) >= 14 {
+		registry, err := decodeMetadataV14(raw)
+		if err != nil {
 			return err
 		}
+		sc.registry = registry
+		return nil
 	}
 
-	return nil
+	if sc.typesPath == "" {
+		sc.log.Warn("no typeRegister file for a runtime before metadata V14, events may not decode")
+	}
+	sc.registry = nil
+	sc.metaDecoder.Init(raw)
+	return sc.metaDecoder.Process()
 }
 
 func (sc *SarpcClient) GetBlock(blockHash string) (*rpc.Block, error) {
@@ -181,7 +300,38 @@ func (sc *SarpcClient) GetBlockHash(blockNum uint64) (string, error) {
 }
 
 func (sc *SarpcClient) GetChainEvents(blockHash string) ([]*ChainEvent, error) {
-	err := sc.UpdateMeta(blockHash)
+	b, err := sc.fetchEvents(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	return sc.DecodeEvents(b)
+}
+
+func (sc *SarpcClient) GetEvents(blockNum uint64) ([]*ChainEvent, error) {
+	b, err := sc.FetchEvents(blockNum)
+	if err != nil {
+		return nil, err
+	}
+	return sc.DecodeEvents(b)
+}
+
+// FetchEvents fetches the undecoded events of a block. It only makes requests over the pool and
+// may be called concurrently, DecodeEvents decodes the result.
+func (sc *SarpcClient) FetchEvents(blockNum uint64) (*BlockEvents, error) {
+	blockHash, err := sc.GetBlockHash(blockNum)
+	if err != nil {
+		return nil, err
+	}
+	b, err := sc.fetchEvents(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	b.Number = blockNum
+	return b, nil
+}
+
+func (sc *SarpcClient) fetchEvents(blockHash string) (*BlockEvents, error) {
+	specVersion, err := sc.specVersion(blockHash)
 	if err != nil {
 		return nil, err
 	}
@@ -194,16 +344,40 @@ func (sc *SarpcClient) GetChainEvents(blockHash string) ([]*ChainEvent, error) {
 	if err != nil {
 		return nil, err
 	}
+	return &BlockEvents{Hash: blockHash, SpecVersion: specVersion, raw: eventRaw}, nil
+}
+
+// DecodeEvents decodes events fetched by FetchEvents, loading newer metadata first if needed.
+// Decoding is serialized.
+func (sc *SarpcClient) DecodeEvents(b *BlockEvents) ([]*ChainEvent, error) {
+	sc.decodeLock.Lock()
+	defer sc.decodeLock.Unlock()
 
+	err := sc.updateMeta(b.Hash, b.SpecVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if sc.registry != nil {
+		value, err = sc.registry.decodeEvents(util.HexToBytes(b.raw))
+		if err != nil {
+			return nil, fmt.Errorf("decode events of block %s error: %s", b.Hash, err)
+		}
+	} else {
+		option := types.ScaleDecoderOption{Metadata: &sc.metaDecoder.Metadata}
+		sc.eventDecoder.Init(types.ScaleBytes{Data: util.HexToBytes(b.raw)}, &option)
+		sc.eventDecoder.Process()
+		value = sc.eventDecoder.Value
+	}
+
+	// both decoders give the values of params as their JSON form
 	var events []*ChainEvent
-	option := types.ScaleDecoderOption{Metadata: &sc.metaDecoder.Metadata}
-	sc.eventDecoder.Init(types.ScaleBytes{Data: util.HexToBytes(eventRaw)}, &option)
-	sc.eventDecoder.Process()
-	b, err := json.Marshal(sc.eventDecoder.Value)
+	bts, err := json.Marshal(value)
 	if err != nil {
 		return nil, err
 	}
-	err = json.Unmarshal(b, &events)
+	err = json.Unmarshal(bts, &events)
 	if err != nil {
 		return nil, err
 	}
@@ -211,16 +385,333 @@ func (sc *SarpcClient) GetChainEvents(blockHash string) ([]*ChainEvent, error) {
 	return events, nil
 }
 
-func (sc *SarpcClient) GetEvents(blockNum uint64) ([]*ChainEvent, error) {
-	blockHash, err := sc.GetBlockHash(blockNum)
+// ExtrinsicOutcome checks the dispatch outcome of the extrinsic with hash extHash included in
+// block blockHash from the System events of the block. It returns a *DispatchError if the
+// extrinsic was dispatched with an error, also if it is wrapped because the extrinsic dispatched
+// the failed call through a proxy or multisig. Such failures within a batch are left to
+// BatchOutcome. If the events cannot be fetched it returns an OutcomeUnknownError.
+func (sc *SarpcClient) ExtrinsicOutcome(blockHash, extHash string) error {
+	index, events, err := sc.extrinsicEvents(blockHash, extHash)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("%w: %s", OutcomeUnknownError, err)
+	}
+	var wrapped error
+	batch := false
+	for _, evt := range events {
+		if value, failed := wrappedFailure(evt); failed && wrapped == nil {
+			wrapped = fmt.Errorf("%s %s: %w", evt.ModuleId, evt.EventId, sc.dispatchError(value, blockHash, index))
+		}
+		if evt.ModuleId == "Utility" {
+			batch = true
+		}
+		if evt.ModuleId != "System" {
+			continue
+		}
+		switch evt.EventId {
+		case "ExtrinsicSuccess":
+			if batch {
+				return nil
+			}
+			return wrapped
+		case "ExtrinsicFailed":
+			if len(evt.Params) == 0 {
+				return fmt.Errorf("extrinsic %d of block %s failed", index, blockHash)
+			}
+			return sc.dispatchError(evt.Params[0].Value, blockHash, index)
+		}
 	}
+	return fmt.Errorf("no outcome of extrinsic %d in the events of block %s", index, blockHash)
+}
 
-	evts, err := sc.GetChainEvents(blockHash)
+// BatchOutcome returns the results of the n calls of the successful Utility batch extrinsic with
+// hash extHash included in block blockHash, nil for the calls that were dispatched without error.
+// If the events cannot be fetched it returns an OutcomeUnknownError.
+func (sc *SarpcClient) BatchOutcome(blockHash, extHash string, n int) ([]error, error) {
+	index, events, err := sc.extrinsicEvents(blockHash, extHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", OutcomeUnknownError, err)
+	}
+	return batchResults(events, n, func(value interface{}) error {
+		return sc.dispatchError(value, blockHash, index)
+	})
+}
+
+// batchResults reads the results of the n calls of a batch from the Utility events of the batch.
+// Every call emits ItemCompleted or ItemFailed. Runtimes older than these events only emit
+// BatchInterrupted for the call that failed, after which the remaining calls are not executed.
+func batchResults(events []*ChainEvent, n int, dispatchError func(value interface{}) error) ([]error, error) {
+	results := make([]error, n)
+	item := 0
+	var wrapped error // failure of the call the current item dispatched through a proxy or multisig
+	for _, evt := range events {
+		if value, failed := wrappedFailure(evt); failed && wrapped == nil {
+			wrapped = fmt.Errorf("%s %s: %w", evt.ModuleId, evt.EventId, dispatchError(value))
+		}
+		if evt.ModuleId != "Utility" {
+			continue
+		}
+		switch evt.EventId {
+		case "ItemCompleted":
+			if item < n && wrapped != nil {
+				results[item] = fmt.Errorf("batch call %d failed: %w", item, wrapped)
+			}
+			wrapped = nil
+			item++
+		case "ItemFailed":
+			if item < n && len(evt.Params) != 0 {
+				results[item] = fmt.Errorf("batch call %d failed: %w", item, dispatchError(evt.Params[0].Value))
+			}
+			wrapped = nil
+			item++
+		case "BatchInterrupted":
+			if len(evt.Params) < 2 {
+				return nil, errors.New("BatchInterrupted without index and error")
+			}
+			failed := indexValue(evt.Params[0].Value)
+			if failed < 0 || failed >= n {
+				return nil, fmt.Errorf("BatchInterrupted at call %d of %d", failed, n)
+			}
+			results[failed] = fmt.Errorf("batch call %d failed: %w", failed, dispatchError(evt.Params[1].Value))
+			for i := failed + 1; i < n; i++ {
+				results[i] = fmt.Errorf("batch call %d not executed", i)
+			}
+			return results, nil
+		}
+	}
+	if item != 0 && item != n {
+		return nil, fmt.Errorf("results of %d calls for a batch of %d", item, n)
+	}
+	return results, nil
+}
+
+// wrappedFailure returns the decoded DispatchError of the call dispatched by Proxy.proxy or by
+// the last approval of Multisig.as_multi, which succeed even if the call they dispatch fails.
+func wrappedFailure(evt *ChainEvent) (interface{}, bool) {
+	executed := evt.ModuleId == "Proxy" && evt.EventId == "ProxyExecuted" ||
+		evt.ModuleId == "Multisig" && evt.EventId == "MultisigExecuted"
+	if !executed || len(evt.Params) == 0 {
+		return nil, false
+	}
+	// the DispatchResult is the last parameter, {"Err": error} with the V14 registry and
+	// {"Error": error} with the types file
+	result, ok := evt.Params[len(evt.Params)-1].Value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	for _, key := range []string{"Err", "Error"} {
+		if value, ok := result[key]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// ExtrinsicHashes returns the hashes of the extrinsics of block blockHash in their order, as
+// shown by explorers.
+func (sc *SarpcClient) ExtrinsicHashes(blockHash string) ([]string, error) {
+	block, err := sc.GetBlock(blockHash)
 	if err != nil {
 		return nil, err
 	}
+	hashes := make([]string, len(block.Extrinsics))
+	for i, ext := range block.Extrinsics {
+		hash := blake2b.Sum256(util.HexToBytes(ext))
+		hashes[i] = hexutil.Encode(hash[:])
+	}
+	return hashes, nil
+}
+
+// extrinsicEvents returns the index of the extrinsic with hash extHash in block blockHash and the
+// events the extrinsic emitted.
+func (sc *SarpcClient) extrinsicEvents(blockHash, extHash string) (int, []*ChainEvent, error) {
+	hashes, err := sc.ExtrinsicHashes(blockHash)
+	if err != nil {
+		return 0, nil, err
+	}
+	index := -1
+	for i, hash := range hashes {
+		if hash == extHash {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return 0, nil, fmt.Errorf("extrinsic %s not in block %s", extHash, blockHash)
+	}
+
+	events, err := sc.GetChainEvents(blockHash)
+	if err != nil {
+		return 0, nil, err
+	}
+	var emitted []*ChainEvent
+	for _, evt := range events {
+		if evt.Phase == 0 && evt.ExtrinsicIdx == index {
+			emitted = append(emitted, evt)
+		}
+	}
+	return index, emitted, nil
+}
+
+// dispatchError returns the DispatchError of the extrinsic index of block blockHash from its
+// decoded value.
+func (sc *SarpcClient) dispatchError(value interface{}, blockHash string, index int) *DispatchError {
+	e := parseDispatchError(value)
+	e.Block, e.Index = blockHash, index
+	if e.Kind == "Module" {
+		sc.resolveModuleError(e)
+	}
+	return e
+}
+
+// parseDispatchError reads a decoded DispatchError, which is an enum like {"Module": {"index": 5,
+// "error": 2}} or {"BadOrigin": null}. The module and error indexes of a Module error are kept in
+// Module and Name until resolved.
+func parseDispatchError(value interface{}) *DispatchError {
+	e := &DispatchError{Kind: "Other"}
+	switch v := value.(type) {
+	case string:
+		e.Kind = v
+	case map[string]interface{}:
+		for kind, inner := range v {
+			e.Kind = kind
+			if module, ok := inner.(map[string]interface{}); ok && kind == "Module" {
+				e.Module = fmt.Sprint(indexValue(module["index"]))
+				e.Name = fmt.Sprint(indexValue(module["error"]))
+			}
+		}
+	}
+	return e
+}
+
+// indexValue reads a decoded index, a number or, like a module error since it became [u8; 4], the
+// hex of the bytes whose first one is the index.
+func indexValue(v interface{}) int {
+	switch i := v.(type) {
+	case float64:
+		return int(i)
+	case string:
+		if b := util.HexToBytes(i); len(b) > 0 {
+			return int(b[0])
+		}
+	}
+	return -1
+}
+
+// resolveModuleError replaces the indexes of a Module error by the names from the metadata.
+func (sc *SarpcClient) resolveModuleError(e *DispatchError) {
+	moduleIndex, err := strconv.Atoi(e.Module)
+	if err != nil {
+		return
+	}
+	errorIndex, err := strconv.Atoi(e.Name)
+	if err != nil {
+		return
+	}
+
+	sc.decodeLock.Lock()
+	defer sc.decodeLock.Unlock()
+	if sc.registry != nil {
+		pallet, name, doc, ok := sc.registry.moduleError(moduleIndex, errorIndex)
+		if pallet != "" {
+			e.Module = pallet
+		}
+		if ok {
+			e.Name = name
+			e.Doc = doc
+		}
+		return
+	}
+	meta := sc.metaDecoder.Metadata
+	for i, module := range meta.Metadata.Modules {
+		// before V12 a module's index is its position
+		if module.Index != moduleIndex && (meta.MetadataVersion >= 12 || i != moduleIndex) {
+			continue
+		}
+		e.Module = module.Name
+		if errorIndex >= 0 && errorIndex < len(module.Errors) {
+			e.Name = module.Errors[errorIndex].Name
+			e.Doc = strings.TrimSpace(strings.Join(module.Errors[errorIndex].Doc, " "))
+		}
+		return
+	}
+}
+
+// headNotification is a notification of chain_subscribeFinalizedHeads
+type headNotification struct {
+	Params struct {
+		Result struct {
+			Number string `json:"number"`
+		} `json:"result"`
+	} `json:"params"`
+	Error *rpc.Error `json:"error,omitempty"`
+}
+
+// SubscribeFinalizedHeads subscribes to the finalized heads on a connection of the pool and sends
+// the number of every head to heads. It returns nil once stop is closed, and an error when the
+// connection fails or no head arrives within timeout, which is reported to the endpoint pool. The
+// connection is closed when it returns.
+func (sc *SarpcClient) SubscribeFinalizedHeads(heads chan<- uint64, timeout time.Duration, stop <-chan int) (err error) {
+	pool, endpoint, err := sc.initial()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil && sc.endpoints != nil {
+			sc.endpoints.Failed(endpoint, err)
+		}
+	}()
+	// the connection carries the subscription, it must not be reused
+	pool.MarkUnusable()
+	defer pool.Close()
+	conn := pool.Conn
+	if !conn.IsConnected() {
+		return fmt.Errorf("websocket not connected")
+	}
 
-	return evts, nil
+	if err = conn.WriteMessage(websocket.TextMessage, rpc.ChainSubscribeFinalizedHeads(wsId)); err != nil {
+		return fmt.Errorf("websocket send error: %v", err)
+	}
+	v := &rpc.JsonRpcResult{}
+	if err = conn.ReadJSON(v); err != nil {
+		return err
+	}
+	if v.Error != nil {
+		return fmt.Errorf("subscribe finalized heads error: %s", v.Error.Message)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n := &headNotification{}
+		if err = conn.ReadJSON(n); err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+		if n.Error != nil {
+			return fmt.Errorf("finalized head error: %s", n.Error.Message)
+		}
+		number, err := strconv.ParseUint(strings.TrimPrefix(n.Params.Result.Number, "0x"), 16, 64)
+		if err != nil {
+			return fmt.Errorf("finalized head number %s invalid: %s", n.Params.Result.Number, err)
+		}
+
+		select {
+		case heads <- number:
+		case <-stop:
+			return nil
+		}
+	}
 }
@@ -0,0 +1,129 @@
+package substrate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	scalecodec "github.com/itering/scale.go"
+	"github.com/stretchr/testify/assert"
+)
+
+// headServer confirms a finalized head subscription and announces the given heads.
+func headServer(t *testing.T, heads ...uint64) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		_, req, err := conn.ReadMessage()
+		if err != nil || !strings.Contains(string(req), "chain_subscribeFinalizedHeads") {
+			t.Errorf("unexpected request %s: %v", req, err)
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"result":"sub"}`))
+		for _, h := range heads {
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(
+				`{"jsonrpc":"2.0","method":"chain_finalizedHead","params":{"subscription":"sub","result":{"number":"0x%x"}}}`, h)))
+		}
+		// keep the connection open without further heads
+		conn.ReadMessage()
+	}))
+}
+
+func TestSubscribeFinalizedHeads(t *testing.T) {
+	srv := headServer(t, 10, 12, 255)
+	defer srv.Close()
+	sc := &SarpcClient{endpoint: "ws" + strings.TrimPrefix(srv.URL, "http"), log: tlog}
+
+	heads := make(chan uint64)
+	stop := make(chan int)
+	result := make(chan error, 1)
+	go func() { result <- sc.SubscribeFinalizedHeads(heads, time.Second, stop) }()
+
+	for _, expected := range []uint64{10, 12, 255} {
+		select {
+		case h := <-heads:
+			assert.Equal(t, expected, h)
+		case err := <-result:
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	assert.NoError(t, <-result)
+}
+
+func TestSubscribeFinalizedHeadsTimeout(t *testing.T) {
+	srv := headServer(t)
+	defer srv.Close()
+	sc := &SarpcClient{endpoint: "ws" + strings.TrimPrefix(srv.URL, "http"), log: tlog}
+
+	err := sc.SubscribeFinalizedHeads(make(chan uint64), 100*time.Millisecond, make(chan int))
+	assert.Error(t, err)
+}
+
+func TestParseDispatchError(t *testing.T) {
+	e := parseDispatchError(map[string]interface{}{"Module": map[string]interface{}{"index": float64(20), "error": float64(3)}})
+	assert.Equal(t, &DispatchError{Kind: "Module", Module: "20", Name: "3"}, e)
+
+	e = parseDispatchError(map[string]interface{}{"Module": map[string]interface{}{"index": float64(20), "error": "0x03000000"}})
+	assert.Equal(t, "3", e.Name)
+
+	e = parseDispatchError(map[string]interface{}{"BadOrigin": nil})
+	assert.Equal(t, &DispatchError{Kind: "BadOrigin"}, e)
+	e.Block, e.Index = "0xab", 2
+	assert.Equal(t, "extrinsic 2 of block 0xab failed: BadOrigin", e.Error())
+}
+
+func TestBatchResults(t *testing.T) {
+	failed := errors.New("dispatch error")
+	dispatchError := func(value interface{}) error { return failed }
+	utility := func(id string, params ...interface{}) *ChainEvent {
+		evt := &ChainEvent{ModuleId: "Utility", EventId: id}
+		for _, p := range params {
+			evt.Params = append(evt.Params, scalecodec.EventParam{Value: p})
+		}
+		return evt
+	}
+	system := &ChainEvent{ModuleId: "System", EventId: "ExtrinsicSuccess"}
+
+	results, err := batchResults([]*ChainEvent{utility("ItemCompleted"), utility("ItemFailed", "err"),
+		utility("ItemCompleted"), utility("BatchCompletedWithErrors"), system}, 3, dispatchError)
+	assert.NoError(t, err)
+	assert.NoError(t, results[0])
+	assert.ErrorIs(t, results[1], failed)
+	assert.NoError(t, results[2])
+
+	// older runtimes stop at the failed call
+	results, err = batchResults([]*ChainEvent{utility("BatchInterrupted", float64(1), "err"), system}, 3, dispatchError)
+	assert.NoError(t, err)
+	assert.NoError(t, results[0])
+	assert.ErrorIs(t, results[1], failed)
+	assert.Error(t, results[2])
+
+	results, err = batchResults([]*ChainEvent{utility("BatchCompleted"), system}, 2, dispatchError)
+	assert.NoError(t, err)
+	assert.Equal(t, []error{nil, nil}, results)
+
+	_, err = batchResults([]*ChainEvent{utility("ItemCompleted"), system}, 2, dispatchError)
+	assert.Error(t, err)
+
+	// calls dispatched through a proxy complete even if the proxied call failed
+	proxied := func(result map[string]interface{}) *ChainEvent {
+		return &ChainEvent{ModuleId: "Proxy", EventId: "ProxyExecuted", Params: []scalecodec.EventParam{{Value: result}}}
+	}
+	results, err = batchResults([]*ChainEvent{proxied(map[string]interface{}{"Ok": nil}), utility("ItemCompleted"),
+		proxied(map[string]interface{}{"Err": "BadOrigin"}), utility("ItemCompleted"), system}, 2, dispatchError)
+	assert.NoError(t, err)
+	assert.NoError(t, results[0])
+	assert.ErrorIs(t, results[1], failed)
+}
@@ -0,0 +1,222 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package approval holds large transfers until an operator decides on them.
+
+A transfer of a resourceId above its configured threshold is not voted automatically. It is
+queued on disk with the status pending and listed by `chainbridge approval list`. Once an
+operator approves it, the running relayer hands it on to the destination writer and marks it
+released. Rejected transfers are never voted and pending transfers that are not decided before
+their expiry are marked expired. Decided entries are kept as a record.
+*/
+package approval
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/msgstore"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+	StatusReleased = "released"
+	StatusExpired  = "expired"
+
+	DefaultExpiry = 72 * time.Hour
+)
+
+// Frequency of checking for operator decisions
+var PollInterval = 10 * time.Second
+
+var _ core.Guard = &Queue{}
+
+// Threshold is the amount above which transfers of a resourceId need an approval, in the units
+// of the destination chain.
+type Threshold struct {
+	ResourceId msg.ResourceId
+	Amount     *big.Int
+	Expiry     time.Duration
+}
+
+// ParseThreshold builds a threshold from its config representation. An empty expiry
+// defaults to DefaultExpiry, an expiry must be positive.
+func ParseThreshold(resourceId, amount, expiry string) (*Threshold, error) {
+	rId, err := hex.DecodeString(strings.TrimPrefix(resourceId, "0x"))
+	if err != nil || len(rId) != 32 {
+		return nil, fmt.Errorf("approval resourceId %s invalid", resourceId)
+	}
+	amt, ok := new(big.Int).SetString(amount, 10)
+	if !ok || amt.Sign() < 0 {
+		return nil, fmt.Errorf("approval threshold %s invalid", amount)
+	}
+	t := &Threshold{ResourceId: msg.ResourceIdFromSlice(rId), Amount: amt, Expiry: DefaultExpiry}
+	if expiry != "" {
+		if t.Expiry, err = time.ParseDuration(expiry); err != nil {
+			return nil, fmt.Errorf("approval expiry %s invalid: %s", expiry, err)
+		}
+		if t.Expiry <= 0 {
+			return nil, fmt.Errorf("approval expiry %s invalid, must be positive", expiry)
+		}
+	}
+	return t, nil
+}
+
+// Queue holds the transfers above their threshold.
+type Queue struct {
+	thresholds map[msg.ResourceId]*Threshold
+	store      *msgstore.Store
+	lock       sync.Mutex
+	log        log15.Logger
+}
+
+func NewQueue(dir string, thresholds []*Threshold, log log15.Logger) (*Queue, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	byResource := make(map[msg.ResourceId]*Threshold)
+	for _, t := range thresholds {
+		byResource[t.ResourceId] = t
+	}
+	return &Queue{
+		thresholds: byResource,
+		store:      store,
+		log:        log,
+	}, nil
+}
+
+// Admit implements core.Guard. Transfers above the threshold are admitted only after they were
+// approved, everything else passes.
+func (q *Queue) Admit(m msg.Message) bool {
+	if m.Type != msg.FungibleTransfer {
+		return true
+	}
+	t, ok := q.thresholds[m.ResourceId]
+	if !ok {
+		return true
+	}
+	amount := new(big.Int).SetBytes(m.Payload[0].([]byte))
+	if amount.Cmp(t.Amount) <= 0 {
+		return true
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	key := msgstore.Key(m.Source, m.Destination, m.DepositNonce)
+	e, err := q.store.Get(key)
+	switch {
+	case err == msgstore.ErrNotFound:
+	case err != nil:
+		// fail closed, the transfer is seen again once the listener retries
+		q.log.Error("Failed to look up approval", append(m.LogContext(), "err", err)...)
+		return false
+	case e.Status == StatusApproved || e.Status == StatusReleased:
+		return true
+	default:
+		q.log.Info("Transfer awaits approval decision", append(m.LogContext(), "status", e.Status)...)
+		return false
+	}
+
+	e = msgstore.NewEntry(m, StatusPending, fmt.Sprintf("amount %s above approval threshold %s", amount, t.Amount))
+	e.ExpiresAt = e.CreatedAt.Add(t.Expiry)
+	if err := q.store.Put(e); err != nil {
+		q.log.Error("Failed to queue transfer for approval", append(m.LogContext(), "err", err)...)
+		return false
+	}
+	q.log.Warn("Transfer held for manual approval", append(m.LogContext(), "amount", amount, "expiresAt", e.ExpiresAt)...)
+	return false
+}
+
+// Watch applies operator decisions and expiries until stop is closed. Approved transfers are
+// handed on through resume.
+func (q *Queue) Watch(resume core.Forwarder, stop <-chan int) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			q.process(resume)
+		}
+	}
+}
+
+func (q *Queue) process(resume core.Forwarder) {
+	entries, err := q.store.List()
+	if err != nil {
+		q.log.Error("Failed to list approval queue", "err", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, e := range entries {
+		switch {
+		case e.Status == StatusPending && now.After(e.ExpiresAt):
+			if !q.finish(e, StatusPending, StatusExpired, fmt.Sprintf("not decided before %s", e.ExpiresAt.Format(time.RFC3339))) {
+				continue
+			}
+			q.log.Warn("Approval expired, transfer will not be voted", append(e.LogContext(), "expiresAt", e.ExpiresAt)...)
+		case e.Status == StatusApproved:
+			m, err := e.Message()
+			if err != nil {
+				q.log.Error("Failed to decode approved transfer", append(e.LogContext(), "err", err)...)
+				continue
+			}
+			q.log.Info("Releasing approved transfer", append(e.LogContext(), "note", e.Note)...)
+			if err := resume(m); err != nil {
+				q.log.Error("Failed to release approved transfer", append(e.LogContext(), "err", err)...)
+				continue
+			}
+			q.finish(e, StatusApproved, StatusReleased, "")
+		}
+	}
+}
+
+// finish moves the entry e from status from to status to, unless its status changed since e was
+// listed, for example by an operator decision in another process. It returns whether it did.
+func (q *Queue) finish(e *msgstore.Entry, from, to, note string) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, err := q.store.Transition(e.Key(), from, to, note); err != nil {
+		q.log.Warn("Approval entry not updated", append(e.LogContext(), "status", to, "err", err)...)
+		return false
+	}
+	return true
+}
+
+// Decide records an operator decision on a pending transfer in the queue kept in dir.
+func Decide(dir, key string, approve bool, note string) (*msgstore.Entry, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	if approve {
+		return store.Transition(key, StatusPending, StatusApproved, note)
+	}
+	return store.Transition(key, StatusPending, StatusRejected, note)
+}
+
+// List returns the entries of the queue kept in dir. If status is not empty only entries with
+// that status are returned.
+func List(dir, status string) ([]*msgstore.Entry, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return store.ListStatus(status)
+}
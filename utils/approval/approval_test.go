@@ -0,0 +1,141 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package approval
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+const testResourceId = "000000000000000000000000000000a9e0095b8965c01e6a09c97938f3860901"
+
+func TestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "approval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	threshold, err := ParseThreshold(testResourceId, "100", "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(dir, []*Threshold{threshold}, log15.New("test", "approval"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small := msg.NewFungibleTransfer(1, 2, 1, big.NewInt(100), threshold.ResourceId, []byte{1})
+	large := msg.NewFungibleTransfer(1, 2, 2, big.NewInt(101), threshold.ResourceId, []byte{2})
+	other := msg.NewFungibleTransfer(1, 2, 3, big.NewInt(101), threshold.ResourceId, []byte{3})
+	assert.True(t, q.Admit(small))
+	assert.False(t, q.Admit(large))
+	assert.False(t, q.Admit(other))
+	// seeing a held transfer again does not release it
+	assert.False(t, q.Admit(large))
+
+	pending, err := List(dir, StatusPending)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 2)
+	assert.Equal(t, "101", pending[0].Amount)
+
+	_, err = Decide(dir, "1-2-2", true, "checked")
+	assert.NoError(t, err)
+	_, err = Decide(dir, "1-2-3", false, "suspicious")
+	assert.NoError(t, err)
+	_, err = Decide(dir, "1-2-3", true, "")
+	assert.Error(t, err)
+
+	released := make([]msg.Message, 0)
+	q.process(func(m msg.Message) error {
+		released = append(released, m)
+		return nil
+	})
+	assert.Equal(t, []msg.Message{large}, released)
+
+	all, err := List(dir, "")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusReleased, all[0].Status)
+	assert.Equal(t, "checked", all[0].Note)
+	assert.Equal(t, StatusRejected, all[1].Status)
+	assert.False(t, q.Admit(other))
+}
+
+func TestQueueExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "approval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	threshold, err := ParseThreshold(testResourceId, "0", "1ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(dir, []*Threshold{threshold}, log15.New("test", "approval"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.False(t, q.Admit(msg.NewFungibleTransfer(1, 2, 1, big.NewInt(1), threshold.ResourceId, []byte{1})))
+	time.Sleep(10 * time.Millisecond)
+	q.process(func(m msg.Message) error {
+		t.Fatal("expired transfer released")
+		return nil
+	})
+
+	expired, err := List(dir, StatusExpired)
+	assert.NoError(t, err)
+	assert.Len(t, expired, 1)
+	_, err = Decide(dir, "1-2-1", true, "")
+	assert.Error(t, err)
+}
+
+func TestQueueDecisionNotOverwritten(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "approval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	threshold, err := ParseThreshold(testResourceId, "0", "1ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(dir, []*Threshold{threshold}, log15.New("test", "approval"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, q.Admit(msg.NewFungibleTransfer(1, 2, 1, big.NewInt(1), threshold.ResourceId, []byte{1})))
+	time.Sleep(10 * time.Millisecond)
+
+	// the operator approves after the relayer listed the expired entry
+	listed, err := List(dir, StatusPending)
+	assert.NoError(t, err)
+	_, err = Decide(dir, "1-2-1", true, "checked")
+	assert.NoError(t, err)
+	assert.False(t, q.finish(listed[0], StatusPending, StatusExpired, "expired"))
+
+	approved, err := List(dir, StatusApproved)
+	assert.NoError(t, err)
+	assert.Len(t, approved, 1)
+	assert.Equal(t, "checked", approved[0].Note)
+}
+
+func TestParseThresholdExpiry(t *testing.T) {
+	for _, expiry := range []string{"0s", "-1h", "soon"} {
+		_, err := ParseThreshold(testResourceId, "100", expiry)
+		assert.Error(t, err, expiry)
+	}
+	threshold, err := ParseThreshold(testResourceId, "100", "")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultExpiry, threshold.Expiry)
+}
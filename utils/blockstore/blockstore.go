@@ -1,22 +1,44 @@
 // Copyright 2020 Stafi Protocol
 // SPDX-License-Identifier: LGPL-3.0-only
 
+/*
+Package blockstore keeps the progress of a listener so it can resume after a restart.
+
+The progress of a chain/relayer pair is a short history of checkpoints, each a block height and
+the hash of that block, and the last processed signature for chains that are polled by
+signature. The history lets a listener find the last block it processed that is still part of
+the canonical chain after a reorg. The state is persisted through a Backend; the file backend
+replaces its file atomically and detects corrupted files when loading them.
+*/
 package blockstore
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"math/big"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/stafiprotocol/chainbridge/utils/msg"
 )
 
-const PathPostfix = ".chainbridge/blockstore"
+const (
+	PathPostfix = ".chainbridge/blockstore"
+	// Version of the stored state
+	Version = 2
+	// DefaultHistory is the number of checkpoints kept for reorg recovery
+	DefaultHistory = 64
+)
+
+var (
+	ErrCorrupt          = errors.New("blockstore corrupt")
+	ErrNoCommonAncestor = errors.New("no stored block is part of the canonical chain")
+)
 
 type Blockstorer interface {
-	StoreBlock(*big.Int) error
+	StoreBlock(block *big.Int, hash string) error
 	StoreSignature(string) error
 }
 
@@ -26,114 +48,260 @@ var _ Blockstorer = &Blockstore{}
 // Dummy store for testing only
 type EmptyStore struct{}
 
-func (s *EmptyStore) StoreBlock(_ *big.Int) error   { return nil }
-func (s *EmptyStore) StoreSignature(_ string) error { return nil }
+func (s *EmptyStore) StoreBlock(_ *big.Int, _ string) error { return nil }
+func (s *EmptyStore) StoreSignature(_ string) error         { return nil }
+
+// Backend persists the state of a blockstore.
+type Backend interface {
+	// Load returns the stored state, or nil if nothing was stored yet.
+	Load() (*State, error)
+	// Save replaces the stored state. After a crash Load returns either the previous or the
+	// new state.
+	Save(*State) error
+}
+
+// Checkpoint is a processed block.
+type Checkpoint struct {
+	Height uint64    `json:"height"`
+	Hash   string    `json:"hash,omitempty"` // empty if unknown
+	Time   time.Time `json:"time"`
+}
+
+// State is the progress of a chain/relayer pair.
+type State struct {
+	History   []Checkpoint `json:"history"`             // oldest first, the last one is the latest
+	Signature string       `json:"signature,omitempty"` // last processed signature
+}
+
+// Latest returns the latest checkpoint, or nil if there is none.
+func (s *State) Latest() *Checkpoint {
+	if len(s.History) == 0 {
+		return nil
+	}
+	c := s.History[len(s.History)-1]
+	return &c
+}
+
+func (s *State) clone() *State {
+	c := *s
+	c.History = append([]Checkpoint(nil), s.History...)
+	return &c
+}
 
 // Blockstore implements Blockstorer.
 type Blockstore struct {
-	path     string // Path excluding filename
-	fullPath string
-	chain    msg.ChainId
-	relayer  string
+	backend Backend
+	history int
+	state   *State // cached state, loaded on first use
+	lock    sync.Mutex
 }
 
+// NewBlockstore returns the blockstore of the chain/relayer pair kept in a file inside path.
+// Passing an empty string for path will cause it to use the home directory.
 func NewBlockstore(path string, chain msg.ChainId, relayer string) (*Blockstore, error) {
-	fileName := getFileName(chain, relayer)
-	if path == "" {
-		def, err := getDefaultPath()
-		if err != nil {
-			return nil, err
-		}
-		path = def
+	path, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
 	}
-
-	return &Blockstore{
-		path:     path,
-		fullPath: filepath.Join(path, fileName),
-		chain:    chain,
-		relayer:  relayer,
-	}, nil
+	return New(NewFileBackend(filepath.Join(path, FileName(chain, relayer)))), nil
 }
 
-// StoreBlock writes the block number to disk.
-func (b *Blockstore) StoreBlock(block *big.Int) error {
-	// Create dir if it does not exist
-	if _, err := os.Stat(b.path); os.IsNotExist(err) {
-		errr := os.MkdirAll(b.path, os.ModePerm)
-		if errr != nil {
-			return errr
-		}
+// NewSignatureBlockstore is NewBlockstore for a chain polled by signature, such as solana.
+func NewSignatureBlockstore(path string, chain msg.ChainId, relayer string) (*Blockstore, error) {
+	path, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
 	}
+	return New(NewSignatureFileBackend(filepath.Join(path, FileName(chain, relayer)))), nil
+}
 
-	// Write bytes to file
-	data := []byte(block.String())
-	err := ioutil.WriteFile(b.fullPath, data, 0600)
+// New returns a blockstore persisted by backend.
+func New(backend Backend) *Blockstore {
+	return &Blockstore{backend: backend, history: DefaultHistory}
+}
+
+// SetHistory sets the number of checkpoints kept.
+func (b *Blockstore) SetHistory(n int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.history = n
+}
+
+// StoreBlock records block, with its hash if known, as the latest processed block. Checkpoints
+// at or above block are replaced, so storing a lower block rewinds the history.
+func (b *Blockstore) StoreBlock(block *big.Int, hash string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	s, err := b.load()
 	if err != nil {
 		return err
 	}
-	return nil
+	s = s.clone()
+	height := block.Uint64()
+	for len(s.History) != 0 && s.History[len(s.History)-1].Height >= height {
+		s.History = s.History[:len(s.History)-1]
+	}
+	s.History = append(s.History, Checkpoint{Height: height, Hash: hash, Time: time.Now().UTC()})
+	if len(s.History) > b.history {
+		s.History = s.History[len(s.History)-b.history:]
+	}
+	return b.save(s)
 }
 
-// StoreBlock writes the signature  to disk.
+// StoreSignature records sig as the latest processed signature.
 func (b *Blockstore) StoreSignature(sig string) error {
-	// Create dir if it does not exist
-	if _, err := os.Stat(b.path); os.IsNotExist(err) {
-		errr := os.MkdirAll(b.path, os.ModePerm)
-		if errr != nil {
-			return errr
-		}
-	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
 
-	// Write bytes to file
-	data := []byte(sig)
-	err := ioutil.WriteFile(b.fullPath, data, 0600)
+	s, err := b.load()
 	if err != nil {
 		return err
 	}
-	return nil
+	s = s.clone()
+	s.Signature = sig
+	return b.save(s)
 }
 
-// TryLoadLatestBlock will attempt to load the latest block for the chain/relayer pair, returning 0 if not found.
-// Passing an empty string for path will cause it to use the home directory.
+// TryLoadLatestSignature will attempt to load the latest signature for the chain/relayer pair,
+// returning an empty string if not found.
 func (b *Blockstore) TryLoadLatestSignature() (string, error) {
-	// If it exists, load and return
-	exists, err := fileExists(b.fullPath)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	s, err := b.load()
 	if err != nil {
 		return "", err
 	}
-	if exists {
-		dat, err := ioutil.ReadFile(b.fullPath)
-		if err != nil {
-			return "", err
-		}
-
-		return string(dat), nil
-	}
-	// Otherwise just return 0
-	return "", nil
+	return s.Signature, nil
 }
 
 // TryLoadLatestBlock will attempt to load the latest block for the chain/relayer pair, returning 0 if not found.
-// Passing an empty string for path will cause it to use the home directory.
 func (b *Blockstore) TryLoadLatestBlock() (*big.Int, error) {
-	// If it exists, load and return
-	exists, err := fileExists(b.fullPath)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	s, err := b.load()
 	if err != nil {
 		return nil, err
 	}
-	if exists {
-		dat, err := ioutil.ReadFile(b.fullPath)
-		if err != nil {
-			return nil, err
+	latest := s.Latest()
+	if latest == nil {
+		return big.NewInt(0), nil
+	}
+	return new(big.Int).SetUint64(latest.Height), nil
+}
+
+// History returns the stored checkpoints, oldest first.
+func (b *Blockstore) History() ([]Checkpoint, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	s, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+	return append([]Checkpoint(nil), s.History...), nil
+}
+
+// State returns a copy of the stored state.
+func (b *Blockstore) State() (*State, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	s, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+	return s.clone(), nil
+}
+
+// Replace replaces the stored state with s.
+func (b *Blockstore) Replace(s *State) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.save(s.clone())
+}
+
+// Reset clears the stored checkpoints and signature, so the listener starts from its configured
+// start block.
+func (b *Blockstore) Reset() error {
+	return b.Replace(&State{})
+}
+
+// Rewind drops the checkpoints of blocks that are no longer part of the canonical chain and
+// returns the latest remaining one, or nil if there are no checkpoints. canonical returns the
+// hash of the canonical block at a height; checkpoints without a hash are trusted.
+func (b *Blockstore) Rewind(canonical func(height uint64) (string, error)) (*Checkpoint, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	s, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(s.History) - 1; i >= 0; i-- {
+		c := s.History[i]
+		if c.Hash != "" {
+			hash, err := canonical(c.Height)
+			if err != nil {
+				return nil, err
+			}
+			if hash != c.Hash {
+				continue
+			}
+		}
+		if i != len(s.History)-1 {
+			s = s.clone()
+			s.History = s.History[:i+1]
+			if err := b.save(s); err != nil {
+				return nil, err
+			}
 		}
-		block, _ := big.NewInt(0).SetString(string(dat), 10)
-		return block, nil
+		return &c, nil
+	}
+	if len(s.History) == 0 {
+		return nil, nil
+	}
+	return nil, ErrNoCommonAncestor
+}
+
+// load returns the cached state, loading it from the backend on first use. The caller must
+// hold the lock.
+func (b *Blockstore) load() (*State, error) {
+	if b.state != nil {
+		return b.state, nil
+	}
+	s, err := b.backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		s = &State{}
+	}
+	b.state = s
+	return s, nil
+}
+
+// save persists s and caches it once it was saved. The caller must hold the lock.
+func (b *Blockstore) save(s *State) error {
+	if err := b.backend.Save(s); err != nil {
+		return err
 	}
-	// Otherwise just return 0
-	return big.NewInt(0), nil
+	b.state = s
+	return nil
 }
 
-func getFileName(chain msg.ChainId, relayer string) string {
+// ResolvePath returns path, or the default blockstore directory if path is empty.
+func ResolvePath(path string) (string, error) {
+	if path == "" {
+		return getDefaultPath()
+	}
+	return path, nil
+}
+
+// FileName returns the name of the blockstore file of a chain/relayer pair.
+func FileName(chain msg.ChainId, relayer string) string {
 	return fmt.Sprintf("%s-%d.block", relayer, chain)
 }
 
@@ -146,13 +314,3 @@ func getDefaultPath() (string, error) {
 
 	return filepath.Join(home, PathPostfix), nil
 }
-
-func fileExists(fileName string) (bool, error) {
-	_, err := os.Stat(fileName)
-	if os.IsNotExist(err) {
-		return false, nil
-	} else if err != nil {
-		return false, err
-	}
-	return true, nil
-}
@@ -4,9 +4,13 @@
 package blockstore
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stafiprotocol/chainbridge/utils/keystore"
@@ -39,7 +43,7 @@ func TestSaveAndLoad(t *testing.T) {
 
 	// Save block number
 	block = big.NewInt(999)
-	err = bs.StoreBlock(block)
+	err = bs.StoreBlock(block, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -56,7 +60,7 @@ func TestSaveAndLoad(t *testing.T) {
 
 	// Save block number again
 	block = big.NewInt(1234)
-	err = bs.StoreBlock(block)
+	err = bs.StoreBlock(block, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -71,3 +75,183 @@ func TestSaveAndLoad(t *testing.T) {
 		t.Fatalf("Expected: %d got: %d", block.Uint64(), latest.Uint64())
 	}
 }
+
+func TestHistoryAndRewind(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "blockstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bs, err := NewBlockstore(dir, msg.ChainId(1), "relayer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs.SetHistory(3)
+	for i := int64(1); i <= 5; i++ {
+		err = bs.StoreBlock(big.NewInt(i), fmt.Sprintf("0x%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := bs.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].Height != 3 || history[2].Hash != "0x5" {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	// blocks 4 and 5 were reorganized
+	canonical := func(height uint64) (string, error) {
+		if height > 3 {
+			return "0xfork", nil
+		}
+		return fmt.Sprintf("0x%d", height), nil
+	}
+	c, err := bs.Rewind(canonical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Height != 3 {
+		t.Fatalf("Expected: %d got: %d", 3, c.Height)
+	}
+
+	// the rewind is persisted
+	reopened, err := NewBlockstore(dir, msg.ChainId(1), "relayer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := reopened.TryLoadLatestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Uint64() != 3 {
+		t.Fatalf("Expected: %d got: %d", 3, latest.Uint64())
+	}
+
+	// storing a lower block replaces the checkpoints above it
+	err = reopened.StoreBlock(big.NewInt(2), "0x2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err = reopened.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Height != 2 {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	_, err = reopened.Rewind(func(uint64) (string, error) { return "0xfork", nil })
+	if !errors.Is(err, ErrNoCommonAncestor) {
+		t.Fatalf("Expected: %s got: %v", ErrNoCommonAncestor, err)
+	}
+}
+
+func TestSignatureKeptApart(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "blockstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bs, err := NewBlockstore(dir, msg.ChainId(1), "relayer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bs.StoreBlock(big.NewInt(7), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bs.StoreSignature("5sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := bs.TryLoadLatestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := bs.TryLoadLatestSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Uint64() != 7 || sig != "5sig" {
+		t.Fatalf("unexpected block %s signature %s", latest, sig)
+	}
+	if _, err := os.Stat(filepath.Join(dir, FileName(1, "relayer")+".tmp")); !os.IsNotExist(err) {
+		t.Fatal("temporary file left behind")
+	}
+}
+
+func TestLegacyAndCorruptFiles(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "blockstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "store.block")
+	write := func(content string) {
+		err := ioutil.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	load := func(content string) (*State, error) {
+		write(content)
+		return NewFileBackend(path).Load()
+	}
+
+	s, err := load("1234\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Latest().Height != 1234 {
+		t.Fatalf("Expected: %d got: %d", 1234, s.Latest().Height)
+	}
+	sig := "5VERv8NMvzbJMEkV8xnrLkEaWRtSz9CosKDYjCJjBRnbJLgp8uirBgmQpjKhoR4tjF3ZpRzrFmBV6UjKdiSZkQUW"
+	write(sig)
+	s, err = NewSignatureFileBackend(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Signature != sig || s.Latest() != nil {
+		t.Fatalf("unexpected state %+v", s)
+	}
+	// signatures are only read for chains polled by signature, and must decode to 64 bytes
+	_, err = load(sig)
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Expected: %s got: %v", ErrCorrupt, err)
+	}
+	for _, content := range []string{"3xSignature", "5VERv8NMvzbJMEkV8xnrLkEaWRtSz9CosKDYjCJjBRnb", "0OIl"} {
+		write(content)
+		_, err = NewSignatureFileBackend(path).Load()
+		if !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("Expected: %s got: %v for %q", ErrCorrupt, err, content)
+		}
+	}
+
+	f := NewFileBackend(path)
+	err = f.Save(&State{History: []Checkpoint{{Height: 10, Hash: "0xa"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{
+		"",
+		string(data[:len(data)/2]),
+		strings.Replace(string(data), `"height": 10`, `"height": 11`, 1),
+		strings.Replace(string(data), `"version": 2`, `"version": 3`, 1),
+	} {
+		_, err = load(content)
+		if !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("Expected: %s got: %v for %q", ErrCorrupt, err, content)
+		}
+	}
+}
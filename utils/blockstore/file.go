@@ -0,0 +1,173 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package blockstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/decred/base58"
+)
+
+// signatureLength is the length of a decoded solana signature.
+const signatureLength = 64
+
+var _ Backend = &FileBackend{}
+
+// envelope is the content of a blockstore file. Checksum is the sha256 of the compact JSON of
+// State.
+type envelope struct {
+	Version  int             `json:"version"`
+	Checksum string          `json:"checksum"`
+	State    json.RawMessage `json:"state"`
+}
+
+// FileBackend keeps the state in a JSON file. The file is replaced by writing a temporary file
+// next to it, syncing it to disk and renaming it over the old one. Files written by earlier
+// versions, holding only a block height or, for chains polled by signature, a signature, are read
+// as the latest checkpoint or signature and upgraded on the next save.
+type FileBackend struct {
+	path       string
+	signatures bool // legacy files may hold a signature
+}
+
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{path: path}
+}
+
+// NewSignatureFileBackend returns the backend of a chain polled by signature, such as solana.
+func NewSignatureFileBackend(path string) *FileBackend {
+	return &FileBackend{path: path, signatures: true}
+}
+
+// Path returns the path of the file.
+func (f *FileBackend) Path() string {
+	return f.path
+}
+
+func (f *FileBackend) Load() (*State, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, err := decode(data, f.signatures)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrCorrupt, f.path, err)
+	}
+	return s, nil
+}
+
+func (f *FileBackend) Save(s *State) error {
+	data, err := encode(s)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(f.path)
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	tmp := f.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	err = os.Rename(tmp, f.path)
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes a rename inside dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func encode(s *State) ([]byte, error) {
+	state, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(state)
+	return json.MarshalIndent(envelope{Version: Version, Checksum: hex.EncodeToString(sum[:]), State: state}, "", "  ")
+}
+
+func decode(data []byte, signatures bool) (*State, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("empty file")
+	}
+	if trimmed[0] != '{' {
+		return decodeLegacy(string(trimmed), signatures)
+	}
+
+	var e envelope
+	err := json.Unmarshal(trimmed, &e)
+	if err != nil {
+		return nil, err
+	}
+	if e.Version != Version {
+		return nil, fmt.Errorf("unsupported version %d", e.Version)
+	}
+	// the state is indented with the rest of the file, the checksum is of its compact form
+	var state bytes.Buffer
+	err = json.Compact(&state, e.State)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(state.Bytes())
+	if hex.EncodeToString(sum[:]) != e.Checksum {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+	var s State
+	err = json.Unmarshal(e.State, &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// decodeLegacy reads a file holding a block height or, if signatures is set, a signature.
+func decodeLegacy(content string, signatures bool) (*State, error) {
+	height, err := strconv.ParseUint(content, 10, 64)
+	if err == nil {
+		return &State{History: []Checkpoint{{Height: height}}}, nil
+	}
+	if !signatures {
+		return nil, fmt.Errorf("invalid block height %q", content)
+	}
+	if len(base58.Decode(content)) != signatureLength {
+		return nil, fmt.Errorf("invalid signature %q", content)
+	}
+	return &State{Signature: content}, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+)
+
+// BackfillSummary is the result of a backfill.
+type BackfillSummary struct {
+	Sent      int               // messages sent by the listener
+	Transfers map[string]string // outcome by transfer key, <source>-<destination>-<nonce>
+}
+
+// Counts returns the number of transfers by outcome.
+func (s *BackfillSummary) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, outcome := range s.Transfers {
+		counts[outcome]++
+	}
+	return counts
+}
+
+// backfillTracker is the Observer of a backfill, it counts the messages that are not resolved yet.
+type backfillTracker struct {
+	pending map[string]int
+	summary BackfillSummary
+	changed chan struct{}
+	lock    sync.Mutex
+}
+
+func newBackfillTracker() *backfillTracker {
+	return &backfillTracker{
+		pending: make(map[string]int),
+		summary: BackfillSummary{Transfers: make(map[string]string)},
+		changed: make(chan struct{}, 1),
+	}
+}
+
+func (t *backfillTracker) Sent(m msg.Message) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pending[transferKey(m)]++
+	t.summary.Sent++
+}
+
+func (t *backfillTracker) Resolved(m msg.Message, outcome string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := transferKey(m)
+	t.summary.Transfers[key] = outcome
+	if t.pending[key] > 1 {
+		t.pending[key]--
+	} else {
+		delete(t.pending, key)
+	}
+	select {
+	case t.changed <- struct{}{}:
+	default:
+	}
+}
+
+// idle reports whether every message sent so far is resolved.
+func (t *backfillTracker) idle() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.pending) == 0
+}
+
+func (t *backfillTracker) result() *BackfillSummary {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s := BackfillSummary{Sent: t.summary.Sent, Transfers: make(map[string]string)}
+	for k, v := range t.summary.Transfers {
+		s.Transfers[k] = v
+	}
+	return &s
+}
+
+// Backfill starts the writers of all chains and has the listener of chain id route the deposits
+// of the blocks from to to, both included. It returns once the outcome of every resulting message
+// is known, or with an error if the listener or a writer fails or an interrupt is received. The
+// chains are stopped when it returns.
+func (c *Core) Backfill(id msg.ChainId, from, to uint64) (*BackfillSummary, error) {
+	var source Backfiller
+	for _, chain := range c.Registry {
+		if chain.Id() != id {
+			continue
+		}
+		b, ok := chain.(Backfiller)
+		if !ok {
+			return nil, fmt.Errorf("chain %s cannot backfill", chain.Name())
+		}
+		source = b
+	}
+	if source == nil {
+		return nil, fmt.Errorf("chain %d not configured", id)
+	}
+
+	t := newBackfillTracker()
+	c.route.SetObserver(t)
+	defer c.route.SetObserver(nil)
+
+	defer func() {
+		for _, chain := range c.Registry {
+			chain.Stop()
+		}
+	}()
+	for _, chain := range c.Registry {
+		err := chain.StartWriter()
+		if err != nil {
+			return nil, fmt.Errorf("failed to start %s writer: %s", chain.Name(), err)
+		}
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+
+	c.log.Info("Backfilling", "chain", id, "from", from, "to", to)
+	scanned := make(chan error, 1)
+	go func() {
+		scanned <- source.Backfill(from, to)
+	}()
+
+	scanning := true
+	for {
+		if !scanning && t.idle() {
+			return t.result(), nil
+		}
+		select {
+		case err := <-scanned:
+			if err != nil {
+				return t.result(), err
+			}
+			scanning = false
+			c.log.Info("Backfill scan done, waiting for the writers", "sent", t.result().Sent)
+		case <-t.changed:
+		case err := <-c.sysErr:
+			return t.result(), err
+		case <-sigc:
+			return t.result(), errors.New("interrupted")
+		}
+	}
+}
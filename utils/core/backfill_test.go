@@ -0,0 +1,92 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+// backfillChain sends a message for every block it backfills, its writer processes messages
+// with odd nonces successfully after a delay.
+type backfillChain struct {
+	id      msg.ChainId
+	router  *Router
+	writing bool
+	stopped bool
+	scanErr error
+}
+
+func (c *backfillChain) Start() error       { return errors.New("listener started") }
+func (c *backfillChain) StartWriter() error { c.writing = true; return nil }
+func (c *backfillChain) Id() msg.ChainId    { return c.id }
+func (c *backfillChain) Name() string       { return "test" }
+func (c *backfillChain) Stop()              { c.stopped = true }
+
+func (c *backfillChain) SetRouter(r *Router) {
+	c.router = r
+	r.Listen(c.id, c)
+}
+
+func (c *backfillChain) Backfill(from, to uint64) error {
+	for block := from; block <= to; block++ {
+		err := c.router.Send(msg.Message{Source: c.id, Destination: c.id, DepositNonce: msg.Nonce(block)})
+		if err != nil {
+			return err
+		}
+	}
+	return c.scanErr
+}
+
+func (c *backfillChain) ResolveMessage(m msg.Message) bool {
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.router.Processed(m, m.DepositNonce%2 == 1)
+	}()
+	return true
+}
+
+type nonceGuard struct{}
+
+func (nonceGuard) Admit(m msg.Message) bool { return m.DepositNonce != 4 }
+
+func TestBackfill(t *testing.T) {
+	c := NewCore(make(chan error))
+	c.route.log.SetHandler(log15.DiscardHandler())
+	chain := &backfillChain{id: 1}
+	c.AddChain(chain)
+	c.AddGuard(nonceGuard{})
+
+	summary, err := c.Backfill(1, 1, 4)
+	assert.NoError(t, err)
+	assert.True(t, chain.writing)
+	assert.True(t, chain.stopped)
+	assert.Equal(t, 4, summary.Sent)
+	assert.Equal(t, map[string]string{
+		"1-1-1": OutcomeProcessed,
+		"1-1-2": OutcomeFailed,
+		"1-1-3": OutcomeProcessed,
+		"1-1-4": OutcomeHeld,
+	}, summary.Transfers)
+	assert.Equal(t, map[string]int{OutcomeProcessed: 2, OutcomeFailed: 1, OutcomeHeld: 1}, summary.Counts())
+}
+
+func TestBackfillErrors(t *testing.T) {
+	c := NewCore(make(chan error))
+	c.route.log.SetHandler(log15.DiscardHandler())
+	chain := &backfillChain{id: 1, scanErr: errors.New("rpc down")}
+	c.AddChain(chain)
+
+	_, err := c.Backfill(2, 1, 1)
+	assert.EqualError(t, err, "chain 2 not configured")
+
+	summary, err := c.Backfill(1, 1, 1)
+	assert.EqualError(t, err, "rpc down")
+	assert.Equal(t, 1, summary.Sent)
+}
@@ -8,13 +8,23 @@ import (
 )
 
 type Chain interface {
-	Start() error // Start chain
+	Start() error       // Start chain
+	StartWriter() error // Start the writer of the chain only, see Core.Backfill
 	SetRouter(*Router)
 	Id() msg.ChainId
 	Name() string
 	Stop()
 }
 
+// Backfiller is implemented by chains whose listener can relay the deposits of past blocks on
+// demand.
+type Backfiller interface {
+	// Backfill sends the deposits of the blocks from to to, both included, to the router with
+	// the parsing of the listener and returns once all of them were sent. It does not update the
+	// blockstore. Solana chains count slots instead of blocks.
+	Backfill(from, to uint64) error
+}
+
 type ChainConfig struct {
 	Name           string            // Human-readable chain name
 	Id             msg.ChainId       // ChainID
@@ -10,6 +10,8 @@ import (
 	"syscall"
 
 	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/notify"
 )
 
 type Core struct {
@@ -34,6 +36,41 @@ func (c *Core) AddChain(chain Chain) {
 	chain.SetRouter(c.route)
 }
 
+// AddGuard registers a guard with the router, see Router.AddGuard
+func (c *Core) AddGuard(g Guard) Forwarder {
+	return c.route.AddGuard(g)
+}
+
+// SetConverter sets the converter of the router, see Router.SetConverter
+func (c *Core) SetConverter(conv Converter) {
+	c.route.SetConverter(conv)
+}
+
+// SetDeadLetters sets the dead letters of the router, see Router.SetDeadLetters
+func (c *Core) SetDeadLetters(d DeadLetters) {
+	c.route.SetDeadLetters(d)
+}
+
+// SetJournal sets the journal of the router, see Router.SetJournal
+func (c *Core) SetJournal(j Journal) {
+	c.route.SetJournal(j)
+}
+
+// SetNotifier sets the notifier of the router and of chain starts and fatal errors
+func (c *Core) SetNotifier(n Notifier) {
+	c.route.SetNotifier(n)
+}
+
+// Notify passes an event to the notifier of the router, see Router.Notify
+func (c *Core) Notify(e *notify.Event) {
+	c.route.Notify(e)
+}
+
+// Retry resends a dead message, see Router.Retry
+func (c *Core) Retry(m msg.Message, stage string) error {
+	return c.route.Retry(m, stage)
+}
+
 // Start will call all registered chains' Start methods and block forever (or until signal is received)
 func (c *Core) Start() {
 	for _, chain := range c.Registry {
@@ -44,9 +81,11 @@ func (c *Core) Start() {
 				"chain", chain.Id(),
 				"err", err,
 			)
+			c.route.Notify(notify.NewEvent(notify.EventFatal, chain.Id(), "", "failed to start %s chain: %s", chain.Name(), err))
 			return
 		}
 		c.log.Info(fmt.Sprintf("Started %s chain", chain.Name()))
+		c.route.Notify(notify.NewEvent(notify.EventStarted, chain.Id(), "", "started %s chain", chain.Name()))
 	}
 
 	sigc := make(chan os.Signal, 1)
@@ -57,6 +96,7 @@ func (c *Core) Start() {
 	select {
 	case err := <-c.sysErr:
 		c.log.Error("FATAL ERROR. Shutting down.", "err", err)
+		c.route.Notify(notify.NewEvent(notify.EventFatal, 0, "", "shutting down: %s", err))
 	case <-sigc:
 		c.log.Warn("Interrupt received, shutting down now.")
 	}
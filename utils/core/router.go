@@ -8,7 +8,10 @@ import (
 	"sync"
 
 	log "github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/journal"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/notify"
+	"github.com/stafiprotocol/chainbridge/utils/tracing"
 )
 
 // Writer consumes a message and makes the requried on-chain interactions.
@@ -16,11 +19,84 @@ type Writer interface {
 	ResolveMessage(message msg.Message) bool
 }
 
+// Guard is consulted by the Router before a message is handed to its destination Writer.
+// Returning false means the guard has taken custody of the message, it may hand it on
+// later through the Forwarder returned by Router.AddGuard. Admit is called with the router
+// locked and must not call a Forwarder itself.
+type Guard interface {
+	Admit(m msg.Message) bool
+}
+
+// Deferrer is implemented by guards that take custody of messages until their background
+// routine decided on them, such as screening. A deferred message is journaled as held but no
+// operator is notified, the guard notifies once it holds the message for good.
+type Deferrer interface {
+	Deferred(m msg.Message) bool
+}
+
+// Accounter is implemented by guards that account for the messages handed to a Writer, such as
+// transfer limits. Forwarded is called with the router locked once every guard admitted m, also
+// if m was held and forwarded later.
+type Accounter interface {
+	Forwarded(m msg.Message)
+}
+
+// Forwarder continues the delivery of a message after a specific guard.
+type Forwarder func(m msg.Message) error
+
+// Converter translates a message into the units of its destination chain. An error rejects
+// the message.
+type Converter interface {
+	Convert(m msg.Message) (msg.Message, error)
+}
+
+const (
+	StageSource      = "source"      // rejected before routing, amounts are in source units
+	StageDestination = "destination" // skipped by the destination writer
+)
+
+// DeadLetters keeps the messages that could not be relayed so they can be retried later.
+type DeadLetters interface {
+	Record(m msg.Message, stage, reason string)
+}
+
+// Journal keeps a durable record of the actions taken on messages.
+type Journal interface {
+	Add(r *journal.Record) error
+}
+
+// Notifier alerts operators about events that need their attention.
+type Notifier interface {
+	Notify(e *notify.Event)
+}
+
+// Outcomes of a message reported to an Observer
+const (
+	OutcomeRejected  = "rejected"  // not routed
+	OutcomeHeld      = "held"      // held by a guard
+	OutcomeProcessed = "processed" // handled by the destination writer
+	OutcomeFailed    = "failed"    // the destination writer failed to handle it
+)
+
+// Observer follows the messages through the router until their outcome is known.
+type Observer interface {
+	// Sent is called when a listener sends a message to the router
+	Sent(m msg.Message)
+	// Resolved is called with the final outcome of a message
+	Resolved(m msg.Message, outcome string)
+}
+
 // Router forwards messages from their source to their destination
 type Router struct {
-	registry map[msg.ChainId]Writer
-	lock     *sync.RWMutex
-	log      log.Logger
+	registry    map[msg.ChainId]Writer
+	guards      []Guard
+	converter   Converter
+	deadLetters DeadLetters
+	journal     Journal
+	notifier    Notifier
+	observer    Observer
+	lock        *sync.RWMutex
+	log         log.Logger
 }
 
 func NewRouter(log log.Logger) *Router {
@@ -36,13 +112,56 @@ func (r *Router) Send(msg msg.Message) error {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	r.log.Trace("Routing message", "src", msg.Source, "dest", msg.Destination, "nonce", msg.DepositNonce, "rId", msg.ResourceId.Hex())
-	w := r.registry[msg.Destination]
+	r.log.Trace("Routing message", msg.LogContext()...)
+	_, span := tracing.StartMessage(tracing.Context(msg), msg, tracing.SpanRoute)
+	defer span.End()
+	if r.observer != nil {
+		r.observer.Sent(msg)
+	}
+	r.add(journal.NewDeposit(msg))
+	if r.converter != nil {
+		converted, err := r.converter.Convert(msg)
+		if err != nil {
+			// the rejection is final, seeing the same event again would not change it
+			r.record(msg, StageSource, err.Error())
+			return nil
+		}
+		msg = converted
+	}
+	return r.deliver(msg, 0)
+}
+
+// deliver runs the message through the guards starting at index from and passes it to the
+// destination Writer once all of them admitted it. The caller must hold the lock.
+func (r *Router) deliver(m msg.Message, from int) error {
+	w := r.registry[m.Destination]
 	if w == nil {
-		return fmt.Errorf("unknown destination chainId: %d", msg.Destination)
+		r.resolved(m, OutcomeRejected)
+		return fmt.Errorf("unknown destination chainId: %d", m.Destination)
+	}
+
+	for _, g := range r.guards[from:] {
+		if !g.Admit(m) {
+			r.log.Debug("Message held by guard", append(m.LogContext(), "guard", fmt.Sprintf("%T", g))...)
+			if d, ok := g.(Deferrer); ok && d.Deferred(m) {
+				r.add(journal.NewDecision(m, journal.StatusHeld, fmt.Sprintf("%T pending", g)))
+			} else {
+				r.add(journal.NewDecision(m, journal.StatusHeld, fmt.Sprintf("%T", g)))
+				r.notify(notify.NewEvent(notify.EventParked, m.Destination, transferKey(m), "transfer %s held by %T", transferKey(m), g))
+			}
+			r.resolved(m, OutcomeHeld)
+			return nil
+		}
 	}
 
-	go w.ResolveMessage(msg)
+	for _, g := range r.guards {
+		if a, ok := g.(Accounter); ok {
+			a.Forwarded(m)
+		}
+	}
+	r.add(journal.NewDecision(m, journal.StatusQueued, ""))
+	tracing.Queued(m)
+	go w.ResolveMessage(m)
 	return nil
 }
 
@@ -65,3 +184,156 @@ func (r *Router) Listen(id msg.ChainId, w Writer) {
 	r.log.Debug("Registering new chain in router", "id", id)
 	r.registry[id] = w
 }
+
+// Reject records a message a listener could not route. Retrying it sends it through the router
+// again.
+func (r *Router) Reject(m msg.Message, reason string) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	r.record(m, StageSource, reason)
+}
+
+// DeadLetter records a message a writer skipped. Retrying it hands it to the writer again.
+func (r *Router) DeadLetter(m msg.Message, reason string) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	r.record(m, StageDestination, reason)
+}
+
+// record logs the message as dead and passes it to the dead letters if they are set. The
+// caller must hold the lock.
+func (r *Router) record(m msg.Message, stage, reason string) {
+	r.log.Error("Message not relayed", append(m.LogContext(), "stage", stage, "reason", reason)...)
+	if r.deadLetters != nil {
+		r.deadLetters.Record(m, stage, reason)
+	}
+	if stage == StageSource {
+		r.add(journal.NewDecision(m, journal.StatusRejected, reason))
+		r.resolved(m, OutcomeRejected)
+	} else {
+		r.add(journal.NewDecision(m, journal.StatusSkipped, reason))
+	}
+	r.notify(notify.NewEvent(notify.EventParked, m.Destination, transferKey(m), "transfer %s not relayed at %s: %s", transferKey(m), stage, reason))
+}
+
+// Notify passes an event to the notifier if it is set.
+func (r *Router) Notify(e *notify.Event) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	r.notify(e)
+}
+
+// notify passes an event to the notifier if it is set. The caller must hold the lock.
+func (r *Router) notify(e *notify.Event) {
+	if r.notifier != nil {
+		r.notifier.Notify(e)
+	}
+}
+
+// SetNotifier sets the notifier alerted about parked messages.
+func (r *Router) SetNotifier(n Notifier) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.notifier = n
+}
+
+func transferKey(m msg.Message) string {
+	return fmt.Sprintf("%d-%d-%d", m.Source, m.Destination, m.DepositNonce)
+}
+
+// Processed is called by a writer once it handled a message, ok is false if it failed to.
+func (r *Router) Processed(m msg.Message, ok bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if ok {
+		r.resolved(m, OutcomeProcessed)
+	} else {
+		r.resolved(m, OutcomeFailed)
+	}
+}
+
+// resolved passes the outcome of a message to the observer if it is set. The caller must hold
+// the lock.
+func (r *Router) resolved(m msg.Message, outcome string) {
+	if r.observer != nil {
+		r.observer.Resolved(m, outcome)
+	}
+}
+
+// SetObserver sets the observer told about the outcome of every message.
+func (r *Router) SetObserver(o Observer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.observer = o
+}
+
+// Journal adds a record to the journal if it is set.
+func (r *Router) Journal(rec *journal.Record) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	r.add(rec)
+}
+
+// add adds a record to the journal if it is set. The caller must hold the lock.
+func (r *Router) add(rec *journal.Record) {
+	if r.journal == nil {
+		return
+	}
+	if err := r.journal.Add(rec); err != nil {
+		r.log.Error("Failed to add journal record", "key", rec.Key(), "kind", rec.Kind, "status", rec.Status, "err", err)
+	}
+}
+
+// SetJournal sets the journal the router and the writers record their actions in.
+func (r *Router) SetJournal(j Journal) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.journal = j
+}
+
+// Retry resends a dead message from the stage it was recorded at.
+func (r *Router) Retry(m msg.Message, stage string) error {
+	if stage != StageDestination {
+		return r.Send(m)
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	w := r.registry[m.Destination]
+	if w == nil {
+		return fmt.Errorf("unknown destination chainId: %d", m.Destination)
+	}
+	r.add(journal.NewDecision(m, journal.StatusQueued, "retry"))
+	tracing.Queued(m)
+	go w.ResolveMessage(m)
+	return nil
+}
+
+// SetDeadLetters sets where messages that could not be relayed are recorded.
+func (r *Router) SetDeadLetters(d DeadLetters) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.deadLetters = d
+}
+
+// SetConverter sets the converter applied to every message before the guards see it.
+func (r *Router) SetConverter(c Converter) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.converter = c
+}
+
+// AddGuard appends g to the guards consulted by Send. Guards are consulted in the order they
+// were added. The returned Forwarder delivers a message as if g had just admitted it.
+func (r *Router) AddGuard(g Guard) Forwarder {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.guards = append(r.guards, g)
+	next := len(r.guards)
+	return func(m msg.Message) error {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		return r.deliver(m, next)
+	}
+}
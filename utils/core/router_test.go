@@ -4,12 +4,14 @@
 package core
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/ChainSafe/log15"
 	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/notify"
 )
 
 type mockWriter struct {
@@ -64,3 +66,160 @@ func TestRouter(t *testing.T) {
 		t.Error("Unexpected message")
 	}
 }
+
+type holdGuard struct {
+	held []msg.Message
+}
+
+func (g *holdGuard) Admit(m msg.Message) bool {
+	if m.DepositNonce%2 == 0 {
+		return true
+	}
+	g.held = append(g.held, m)
+	return false
+}
+
+type mockNotifier struct {
+	events []*notify.Event
+}
+
+func (n *mockNotifier) Notify(e *notify.Event) {
+	n.events = append(n.events, e)
+}
+
+func TestRouterGuard(t *testing.T) {
+	router := NewRouter(log15.New("test_router"))
+	w := &mockWriter{msgs: *new([]msg.Message)}
+	router.Listen(msg.ChainId(1), w)
+	n := &mockNotifier{}
+	router.SetNotifier(n)
+
+	g := &holdGuard{}
+	resume := router.AddGuard(g)
+
+	for nonce := msg.Nonce(1); nonce <= 2; nonce++ {
+		err := router.Send(msg.Message{Source: msg.ChainId(0), Destination: msg.ChainId(1), DepositNonce: nonce})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(time.Second)
+
+	if len(w.msgs) != 1 || w.msgs[0].DepositNonce != 2 {
+		t.Fatalf("Unexpected messages delivered: %v", w.msgs)
+	}
+	if len(g.held) != 1 {
+		t.Fatalf("Expected 1 held message, got %d", len(g.held))
+	}
+	if len(n.events) != 1 || n.events[0].Type != notify.EventParked || n.events[0].Key != "0-1-1" {
+		t.Fatalf("Unexpected notifications: %v", n.events)
+	}
+
+	err := resume(g.held[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	if len(w.msgs) != 2 || w.msgs[1].DepositNonce != 1 {
+		t.Fatalf("Held message not delivered: %v", w.msgs)
+	}
+}
+
+// deferGuard defers every message it holds
+type deferGuard struct {
+	holdGuard
+}
+
+func (g *deferGuard) Deferred(m msg.Message) bool {
+	return true
+}
+
+func TestRouterDeferred(t *testing.T) {
+	router := NewRouter(log15.New("test_router"))
+	router.Listen(msg.ChainId(1), &mockWriter{msgs: *new([]msg.Message)})
+	n := &mockNotifier{}
+	router.SetNotifier(n)
+	g := &deferGuard{}
+	router.AddGuard(g)
+
+	err := router.Send(msg.Message{Source: msg.ChainId(0), Destination: msg.ChainId(1), DepositNonce: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.held) != 1 {
+		t.Fatalf("Expected 1 held message, got %d", len(g.held))
+	}
+	if len(n.events) != 0 {
+		t.Fatalf("Unexpected notifications: %v", n.events)
+	}
+}
+
+// accountGuard admits every message and counts those forwarded
+type accountGuard struct {
+	forwarded []msg.Nonce
+}
+
+func (g *accountGuard) Admit(m msg.Message) bool {
+	return true
+}
+
+func (g *accountGuard) Forwarded(m msg.Message) {
+	g.forwarded = append(g.forwarded, m.DepositNonce)
+}
+
+func TestRouterAccounter(t *testing.T) {
+	router := NewRouter(log15.New("test_router"))
+	router.Listen(msg.ChainId(1), &mockWriter{msgs: *new([]msg.Message)})
+	a := &accountGuard{}
+	router.AddGuard(a)
+	g := &holdGuard{}
+	resume := router.AddGuard(g)
+
+	for nonce := msg.Nonce(1); nonce <= 2; nonce++ {
+		err := router.Send(msg.Message{Source: msg.ChainId(0), Destination: msg.ChainId(1), DepositNonce: nonce})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the held message is only accounted for once it is forwarded
+	if !reflect.DeepEqual(a.forwarded, []msg.Nonce{2}) {
+		t.Fatalf("Unexpected forwarded messages: %v", a.forwarded)
+	}
+	err := resume(g.held[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a.forwarded, []msg.Nonce{2, 1}) {
+		t.Fatalf("Unexpected forwarded messages: %v", a.forwarded)
+	}
+}
+
+type oddRejecter struct{}
+
+func (oddRejecter) Convert(m msg.Message) (msg.Message, error) {
+	if m.DepositNonce%2 == 1 {
+		return m, fmt.Errorf("odd nonce %d", m.DepositNonce)
+	}
+	m.ResourceId = msg.ResourceIdFromSlice([]byte{1})
+	return m, nil
+}
+
+func TestRouterConverter(t *testing.T) {
+	router := NewRouter(log15.New("test_router"))
+	w := &mockWriter{msgs: *new([]msg.Message)}
+	router.Listen(msg.ChainId(1), w)
+	router.SetConverter(oddRejecter{})
+
+	for nonce := msg.Nonce(1); nonce <= 2; nonce++ {
+		err := router.Send(msg.Message{Source: msg.ChainId(0), Destination: msg.ChainId(1), DepositNonce: nonce})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(time.Second)
+
+	if len(w.msgs) != 1 || w.msgs[0].DepositNonce != 2 || w.msgs[0].ResourceId[0] != 1 {
+		t.Fatalf("Unexpected messages delivered: %v", w.msgs)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package deadletter keeps the transfers that could not be relayed.
+
+Listeners reject deposits they cannot route, the router rejects transfers whose amount cannot
+be converted and writers skip transfers they cannot vote on, for example because the
+recipient account does not exist. All of them end up in the Queue with the reason and the
+stage they were dropped at, instead of only being logged. An operator lists them with
+`chainbridge deadletter list`, and may retry or discard each one. A retried transfer is sent
+again from its stage by the running relayer, if it fails again it is recorded again.
+*/
+package deadletter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/msgstore"
+)
+
+const (
+	StatusDead      = "dead"      // not relayed, waiting for an operator
+	StatusRetry     = "retry"     // marked for retry by an operator, waiting for the relayer
+	StatusRetried   = "retried"   // sent again by the relayer
+	StatusDiscarded = "discarded" // dropped by an operator
+)
+
+// Frequency of picking up retries
+var PollInterval = 10 * time.Second
+
+var _ core.DeadLetters = &Queue{}
+
+// Queue records dead transfers on disk.
+type Queue struct {
+	store *msgstore.Store
+	lock  sync.Mutex
+	log   log15.Logger
+}
+
+func NewQueue(dir string, log log15.Logger) (*Queue, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Queue{store: store, log: log}, nil
+}
+
+// Record implements core.DeadLetters. A transfer recorded before keeps its creation time.
+func (q *Queue) Record(m msg.Message, stage, reason string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	e := msgstore.NewEntry(m, StatusDead, reason)
+	e.Stage = stage
+	if old, err := q.store.Get(e.Key()); err == nil {
+		e.CreatedAt = old.CreatedAt
+	}
+	if err := q.store.Put(e); err != nil {
+		q.log.Error("Failed to record dead transfer", append(e.LogContext(), "reason", reason, "err", err)...)
+	}
+}
+
+// Watch sends the transfers marked for retry through retry until stop is closed.
+func (q *Queue) Watch(retry func(m msg.Message, stage string) error, stop <-chan int) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			q.process(retry)
+		}
+	}
+}
+
+func (q *Queue) process(retry func(m msg.Message, stage string) error) {
+	entries, err := q.store.ListStatus(StatusRetry)
+	if err != nil {
+		q.log.Error("Failed to list dead transfers", "err", err)
+		return
+	}
+
+	for _, e := range entries {
+		m, err := e.Message()
+		if err != nil {
+			q.log.Error("Failed to decode dead transfer", append(e.LogContext(), "err", err)...)
+			continue
+		}
+		// mark it first, a transfer failing again is recorded as dead while it is retried
+		if _, err := q.transition(e.Key(), StatusRetry, StatusRetried); err != nil {
+			q.log.Error("Failed to update dead transfer", append(e.LogContext(), "err", err)...)
+			continue
+		}
+		q.log.Info("Retrying dead transfer", append(e.LogContext(), "stage", e.Stage, "note", e.Note)...)
+		if err := retry(m, e.Stage); err != nil {
+			q.log.Error("Failed to retry dead transfer", append(e.LogContext(), "err", err)...)
+			q.Record(m, e.Stage, err.Error())
+		}
+	}
+}
+
+func (q *Queue) transition(key, from, to string) (*msgstore.Entry, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.store.Transition(key, from, to, "")
+}
+
+// List returns the dead transfers kept in dir. If status is not empty only entries with that
+// status are returned.
+func List(dir, status string) ([]*msgstore.Entry, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return store.ListStatus(status)
+}
+
+// Get returns a single dead transfer kept in dir.
+func Get(dir, key string) (*msgstore.Entry, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(key)
+}
+
+// Retryable returns why e cannot be retried, or the empty string if it can. Transfers that were
+// recorded without their full content cannot be retried.
+func Retryable(e *msgstore.Entry) string {
+	if e.Amount == "" || e.Recipient == "" {
+		return "recorded without amount or recipient"
+	}
+	if _, err := e.Message(); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// Retry marks a dead transfer to be sent again by the running relayer.
+func Retry(dir, key, note string) (*msgstore.Entry, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	e, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if reason := Retryable(e); reason != "" {
+		return nil, fmt.Errorf("transfer %s cannot be retried: %s", key, reason)
+	}
+	return store.Transition(key, StatusDead, StatusRetry, note)
+}
+
+// Discard marks a dead transfer as dropped.
+func Discard(dir, key, note string) (*msgstore.Entry, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return store.Transition(key, StatusDead, StatusDiscarded, note)
+}
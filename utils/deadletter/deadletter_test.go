@@ -0,0 +1,92 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package deadletter
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := NewQueue(dir, log15.New("test", "deadletter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rId := msg.ResourceIdFromSlice([]byte{1})
+	skipped := msg.NewFungibleTransfer(1, 2, 1, big.NewInt(10), rId, []byte{1})
+	rejected := msg.NewFungibleTransfer(1, 2, 2, big.NewInt(20), rId, []byte{2})
+	incomplete := msg.Message{Source: 1, Destination: 2, Type: msg.FungibleTransfer, DepositNonce: 3, ResourceId: rId}
+	q.Record(skipped, core.StageDestination, "mint mismatch")
+	q.Record(rejected, core.StageSource, "precision loss")
+	q.Record(incomplete, core.StageSource, "handler unrecognized")
+
+	dead, err := List(dir, StatusDead)
+	assert.NoError(t, err)
+	assert.Len(t, dead, 3)
+	e, err := Get(dir, "1-2-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "mint mismatch", e.Reason)
+	assert.Equal(t, core.StageDestination, e.Stage)
+	assert.Empty(t, Retryable(e))
+	e, err = Get(dir, "1-2-3")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, Retryable(e))
+
+	_, err = Retry(dir, "1-2-3", "")
+	assert.Error(t, err)
+	_, err = Discard(dir, "1-2-3", "no amount")
+	assert.NoError(t, err)
+	_, err = Retry(dir, "1-2-1", "account created")
+	assert.NoError(t, err)
+	_, err = Retry(dir, "1-2-2", "")
+	assert.NoError(t, err)
+
+	type retried struct {
+		nonce msg.Nonce
+		stage string
+	}
+	calls := make([]retried, 0)
+	q.process(func(m msg.Message, stage string) error {
+		calls = append(calls, retried{m.DepositNonce, stage})
+		if m.DepositNonce == 2 {
+			return errors.New("still rejected")
+		}
+		return nil
+	})
+	assert.Equal(t, []retried{{1, core.StageDestination}, {2, core.StageSource}}, calls)
+
+	e, err = Get(dir, "1-2-1")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusRetried, e.Status)
+	e, err = Get(dir, "1-2-2")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusDead, e.Status)
+	assert.Equal(t, "still rejected", e.Reason)
+	e, err = Get(dir, "1-2-3")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusDiscarded, e.Status)
+
+	// nothing is retried twice
+	calls = calls[:0]
+	q.process(func(m msg.Message, stage string) error {
+		calls = append(calls, retried{m.DepositNonce, stage})
+		return nil
+	})
+	assert.Empty(t, calls)
+}
@@ -0,0 +1,289 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package journal keeps a durable record of what the relayer did.
+
+Every deposit observed by a listener, every decision taken on a transfer and every transaction
+submitted by a writer is added as a Record to a SQLite database. Records are keyed by the
+source, destination and deposit nonce of their transfer so the whole history of a transfer can
+be read back with `chainbridge journal`. The database is opened in WAL mode, so it can be
+queried while the relayer is writing to it.
+*/
+package journal
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+)
+
+const (
+	KindDeposit  = "deposit"  // a deposit observed on the source chain
+	KindDecision = "decision" // a decision on a transfer
+	KindTx       = "tx"       // a transaction submitted to the destination chain
+
+	StatusObserved  = "observed"  // deposit seen by a listener
+	StatusQueued    = "queued"    // handed to the destination writer
+	StatusHeld      = "held"      // held by a guard
+	StatusRejected  = "rejected"  // not routed
+	StatusSkipped   = "skipped"   // skipped by the writer
+	StatusNotVoted  = "not-voted" // no vote needed, e.g. already voted or expired
+	StatusExecuted  = "executed"  // proposal executed on the destination chain
+	StatusSubmitted = "submitted" // transaction sent
+	StatusSucceeded = "succeeded" // transaction included and successful
+	StatusFailed    = "failed"    // transaction could not be sent or failed on chain
+)
+
+// FileName is the name of the database file inside the journal directory
+const FileName = "journal.db"
+
+const schema = `
+CREATE TABLE IF NOT EXISTS records (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time INTEGER NOT NULL,
+	source INTEGER NOT NULL,
+	destination INTEGER NOT NULL,
+	nonce INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	status TEXT NOT NULL,
+	chain INTEGER NOT NULL,
+	block INTEGER NOT NULL,
+	tx_hash TEXT NOT NULL,
+	resource_id TEXT NOT NULL,
+	amount TEXT NOT NULL,
+	recipient TEXT NOT NULL,
+	detail TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS records_transfer ON records (source, destination, nonce);
+CREATE INDEX IF NOT EXISTS records_tx_hash ON records (tx_hash);
+CREATE INDEX IF NOT EXISTS records_time ON records (time);
+CREATE INDEX IF NOT EXISTS records_status ON records (status);
+`
+
+const columns = "id, time, source, destination, nonce, kind, status, chain, block, tx_hash, resource_id, amount, recipient, detail"
+
+// Record is a single action taken on a transfer.
+type Record struct {
+	Id           int64
+	Time         time.Time
+	Source       msg.ChainId
+	Destination  msg.ChainId
+	DepositNonce msg.Nonce
+	Kind         string
+	Status       string
+	Chain        msg.ChainId // chain the action took place on
+	Block        uint64
+	TxHash       string
+	ResourceId   string
+	Amount       string
+	Recipient    string
+	Detail       string
+}
+
+func newRecord(m msg.Message, kind, status, detail string) *Record {
+	r := &Record{
+		Time:         time.Now().UTC(),
+		Source:       m.Source,
+		Destination:  m.Destination,
+		DepositNonce: m.DepositNonce,
+		Kind:         kind,
+		Status:       status,
+		Chain:        m.Destination,
+		ResourceId:   m.ResourceId.Hex(),
+		Detail:       detail,
+	}
+	if len(m.Payload) > 1 {
+		if amt, ok := m.Payload[0].([]byte); ok {
+			r.Amount = new(big.Int).SetBytes(amt).String()
+		}
+		if rec, ok := m.Payload[1].([]byte); ok {
+			r.Recipient = hex.EncodeToString(rec)
+		}
+	}
+	return r
+}
+
+// NewDeposit records a deposit observed on the source chain of m.
+func NewDeposit(m msg.Message) *Record {
+	r := newRecord(m, KindDeposit, StatusObserved, "")
+	r.Chain = m.Source
+	r.Block = m.Block
+	r.TxHash = m.TxHash
+	return r
+}
+
+// NewDecision records a decision taken on m.
+func NewDecision(m msg.Message, status, detail string) *Record {
+	return newRecord(m, KindDecision, status, detail)
+}
+
+// NewTx records a transaction submitted to the destination chain of m.
+func NewTx(m msg.Message, txHash, status, detail string) *Record {
+	r := newRecord(m, KindTx, status, detail)
+	r.TxHash = txHash
+	return r
+}
+
+// Key identifies the transfer of the record.
+func (r *Record) Key() string {
+	return fmt.Sprintf("%d-%d-%d", r.Source, r.Destination, r.DepositNonce)
+}
+
+// Query selects records, zero fields do not restrict the result.
+type Query struct {
+	Source       *msg.ChainId
+	Destination  *msg.ChainId
+	DepositNonce *msg.Nonce
+	TxHash       string
+	Kind         string
+	Status       string
+	From         time.Time
+	To           time.Time
+	Limit        int
+}
+
+// Journal is the database of records.
+type Journal struct {
+	db *sql.DB
+}
+
+// Open opens or creates the journal database at path.
+func Open(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000", path))
+	if err != nil {
+		return nil, err
+	}
+	// a single connection serializes the writes of all chains
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("journal %s: %s", path, err)
+	}
+	return &Journal{db: db}, nil
+}
+
+// OpenReadOnly opens an existing journal database for queries.
+func OpenReadOnly(path string) (*Journal, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_busy_timeout=5000", path))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("journal %s: %s", path, err)
+	}
+	return &Journal{db: db}, nil
+}
+
+func (j *Journal) Close() error {
+	return j.db.Close()
+}
+
+// Add inserts a record and sets its Id.
+func (j *Journal) Add(r *Record) error {
+	res, err := j.db.Exec("INSERT INTO records (time, source, destination, nonce, kind, status, chain, block, tx_hash, resource_id, amount, recipient, detail) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		r.Time.UnixNano(), r.Source, r.Destination, uint64(r.DepositNonce), r.Kind, r.Status, r.Chain, r.Block, r.TxHash, r.ResourceId, r.Amount, r.Recipient, r.Detail)
+	if err != nil {
+		return err
+	}
+	r.Id, err = res.LastInsertId()
+	return err
+}
+
+// Query returns the records matching q ordered by time.
+func (j *Journal) Query(q Query) ([]*Record, error) {
+	where := make([]string, 0)
+	args := make([]interface{}, 0)
+	if q.Source != nil {
+		where, args = append(where, "source = ?"), append(args, *q.Source)
+	}
+	if q.Destination != nil {
+		where, args = append(where, "destination = ?"), append(args, *q.Destination)
+	}
+	if q.DepositNonce != nil {
+		where, args = append(where, "nonce = ?"), append(args, uint64(*q.DepositNonce))
+	}
+	if q.TxHash != "" {
+		where, args = append(where, "tx_hash = ?"), append(args, q.TxHash)
+	}
+	if q.Kind != "" {
+		where, args = append(where, "kind = ?"), append(args, q.Kind)
+	}
+	if q.Status != "" {
+		where, args = append(where, "status = ?"), append(args, q.Status)
+	}
+	if !q.From.IsZero() {
+		where, args = append(where, "time >= ?"), append(args, q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		where, args = append(where, "time < ?"), append(args, q.To.UnixNano())
+	}
+
+	stmt := "SELECT " + columns + " FROM records"
+	if len(where) > 0 {
+		stmt += " WHERE " + strings.Join(where, " AND ")
+	}
+	stmt += " ORDER BY time, id"
+	if q.Limit > 0 {
+		stmt += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	rows, err := j.db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]*Record, 0)
+	for rows.Next() {
+		var r Record
+		var t int64
+		var nonce uint64
+		err := rows.Scan(&r.Id, &t, &r.Source, &r.Destination, &nonce, &r.Kind, &r.Status, &r.Chain, &r.Block,
+			&r.TxHash, &r.ResourceId, &r.Amount, &r.Recipient, &r.Detail)
+		if err != nil {
+			return nil, err
+		}
+		r.Time = time.Unix(0, t).UTC()
+		r.DepositNonce = msg.Nonce(nonce)
+		records = append(records, &r)
+	}
+	return records, rows.Err()
+}
+
+// Pending returns the nonces of the transfers on a route that are neither executed nor voted
+// on, that is whose latest record is not a decision to vote or a transaction.
+func (j *Journal) Pending(source, destination msg.ChainId) ([]msg.Nonce, error) {
+	rows, err := j.db.Query(`SELECT r.nonce FROM records r
+		WHERE r.source = ? AND r.destination = ?
+		AND r.id = (SELECT MAX(id) FROM records WHERE source = r.source AND destination = r.destination AND nonce = r.nonce)
+		AND r.status IN (?, ?, ?, ?, ?, ?)
+		ORDER BY r.nonce`,
+		source, destination, StatusObserved, StatusQueued, StatusHeld, StatusRejected, StatusSkipped, StatusFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nonces := make([]msg.Nonce, 0)
+	for rows.Next() {
+		var nonce uint64
+		if err := rows.Scan(&nonce); err != nil {
+			return nil, err
+		}
+		nonces = append(nonces, msg.Nonce(nonce))
+	}
+	return nonces, rows.Err()
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package journal
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, FileName)
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	rId := msg.ResourceIdFromSlice([]byte{1})
+	first := msg.NewFungibleTransfer(1, 2, 7, big.NewInt(100), rId, []byte{0xab})
+	first.Block = 42
+	first.TxHash = "0xdeposit"
+	second := msg.NewFungibleTransfer(2, 1, 7, big.NewInt(5), rId, []byte{0xcd})
+
+	start := time.Now().UTC()
+	assert.NoError(t, j.Add(NewDeposit(first)))
+	assert.NoError(t, j.Add(NewDecision(first, StatusHeld, "*approval.Queue")))
+	assert.NoError(t, j.Add(NewTx(first, "0xvote", StatusSubmitted, "voteProposal")))
+	assert.NoError(t, j.Add(NewDeposit(second)))
+	assert.NoError(t, j.Add(NewTx(second, "0xack", StatusFailed, "extrinsic dropped")))
+
+	// the journal can be queried while it is open for writing
+	ro, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+
+	source, destination, nonce := msg.ChainId(1), msg.ChainId(2), msg.Nonce(7)
+	records, err := ro.Query(Query{Source: &source, Destination: &destination, DepositNonce: &nonce})
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, KindDeposit, records[0].Kind)
+	assert.Equal(t, source, records[0].Chain)
+	assert.Equal(t, uint64(42), records[0].Block)
+	assert.Equal(t, "0xdeposit", records[0].TxHash)
+	assert.Equal(t, "100", records[0].Amount)
+	assert.Equal(t, "ab", records[0].Recipient)
+	assert.Equal(t, StatusHeld, records[1].Status)
+	assert.Equal(t, destination, records[2].Chain)
+	assert.Equal(t, "1-2-7", records[2].Key())
+
+	records, err = ro.Query(Query{DepositNonce: &nonce})
+	assert.NoError(t, err)
+	assert.Len(t, records, 5)
+
+	records, err = ro.Query(Query{TxHash: "0xack"})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "extrinsic dropped", records[0].Detail)
+
+	records, err = ro.Query(Query{Status: StatusFailed})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	records, err = ro.Query(Query{From: start, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	records, err = ro.Query(Query{To: start})
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	// the first transfer was voted on, the second failed
+	pending, err := ro.Pending(1, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	pending, err = ro.Pending(2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []msg.Nonce{7}, pending)
+}
+
+func TestOpenReadOnlyMissing(t *testing.T) {
+	_, err := OpenReadOnly(filepath.Join(os.TempDir(), "missing", FileName))
+	assert.Error(t, err)
+}
@@ -0,0 +1,563 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package limits implements transfer rate limits with a circuit breaker.
+
+Rules bound the amount of a single transfer and the volume moved within a rolling window for
+a resourceId, optionally restricted to a source and destination chain. Volume is tracked per
+route, that is per (source, destination, resourceId). A transfer that breaches a rule trips
+the breaker of its route: the route is paused, the trip is recorded on disk and every transfer
+on that route is held until an operator resets it with `chainbridge breaker reset`. The held
+transfers are checked again when they are released, those still breaching a rule stay held
+until an operator releases them one by one.
+
+Only transfers handed to the destination writer count towards the volume of a window, a
+transfer held by a later guard does not. Spends are recorded by deposit nonce, so a deposit
+that is observed again is not counted twice.
+
+Amounts are compared in the units of the destination chain: the router converts a message with
+the token registry before any guard sees it.
+*/
+package limits
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/msgstore"
+)
+
+const (
+	StatusPaused    = "paused"    // held on a paused route
+	StatusBreaching = "breaching" // still breaching a rule after the route was reset
+	StatusReleased  = "released"  // released by an operator, waiting for the relayer
+	StatusDiscarded = "discarded" // dropped by an operator, removed by the relayer
+
+	trippedDir  = "tripped"
+	heldDir     = "held"
+	windowsFile = "windows.json"
+)
+
+// Frequency of checking for operator resets
+var PollInterval = 10 * time.Second
+
+var _ core.Guard = &Breaker{}
+var _ core.Accounter = &Breaker{}
+
+// Rule bounds transfers of a resourceId. A nil source or destination matches any chain and a
+// nil amount is not enforced.
+type Rule struct {
+	ResourceId   msg.ResourceId
+	Source       *msg.ChainId
+	Destination  *msg.ChainId
+	MaxAmount    *big.Int
+	WindowAmount *big.Int
+	Window       time.Duration
+}
+
+// ParseRule builds a rule from its config representation.
+func ParseRule(resourceId, source, destination, maxAmount, windowAmount, window string) (*Rule, error) {
+	rId, err := hex.DecodeString(strings.TrimPrefix(resourceId, "0x"))
+	if err != nil || len(rId) != 32 {
+		return nil, fmt.Errorf("limit resourceId %s invalid", resourceId)
+	}
+	r := &Rule{ResourceId: msg.ResourceIdFromSlice(rId)}
+
+	if r.Source, err = parseChainId(source); err != nil {
+		return nil, err
+	}
+	if r.Destination, err = parseChainId(destination); err != nil {
+		return nil, err
+	}
+	if r.MaxAmount, err = parseAmount(maxAmount); err != nil {
+		return nil, err
+	}
+	if r.WindowAmount, err = parseAmount(windowAmount); err != nil {
+		return nil, err
+	}
+	if r.WindowAmount != nil {
+		if window == "" {
+			return nil, fmt.Errorf("limit for %s has windowAmount but no window", resourceId)
+		}
+		if r.Window, err = time.ParseDuration(window); err != nil {
+			return nil, fmt.Errorf("limit window %s invalid: %s", window, err)
+		}
+		if r.Window <= 0 {
+			return nil, fmt.Errorf("limit window %s must be positive", window)
+		}
+	}
+	return r, nil
+}
+
+func (r *Rule) matches(m msg.Message) bool {
+	if r.ResourceId != m.ResourceId {
+		return false
+	}
+	if r.Source != nil && *r.Source != m.Source {
+		return false
+	}
+	if r.Destination != nil && *r.Destination != m.Destination {
+		return false
+	}
+	return true
+}
+
+// Trip records why a route was paused.
+type Trip struct {
+	Route     string    `json:"route"`
+	Reason    string    `json:"reason"`
+	Trigger   string    `json:"trigger"` // key of the transfer that tripped the breaker
+	TrippedAt time.Time `json:"trippedAt"`
+}
+
+type spend struct {
+	Time   time.Time `json:"time"`
+	Amount *big.Int  `json:"amount"`
+	Nonce  msg.Nonce `json:"nonce"`
+}
+
+// Breaker enforces the rules and pauses routes that breach them.
+type Breaker struct {
+	rules   []*Rule
+	dir     string
+	held    *msgstore.Store
+	tripped map[string]*Trip
+	spends  map[string][]spend
+	lock    sync.Mutex
+	log     log15.Logger
+}
+
+// NewBreaker loads the breaker state kept in dir.
+func NewBreaker(dir string, rules []*Rule, log log15.Logger) (*Breaker, error) {
+	if err := os.MkdirAll(filepath.Join(dir, trippedDir), os.ModePerm); err != nil {
+		return nil, err
+	}
+	held, err := msgstore.NewStore(filepath.Join(dir, heldDir))
+	if err != nil {
+		return nil, err
+	}
+
+	trips, err := LoadTrips(dir)
+	if err != nil {
+		return nil, err
+	}
+	tripped := make(map[string]*Trip)
+	for _, t := range trips {
+		log.Warn("Route is paused by the circuit breaker", "route", t.Route, "reason", t.Reason, "trippedAt", t.TrippedAt)
+		tripped[t.Route] = t
+	}
+
+	spends := make(map[string][]spend)
+	data, err := ioutil.ReadFile(filepath.Join(dir, windowsFile))
+	if err == nil {
+		if err := json.Unmarshal(data, &spends); err != nil {
+			return nil, fmt.Errorf("breaker windows file corrupted: %s", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &Breaker{
+		rules:   rules,
+		dir:     dir,
+		held:    held,
+		tripped: tripped,
+		spends:  spends,
+		log:     log,
+	}, nil
+}
+
+// Admit implements core.Guard. Transfers on a paused route, or breaching a rule, are held.
+func (b *Breaker) Admit(m msg.Message) bool {
+	if m.Type != msg.FungibleTransfer {
+		return true
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, ok := b.tripped[RouteOf(m)]; ok {
+		b.hold(m, "route paused")
+		return false
+	}
+	if reason := b.check(m); reason != "" {
+		b.trip(m, reason)
+		return false
+	}
+	return true
+}
+
+// check returns the rule m breaches, if any. The caller must hold the lock.
+func (b *Breaker) check(m msg.Message) string {
+	rules := b.matching(m)
+	if len(rules) == 0 {
+		return ""
+	}
+
+	now := time.Now().UTC()
+	spends := b.prune(RouteOf(m), now)
+	for _, s := range spends {
+		// a deposit observed again was admitted and counted before
+		if s.Nonce == m.DepositNonce {
+			return ""
+		}
+	}
+	amount := new(big.Int).SetBytes(m.Payload[0].([]byte))
+	for _, r := range rules {
+		if r.MaxAmount != nil && amount.Cmp(r.MaxAmount) > 0 {
+			return fmt.Sprintf("amount %s exceeds max single transfer %s", amount, r.MaxAmount)
+		}
+		if r.WindowAmount != nil {
+			volume := new(big.Int).Set(amount)
+			for _, s := range spends {
+				if now.Sub(s.Time) < r.Window {
+					volume.Add(volume, s.Amount)
+				}
+			}
+			if volume.Cmp(r.WindowAmount) > 0 {
+				return fmt.Sprintf("volume %s within %s exceeds cap %s", volume, r.Window, r.WindowAmount)
+			}
+		}
+	}
+	return ""
+}
+
+// Forwarded implements core.Accounter, it adds the amount of m to the volume of its route unless
+// it was counted before.
+func (b *Breaker) Forwarded(m msg.Message) {
+	if m.Type != msg.FungibleTransfer {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if len(b.matching(m)) == 0 {
+		return
+	}
+	route := RouteOf(m)
+	now := time.Now().UTC()
+	spends := b.prune(route, now)
+	for _, s := range spends {
+		if s.Nonce == m.DepositNonce {
+			return
+		}
+	}
+	amount := new(big.Int).SetBytes(m.Payload[0].([]byte))
+	b.spends[route] = append(spends, spend{Time: now, Amount: amount, Nonce: m.DepositNonce})
+	if err := b.storeWindows(); err != nil {
+		b.log.Error("Failed to write breaker windows", "err", err)
+	}
+}
+
+// Watch picks up operator resets and releases the held transfers of reset routes through
+// resume. It returns once stop is closed.
+func (b *Breaker) Watch(resume core.Forwarder, stop <-chan int) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			b.release(resume)
+		}
+	}
+}
+
+// release hands on the held transfers of the routes that are not paused. Transfers held when
+// the route was paused are checked against the rules again, those still breaching them wait
+// for an operator to release them.
+func (b *Breaker) release(resume core.Forwarder) {
+	released, err := b.resetRoutes()
+	if err != nil {
+		b.log.Error("Failed to check breaker resets", "err", err)
+		return
+	}
+
+	for _, e := range released {
+		switch e.Status {
+		case StatusBreaching:
+			continue
+		case StatusDiscarded:
+			b.log.Info("Dropping discarded transfer", e.LogContext()...)
+			if err := b.held.Delete(e.Key()); err != nil {
+				b.log.Error("Failed to remove held transfer", append(e.LogContext(), "err", err)...)
+			}
+			continue
+		}
+		m, err := e.Message()
+		if err != nil {
+			b.log.Error("Failed to decode held transfer", append(e.LogContext(), "err", err)...)
+			continue
+		}
+		if e.Status == StatusPaused {
+			b.lock.Lock()
+			reason := b.check(m)
+			b.lock.Unlock()
+			if reason != "" {
+				b.log.Warn("Held transfer still breaches a limit, it needs a release", append(m.LogContext(), "reason", reason)...)
+				if _, err := b.held.Transition(e.Key(), StatusPaused, StatusBreaching, reason); err != nil {
+					b.log.Error("Failed to update held transfer", append(e.LogContext(), "err", err)...)
+				}
+				continue
+			}
+		}
+		b.log.Info("Releasing held transfer", append(m.LogContext(), "status", e.Status)...)
+		if err := resume(m); err != nil {
+			b.log.Error("Failed to release held transfer", append(e.LogContext(), "err", err)...)
+			continue
+		}
+		if err := b.held.Delete(e.Key()); err != nil {
+			b.log.Error("Failed to remove held transfer", append(e.LogContext(), "err", err)...)
+		}
+	}
+}
+
+// resetRoutes forgets the trips an operator removed and returns the held transfers that may
+// continue.
+func (b *Breaker) resetRoutes() ([]*msgstore.Entry, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for route := range b.tripped {
+		_, err := os.Stat(b.tripPath(route))
+		if err == nil {
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		b.log.Info("Circuit breaker reset", "route", route)
+		delete(b.tripped, route)
+		delete(b.spends, route)
+		if err := b.storeWindows(); err != nil {
+			b.log.Error("Failed to write breaker windows", "err", err)
+		}
+	}
+
+	entries, err := b.held.List()
+	if err != nil {
+		return nil, err
+	}
+	released := make([]*msgstore.Entry, 0)
+	for _, e := range entries {
+		if _, ok := b.tripped[entryRoute(e)]; !ok {
+			released = append(released, e)
+		}
+	}
+	return released, nil
+}
+
+func (b *Breaker) matching(m msg.Message) []*Rule {
+	rules := make([]*Rule, 0)
+	for _, r := range b.rules {
+		if r.matches(m) {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// prune drops spends of route that no rule window covers anymore
+func (b *Breaker) prune(route string, now time.Time) []spend {
+	var longest time.Duration
+	for _, r := range b.rules {
+		if r.Window > longest {
+			longest = r.Window
+		}
+	}
+	kept := make([]spend, 0, len(b.spends[route]))
+	for _, s := range b.spends[route] {
+		if now.Sub(s.Time) < longest {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+func (b *Breaker) trip(m msg.Message, reason string) {
+	route := RouteOf(m)
+	t := &Trip{
+		Route:     route,
+		Reason:    reason,
+		Trigger:   msgstore.Key(m.Source, m.Destination, m.DepositNonce),
+		TrippedAt: time.Now().UTC(),
+	}
+	b.log.Error("Circuit breaker tripped, route paused", append(m.LogContext(), "route", route, "reason", reason)...)
+	b.tripped[route] = t
+
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err == nil {
+		err = msgstore.WriteFileAtomic(b.tripPath(route), data)
+	}
+	if err != nil {
+		b.log.Error("Failed to record breaker trip", "route", route, "err", err)
+	}
+	b.hold(m, reason)
+}
+
+func (b *Breaker) hold(m msg.Message, reason string) {
+	b.log.Warn("Holding transfer", append(m.LogContext(), "reason", reason)...)
+	err := b.held.Put(msgstore.NewEntry(m, StatusPaused, reason))
+	if err != nil {
+		b.log.Error("Failed to persist held transfer", append(m.LogContext(), "err", err)...)
+	}
+}
+
+func (b *Breaker) storeWindows() error {
+	data, err := json.Marshal(b.spends)
+	if err != nil {
+		return err
+	}
+	return msgstore.WriteFileAtomic(filepath.Join(b.dir, windowsFile), data)
+}
+
+func (b *Breaker) tripPath(route string) string {
+	return filepath.Join(b.dir, trippedDir, route+".json")
+}
+
+// RouteOf returns the route identifier of a message: <source>-<destination>-<resourceId>
+func RouteOf(m msg.Message) string {
+	return fmt.Sprintf("%d-%d-%s", m.Source, m.Destination, m.ResourceId.Hex())
+}
+
+func entryRoute(e *msgstore.Entry) string {
+	return fmt.Sprintf("%d-%d-%s", e.Source, e.Destination, e.ResourceId)
+}
+
+// LoadTrips returns the trips recorded in dir, oldest first.
+func LoadTrips(dir string) ([]*Trip, error) {
+	files, err := ioutil.ReadDir(filepath.Join(dir, trippedDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	trips := make([]*Trip, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, trippedDir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		t := new(Trip)
+		if err := json.Unmarshal(data, t); err != nil {
+			return nil, fmt.Errorf("trip record %s corrupted: %s", f.Name(), err)
+		}
+		trips = append(trips, t)
+	}
+	sort.Slice(trips, func(i, j int) bool {
+		return trips[i].TrippedAt.Before(trips[j].TrippedAt)
+	})
+	return trips, nil
+}
+
+// HeldDir returns the directory of the transfers held by the breaker kept in dir.
+func HeldDir(dir string) string {
+	return filepath.Join(dir, heldDir)
+}
+
+// HeldTransfers returns the transfers held by the breaker kept in dir.
+func HeldTransfers(dir string) ([]*msgstore.Entry, error) {
+	held, err := msgstore.NewStore(HeldDir(dir))
+	if err != nil {
+		return nil, err
+	}
+	return held.List()
+}
+
+// Reset removes the trip of route. A running relayer picks up the reset and releases the
+// held transfers of the route that no longer breach a limit, unless discard is set in which case
+// they are dropped.
+func Reset(dir, route string, discard bool) error {
+	path := filepath.Join(dir, trippedDir, route+".json")
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("route %s is not paused", route)
+		}
+		return err
+	}
+
+	if discard {
+		held, err := msgstore.NewStore(filepath.Join(dir, heldDir))
+		if err != nil {
+			return err
+		}
+		entries, err := held.List()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if entryRoute(e) != route {
+				continue
+			}
+			if err := held.Delete(e.Key()); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Remove(path)
+}
+
+// Release lets the running relayer hand on a transfer that still breached a limit when its route
+// was reset.
+func Release(dir, key, note string) (*msgstore.Entry, error) {
+	held, err := msgstore.NewStore(HeldDir(dir))
+	if err != nil {
+		return nil, err
+	}
+	return held.Transition(key, StatusBreaching, StatusReleased, note)
+}
+
+// Discard drops a transfer that still breached a limit when its route was reset. The running
+// relayer removes it.
+func Discard(dir, key, note string) (*msgstore.Entry, error) {
+	held, err := msgstore.NewStore(HeldDir(dir))
+	if err != nil {
+		return nil, err
+	}
+	return held.Transition(key, StatusBreaching, StatusDiscarded, note)
+}
+
+func parseChainId(s string) (*msg.ChainId, error) {
+	if s == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("limit chain id %s invalid: %s", s, err)
+	}
+	c := msg.ChainId(id)
+	return &c, nil
+}
+
+func parseAmount(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	amount, ok := new(big.Int).SetString(s, 10)
+	if !ok || amount.Sign() < 0 {
+		return nil, fmt.Errorf("limit amount %s invalid", s)
+	}
+	return amount, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package limits
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+const testResourceId = "000000000000000000000000000000a9e0095b8965c01e6a09c97938f3860901"
+
+func newTestBreaker(t *testing.T, dir string) *Breaker {
+	rule, err := ParseRule(testResourceId, "1", "", "100", "150", "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBreaker(dir, []*Rule{rule}, log15.New("test", "breaker"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func newTestMessage(t *testing.T, nonce msg.Nonce, amount int64) msg.Message {
+	rule, err := ParseRule(testResourceId, "", "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg.NewFungibleTransfer(1, 2, nonce, big.NewInt(amount), rule.ResourceId, []byte{1, 2, 3})
+}
+
+func TestParseRule(t *testing.T) {
+	_, err := ParseRule("0x"+testResourceId, "1", "2", "10", "", "")
+	assert.NoError(t, err)
+
+	_, err = ParseRule(testResourceId[2:], "", "", "10", "", "")
+	assert.Error(t, err)
+
+	_, err = ParseRule(testResourceId, "", "", "", "10", "")
+	assert.Error(t, err)
+
+	_, err = ParseRule(testResourceId, "256", "", "10", "", "")
+	assert.Error(t, err)
+}
+
+func TestBreakerTripsAndResets(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "breaker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := newTestBreaker(t, dir)
+	first := newTestMessage(t, 1, 100)
+	assert.True(t, b.Admit(first))
+	b.Forwarded(first)
+	// window volume 100 + 60 breaches the cap of 150
+	assert.False(t, b.Admit(newTestMessage(t, 2, 60)))
+	// the route is paused for any amount now
+	assert.False(t, b.Admit(newTestMessage(t, 3, 1)))
+
+	trips, err := LoadTrips(dir)
+	assert.NoError(t, err)
+	assert.Len(t, trips, 1)
+	assert.Equal(t, "1-2-"+testResourceId, trips[0].Route)
+	assert.Equal(t, "1-2-2", trips[0].Trigger)
+
+	held, err := HeldTransfers(dir)
+	assert.NoError(t, err)
+	assert.Len(t, held, 2)
+
+	// state survives a restart
+	b = newTestBreaker(t, dir)
+	assert.False(t, b.Admit(newTestMessage(t, 4, 1)))
+
+	assert.False(t, b.Admit(newTestMessage(t, 5, 101)))
+
+	// the released transfers are checked again, the one above the max needs a release
+	assert.NoError(t, Reset(dir, trips[0].Route, false))
+	released := make([]msg.Message, 0)
+	resume := func(m msg.Message) error {
+		released = append(released, m)
+		b.Forwarded(m)
+		return nil
+	}
+	b.release(resume)
+	assert.Len(t, released, 3)
+	assert.Equal(t, msg.Nonce(2), released[0].DepositNonce)
+	assert.Equal(t, big.NewInt(60).Bytes(), released[0].Payload[0])
+
+	held, err = HeldTransfers(dir)
+	assert.NoError(t, err)
+	assert.Len(t, held, 1)
+	assert.Equal(t, StatusBreaching, held[0].Status)
+	assert.Equal(t, "1-2-5", held[0].Key())
+
+	_, err = Release(dir, "1-2-2", "")
+	assert.Error(t, err)
+	_, err = Release(dir, "1-2-5", "large but expected")
+	assert.NoError(t, err)
+	b.release(resume)
+	assert.Len(t, released, 4)
+	held, err = HeldTransfers(dir)
+	assert.NoError(t, err)
+	assert.Len(t, held, 0)
+
+	// single transfers above the max always trip
+	assert.False(t, b.Admit(newTestMessage(t, 6, 101)))
+}
+
+func TestBreakerCountsForwardedOnce(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "breaker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := newTestBreaker(t, dir)
+	// admitted but held by a later guard, so not counted
+	assert.True(t, b.Admit(newTestMessage(t, 1, 100)))
+	assert.True(t, b.Admit(newTestMessage(t, 2, 100)))
+
+	forwarded := newTestMessage(t, 2, 100)
+	b.Forwarded(forwarded)
+	// a deposit observed again is admitted and not counted twice
+	assert.True(t, b.Admit(forwarded))
+	b.Forwarded(forwarded)
+	assert.True(t, b.Admit(newTestMessage(t, 3, 50)))
+	assert.False(t, b.Admit(newTestMessage(t, 4, 51)))
+
+	// and survives a restart
+	b = newTestBreaker(t, dir)
+	assert.Len(t, b.spends["1-2-"+testResourceId], 1)
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package logging builds the log handler of the relayer.
+
+Lines written to stdout are filtered by level: the level of the chain or component a logger
+belongs to, taken from its "chain" or "system" context, or the default level. Each log file
+receives all lines, or those up to a level of its own. Files are rotated by size, by time or
+both, and old files are removed by count and by age.
+*/
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatLogfmt   = "logfmt"
+	FormatTerminal = "terminal"
+)
+
+// Context keys naming the chain or component of a logger
+var componentKeys = []string{"chain", "system"}
+
+var stdout io.Writer = os.Stdout
+
+// Output is stdout or a log file.
+type Output struct {
+	Path       string // file path, empty for stdout
+	Format     string // FormatJSON, FormatLogfmt or FormatTerminal
+	Level      *log15.Lvl
+	MaxSize    int           // megabytes after which the file is rotated, 0 disables size rotation
+	Rotate     time.Duration // interval after which the file is rotated, 0 disables time rotation
+	MaxBackups int           // rotated files kept, 0 keeps all
+	MaxAge     int           // days rotated files are kept, 0 keeps them forever
+	Compress   bool          // gzip rotated files
+}
+
+// Config is the configuration of all outputs.
+type Config struct {
+	Level   log15.Lvl
+	Levels  map[string]log15.Lvl // levels by chain name or component
+	Stdout  *Output              // nil disables stdout
+	Outputs []*Output
+}
+
+// DefaultConfig writes logfmt to stdout, all lines to bridge_log.json and errors to
+// bridge_log_errors.json.
+func DefaultConfig(lvl log15.Lvl) *Config {
+	errLvl := log15.LvlError
+	return &Config{
+		Level:  lvl,
+		Stdout: &Output{Format: FormatLogfmt},
+		Outputs: []*Output{
+			{Path: "bridge_log.json", Format: FormatJSON},
+			{Path: "bridge_log_errors.json", Format: FormatJSON, Level: &errLvl},
+		},
+	}
+}
+
+// ParseLevel accepts a level name such as "info" or "dbug", or its number.
+func ParseLevel(s string) (log15.Lvl, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return log15.Lvl(n), nil
+	}
+	return log15.LvlFromString(s)
+}
+
+// Handler builds the handler writing to the outputs of c.
+func Handler(c *Config) (log15.Handler, error) {
+	handlers := make([]log15.Handler, 0, len(c.Outputs)+1)
+	if c.Stdout != nil {
+		h, err := handler(c.Stdout, stdout)
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, log15.FilterHandler(c.admit, h))
+	}
+	for _, o := range c.Outputs {
+		if o.Path == "" {
+			return nil, fmt.Errorf("log file path empty")
+		}
+		h, err := handler(o, fileWriter(o))
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, h)
+	}
+	return log15.MultiHandler(handlers...), nil
+}
+
+// admit filters the records written to stdout by the level of their chain or component.
+func (c *Config) admit(r *log15.Record) bool {
+	lvl := c.Level
+	for i := 0; i+1 < len(r.Ctx); i += 2 {
+		key, ok := r.Ctx[i].(string)
+		if !ok || !isComponentKey(key) {
+			continue
+		}
+		if l, ok := c.Levels[fmt.Sprint(r.Ctx[i+1])]; ok {
+			lvl = l
+			break
+		}
+	}
+	return r.Lvl <= lvl
+}
+
+func isComponentKey(key string) bool {
+	for _, k := range componentKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func handler(o *Output, w io.Writer) (log15.Handler, error) {
+	var format log15.Format
+	switch o.Format {
+	case FormatJSON:
+		format = log15.JsonFormat()
+	case FormatLogfmt, "":
+		format = log15.LogfmtFormat()
+	case FormatTerminal:
+		format = log15.TerminalFormat()
+	default:
+		return nil, fmt.Errorf("log format %s unknown", o.Format)
+	}
+
+	h := log15.StreamHandler(w, format)
+	if o.Level != nil {
+		h = log15.LvlFilterHandler(*o.Level, h)
+	}
+	return h, nil
+}
+
+// fileWriter opens a log file rotated as configured. A file without a size limit is only
+// rotated by time.
+func fileWriter(o *Output) io.Writer {
+	l := &lumberjack.Logger{
+		Filename:   o.Path,
+		MaxSize:    o.MaxSize,
+		MaxBackups: o.MaxBackups,
+		MaxAge:     o.MaxAge,
+		Compress:   o.Compress,
+		LocalTime:  true,
+	}
+	if o.MaxSize == 0 {
+		// lumberjack treats 0 as its 100 MB default
+		l.MaxSize = int(^uint(0) >> 1 / (1024 * 1024))
+	}
+	if o.Rotate > 0 {
+		go rotate(l, o.Rotate)
+	}
+	return l
+}
+
+// rotate rotates l at every multiple of interval for the lifetime of the process.
+func rotate(l *lumberjack.Logger, interval time.Duration) {
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(interval).Add(interval).Sub(now))
+		if err := l.Rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to rotate log file %s: %s\n", l.Filename, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stretchr/testify/assert"
+)
+
+func readLines(t *testing.T, path string) []map[string]interface{} {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make([]map[string]interface{}, 0)
+	for _, l := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if l == "" {
+			continue
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(l), &m); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestHandler(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	errLvl := log15.LvlError
+	c := &Config{
+		Level:  log15.LvlInfo,
+		Levels: map[string]log15.Lvl{"kovan": log15.LvlDebug, "router": log15.LvlError},
+		Stdout: &Output{Format: FormatLogfmt},
+		Outputs: []*Output{
+			{Path: filepath.Join(dir, "all.json"), Format: FormatJSON},
+			{Path: filepath.Join(dir, "errors.json"), Format: FormatJSON, Level: &errLvl},
+		},
+	}
+	h, err := Handler(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := log15.New()
+	root.SetHandler(h)
+	chain := root.New("chain", "kovan")
+	router := root.New("system", "router")
+
+	chain.Debug("chain debug")
+	root.Debug("root debug")
+	root.Info("root info")
+	router.Warn("router warn")
+	router.Error("router error", "src", 1, "dst", 2, "nonce", 3)
+
+	console := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(t, console, 3) {
+		assert.Contains(t, console[0], `msg="chain debug"`)
+		assert.Contains(t, console[1], `msg="root info"`)
+		assert.Contains(t, console[2], `msg="router error"`)
+	}
+	all := readLines(t, filepath.Join(dir, "all.json"))
+	if assert.Len(t, all, 5) {
+		assert.Equal(t, "chain debug", all[0]["msg"])
+		assert.Equal(t, "kovan", all[0]["chain"])
+		assert.Equal(t, "root debug", all[1]["msg"])
+		assert.Equal(t, "router warn", all[3]["msg"])
+		assert.Equal(t, "router error", all[4]["msg"])
+		assert.Equal(t, float64(3), all[4]["nonce"])
+	}
+	errors := readLines(t, filepath.Join(dir, "errors.json"))
+	if assert.Len(t, errors, 1) {
+		assert.Equal(t, "router error", errors[0]["msg"])
+	}
+}
+
+func TestHandlerInvalid(t *testing.T) {
+	_, err := Handler(&Config{Stdout: &Output{Format: "xml"}})
+	assert.Error(t, err)
+	_, err = Handler(&Config{Outputs: []*Output{{Format: FormatJSON}}})
+	assert.Error(t, err)
+}
+
+func TestParseLevel(t *testing.T) {
+	lvl, err := ParseLevel("dbug")
+	assert.NoError(t, err)
+	assert.Equal(t, log15.LvlDebug, lvl)
+	lvl, err = ParseLevel("2")
+	assert.NoError(t, err)
+	assert.Equal(t, log15.LvlWarn, lvl)
+	_, err = ParseLevel("loud")
+	assert.Error(t, err)
+}
@@ -32,6 +32,8 @@ type Message struct {
 	DepositNonce Nonce        // Nonce for the deposit
 	ResourceId   ResourceId
 	Payload      []interface{} // data associated with event sequence
+	Block        uint64        // block (slot on solana) the deposit was observed in, if known
+	TxHash       string        // hash (signature on solana) of the deposit transaction, if known
 }
 
 func NewFungibleTransfer(source, dest ChainId, nonce Nonce, amount *big.Int, resourceId ResourceId, recipient []byte) Message {
@@ -48,6 +50,11 @@ func NewFungibleTransfer(source, dest ChainId, nonce Nonce, amount *big.Int, res
 	}
 }
 
+// LogContext returns the key value pairs identifying the transfer of m in log lines.
+func (m Message) LogContext() []interface{} {
+	return []interface{}{"src", m.Source, "dst", m.Destination, "nonce", m.DepositNonce, "resourceId", m.ResourceId.Hex()}
+}
+
 func ResourceIdFromSlice(in []byte) ResourceId {
 	var res ResourceId
 	copy(res[:], in)
@@ -0,0 +1,324 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package msgstore keeps bridge messages that are waiting on something other than a writer,
+such as an operator decision. Every message is written to its own JSON file inside the
+store directory so that entries survive restarts and can be inspected and updated by the
+chainbridge CLI while the relayer is running. Changes hold a lock on a file of the directory, so
+the transitions of the relayer and of the CLI exclude each other.
+*/
+package msgstore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+)
+
+const (
+	fileExt  = ".json"
+	lockFile = ".lock"
+)
+
+var ErrNotFound = errors.New("entry not found")
+
+// Entry is a message together with the reason it was put aside.
+type Entry struct {
+	Source       msg.ChainId      `json:"source"`
+	Destination  msg.ChainId      `json:"destination"`
+	Type         msg.TransferType `json:"type"`
+	DepositNonce msg.Nonce        `json:"depositNonce"`
+	ResourceId   string           `json:"resourceId"`
+	Amount       string           `json:"amount"`
+	Recipient    string           `json:"recipient"`
+	Status       string           `json:"status"`
+	Reason       string           `json:"reason"`
+	Note         string           `json:"note,omitempty"`  // operator comment on a decision
+	Stage        string           `json:"stage,omitempty"` // point of the relay the message was put aside at
+	Block        uint64           `json:"block,omitempty"`
+	TxHash       string           `json:"txHash,omitempty"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	UpdatedAt    time.Time        `json:"updatedAt"`
+	ExpiresAt    time.Time        `json:"expiresAt"`
+}
+
+// NewEntry captures a fungible transfer message with the given status and reason.
+func NewEntry(m msg.Message, status, reason string) *Entry {
+	now := time.Now().UTC()
+	e := &Entry{
+		Source:       m.Source,
+		Destination:  m.Destination,
+		Type:         m.Type,
+		DepositNonce: m.DepositNonce,
+		ResourceId:   m.ResourceId.Hex(),
+		Status:       status,
+		Reason:       reason,
+		Block:        m.Block,
+		TxHash:       m.TxHash,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if len(m.Payload) > 1 {
+		if amt, ok := m.Payload[0].([]byte); ok {
+			e.Amount = new(big.Int).SetBytes(amt).String()
+		}
+		if rec, ok := m.Payload[1].([]byte); ok {
+			e.Recipient = hex.EncodeToString(rec)
+		}
+	}
+	return e
+}
+
+// Update changes the status of the entry and records the time of the change.
+func (e *Entry) Update(status, note string) {
+	e.Status = status
+	if note != "" {
+		e.Note = note
+	}
+	e.UpdatedAt = time.Now().UTC()
+}
+
+// LogContext returns the key value pairs identifying the transfer of the entry in log lines,
+// the same as msg.Message.LogContext.
+func (e *Entry) LogContext() []interface{} {
+	return []interface{}{"src", e.Source, "dst", e.Destination, "nonce", e.DepositNonce, "resourceId", e.ResourceId}
+}
+
+// Key identifies the entry within a store.
+func (e *Entry) Key() string {
+	return Key(e.Source, e.Destination, e.DepositNonce)
+}
+
+// Message rebuilds the original message from the entry.
+func (e *Entry) Message() (msg.Message, error) {
+	rId, err := hex.DecodeString(e.ResourceId)
+	if err != nil {
+		return msg.Message{}, fmt.Errorf("resourceId decode error: %s", err)
+	}
+	amount, ok := new(big.Int).SetString(e.Amount, 10)
+	if !ok {
+		return msg.Message{}, fmt.Errorf("amount decode error: %s", e.Amount)
+	}
+	recipient, err := hex.DecodeString(e.Recipient)
+	if err != nil {
+		return msg.Message{}, fmt.Errorf("recipient decode error: %s", err)
+	}
+	m := msg.NewFungibleTransfer(e.Source, e.Destination, e.DepositNonce, amount, msg.ResourceIdFromSlice(rId), recipient)
+	if e.Type != "" {
+		m.Type = e.Type
+	}
+	m.Block = e.Block
+	m.TxHash = e.TxHash
+	return m, nil
+}
+
+// Key builds the store key of a message from its route and nonce.
+func Key(src, dst msg.ChainId, nonce msg.Nonce) string {
+	return fmt.Sprintf("%d-%d-%d", src, dst, nonce)
+}
+
+// Store is a directory of entries keyed by Entry.Key. Entries are replaced atomically, so they
+// can be read without the lock.
+type Store struct {
+	dir  string
+	lock sync.Mutex
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// acquire takes the lock of the store, shared with other processes using the same directory,
+// and returns the function releasing it.
+func (s *Store) acquire() (func(), error) {
+	s.lock.Lock()
+	f, err := os.OpenFile(filepath.Join(s.dir, lockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+	if err := lockExclusive(f); err != nil {
+		f.Close()
+		s.lock.Unlock()
+		return nil, fmt.Errorf("lock store %s: %s", s.dir, err)
+	}
+	return func() {
+		unlock(f)
+		f.Close()
+		s.lock.Unlock()
+	}, nil
+}
+
+// Put writes the entry, replacing any previous entry with the same key.
+func (s *Store) Put(e *Entry) error {
+	release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(s.path(e.Key()), data)
+}
+
+// Get returns the entry stored under key, or ErrNotFound.
+func (s *Store) Get(key string) (*Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.read(s.path(key))
+}
+
+// Delete removes the entry stored under key. Removing a missing entry is not an error.
+func (s *Store) Delete(key string) error {
+	release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = os.Remove(s.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns all entries, oldest first.
+func (s *Store) List() ([]*Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fileExt) {
+			continue
+		}
+		e, err := s.read(filepath.Join(s.dir, f.Name()))
+		if err == ErrNotFound {
+			// removed by another process in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+// ListStatus returns the entries with the given status, oldest first. An empty status returns
+// all entries.
+func (s *Store) ListStatus(status string) ([]*Entry, error) {
+	entries, err := s.List()
+	if err != nil || status == "" {
+		return entries, err
+	}
+	filtered := make([]*Entry, 0, len(entries))
+	for _, e := range entries {
+		if e.Status == status {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered, nil
+}
+
+// Transition moves the entry stored under key from status from to status to. It fails if the
+// entry has another status, also if another process changed it in the meantime.
+func (s *Store) Transition(key, from, to, note string) (*Entry, error) {
+	release, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	e, err := s.read(s.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("transfer %s: %s", key, err)
+	}
+	if e.Status != from {
+		return nil, fmt.Errorf("transfer %s is %s, expected %s", key, e.Status, from)
+	}
+	e.Update(to, note)
+
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return e, WriteFileAtomic(s.path(key), data)
+}
+
+func (s *Store) path(key string) string {
+	return filepath.Join(s.dir, key+fileExt)
+}
+
+func (s *Store) read(path string) (*Entry, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	e := new(Entry)
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("entry %s is corrupted: %s", path, err)
+	}
+	return e, nil
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it into place,
+// so readers never observe a partially written file.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package msgstore
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransitionAcrossStores(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "msgstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the relayer and the CLI each open their own store on the directory
+	relayer, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for nonce := msg.Nonce(1); nonce <= 50; nonce++ {
+		m := msg.NewFungibleTransfer(1, 2, nonce, big.NewInt(1), msg.ResourceId{}, []byte{1})
+		assert.NoError(t, relayer.Put(NewEntry(m, "pending", "")))
+		key := Key(1, 2, nonce)
+
+		var wg sync.WaitGroup
+		results := make([]error, 2)
+		for i, s := range []*Store{relayer, cli} {
+			wg.Add(1)
+			go func(i int, s *Store, to string) {
+				defer wg.Done()
+				_, results[i] = s.Transition(key, "pending", to, "")
+			}(i, s, []string{"expired", "approved"}[i])
+		}
+		wg.Wait()
+
+		// exactly one of the transitions wins and its status is kept
+		e, err := cli.Get(key)
+		assert.NoError(t, err)
+		switch {
+		case results[0] == nil && results[1] != nil:
+			assert.Equal(t, "expired", e.Status)
+		case results[1] == nil && results[0] != nil:
+			assert.Equal(t, "approved", e.Status)
+		default:
+			t.Fatalf("transfer %s: both or no transitions applied: %v", key, results)
+		}
+	}
+}
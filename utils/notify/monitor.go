@@ -0,0 +1,90 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package notify
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+)
+
+// Frequency of the balance and lag checks
+var DefaultCheckInterval = time.Minute
+
+// BalanceChecker is a chain that reports the balance of the relayer account in its smallest unit.
+type BalanceChecker interface {
+	Balance() (*big.Int, error)
+}
+
+// LagChecker is a chain that reports how many blocks its listener is behind the chain head.
+type LagChecker interface {
+	Lag() (uint64, error)
+}
+
+type check func() (*Event, error)
+
+// Monitor periodically checks the health of chains and notifies about problems.
+type Monitor struct {
+	notifier *Notifier
+	interval time.Duration
+	checks   []check
+}
+
+func NewMonitor(n *Notifier, interval time.Duration) *Monitor {
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	return &Monitor{notifier: n, interval: interval}
+}
+
+// AddBalance notifies when the balance of a chain drops below min.
+func (m *Monitor) AddBalance(chain msg.ChainId, c BalanceChecker, min *big.Int) {
+	m.checks = append(m.checks, func() (*Event, error) {
+		balance, err := c.Balance()
+		if err != nil || balance.Cmp(min) >= 0 {
+			return nil, err
+		}
+		return NewEvent(EventLowBalance, chain, "balance", "relayer balance %s below %s", balance, min), nil
+	})
+}
+
+// AddLag notifies when the listener of a chain is more than max blocks behind.
+func (m *Monitor) AddLag(chain msg.ChainId, c LagChecker, max uint64) {
+	m.checks = append(m.checks, func() (*Event, error) {
+		lag, err := c.Lag()
+		if err != nil || lag <= max {
+			return nil, err
+		}
+		return NewEvent(EventLag, chain, "lag", "listener %d blocks behind, more than %d", lag, max), nil
+	})
+}
+
+// Watch runs the checks until stop is closed.
+func (m *Monitor) Watch(stop <-chan int) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+func (m *Monitor) check() {
+	for _, c := range m.checks {
+		e, err := c()
+		if err != nil {
+			m.notifier.log.Warn("Health check failed", "err", err)
+			continue
+		}
+		if e != nil {
+			m.notifier.Notify(e)
+		}
+	}
+}
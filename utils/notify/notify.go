@@ -0,0 +1,191 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package notify pages operators when the relayer needs attention.
+
+Events are raised on fatal errors, chain starts, parked transfers, low relayer balances and
+listeners falling behind, and are delivered to a Sink such as a JSON webhook. Delivery is
+asynchronous so a slow sink never blocks the relay. Every event type is throttled to one
+notification per interval, and an event with the same type, chain and key is only sent once within
+the deduplication window, so a flapping RPC endpoint does not flood the channel. The number
+of suppressed events is reported with the next notification of their type.
+*/
+package notify
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+)
+
+const (
+	EventFatal      = "fatal"       // the relayer is shutting down on an error
+	EventStarted    = "started"     // a chain was (re)started
+	EventParked     = "parked"      // a transfer was held, rejected or skipped
+	EventLowBalance = "low-balance" // the relayer account is running out of funds
+	EventLag        = "lag"         // a listener fell behind the chain head
+)
+
+var (
+	DefaultThrottle = time.Minute
+	DefaultDedup    = time.Hour
+	// Event types that are rare enough to never be throttled by default
+	unthrottled = []string{EventFatal, EventStarted}
+	// Time given to pending notifications when the notifier is closed
+	CloseTimeout = 10 * time.Second
+)
+
+const queueSize = 100
+
+// Event is a single notification.
+type Event struct {
+	Type       string      `json:"type"`
+	Chain      msg.ChainId `json:"chain"`
+	Key        string      `json:"key,omitempty"` // identifies repeated occurrences of the event on a chain
+	Message    string      `json:"message"`
+	Time       time.Time   `json:"time"`
+	Suppressed int         `json:"suppressed"` // events of this type suppressed since the last notification
+}
+
+func NewEvent(typ string, chain msg.ChainId, key, format string, args ...interface{}) *Event {
+	return &Event{
+		Type:    typ,
+		Chain:   chain,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+		Time:    time.Now().UTC(),
+	}
+}
+
+// Sink delivers notifications.
+type Sink interface {
+	Send(e *Event) error
+}
+
+// Notifier throttles, deduplicates and delivers events to a sink.
+type Notifier struct {
+	sink       Sink
+	throttle   map[string]time.Duration
+	dedup      time.Duration
+	last       map[string]time.Time // type to time of the last notification
+	sent       map[string]time.Time // type, chain and key to time of the last notification
+	suppressed map[string]int
+	queue      chan *Event
+	done       chan struct{}
+	closed     bool
+	lock       sync.Mutex
+	log        log15.Logger
+}
+
+// NewNotifier starts delivering events to sink until Close is called.
+func NewNotifier(sink Sink, log log15.Logger) *Notifier {
+	n := &Notifier{
+		sink:       sink,
+		throttle:   make(map[string]time.Duration),
+		dedup:      DefaultDedup,
+		last:       make(map[string]time.Time),
+		sent:       make(map[string]time.Time),
+		suppressed: make(map[string]int),
+		queue:      make(chan *Event, queueSize),
+		done:       make(chan struct{}),
+		log:        log,
+	}
+	for _, typ := range unthrottled {
+		n.throttle[typ] = 0
+	}
+	go n.run()
+	return n
+}
+
+// SetThrottle sets the minimum interval between two notifications of an event type.
+func (n *Notifier) SetThrottle(typ string, d time.Duration) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.throttle[typ] = d
+}
+
+// SetDedup sets how long an event with the same type, chain and key is suppressed.
+func (n *Notifier) SetDedup(d time.Duration) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.dedup = d
+}
+
+// Notify queues e for delivery unless it is throttled or a duplicate. It never blocks, events
+// are dropped when the queue is full.
+func (n *Notifier) Notify(e *Event) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.closed || !n.admit(e, time.Now()) {
+		return
+	}
+	select {
+	case n.queue <- e:
+	default:
+		n.log.Warn("Notification queue full, dropping event", "type", e.Type, "chain", e.Chain, "message", e.Message)
+	}
+}
+
+// admit decides whether e is sent. The caller must hold the lock.
+func (n *Notifier) admit(e *Event, now time.Time) bool {
+	key := fmt.Sprintf("%s/%d/%s", e.Type, e.Chain, e.Key)
+	if e.Key != "" {
+		if t, ok := n.sent[key]; ok && now.Sub(t) < n.dedup {
+			n.suppressed[e.Type]++
+			return false
+		}
+	}
+	throttle, ok := n.throttle[e.Type]
+	if !ok {
+		throttle = DefaultThrottle
+	}
+	if t, ok := n.last[e.Type]; ok && now.Sub(t) < throttle {
+		n.suppressed[e.Type]++
+		return false
+	}
+
+	e.Suppressed = n.suppressed[e.Type]
+	n.suppressed[e.Type] = 0
+	n.last[e.Type] = now
+	if e.Key != "" {
+		n.sent[key] = now
+	}
+	for k, t := range n.sent {
+		if now.Sub(t) >= n.dedup {
+			delete(n.sent, k)
+		}
+	}
+	return true
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+	for e := range n.queue {
+		if err := n.sink.Send(e); err != nil {
+			n.log.Error("Failed to send notification", "type", e.Type, "chain", e.Chain, "err", err)
+		}
+	}
+}
+
+// Close stops accepting events and waits up to CloseTimeout for the queued ones to be sent.
+func (n *Notifier) Close() {
+	n.lock.Lock()
+	if n.closed {
+		n.lock.Unlock()
+		return
+	}
+	n.closed = true
+	close(n.queue)
+	n.lock.Unlock()
+
+	select {
+	case <-n.done:
+	case <-time.After(CloseTimeout):
+		n.log.Warn("Notifications still pending at shutdown")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package notify
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSink struct {
+	events []*Event
+	lock   sync.Mutex
+}
+
+func (s *testSink) Send(e *Event) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func TestNotifierAdmit(t *testing.T) {
+	n := NewNotifier(&testSink{}, log15.Root())
+	defer n.Close()
+	n.SetThrottle(EventLag, time.Minute)
+	n.SetDedup(time.Hour)
+
+	now := time.Now()
+	assert.True(t, n.admit(NewEvent(EventLag, 1, "lag", "behind"), now))
+	// throttled by type, also on another chain
+	assert.False(t, n.admit(NewEvent(EventLag, 2, "lag", "behind"), now.Add(time.Second)))
+	// a duplicate is suppressed after the throttle passed
+	assert.False(t, n.admit(NewEvent(EventLag, 1, "lag", "behind"), now.Add(2*time.Minute)))
+
+	e := NewEvent(EventLag, 2, "lag", "behind")
+	assert.True(t, n.admit(e, now.Add(2*time.Minute)))
+	assert.Equal(t, 2, e.Suppressed)
+
+	// the duplicate is sent again once the window passed
+	e = NewEvent(EventLag, 1, "lag", "behind")
+	assert.True(t, n.admit(e, now.Add(2*time.Hour)))
+	assert.Equal(t, 0, e.Suppressed)
+
+	// starts are not throttled
+	assert.True(t, n.admit(NewEvent(EventStarted, 1, "", "started"), now))
+	assert.True(t, n.admit(NewEvent(EventStarted, 2, "", "started"), now))
+}
+
+func TestNotifierClose(t *testing.T) {
+	sink := &testSink{}
+	n := NewNotifier(sink, log15.Root())
+	n.Notify(NewEvent(EventFatal, 1, "", "polling failed"))
+	n.Notify(NewEvent(EventParked, 1, "1-2-3", "held"))
+	n.Close()
+	// events after close are dropped
+	n.Notify(NewEvent(EventParked, 1, "1-2-4", "held"))
+
+	assert.Len(t, sink.events, 2)
+	assert.Equal(t, EventFatal, sink.events[0].Type)
+}
+
+type testBalance struct{ balance *big.Int }
+
+func (b *testBalance) Balance() (*big.Int, error) { return b.balance, nil }
+
+func TestMonitor(t *testing.T) {
+	sink := &testSink{}
+	n := NewNotifier(sink, log15.Root())
+	m := NewMonitor(n, time.Second)
+	balance := &testBalance{balance: big.NewInt(100)}
+	m.AddBalance(1, balance, big.NewInt(50))
+
+	m.check()
+	balance.balance = big.NewInt(10)
+	m.check()
+	m.check()
+	n.Close()
+
+	if assert.Len(t, sink.events, 1) {
+		assert.Equal(t, EventLowBalance, sink.events[0].Type)
+		assert.Equal(t, "relayer balance 10 below 50", sink.events[0].Message)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var got map[string]interface{}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(server.URL, "", 0)
+	assert.NoError(t, err)
+	e := NewEvent(EventParked, 2, "1-2-3", "transfer %s held", "1-2-3")
+	e.Suppressed = 4
+	assert.NoError(t, sink.Send(e))
+	assert.Equal(t, "[chainbridge] parked on chain 2: transfer 1-2-3 held (4 similar suppressed)", got["text"])
+	assert.Equal(t, "parked", got["type"])
+	assert.Equal(t, "1-2-3", got["key"])
+
+	sink, err = NewWebhookSink(server.URL, "{{.Message}}", 0)
+	assert.NoError(t, err)
+	status = http.StatusBadGateway
+	assert.Error(t, sink.Send(e))
+	assert.Equal(t, "transfer 1-2-3 held", got["text"])
+
+	_, err = NewWebhookSink(server.URL, "{{.Message", 0)
+	assert.Error(t, err)
+}
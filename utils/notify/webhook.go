@@ -0,0 +1,79 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate renders the text of a notification.
+const DefaultTemplate = `[chainbridge] {{.Type}} on chain {{.Chain}}: {{.Message}}{{if .Suppressed}} ({{.Suppressed}} similar suppressed){{end}}`
+
+const DefaultWebhookTimeout = 10 * time.Second
+
+var _ Sink = &WebhookSink{}
+
+// WebhookPayload is posted as JSON to the webhook. Text is rendered from the template, which
+// makes the payload accepted by chat services expecting a text field.
+type WebhookPayload struct {
+	*Event
+	Text string `json:"text"`
+}
+
+// WebhookSink posts events to a URL. Any response other than 2xx is treated as an error.
+type WebhookSink struct {
+	url      string
+	template *template.Template
+	client   *http.Client
+}
+
+// NewWebhookSink parses tmpl, a text/template executed on the Event, DefaultTemplate is used
+// if it is empty.
+func NewWebhookSink(url, tmpl string, timeout time.Duration) (*WebhookSink, error) {
+	if tmpl == "" {
+		tmpl = DefaultTemplate
+	}
+	t, err := template.New("notification").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("notification template invalid: %s", err)
+	}
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	return &WebhookSink{
+		url:      url,
+		template: t,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Send implements Sink.
+func (w *WebhookSink) Send(e *Event) error {
+	var text strings.Builder
+	if err := w.template.Execute(&text, e); err != nil {
+		return err
+	}
+	body, err := json.Marshal(WebhookPayload{Event: e, Text: text.String()})
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
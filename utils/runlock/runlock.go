@@ -0,0 +1,59 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package runlock keeps two relayer processes from working on the same state directory. A
+process holds the lock on a file of the directory for as long as it runs; the lock is released
+by the operating system when the process exits, also when it crashes.
+*/
+package runlock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const FileName = "relayer.lock"
+
+var ErrLocked = errors.New("state directory in use")
+
+// Lock is the held lock of a state directory.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire takes the lock of dir without waiting. If another process holds it, the returned
+// error wraps ErrLocked and names the pid of that process.
+func Acquire(dir string) (*Lock, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, FileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLock(f); err != nil {
+		f.Close()
+		if pid, rerr := os.ReadFile(path); rerr == nil && len(pid) != 0 {
+			return nil, fmt.Errorf("%w: %s held by pid %s", ErrLocked, path, strings.TrimSpace(string(pid)))
+		}
+		return nil, fmt.Errorf("%w: %s", ErrLocked, path)
+	}
+	// the pid is only informative, a failure to write it does not matter
+	if f.Truncate(0) == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release releases the lock.
+func (l *Lock) Release() error {
+	unlock(l.f)
+	return l.f.Close()
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package runlock
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquire(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Acquire(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// flock locks are per open file, so a second open in the same process is refused too
+	_, err = Acquire(dir)
+	assert.True(t, errors.Is(err, ErrLocked), err)
+
+	assert.NoError(t, l.Release())
+	l, err = Acquire(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release())
+}
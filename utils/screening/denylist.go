@@ -0,0 +1,135 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package screening
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/decred/base58"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"golang.org/x/crypto/blake2b"
+)
+
+var _ Screener = &Denylist{}
+var _ Reloader = &Denylist{}
+
+// Denylist rejects transfers to the addresses listed in a local file. The file holds one
+// address per line, empty lines and lines starting with # are ignored. Addresses may be given
+// as hex (ethereum, raw account ids), bech32 (cosmos chains), ss58 (substrate) or base58
+// (solana) and are compared on their raw bytes.
+type Denylist struct {
+	path    string
+	modTime time.Time
+	denied  map[string]string // raw address hex -> address as listed
+	lock    sync.RWMutex
+}
+
+func NewDenylist(path string) (*Denylist, error) {
+	d := &Denylist{path: path}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Screen implements Screener.
+func (d *Denylist) Screen(m msg.Message) (bool, string, error) {
+	if len(m.Payload) < 2 {
+		return true, "", nil
+	}
+	recipient, ok := m.Payload[1].([]byte)
+	if !ok {
+		return false, "", fmt.Errorf("recipient type %T unexpected", m.Payload[1])
+	}
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if listed, ok := d.denied[hex.EncodeToString(recipient)]; ok {
+		return false, fmt.Sprintf("recipient %s is on denylist %s", listed, d.path), nil
+	}
+	return true, "", nil
+}
+
+// Reload reads the file again if it changed since it was last loaded.
+func (d *Denylist) Reload() error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+	d.lock.RLock()
+	unchanged := info.ModTime().Equal(d.modTime) && d.denied != nil
+	d.lock.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return err
+	}
+	denied := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		raw, err := decodeAddress(entry)
+		if err != nil {
+			return fmt.Errorf("denylist %s line %d: %s", d.path, line, err)
+		}
+		denied[hex.EncodeToString(raw)] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.denied = denied
+	d.modTime = info.ModTime()
+	return nil
+}
+
+// decodeAddress returns the raw bytes of an address in one of the supported formats.
+func decodeAddress(addr string) ([]byte, error) {
+	if strings.HasPrefix(addr, "0x") || strings.HasPrefix(addr, "0X") {
+		return hex.DecodeString(addr[2:])
+	}
+	if raw, err := hex.DecodeString(addr); err == nil && (len(raw) == 20 || len(raw) == 32) {
+		return raw, nil
+	}
+	if _, raw, err := bech32.DecodeAndConvert(addr); err == nil {
+		return raw, nil
+	}
+
+	raw := base58.Decode(addr)
+	var prefix int
+	switch len(raw) {
+	case 32: // solana public key
+		return raw, nil
+	case 35: // ss58 with a one byte prefix and a two byte checksum
+		prefix = 1
+	case 36: // ss58 with a two byte prefix
+		prefix = 2
+	default:
+		return nil, fmt.Errorf("address %s format not recognized", addr)
+	}
+	checksum := blake2b.Sum512(append([]byte("SS58PRE"), raw[:prefix+32]...))
+	if !bytes.Equal(checksum[:2], raw[prefix+32:]) {
+		return nil, fmt.Errorf("address %s ss58 checksum mismatch", addr)
+	}
+	return raw[prefix : prefix+32], nil
+}
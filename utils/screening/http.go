@@ -0,0 +1,108 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package screening
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+)
+
+const DefaultHTTPTimeout = 5 * time.Second
+
+var _ Screener = &HTTPScreener{}
+
+// ScreenRequest is posted as JSON to the screening service.
+type ScreenRequest struct {
+	Source       msg.ChainId `json:"source"`
+	Destination  msg.ChainId `json:"destination"`
+	DepositNonce msg.Nonce   `json:"depositNonce"`
+	ResourceId   string      `json:"resourceId"`
+	Amount       string      `json:"amount"`
+	Recipient    string      `json:"recipient"` // hex encoded raw recipient
+}
+
+// ScreenResponse is the verdict returned by the screening service.
+type ScreenResponse struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+// HTTPScreener asks an external service whether a transfer may be relayed. Any response other
+// than 200 with a valid ScreenResponse is treated as an error.
+type HTTPScreener struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPScreener(url string, timeout time.Duration) *HTTPScreener {
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	return &HTTPScreener{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Screen implements Screener.
+func (h *HTTPScreener) Screen(m msg.Message) (bool, string, error) {
+	if len(m.Payload) < 2 {
+		return true, "", nil
+	}
+	amount, ok := m.Payload[0].([]byte)
+	if !ok {
+		return false, "", fmt.Errorf("amount type %T unexpected", m.Payload[0])
+	}
+	recipient, ok := m.Payload[1].([]byte)
+	if !ok {
+		return false, "", fmt.Errorf("recipient type %T unexpected", m.Payload[1])
+	}
+
+	body, err := json.Marshal(ScreenRequest{
+		Source:       m.Source,
+		Destination:  m.Destination,
+		DepositNonce: m.DepositNonce,
+		ResourceId:   m.ResourceId.Hex(),
+		Amount:       new(big.Int).SetBytes(amount).String(),
+		Recipient:    hex.EncodeToString(recipient),
+	})
+	if err != nil {
+		return false, "", err
+	}
+
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, "", fmt.Errorf("screening service returned %s: %s", resp.Status, data)
+	}
+
+	var verdict ScreenResponse
+	if err := json.Unmarshal(data, &verdict); err != nil {
+		return false, "", fmt.Errorf("screening service response invalid: %s", err)
+	}
+	if !verdict.Allowed {
+		reason := verdict.Reason
+		if reason == "" {
+			reason = "denied by screening service"
+		}
+		return false, reason, nil
+	}
+	return true, "", nil
+}
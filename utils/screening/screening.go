@@ -0,0 +1,289 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package screening checks the recipient of every transfer before any writer votes on it.
+
+A Screener decides whether a transfer may be relayed. Two implementations are provided: a
+Denylist backed by a local file that is reloaded when it changes, and an HTTPScreener that asks
+an external screening service. The Guard sits in the router, so every destination writer is
+covered. As screeners may call out over the network, the router only parks new transfers as
+unscreened and the screeners are consulted by Watch, which hands on the allowed transfers.
+Transfers that are denied are parked with the reason on disk, an operator may release a false
+positive with `chainbridge screening release`. Transfers that could not be screened because a
+screener failed are retried until they get a verdict.
+*/
+package screening
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/msgstore"
+	"github.com/stafiprotocol/chainbridge/utils/notify"
+)
+
+const (
+	StatusParked     = "parked"     // denied by a screener
+	StatusUnscreened = "unscreened" // waiting for screening, or a screener failed and it is retried
+	StatusReleased   = "released"   // released by an operator, waiting for the relayer
+	StatusRelayed    = "relayed"    // handed on to the writer
+	StatusDiscarded  = "discarded"  // dropped by an operator
+)
+
+// Frequency of reloading screeners, retrying failed screenings and picking up releases
+var PollInterval = 10 * time.Second
+
+// Screener decides whether a transfer may be relayed to its recipient. The recipient is
+// Payload[1] of a fungible transfer message.
+type Screener interface {
+	// Screen returns false and a reason if the transfer must not be relayed. An error means no
+	// verdict could be reached.
+	Screen(m msg.Message) (bool, string, error)
+}
+
+// Reloader is implemented by screeners whose data can change while the relayer is running.
+type Reloader interface {
+	Reload() error
+}
+
+var _ core.Guard = &Guard{}
+var _ core.Deferrer = &Guard{}
+
+// Guard parks the transfers rejected by any of its screeners.
+type Guard struct {
+	screeners []Screener
+	store     *msgstore.Store
+	lock      sync.Mutex
+	wake      chan struct{} // signals Watch that a transfer waits for screening
+	inline    bool          // screen in Admit
+	notifier  core.Notifier // alerted about transfers parked by Watch, may be nil
+	log       log15.Logger
+}
+
+func NewGuard(dir string, screeners []Screener, log log15.Logger) (*Guard, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Guard{
+		screeners: screeners,
+		store:     store,
+		wake:      make(chan struct{}, 1),
+		log:       log,
+	}, nil
+}
+
+// SetInline has Admit screen new transfers itself instead of leaving them to Watch. This holds up
+// the router while the screeners run and is meant for one-off runs such as a backfill.
+func (g *Guard) SetInline(inline bool) {
+	g.inline = inline
+}
+
+// SetNotifier sets the notifier alerted about the transfers Watch parks.
+func (g *Guard) SetNotifier(n core.Notifier) {
+	g.notifier = n
+}
+
+// Admit implements core.Guard. It runs under the lock of the router, so unless the guard is
+// inline a new transfer is only parked as unscreened and screened by Watch.
+func (g *Guard) Admit(m msg.Message) bool {
+	if m.Type != msg.FungibleTransfer {
+		return true
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	key := msgstore.Key(m.Source, m.Destination, m.DepositNonce)
+	e, err := g.store.Get(key)
+	switch {
+	case err == msgstore.ErrNotFound:
+	case err != nil:
+		g.log.Error("Failed to look up screening record", append(m.LogContext(), "err", err)...)
+		return false
+	case e.Status == StatusReleased || e.Status == StatusRelayed:
+		return true
+	default:
+		g.log.Info("Transfer is parked by screening", append(m.LogContext(), "status", e.Status, "reason", e.Reason)...)
+		return false
+	}
+
+	if g.inline {
+		ok, reason, err := g.screen(m)
+		if err != nil {
+			g.park(m, StatusUnscreened, err.Error())
+			return false
+		}
+		if !ok {
+			g.park(m, StatusParked, reason)
+			return false
+		}
+		return true
+	}
+
+	g.log.Debug("Transfer waits for screening", m.LogContext()...)
+	g.park(m, StatusUnscreened, "")
+	select {
+	case g.wake <- struct{}{}:
+	default:
+	}
+	return false
+}
+
+// Deferred implements core.Deferrer, m is deferred if it waits to be screened by Watch.
+func (g *Guard) Deferred(m msg.Message) bool {
+	if g.inline {
+		return false
+	}
+	e, err := g.store.Get(msgstore.Key(m.Source, m.Destination, m.DepositNonce))
+	return err == nil && e.Status == StatusUnscreened
+}
+
+func (g *Guard) park(m msg.Message, status, reason string) {
+	if reason != "" {
+		g.log.Warn("Transfer parked by screening", append(m.LogContext(), "status", status, "reason", reason)...)
+	}
+	if err := g.store.Put(msgstore.NewEntry(m, status, reason)); err != nil {
+		g.log.Error("Failed to park transfer", append(m.LogContext(), "err", err)...)
+	}
+}
+
+func (g *Guard) screen(m msg.Message) (bool, string, error) {
+	for _, s := range g.screeners {
+		ok, reason, err := s.Screen(m)
+		if err != nil {
+			return false, "", fmt.Errorf("screening failed: %s", err)
+		}
+		if !ok {
+			return false, reason, nil
+		}
+	}
+	return true, "", nil
+}
+
+// Watch screens the transfers parked by Admit, retries failed screenings, reloads the screeners
+// and hands on allowed and released transfers through resume until stop is closed.
+func (g *Guard) Watch(resume core.Forwarder, stop <-chan int) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-g.wake:
+			g.process(resume)
+		case <-ticker.C:
+			g.reload()
+			g.process(resume)
+		}
+	}
+}
+
+func (g *Guard) reload() {
+	for _, s := range g.screeners {
+		if r, ok := s.(Reloader); ok {
+			if err := r.Reload(); err != nil {
+				g.log.Error("Failed to reload screener", "err", err)
+			}
+		}
+	}
+}
+
+func (g *Guard) process(resume core.Forwarder) {
+	entries, err := g.store.List()
+	if err != nil {
+		g.log.Error("Failed to list parked transfers", "err", err)
+		return
+	}
+
+	for _, e := range entries {
+		if e.Status != StatusReleased && e.Status != StatusUnscreened {
+			continue
+		}
+		m, err := e.Message()
+		if err != nil {
+			g.log.Error("Failed to decode parked transfer", append(e.LogContext(), "err", err)...)
+			continue
+		}
+
+		if e.Status == StatusUnscreened {
+			ok, reason, err := g.screen(m)
+			if err != nil {
+				if e.Reason == "" {
+					g.log.Warn("Screening failed, retrying", append(e.LogContext(), "err", err)...)
+					g.update(e, StatusUnscreened, err.Error())
+					g.notify(m, e.Key(), err.Error())
+				} else {
+					g.log.Debug("Screening still failing", append(e.LogContext(), "err", err)...)
+				}
+				continue
+			}
+			if !ok {
+				g.update(e, StatusParked, reason)
+				g.log.Warn("Transfer parked by screening", append(e.LogContext(), "reason", reason)...)
+				g.notify(m, e.Key(), reason)
+				continue
+			}
+		}
+
+		g.log.Info("Relaying screened transfer", append(e.LogContext(), "status", e.Status)...)
+		if err := resume(m); err != nil {
+			g.log.Error("Failed to relay screened transfer", append(e.LogContext(), "err", err)...)
+			continue
+		}
+		g.update(e, StatusRelayed, "")
+	}
+}
+
+func (g *Guard) notify(m msg.Message, key, reason string) {
+	if g.notifier != nil {
+		g.notifier.Notify(notify.NewEvent(notify.EventParked, m.Destination, key, "transfer %s parked by screening: %s", key, reason))
+	}
+}
+
+func (g *Guard) update(e *msgstore.Entry, status, reason string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if reason != "" {
+		e.Reason = reason
+	}
+	e.Update(status, "")
+	if err := g.store.Put(e); err != nil {
+		g.log.Error("Failed to update parked transfer", append(e.LogContext(), "err", err)...)
+	}
+}
+
+// List returns the parked transfers kept in dir. If status is not empty only entries with that
+// status are returned.
+func List(dir, status string) ([]*msgstore.Entry, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return store.ListStatus(status)
+}
+
+// Release lets the running relayer hand on a parked transfer regardless of the screeners.
+func Release(dir, key, note string) (*msgstore.Entry, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return store.Transition(key, StatusParked, StatusReleased, note)
+}
+
+// Discard marks a parked transfer as dropped.
+func Discard(dir, key, note string) (*msgstore.Entry, error) {
+	store, err := msgstore.NewStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return store.Transition(key, StatusParked, StatusDiscarded, note)
+}
@@ -0,0 +1,229 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package screening
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/log15"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+var testResourceId = msg.ResourceIdFromSlice(common.FromHex("000000000000000000000000000000a9e0095b8965c01e6a09c97938f3860901"))
+
+const (
+	deniedHex  = "0xff93b45308fd417df303d6515ab04d9e89a750ca"
+	deniedSS58 = "5GrwvaEF5zXb26Fz9rcQpDWS57CtERHpNehXCPcNoHGKutQY"
+)
+
+// Alice's public key, the account behind deniedSS58
+var aliceKey = common.FromHex("0xd43593c715fdd31c61141abd04a99fd6822c8558854ccde39a5684e7a56da27d")
+
+type stubScreener struct {
+	allow bool
+	err   error
+}
+
+func (s *stubScreener) Screen(m msg.Message) (bool, string, error) {
+	if s.err != nil {
+		return false, "", s.err
+	}
+	return s.allow, "stub", nil
+}
+
+func writeDenylist(t *testing.T, path string, lines string) {
+	if err := ioutil.WriteFile(path, []byte(lines), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "screening")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "denylist")
+
+	writeDenylist(t, path, "# sanctioned\n"+deniedHex+"\n\n"+deniedSS58+"\n")
+	d, err := NewDenylist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, reason, err := d.Screen(msg.NewFungibleTransfer(1, 2, 1, big.NewInt(1), testResourceId, common.FromHex(deniedHex)))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Contains(t, reason, deniedHex)
+
+	ok, _, err = d.Screen(msg.NewFungibleTransfer(2, 1, 1, big.NewInt(1), testResourceId, aliceKey))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, _, err = d.Screen(msg.NewFungibleTransfer(1, 2, 2, big.NewInt(1), testResourceId, []byte{1, 2, 3}))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// the file is picked up again once it changes
+	writeDenylist(t, path, deniedSS58+"\n")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, d.Reload())
+	ok, _, err = d.Screen(msg.NewFungibleTransfer(1, 2, 1, big.NewInt(1), testResourceId, common.FromHex(deniedHex)))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	writeDenylist(t, path, "not-an-address\n")
+	assert.NoError(t, os.Chtimes(path, later.Add(time.Minute), later.Add(time.Minute)))
+	assert.Error(t, d.Reload())
+
+	// a mistyped ss58 address fails its checksum
+	writeDenylist(t, path, "5GrwvaEF5zXb26Fz9rcQpDWS57CtERHpNehXCPcNoHGKutQZ\n")
+	assert.NoError(t, os.Chtimes(path, later.Add(2*time.Minute), later.Add(2*time.Minute)))
+	err = d.Reload()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum")
+}
+
+func TestHTTPScreener(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ScreenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.DepositNonce == 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp := ScreenResponse{Allowed: req.DepositNonce == 1}
+		if !resp.Allowed {
+			resp.Reason = "flagged"
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	s := NewHTTPScreener(server.URL, 0)
+	ok, _, err := s.Screen(msg.NewFungibleTransfer(1, 2, 1, big.NewInt(1), testResourceId, []byte{1}))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, reason, err := s.Screen(msg.NewFungibleTransfer(1, 2, 2, big.NewInt(1), testResourceId, []byte{1}))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "flagged", reason)
+
+	_, _, err = s.Screen(msg.NewFungibleTransfer(1, 2, 3, big.NewInt(1), testResourceId, []byte{1}))
+	assert.Error(t, err)
+}
+
+func TestGuard(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "screening")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stub := &stubScreener{allow: false}
+	g, err := NewGuard(dir, []Screener{stub}, log15.New("test", "screening"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relayed := make([]msg.Message, 0)
+	resume := func(m msg.Message) error {
+		relayed = append(relayed, m)
+		return nil
+	}
+
+	// new transfers are only parked by Admit, the screeners are consulted by Watch
+	denied := msg.NewFungibleTransfer(1, 2, 1, big.NewInt(1), testResourceId, []byte{1})
+	assert.False(t, g.Admit(denied))
+	assert.True(t, g.Deferred(denied))
+	entries, err := List(dir, "")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, StatusUnscreened, entries[0].Status)
+	g.process(resume)
+	assert.False(t, g.Deferred(denied))
+
+	stub.err = errors.New("service down")
+	failed := msg.NewFungibleTransfer(1, 2, 2, big.NewInt(1), testResourceId, []byte{2})
+	assert.False(t, g.Admit(failed))
+	g.process(resume)
+	assert.Empty(t, relayed)
+
+	entries, err = List(dir, "")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, StatusParked, entries[0].Status)
+	assert.Equal(t, StatusUnscreened, entries[1].Status)
+	assert.Contains(t, entries[1].Reason, "service down")
+
+	_, err = Release(dir, "1-2-1", "false positive")
+	assert.NoError(t, err)
+	_, err = Release(dir, "1-2-2", "")
+	assert.Error(t, err)
+
+	// the screener still fails, only the released transfer is relayed
+	g.process(resume)
+	assert.Equal(t, []msg.Message{denied}, relayed)
+
+	stub.err = nil
+	stub.allow = true
+	g.process(resume)
+	assert.Equal(t, []msg.Message{denied, failed}, relayed)
+
+	entries, err = List(dir, StatusRelayed)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.True(t, g.Admit(denied))
+
+	stub.allow = false
+	other := msg.NewFungibleTransfer(1, 2, 3, big.NewInt(1), testResourceId, []byte{3})
+	assert.False(t, g.Admit(other))
+	g.process(resume)
+	_, err = Discard(dir, "1-2-3", "")
+	assert.NoError(t, err)
+	assert.False(t, g.Admit(other))
+}
+
+func TestGuardInline(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "screening")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stub := &stubScreener{allow: true}
+	g, err := NewGuard(dir, []Screener{stub}, log15.New("test", "screening"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetInline(true)
+
+	assert.True(t, g.Admit(msg.NewFungibleTransfer(1, 2, 1, big.NewInt(1), testResourceId, []byte{1})))
+
+	stub.allow = false
+	denied := msg.NewFungibleTransfer(1, 2, 2, big.NewInt(1), testResourceId, []byte{2})
+	assert.False(t, g.Admit(denied))
+	assert.False(t, g.Deferred(denied))
+	entries, err := List(dir, StatusParked)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
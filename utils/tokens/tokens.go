@@ -0,0 +1,307 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package tokens keeps the decimals of every bridged token on every chain.
+
+Listeners route amounts in the units of their own chain. Before a transfer reaches any guard
+or writer the Router converts its amount into the units of the destination chain through the
+Registry. Conversion is exact: scaling up multiplies by a power of ten, scaling down is only
+allowed if the amount is a multiple of the divisor. A transfer that would lose precision or
+that does not fit the amount type of the destination chain is rejected instead of being
+rounded or truncated. So is a transfer from or to a chain whose amounts are scaled when the
+decimals of its token are not known on both chains, instead of being relayed unscaled.
+
+Chains implementing DecimalsSource are asked for the decimals of tokens they hold that are not
+configured for them, and the answers are cached.
+*/
+package tokens
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/stafiprotocol/chainbridge/utils/core"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+)
+
+var (
+	ErrPrecisionLoss   = errors.New("amount would lose precision")
+	ErrOverflow        = errors.New("amount overflows destination")
+	ErrUnknownDecimals = errors.New("token decimals unknown")
+)
+
+var _ core.Converter = &Registry{}
+
+// AmountBits returns the width of the amount type of a chain type, or 0 if it is unknown.
+func AmountBits(chainType string) int {
+	switch chainType {
+	case "ethereum", "stafihub", "neutron":
+		return 256
+	case "substrate":
+		return 128
+	case "solana":
+		return 64
+	}
+	return 0
+}
+
+// Token is a bridged token. Decimals applies to every chain not listed in Chains.
+type Token struct {
+	ResourceId msg.ResourceId
+	Symbol     string
+	Decimals   uint8
+	Chains     map[msg.ChainId]uint8
+}
+
+// ParseToken builds a token from its config representation, chains maps chain ids to the
+// decimals of the token on that chain.
+func ParseToken(resourceId, symbol string, decimals uint8, chains map[string]uint8) (*Token, error) {
+	rId, err := hex.DecodeString(strings.TrimPrefix(resourceId, "0x"))
+	if err != nil || len(rId) != 32 {
+		return nil, fmt.Errorf("token resourceId %s invalid", resourceId)
+	}
+	t := &Token{
+		ResourceId: msg.ResourceIdFromSlice(rId),
+		Symbol:     symbol,
+		Decimals:   decimals,
+		Chains:     make(map[msg.ChainId]uint8),
+	}
+	for id, d := range chains {
+		var chainId uint8
+		if _, err := fmt.Sscanf(id, "%d", &chainId); err != nil {
+			return nil, fmt.Errorf("token %s chain id %s invalid", resourceId, id)
+		}
+		t.Chains[msg.ChainId(chainId)] = d
+	}
+	return t, nil
+}
+
+// DecimalsOn returns the decimals of the token on a chain.
+func (t *Token) DecimalsOn(chain msg.ChainId) uint8 {
+	if d, ok := t.Chains[chain]; ok {
+		return d
+	}
+	return t.Decimals
+}
+
+// DecimalsSource is a chain that reads the decimals of tokens from its own state.
+type DecimalsSource interface {
+	// Decimals returns the decimals of the token with a resourceId on the chain, and false if the
+	// chain does not know the token.
+	Decimals(rId msg.ResourceId) (uint8, bool, error)
+}
+
+// Registry holds the tokens by resourceId and the amount widths by chain. A chain is scaled if
+// decimals are set for it, by a token or a DecimalsSource, so its amounts are never relayed
+// without knowing the decimals of their token.
+type Registry struct {
+	tokens   map[msg.ResourceId]*Token
+	bits     map[msg.ChainId]int
+	sources  map[msg.ChainId]DecimalsSource
+	resolved map[msg.ChainId]map[msg.ResourceId]uint8 // decimals read from the sources
+	scaled   map[msg.ChainId]bool
+	lock     sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		tokens:   make(map[msg.ResourceId]*Token),
+		bits:     make(map[msg.ChainId]int),
+		sources:  make(map[msg.ChainId]DecimalsSource),
+		resolved: make(map[msg.ChainId]map[msg.ResourceId]uint8),
+		scaled:   make(map[msg.ChainId]bool),
+	}
+}
+
+// Register adds a token, every resourceId may only be registered once.
+func (r *Registry) Register(t *Token) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.tokens[t.ResourceId]; ok {
+		return fmt.Errorf("token %s registered twice", t.ResourceId.Hex())
+	}
+	if t.Chains == nil {
+		t.Chains = make(map[msg.ChainId]uint8)
+	}
+	for chain := range t.Chains {
+		r.scaled[chain] = true
+	}
+	r.tokens[t.ResourceId] = t
+	return nil
+}
+
+// SetAmountBits sets the width of amounts on a chain. Amounts to chains without a width are
+// not bounded.
+func (r *Registry) SetAmountBits(chain msg.ChainId, bits int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.bits[chain] = bits
+}
+
+// SetDecimalsSource makes the registry read the decimals of tokens on a chain from the chain,
+// unless they are configured for the chain.
+func (r *Registry) SetDecimalsSource(chain msg.ChainId, s DecimalsSource) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.sources[chain] = s
+	r.scaled[chain] = true
+}
+
+// SetScaled marks the amounts of a chain as scaled, even if no decimals are set for it yet.
+func (r *Registry) SetScaled(chain msg.ChainId) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.scaled[chain] = true
+}
+
+// SetDecimals sets the decimals of a registered token on a chain.
+func (r *Registry) SetDecimals(rId msg.ResourceId, chain msg.ChainId, decimals uint8) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	t, ok := r.tokens[rId]
+	if !ok {
+		return fmt.Errorf("token %s not registered", rId.Hex())
+	}
+	t.Chains[chain] = decimals
+	r.scaled[chain] = true
+	return nil
+}
+
+// Token returns the token registered for a resourceId.
+func (r *Registry) Token(rId msg.ResourceId) (*Token, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	t, ok := r.tokens[rId]
+	return t, ok
+}
+
+// Convert implements core.Converter. The amount of a fungible transfer is converted from the
+// decimals of its source to those of its destination. Transfers of tokens whose decimals are
+// not known on both chains fail with ErrUnknownDecimals if either chain is scaled, and keep
+// their amount otherwise. Either way the amount is bounded by the amount width of the
+// destination.
+func (r *Registry) Convert(m msg.Message) (msg.Message, error) {
+	if m.Type != msg.FungibleTransfer {
+		return m, nil
+	}
+
+	r.lock.RLock()
+	t := r.tokens[m.ResourceId]
+	bits := r.bits[m.Destination]
+	scaled := r.scaled[m.Source] || r.scaled[m.Destination]
+	r.lock.RUnlock()
+
+	amount := new(big.Int).SetBytes(m.Payload[0].([]byte))
+	converted := amount
+	from, okFrom, err := r.decimalsOn(t, m.ResourceId, m.Source)
+	if err != nil {
+		return m, err
+	}
+	to, okTo, err := r.decimalsOn(t, m.ResourceId, m.Destination)
+	if err != nil {
+		return m, err
+	}
+	if okFrom && okTo {
+		converted, err = ConvertAmount(amount, from, to)
+		if err != nil {
+			return m, fmt.Errorf("%s from chain %d to %d: %w", symbol(t, m.ResourceId), m.Source, m.Destination, err)
+		}
+	} else if scaled {
+		return m, fmt.Errorf("%s from chain %d to %d: %w", symbol(t, m.ResourceId), m.Source, m.Destination, ErrUnknownDecimals)
+	}
+	if bits > 0 && converted.BitLen() > bits {
+		return m, fmt.Errorf("amount %s to chain %d: %w (%d bits)", converted, m.Destination, ErrOverflow, bits)
+	}
+
+	payload := make([]interface{}, len(m.Payload))
+	copy(payload, m.Payload)
+	payload[0] = converted.Bytes()
+	m.Payload = payload
+	return m, nil
+}
+
+// decimalsOn returns the decimals of a token on a chain: configured for the chain, read from
+// the chain, or the default decimals of the token, in that order. t is nil for unregistered
+// tokens. It returns false if the decimals are not known.
+func (r *Registry) decimalsOn(t *Token, rId msg.ResourceId, chain msg.ChainId) (uint8, bool, error) {
+	r.lock.RLock()
+	if t != nil {
+		if d, ok := t.Chains[chain]; ok {
+			r.lock.RUnlock()
+			return d, true, nil
+		}
+	}
+	d, cached := r.resolved[chain][rId]
+	source := r.sources[chain]
+	r.lock.RUnlock()
+	if cached {
+		return d, true, nil
+	}
+
+	if source != nil {
+		d, ok, err := source.Decimals(rId)
+		if err != nil {
+			return 0, false, fmt.Errorf("decimals of %s on chain %d: %w", symbol(t, rId), chain, err)
+		}
+		if ok {
+			r.lock.Lock()
+			if r.resolved[chain] == nil {
+				r.resolved[chain] = make(map[msg.ResourceId]uint8)
+			}
+			r.resolved[chain][rId] = d
+			r.lock.Unlock()
+			return d, true, nil
+		}
+	}
+	if t != nil {
+		return t.Decimals, true, nil
+	}
+	return 0, false, nil
+}
+
+// symbol names a token for errors, t is nil for unregistered tokens.
+func symbol(t *Token, rId msg.ResourceId) string {
+	if t != nil && t.Symbol != "" {
+		return t.Symbol
+	}
+	return rId.Hex()
+}
+
+// ConvertAmount scales amount from one number of decimals to another. Scaling down fails with
+// ErrPrecisionLoss unless the amount is an exact multiple of the divisor.
+func ConvertAmount(amount *big.Int, from, to uint8) (*big.Int, error) {
+	switch {
+	case from == to:
+		return new(big.Int).Set(amount), nil
+	case to > from:
+		factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(to-from)), nil)
+		return new(big.Int).Mul(amount, factor), nil
+	default:
+		factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(from-to)), nil)
+		q, rem := new(big.Int).QuoRem(amount, factor, new(big.Int))
+		if rem.Sign() != 0 {
+			return nil, fmt.Errorf("%w: %s has %d decimals, destination has %d", ErrPrecisionLoss, amount, from, to)
+		}
+		return q, nil
+	}
+}
+
+// FactorDecimals returns n for a decimal factor of 10^n, the representation of the substrate
+// symbols config.
+func FactorDecimals(factor string) (uint8, error) {
+	if factor == "" || strings.Trim(factor, "0") != "1" || !strings.HasPrefix(factor, "1") {
+		return 0, fmt.Errorf("decimalFactor %s is not a power of ten", factor)
+	}
+	n := len(factor) - 1
+	if n > 255 {
+		return 0, fmt.Errorf("decimalFactor %s too large", factor)
+	}
+	return uint8(n), nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package tokens
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+const testResourceId = "000000000000000000000000000000a9e0095b8965c01e6a09c97938f3860901"
+
+func TestConvertAmount(t *testing.T) {
+	amount, err := ConvertAmount(big.NewInt(15), 6, 18)
+	assert.NoError(t, err)
+	assert.Equal(t, "15000000000000", amount.String())
+
+	amount, err = ConvertAmount(big.NewInt(15000000000000), 18, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(15), amount.Int64())
+
+	_, err = ConvertAmount(big.NewInt(15000000000001), 18, 6)
+	assert.True(t, errors.Is(err, ErrPrecisionLoss))
+
+	amount, err = ConvertAmount(big.NewInt(7), 9, 9)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), amount.Int64())
+}
+
+func TestFactorDecimals(t *testing.T) {
+	n, err := FactorDecimals("1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0), n)
+	n, err = FactorDecimals("1000000")
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(6), n)
+	for _, bad := range []string{"", "0", "10010", "2000", "0100"} {
+		_, err = FactorDecimals(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRegistryConvert(t *testing.T) {
+	token, err := ParseToken(testResourceId, "RFIS", 18, map[string]uint8{"1": 12, "3": 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	assert.NoError(t, r.Register(token))
+	assert.Error(t, r.Register(token))
+	r.SetAmountBits(1, 128)
+	r.SetAmountBits(3, 64)
+
+	// substrate to ethereum scales up
+	m := msg.NewFungibleTransfer(1, 2, 1, big.NewInt(5), token.ResourceId, []byte{1})
+	converted, err := r.Convert(m)
+	assert.NoError(t, err)
+	assert.Equal(t, "5000000", new(big.Int).SetBytes(converted.Payload[0].([]byte)).String())
+	// the original message is left untouched
+	assert.Equal(t, int64(5), new(big.Int).SetBytes(m.Payload[0].([]byte)).Int64())
+
+	// ethereum to solana scales down exactly or not at all
+	m = msg.NewFungibleTransfer(2, 3, 1, big.NewInt(3000000000), token.ResourceId, []byte{1})
+	converted, err = r.Convert(m)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), new(big.Int).SetBytes(converted.Payload[0].([]byte)).Int64())
+	_, err = r.Convert(msg.NewFungibleTransfer(2, 3, 2, big.NewInt(3000000001), token.ResourceId, []byte{1}))
+	assert.True(t, errors.Is(err, ErrPrecisionLoss))
+
+	// solana amounts are u64
+	tooLarge := new(big.Int).Lsh(big.NewInt(1), 64)
+	tooLarge.Mul(tooLarge, big.NewInt(1000000000))
+	_, err = r.Convert(msg.NewFungibleTransfer(2, 3, 3, tooLarge, token.ResourceId, []byte{1}))
+	assert.True(t, errors.Is(err, ErrOverflow))
+
+	// unregistered tokens are rejected from and to scaled chains instead of relayed unscaled
+	other := msg.ResourceIdFromSlice([]byte{1})
+	_, err = r.Convert(msg.NewFungibleTransfer(2, 1, 4, big.NewInt(42), other, []byte{1}))
+	assert.True(t, errors.Is(err, ErrUnknownDecimals))
+	_, err = r.Convert(msg.NewFungibleTransfer(1, 2, 4, big.NewInt(42), other, []byte{1}))
+	assert.True(t, errors.Is(err, ErrUnknownDecimals))
+
+	// between unscaled chains they pass through but stay bounded
+	r.SetAmountBits(4, 64)
+	converted, err = r.Convert(msg.NewFungibleTransfer(2, 4, 4, big.NewInt(42), other, []byte{1}))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), new(big.Int).SetBytes(converted.Payload[0].([]byte)).Int64())
+	_, err = r.Convert(msg.NewFungibleTransfer(2, 4, 5, new(big.Int).Lsh(big.NewInt(1), 64), other, []byte{1}))
+	assert.True(t, errors.Is(err, ErrOverflow))
+
+	assert.NoError(t, r.SetDecimals(token.ResourceId, 3, 18))
+	converted, err = r.Convert(msg.NewFungibleTransfer(2, 3, 6, big.NewInt(3000000001), token.ResourceId, []byte{1}))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3000000001), new(big.Int).SetBytes(converted.Payload[0].([]byte)).Int64())
+}
+
+// stateDecimals is a chain answering the decimals of the tokens it holds.
+type stateDecimals struct {
+	decimals map[msg.ResourceId]uint8
+	err      error
+	calls    int
+}
+
+func (s *stateDecimals) Decimals(rId msg.ResourceId) (uint8, bool, error) {
+	s.calls++
+	d, ok := s.decimals[rId]
+	return d, ok, s.err
+}
+
+func TestRegistryDecimalsSource(t *testing.T) {
+	token, err := ParseToken(testResourceId, "RFIS", 18, map[string]uint8{"3": 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := msg.ResourceIdFromSlice([]byte{1})
+	r := NewRegistry()
+	assert.NoError(t, r.Register(token))
+	chain := &stateDecimals{decimals: map[msg.ResourceId]uint8{token.ResourceId: 12, other: 6}}
+	r.SetDecimalsSource(1, chain)
+	r.SetDecimalsSource(3, chain)
+
+	// the decimals on chain 1 come from its state, once
+	for nonce := msg.Nonce(1); nonce <= 2; nonce++ {
+		converted, err := r.Convert(msg.NewFungibleTransfer(1, 2, nonce, big.NewInt(5), token.ResourceId, []byte{1}))
+		assert.NoError(t, err)
+		assert.Equal(t, "5000000", new(big.Int).SetBytes(converted.Payload[0].([]byte)).String())
+	}
+	assert.Equal(t, 1, chain.calls)
+
+	// configured decimals override the state
+	converted, err := r.Convert(msg.NewFungibleTransfer(3, 2, 3, big.NewInt(5), token.ResourceId, []byte{1}))
+	assert.NoError(t, err)
+	assert.Equal(t, "5000000000", new(big.Int).SetBytes(converted.Payload[0].([]byte)).String())
+	assert.Equal(t, 1, chain.calls)
+
+	// an unregistered token needs its decimals on both chains
+	converted, err = r.Convert(msg.NewFungibleTransfer(1, 3, 4, big.NewInt(7000000), other, []byte{1}))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7000000), new(big.Int).SetBytes(converted.Payload[0].([]byte)).Int64())
+	r.SetDecimalsSource(2, &stateDecimals{decimals: map[msg.ResourceId]uint8{other: 0}})
+	converted, err = r.Convert(msg.NewFungibleTransfer(1, 2, 5, big.NewInt(7000000), other, []byte{1}))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), new(big.Int).SetBytes(converted.Payload[0].([]byte)).Int64())
+
+	// a failing chain rejects the transfer without caching
+	failing := &stateDecimals{err: errors.New("connection refused")}
+	r.SetDecimalsSource(4, failing)
+	_, err = r.Convert(msg.NewFungibleTransfer(4, 2, 6, big.NewInt(5), token.ResourceId, []byte{1}))
+	assert.Error(t, err)
+	_, err = r.Convert(msg.NewFungibleTransfer(4, 2, 7, big.NewInt(5), token.ResourceId, []byte{1}))
+	assert.Error(t, err)
+	assert.Equal(t, 2, failing.calls)
+}
@@ -0,0 +1,283 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package tracing follows transfers across the relay with OpenTelemetry.
+
+A listener starts a trace for every deposit it observes. The trace is kept out of the message, in
+a table keyed by the source, destination and nonce of the transfer, where the router and the
+destination writer look it up. The table holds the traces of the last MaxTransfers transfers. Handler lookups, the time a message
+waits in the writer queue, proposal checks, transaction submission and confirmation are recorded
+as spans of that trace. Spans are exported over OTLP/HTTP, to a local file as JSON, or both.
+Until Setup is called spans are dropped, so the relay is unaffected when tracing is not configured.
+*/
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ServiceName        = "chainbridge"
+	DefaultSampleRatio = 1.0
+
+	instrumentation = "github.com/stafiprotocol/chainbridge"
+)
+
+// Time given to pending spans when the relayer shuts down
+var ShutdownTimeout = 10 * time.Second
+
+// Transfers whose traces are kept, the oldest are dropped first
+var MaxTransfers = 10000
+
+// Span names shared by the chains
+const (
+	SpanDeposit       = "deposit"        // a deposit observed by a listener, the root of a trace
+	SpanHandlerLookup = "handler.lookup" // resolving the handler of a resource
+	SpanDepositRecord = "deposit.record" // reading the deposit record from the handler
+	SpanRoute         = "router.route"   // conversion and guards in the router
+	SpanQueue         = "writer.queue"   // time spent in the writer queue
+	SpanProcess       = "writer.process" // handling of the message by the writer
+	SpanProposalCheck = "proposal.check" // querying the state of the proposal
+	SpanTxSubmit      = "tx.submit"      // submitting a transaction
+	SpanTxConfirm     = "tx.confirm"     // waiting for a transaction or proposal to be final
+)
+
+// OTLP configures the export of spans to an OTLP/HTTP collector.
+type OTLP struct {
+	Endpoint string // host:port of the collector
+	URLPath  string // defaults to /v1/traces
+	Insecure bool   // use http instead of https
+	Headers  map[string]string
+}
+
+// Config selects the exporters. Spans are only exported if at least one is set.
+type Config struct {
+	OTLP        *OTLP
+	File        string  // path of a file spans are appended to as JSON
+	SampleRatio float64 // fraction of deposits traced
+}
+
+// transfer identifies a transfer across the relay.
+type transfer struct {
+	source      msg.ChainId
+	destination msg.ChainId
+	nonce       msg.Nonce
+}
+
+func transferOf(m msg.Message) transfer {
+	return transfer{source: m.Source, destination: m.Destination, nonce: m.DepositNonce}
+}
+
+// state is the trace of a transfer and the time it was last put in a writer queue.
+type state struct {
+	ctx    context.Context
+	queued time.Time
+}
+
+var (
+	lock   sync.Mutex
+	traces = make(map[transfer]*state)
+	order  []transfer // keys of traces, oldest first
+)
+
+// lookup returns the state of t, adding it if create is set. The caller must hold lock.
+func lookup(t transfer, create bool) *state {
+	s, ok := traces[t]
+	if ok || !create {
+		return s
+	}
+	for len(order) >= MaxTransfers && len(order) > 0 {
+		delete(traces, order[0])
+		order = order[1:]
+	}
+	s = &state{ctx: context.Background()}
+	traces[t] = s
+	order = append(order, t)
+	return s
+}
+
+// Setup installs the global tracer provider and returns a function flushing pending spans and
+// closing the exporters.
+func Setup(c Config) (func(context.Context) error, error) {
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return nil, errors.New("tracing sample ratio must be between 0 and 1")
+	}
+
+	var opts []sdktrace.TracerProviderOption
+	var file *os.File
+	if c.OTLP != nil {
+		exp, err := otlptracehttp.New(context.Background(), otlpOptions(c.OTLP)...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+	if c.File != "" {
+		err := os.MkdirAll(filepath.Dir(c.File), os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+		file, err = os.OpenFile(c.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(ServiceName))
+	opts = append(opts,
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+	)
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if file != nil {
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+func otlpOptions(c *OTLP) []otlptracehttp.Option {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(c.Endpoint)}
+	if c.URLPath != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(c.URLPath))
+	}
+	if c.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(c.Headers) != 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(c.Headers))
+	}
+	return opts
+}
+
+// Tracer returns the tracer of the relayer.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Start starts a span as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartTransfer starts a new trace for the transfer of m with a root span named name, and keeps
+// it as the trace of the transfer.
+func StartTransfer(m msg.Message, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := StartMessage(context.Background(), m, name, attrs...)
+	lock.Lock()
+	defer lock.Unlock()
+	lookup(transferOf(m), true).ctx = ctx
+	return ctx, span
+}
+
+// Context returns the context carrying the trace of the transfer of m, the background context
+// if there is none.
+func Context(m msg.Message) context.Context {
+	lock.Lock()
+	defer lock.Unlock()
+	if s := lookup(transferOf(m), false); s != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+// StartMessage starts a span describing m as a child of the span in ctx.
+func StartMessage(ctx context.Context, m msg.Message, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Start(ctx, name, append(MessageAttributes(m), attrs...)...)
+}
+
+// MessageAttributes returns the attributes identifying the transfer of m.
+func MessageAttributes(m msg.Message) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.Int("transfer.source", int(m.Source)),
+		attribute.Int("transfer.destination", int(m.Destination)),
+		attribute.Int64("transfer.nonce", int64(m.DepositNonce)),
+		attribute.String("transfer.resource_id", m.ResourceId.Hex()),
+	}
+	if m.Block != 0 {
+		attrs = append(attrs, attribute.Int64("transfer.block", int64(m.Block)))
+	}
+	if m.TxHash != "" {
+		attrs = append(attrs, attribute.String("transfer.tx", m.TxHash))
+	}
+	return attrs
+}
+
+// Endpoint returns the attribute naming the RPC endpoint a span talks to.
+func Endpoint(url string) attribute.KeyValue {
+	return attribute.String("rpc.endpoint", url)
+}
+
+// Tx returns the attribute naming the transaction a span submitted or waited for.
+func Tx(hash string) attribute.KeyValue {
+	return attribute.String("tx.hash", hash)
+}
+
+// Fail records err on span and marks the span as failed.
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// End records err on span if it is not nil and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		Fail(span, err)
+	}
+	span.End()
+}
+
+// Queued marks m as put in a writer queue now.
+func Queued(m msg.Message) {
+	lock.Lock()
+	defer lock.Unlock()
+	lookup(transferOf(m), true).queued = time.Now()
+}
+
+// QueueWait records the time m waited since it was queued. Writers call it when they take m off
+// their queue.
+func QueueWait(m msg.Message) {
+	lock.Lock()
+	s := lookup(transferOf(m), false)
+	var ctx context.Context
+	var queued time.Time
+	if s != nil {
+		ctx, queued = s.ctx, s.queued
+		s.queued = time.Time{}
+	}
+	lock.Unlock()
+	if queued.IsZero() {
+		return
+	}
+	_, span := Tracer().Start(ctx, SpanQueue, trace.WithTimestamp(queued), trace.WithAttributes(MessageAttributes(m)...))
+	span.End()
+}
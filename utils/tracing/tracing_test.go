@@ -0,0 +1,125 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func record(t *testing.T) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return sr
+}
+
+func testMessage() msg.Message {
+	m := msg.NewFungibleTransfer(1, 2, 7, big.NewInt(100), msg.ResourceIdFromSlice([]byte{1}), []byte{2})
+	m.Block = 10
+	m.TxHash = "0xabc"
+	return m
+}
+
+func TestMessageTrace(t *testing.T) {
+	sr := record(t)
+
+	m := testMessage()
+	_, deposit := StartTransfer(m, SpanDeposit)
+	Queued(m)
+	time.Sleep(10 * time.Millisecond)
+	QueueWait(m)
+	ctx, process := StartMessage(Context(m), m, SpanProcess)
+	_, submit := StartMessage(ctx, m, SpanTxSubmit, Tx("0xdef"))
+	End(submit, errors.New("nonce too low"))
+	process.End()
+	deposit.End()
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 4)
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+
+	root := byName[SpanDeposit]
+	assert.False(t, root.Parent().IsValid())
+	assert.Contains(t, root.Attributes(), MessageAttributes(testMessage())[2])
+	for _, name := range []string{SpanQueue, SpanProcess} {
+		assert.Equal(t, root.SpanContext().SpanID(), byName[name].Parent().SpanID(), name)
+		assert.Equal(t, root.SpanContext().TraceID(), byName[name].SpanContext().TraceID(), name)
+	}
+	assert.Equal(t, byName[SpanProcess].SpanContext().SpanID(), byName[SpanTxSubmit].Parent().SpanID())
+
+	queue := byName[SpanQueue]
+	assert.GreaterOrEqual(t, queue.EndTime().Sub(queue.StartTime()), 10*time.Millisecond)
+
+	assert.Equal(t, codes.Error, byName[SpanTxSubmit].Status().Code)
+	assert.Equal(t, "nonce too low", byName[SpanTxSubmit].Status().Description)
+	assert.Equal(t, codes.Unset, byName[SpanProcess].Status().Code)
+}
+
+func TestQueueWaitWithoutQueued(t *testing.T) {
+	sr := record(t)
+	QueueWait(testMessage())
+	assert.Empty(t, sr.Ended())
+}
+
+func TestTransferEviction(t *testing.T) {
+	record(t)
+	prev := MaxTransfers
+	MaxTransfers = 2
+	defer func() { MaxTransfers = prev }()
+
+	var msgs []msg.Message
+	for nonce := msg.Nonce(100); nonce < 103; nonce++ {
+		m := testMessage()
+		m.DepositNonce = nonce
+		_, span := StartTransfer(m, SpanDeposit)
+		span.End()
+		msgs = append(msgs, m)
+	}
+	assert.False(t, trace.SpanContextFromContext(Context(msgs[0])).IsValid())
+	for _, m := range msgs[1:] {
+		assert.True(t, trace.SpanContextFromContext(Context(m)).IsValid(), m.DepositNonce)
+	}
+}
+
+func TestSetupFile(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(prev)
+
+	path := filepath.Join(t.TempDir(), "traces", "spans.json")
+	shutdown, err := Setup(Config{File: path, SampleRatio: 1})
+	assert.NoError(t, err)
+
+	_, span := StartTransfer(testMessage(), SpanDeposit)
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	out, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(out), `"Name":"deposit"`), string(out))
+	assert.True(t, strings.Contains(string(out), ServiceName))
+}
+
+func TestSetupSampleRatio(t *testing.T) {
+	_, err := Setup(Config{SampleRatio: 1.5})
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package tracking
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type handler struct {
+	tracker *Tracker
+	log     log15.Logger
+}
+
+// NewHandler serves the tracker as JSON:
+//
+//	GET /transfers/{source}/{destination}/{nonce}  a single transfer
+//	GET /transfers?source={source}&tx={hash}       the transfers deposited by a transaction
+//	GET /routes/{source}/{destination}/pending     the pending transfers of a route
+func NewHandler(t *Tracker, log log15.Logger) http.Handler {
+	h := &handler{tracker: t, log: log}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /transfers/{source}/{destination}/{nonce}", h.transfer)
+	mux.HandleFunc("GET /transfers", h.transfersByTx)
+	mux.HandleFunc("GET /routes/{source}/{destination}/pending", h.pending)
+	return mux
+}
+
+func (h *handler) transfer(w http.ResponseWriter, r *http.Request) {
+	source, destination, err := parseRoute(r.PathValue("source"), r.PathValue("destination"))
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	nonce, err := strconv.ParseUint(r.PathValue("nonce"), 10, 64)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, fmt.Errorf("nonce %s invalid", r.PathValue("nonce")))
+		return
+	}
+
+	tr, err := h.tracker.ByNonce(source, destination, msg.Nonce(nonce))
+	if errors.Is(err, ErrNotFound) {
+		h.error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.write(w, tr)
+}
+
+func (h *handler) transfersByTx(w http.ResponseWriter, r *http.Request) {
+	source, err := parseChainId(r.URL.Query().Get("source"))
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	tx := r.URL.Query().Get("tx")
+	if tx == "" {
+		h.error(w, http.StatusBadRequest, errors.New("tx required"))
+		return
+	}
+
+	transfers, err := h.tracker.ByTx(source, tx)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(transfers) == 0 {
+		h.error(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+	h.write(w, transfers)
+}
+
+func (h *handler) pending(w http.ResponseWriter, r *http.Request) {
+	source, destination, err := parseRoute(r.PathValue("source"), r.PathValue("destination"))
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	transfers, err := h.tracker.Pending(source, destination)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.write(w, transfers)
+}
+
+func (h *handler) write(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Error("Failed to write response", "err", err)
+	}
+}
+
+func (h *handler) error(w http.ResponseWriter, status int, err error) {
+	if status == http.StatusInternalServerError {
+		h.log.Error("Failed to serve request", "err", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+}
+
+func parseRoute(source, destination string) (msg.ChainId, msg.ChainId, error) {
+	src, err := parseChainId(source)
+	if err != nil {
+		return 0, 0, err
+	}
+	dst, err := parseChainId(destination)
+	if err != nil {
+		return 0, 0, err
+	}
+	return src, dst, nil
+}
+
+func parseChainId(id string) (msg.ChainId, error) {
+	v, err := strconv.ParseUint(id, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("chain id %q invalid", id)
+	}
+	return msg.ChainId(v), nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+/*
+Package tracking reports where a transfer is in its relay.
+
+The Tracker folds the journal records of a transfer into its lifecycle: observed on the source
+chain, queued for the destination writer, voted on, executed on the destination chain, or
+parked by a guard or writer. A parked transfer is completed with the entry of the store that
+holds it, such as the screening guard or the dead letters, so the reason and the operator
+notes are reported together. The HTTP handler serves the Tracker as JSON.
+*/
+package tracking
+
+import (
+	"errors"
+	"time"
+
+	"github.com/stafiprotocol/chainbridge/utils/journal"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/msgstore"
+)
+
+const (
+	StateObserved = "observed" // deposit seen on the source chain
+	StateQueued   = "queued"   // handed to the destination writer
+	StateVoted    = "voted"    // voted on, or no vote was needed
+	StateExecuted = "executed" // proposal executed on the destination chain
+	StateParked   = "parked"   // put aside by a guard or writer
+	StateFailed   = "failed"   // the last transaction failed, the writer may try again
+)
+
+var ErrNotFound = errors.New("transfer not found")
+
+// Event is a single journal record of a transfer.
+type Event struct {
+	Time   time.Time   `json:"time"`
+	Kind   string      `json:"kind"`
+	Status string      `json:"status"`
+	Chain  msg.ChainId `json:"chain"`
+	Block  uint64      `json:"block,omitempty"`
+	TxHash string      `json:"txHash,omitempty"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+// Parked is the entry of the store holding a parked transfer.
+type Parked struct {
+	By        string    `json:"by"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason"`
+	Note      string    `json:"note,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Transfer is the lifecycle of a transfer. Amount is in the units of the source chain.
+type Transfer struct {
+	Source       msg.ChainId `json:"source"`
+	Destination  msg.ChainId `json:"destination"`
+	DepositNonce msg.Nonce   `json:"depositNonce"`
+	ResourceId   string      `json:"resourceId"`
+	Amount       string      `json:"amount"`
+	Recipient    string      `json:"recipient"`
+	Block        uint64      `json:"block,omitempty"`
+	TxHash       string      `json:"txHash,omitempty"`
+	State        string      `json:"state"`
+	Reason       string      `json:"reason,omitempty"`
+	Parked       *Parked     `json:"parked,omitempty"`
+	UpdatedAt    time.Time   `json:"updatedAt"`
+	History      []Event     `json:"history"`
+}
+
+type store struct {
+	name  string
+	store *msgstore.Store
+}
+
+// Tracker reads transfers from the journal and the stores of parked transfers.
+type Tracker struct {
+	journal *journal.Journal
+	stores  []store
+}
+
+func NewTracker(j *journal.Journal) *Tracker {
+	return &Tracker{journal: j}
+}
+
+// AddStore adds a store of parked transfers kept in dir under name.
+func (t *Tracker) AddStore(name, dir string) error {
+	s, err := msgstore.NewStore(dir)
+	if err != nil {
+		return err
+	}
+	t.stores = append(t.stores, store{name: name, store: s})
+	return nil
+}
+
+// ByNonce returns the transfer identified by its route and deposit nonce.
+func (t *Tracker) ByNonce(source, destination msg.ChainId, nonce msg.Nonce) (*Transfer, error) {
+	records, err := t.journal.Query(journal.Query{Source: &source, Destination: &destination, DepositNonce: &nonce})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	return t.transfer(records), nil
+}
+
+// ByTx returns the transfers deposited by a transaction on the source chain, identified by its
+// hash or signature.
+func (t *Tracker) ByTx(source msg.ChainId, txHash string) ([]*Transfer, error) {
+	deposits, err := t.journal.Query(journal.Query{Source: &source, TxHash: txHash, Kind: journal.KindDeposit})
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make([]*Transfer, 0, len(deposits))
+	seen := make(map[string]bool)
+	for _, d := range deposits {
+		if seen[d.Key()] {
+			continue
+		}
+		seen[d.Key()] = true
+		tr, err := t.ByNonce(d.Source, d.Destination, d.DepositNonce)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, tr)
+	}
+	return transfers, nil
+}
+
+// Pending returns the transfers on a route that were neither voted on nor executed.
+func (t *Tracker) Pending(source, destination msg.ChainId) ([]*Transfer, error) {
+	nonces, err := t.journal.Pending(source, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make([]*Transfer, 0, len(nonces))
+	for _, nonce := range nonces {
+		tr, err := t.ByNonce(source, destination, nonce)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, tr)
+	}
+	return transfers, nil
+}
+
+// transfer folds the records of a transfer, ordered by time, into its lifecycle. The latest
+// record decides the state, except that an executed transfer stays executed.
+func (t *Tracker) transfer(records []*journal.Record) *Transfer {
+	first := records[0]
+	tr := &Transfer{
+		Source:       first.Source,
+		Destination:  first.Destination,
+		DepositNonce: first.DepositNonce,
+		ResourceId:   first.ResourceId,
+		Amount:       first.Amount,
+		Recipient:    first.Recipient,
+		History:      make([]Event, 0, len(records)),
+	}
+
+	for _, r := range records {
+		tr.History = append(tr.History, Event{
+			Time:   r.Time,
+			Kind:   r.Kind,
+			Status: r.Status,
+			Chain:  r.Chain,
+			Block:  r.Block,
+			TxHash: r.TxHash,
+			Detail: r.Detail,
+		})
+		tr.UpdatedAt = r.Time
+
+		if r.Kind == journal.KindDeposit {
+			// the deposit carries the amount in source units
+			tr.ResourceId, tr.Amount, tr.Recipient = r.ResourceId, r.Amount, r.Recipient
+			tr.Block, tr.TxHash = r.Block, r.TxHash
+		}
+		if tr.State == StateExecuted {
+			continue
+		}
+		if state := recordState(r); state != "" {
+			tr.State, tr.Reason = state, ""
+			if state == StateParked || state == StateFailed {
+				tr.Reason = r.Detail
+			}
+		}
+	}
+
+	if tr.State == StateParked {
+		tr.Parked = t.parked(msgstore.Key(tr.Source, tr.Destination, tr.DepositNonce))
+	}
+	return tr
+}
+
+func recordState(r *journal.Record) string {
+	switch r.Status {
+	case journal.StatusObserved:
+		return StateObserved
+	case journal.StatusQueued:
+		return StateQueued
+	case journal.StatusHeld, journal.StatusRejected, journal.StatusSkipped:
+		return StateParked
+	case journal.StatusNotVoted, journal.StatusSubmitted, journal.StatusSucceeded:
+		return StateVoted
+	case journal.StatusExecuted:
+		return StateExecuted
+	case journal.StatusFailed:
+		return StateFailed
+	}
+	return ""
+}
+
+// parked returns the most recently updated entry of the stores holding the transfer, or nil.
+// A transfer may have passed one guard before being held by the next.
+func (t *Tracker) parked(key string) *Parked {
+	var parked *Parked
+	for _, s := range t.stores {
+		e, err := s.store.Get(key)
+		if err != nil {
+			continue
+		}
+		if parked != nil && !e.UpdatedAt.After(parked.UpdatedAt) {
+			continue
+		}
+		parked = &Parked{
+			By:        s.name,
+			Status:    e.Status,
+			Reason:    e.Reason,
+			Note:      e.Note,
+			UpdatedAt: e.UpdatedAt,
+		}
+	}
+	return parked
+}
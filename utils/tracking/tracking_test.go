@@ -0,0 +1,126 @@
+// Copyright 2020 Stafi Protocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package tracking
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChainSafe/log15"
+	"github.com/stafiprotocol/chainbridge/utils/journal"
+	"github.com/stafiprotocol/chainbridge/utils/msg"
+	"github.com/stafiprotocol/chainbridge/utils/msgstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "tracking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := journal.Open(filepath.Join(dir, journal.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	rId := msg.ResourceIdFromSlice([]byte{1})
+	executed := msg.NewFungibleTransfer(1, 2, 1, big.NewInt(100), rId, []byte{0xab})
+	executed.TxHash = "0xdeposit"
+	parked := msg.NewFungibleTransfer(1, 2, 2, big.NewInt(200), rId, []byte{0xcd})
+	parked.TxHash = "0xdeposit"
+	queued := msg.NewFungibleTransfer(1, 2, 3, big.NewInt(300), rId, []byte{0xef})
+
+	records := []*journal.Record{
+		journal.NewDeposit(executed),
+		journal.NewDecision(executed, journal.StatusQueued, ""),
+		journal.NewTx(executed, "0xvote", journal.StatusSubmitted, "voteProposal"),
+		journal.NewDecision(executed, journal.StatusExecuted, "proposal complete"),
+		// a late vote does not undo the execution
+		journal.NewDecision(executed, journal.StatusNotVoted, "already voted"),
+		journal.NewDeposit(parked),
+		journal.NewDecision(parked, journal.StatusSkipped, "recipient invalid"),
+		journal.NewDeposit(queued),
+		journal.NewDecision(queued, journal.StatusQueued, ""),
+	}
+	for _, r := range records {
+		assert.NoError(t, j.Add(r))
+	}
+
+	deadDir := filepath.Join(dir, "deadletter")
+	store, err := msgstore.NewStore(deadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, store.Put(msgstore.NewEntry(parked, "dead", "recipient invalid")))
+
+	tracker := NewTracker(j)
+	assert.NoError(t, tracker.AddStore("deadletter", deadDir))
+
+	tr, err := tracker.ByNonce(1, 2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, StateExecuted, tr.State)
+	assert.Equal(t, "100", tr.Amount)
+	assert.Equal(t, "0xdeposit", tr.TxHash)
+	assert.Len(t, tr.History, 5)
+
+	_, err = tracker.ByNonce(1, 2, 9)
+	assert.Equal(t, ErrNotFound, err)
+
+	transfers, err := tracker.ByTx(1, "0xdeposit")
+	assert.NoError(t, err)
+	assert.Len(t, transfers, 2)
+	assert.Equal(t, StateParked, transfers[1].State)
+	assert.Equal(t, "recipient invalid", transfers[1].Reason)
+	if assert.NotNil(t, transfers[1].Parked) {
+		assert.Equal(t, "deadletter", transfers[1].Parked.By)
+		assert.Equal(t, "dead", transfers[1].Parked.Status)
+	}
+
+	pending, err := tracker.Pending(1, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 2) {
+		assert.Equal(t, msg.Nonce(2), pending[0].DepositNonce)
+		assert.Equal(t, StateQueued, pending[1].State)
+	}
+
+	server := httptest.NewServer(NewHandler(tracker, log15.Root()))
+	defer server.Close()
+
+	var got Transfer
+	assert.Equal(t, http.StatusOK, getJSON(t, server.URL+"/transfers/1/2/3", &got))
+	assert.Equal(t, StateQueued, got.State)
+
+	var list []*Transfer
+	assert.Equal(t, http.StatusOK, getJSON(t, server.URL+"/transfers?source=1&tx=0xdeposit", &list))
+	assert.Len(t, list, 2)
+	assert.Equal(t, http.StatusOK, getJSON(t, server.URL+"/routes/1/2/pending", &list))
+	assert.Len(t, list, 2)
+
+	var e errorResponse
+	assert.Equal(t, http.StatusNotFound, getJSON(t, server.URL+"/transfers/1/2/9", &e))
+	assert.Equal(t, ErrNotFound.Error(), e.Error)
+	assert.Equal(t, http.StatusBadRequest, getJSON(t, server.URL+"/transfers/1/300/1", &e))
+	assert.Equal(t, http.StatusBadRequest, getJSON(t, server.URL+"/transfers?source=1", &e))
+}
+
+func getJSON(t *testing.T, url string, v interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}